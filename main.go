@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"discard/message-service/pkg/api"
+	"discard/message-service/pkg/auth"
 	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/messaging"
 	logger "discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/system"
+	"encoding/hex"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -19,6 +26,7 @@ func main() {
 	var (
 		ADDRESS                 string = "0.0.0.0"
 		PORT                    string = "8080"
+		GRPC_PORT               string = "9090"
 		RABBITMQ_SERVER_ADDRESS string = os.Getenv("RABBITMQ_SERVER_ADDRESS")
 		DATABASE_URL            string = os.Getenv("DATABASE_URL")
 		DATABASE_PROVIDER       string = os.Getenv("DATABASE_PROVIDER")
@@ -26,13 +34,54 @@ func main() {
 		ASTRA_TOKEN             string = os.Getenv("ASTRA_TOKEN")
 		DATABASE_KEYSPACE       string = "messages"
 		DELETION_REQUEST_STRING string = "Deletion request gotten for user: "
+		EXPORT_REQUEST_STRING   string = "Export request gotten for user: "
+		EXPORT_DIRECTORY        string = os.Getenv("EXPORT_DIRECTORY")
+		EXPORT_SIGNING_KEY      string = os.Getenv("EXPORT_SIGNING_KEY")
+		MASTER_KEY_FILE         string = os.Getenv("MASTER_KEY_FILE")
+		MASTER_KEY_CREATE       bool   = os.Getenv("MASTER_KEY_CREATE") == "true"
 	)
+	var (
+		USER_RATE_LIMIT    float64       = 1 // messages per second
+		USER_RATE_BURST    int           = 5
+		CHANNEL_RATE_LIMIT float64       = 10
+		CHANNEL_RATE_BURST int           = 20
+		IDEMPOTENCY_TTL    time.Duration = 24 * time.Hour
+		API_DOCS_ENABLED   bool          = os.Getenv("API_DOCS_ENABLED") == "true"
+		REALTIME_HISTORY   int           = 1024
+		EXPORT_LINK_TTL    time.Duration = 7 * 24 * time.Hour
+		RETENTION_INTERVAL time.Duration = time.Hour
+		RETENTION_BATCH    int           = 100
+		RETENTION_DRY_RUN  bool          = os.Getenv("RETENTION_DRY_RUN") == "true"
+		PINS_PER_CHANNEL   int           = 50
+		SCHEDULER_INTERVAL time.Duration = 10 * time.Second
+		SCHEDULER_LEASE    time.Duration = time.Minute
+		DRAFT_TTL          time.Duration = 30 * 24 * time.Hour
+	)
+
+	if EXPORT_DIRECTORY == "" {
+		EXPORT_DIRECTORY = filepath.Join(os.TempDir(), "message-service-exports")
+	}
+	if EXPORT_SIGNING_KEY == "" {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		logger.FailOnError(err, "Failed to generate an export signing key")
+		EXPORT_SIGNING_KEY = hex.EncodeToString(key)
+		logger.WARN.Println("EXPORT_SIGNING_KEY is not set, export download links will not survive a restart")
+	}
+
+	if MASTER_KEY_CREATE {
+		logger.WARN.Println("MASTER_KEY_CREATE is set, a missing master key is created, only use this for development")
+	}
 
 	// Start GIN API server + DB connection
 	configuration := configuration.Configuration{
 		APISettings: configuration.APISettings{
-			Address: ADDRESS,
-			Port:    PORT,
+			Address:         ADDRESS,
+			Port:            PORT,
+			GRPCPort:        GRPC_PORT,
+			IdempotencyTTL:  IDEMPOTENCY_TTL,
+			DocsEnabled:     API_DOCS_ENABLED,
+			RealtimeHistory: REALTIME_HISTORY,
 		},
 		DatabaseSettings: configuration.DatabaseSettings{
 			Url:        DATABASE_URL,
@@ -41,9 +90,41 @@ func main() {
 			AstraId:    ASTRA_DATABASE_ID,
 			AstraToken: ASTRA_TOKEN,
 		},
+		RateLimitSettings: configuration.RateLimitSettings{
+			UserRate:     USER_RATE_LIMIT,
+			UserBurst:    USER_RATE_BURST,
+			ChannelRate:  CHANNEL_RATE_LIMIT,
+			ChannelBurst: CHANNEL_RATE_BURST,
+		},
+		ExportSettings: configuration.ExportSettings{
+			Directory:  EXPORT_DIRECTORY,
+			SigningKey: EXPORT_SIGNING_KEY,
+			LinkTTL:    EXPORT_LINK_TTL,
+		},
+		RetentionSettings: configuration.RetentionSettings{
+			Interval:  RETENTION_INTERVAL,
+			BatchSize: RETENTION_BATCH,
+			DryRun:    RETENTION_DRY_RUN,
+		},
+		EncryptionSettings: configuration.EncryptionSettings{
+			MasterKeyFile:   MASTER_KEY_FILE,
+			CreateMasterKey: MASTER_KEY_CREATE,
+		},
+		PinSettings: configuration.PinSettings{
+			DefaultLimit: PINS_PER_CHANNEL,
+		},
+		SchedulerSettings: configuration.SchedulerSettings{
+			Interval: SCHEDULER_INTERVAL,
+			Lease:    SCHEDULER_LEASE,
+		},
+		DraftSettings: configuration.DraftSettings{
+			TTL: DRAFT_TTL,
+		},
 	}
 
-	go api.InitializeAPI(configuration)
+	// events published before RabbitMQ is reachable are sent once it is
+	publisher := messaging.NewAMQPPublisher()
+	go api.InitializeAPI(configuration, publisher)
 
 	apiReady := false
 	for !apiReady {
@@ -108,6 +189,58 @@ func main() {
 	)
 	logger.FailOnError(err, "Failed to start consuming messages")
 
+	publishChannel, err := activeConnection.Channel()
+	logger.FailOnError(err, "Failed to create a publishing channel")
+	defer publishChannel.Close()
+	publisher.Attach(publishChannel)
+
+	exportQueue, err := ch.QueueDeclare(
+		"export-user", // name
+		false,         // durable
+		false,         // delete when unused
+		false,         // exclusive
+		false,         // no-wait
+		nil,           // arguments
+	)
+	logger.FailOnError(err, "Failed to declare a queue")
+
+	exportRequests, err := ch.Consume(
+		exportQueue.Name, // queue
+		"",               // consumer
+		true,             // auto-ack
+		false,            // exclusive
+		false,            // no-local
+		false,            // no-wait
+		nil,              // args
+	)
+	logger.FailOnError(err, "Failed to start consuming export requests")
+
+	// Membership and channel events are written as system messages into their channel
+	var systemEvents []<-chan amqp.Delivery
+	for _, name := range []string{system.MembershipQueue, system.ChannelQueue} {
+		systemQueue, err := ch.QueueDeclare(
+			name,  // name
+			false, // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		logger.FailOnError(err, "Failed to declare a queue")
+
+		events, err := ch.Consume(
+			systemQueue.Name, // queue
+			"",               // consumer
+			true,             // auto-ack
+			false,            // exclusive
+			false,            // no-local
+			false,            // no-wait
+			nil,              // args
+		)
+		logger.FailOnError(err, "Failed to start consuming "+name)
+		systemEvents = append(systemEvents, events)
+	}
+
 	forever := make(chan bool)
 
 	// Keep consuming messages
@@ -134,6 +267,57 @@ func main() {
 			}
 		}
 	}()
+	// Exports are started through the admin endpoint, acting as an admin of the gateway
+	go func() {
+		for d := range exportRequests {
+			logger.LOG.Printf("Received an export request: %s\n", d.Body)
+			userID, found := strings.CutPrefix(string(d.Body), EXPORT_REQUEST_STRING)
+			if !found {
+				logger.WARN.Println("Ignoring malformed export request")
+				continue
+			}
+
+			request, err := http.NewRequest("POST", "http://"+ADDRESS+":"+PORT+"/api/v1/message/user/"+strings.TrimSpace(userID)+"/export", nil)
+			if err != nil {
+				logger.WARN.Println("Failed to create export request")
+				continue
+			}
+			request.Header.Set(auth.UserIDHeader, "message-service")
+			request.Header.Set(auth.RolesHeader, auth.RoleAdmin)
+			if _, err = http.DefaultClient.Do(request); err != nil {
+				logger.WARN.Println("Failed to send export request to API")
+			} else {
+				logger.LOG.Println("Successfully sent export request to API")
+			}
+		}
+	}()
+	// System messages are written through the admin endpoint, which drops repeated events
+	for _, events := range systemEvents {
+		go func(events <-chan amqp.Delivery) {
+			for d := range events {
+				logger.LOG.Printf("Received a system event: %s\n", d.Body)
+				request, err := http.NewRequest("POST", "http://"+ADDRESS+":"+PORT+"/api/v1/message/system", bytes.NewReader(d.Body))
+				if err != nil {
+					logger.WARN.Println("Failed to create system message request")
+					continue
+				}
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set(auth.UserIDHeader, "message-service")
+				request.Header.Set(auth.RolesHeader, auth.RoleAdmin)
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					logger.WARN.Println("Failed to send system message request to API")
+					continue
+				}
+				response.Body.Close()
+				if response.StatusCode >= http.StatusBadRequest {
+					logger.WARN.Println("API refused system event: ", response.Status)
+				} else {
+					logger.LOG.Println("Successfully wrote system message")
+				}
+			}
+		}(events)
+	}
 	logger.LOG.Printf("Waiting for messages... To exit press CTRL+C")
 
 	<-forever
@@ -4,44 +4,279 @@ import (
 	"discard/message-service/pkg/configuration"
 	"discard/message-service/pkg/controllers"
 	"discard/message-service/pkg/database"
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/drafts"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/export"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/mentions"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/metrics"
 	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/openapi"
+	"discard/message-service/pkg/pins"
+	"discard/message-service/pkg/polls"
+	"discard/message-service/pkg/ratelimit"
+	"discard/message-service/pkg/realtime"
 	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/retention"
+	"discard/message-service/pkg/scheduler"
+	"discard/message-service/pkg/search"
+	"discard/message-service/pkg/unread"
 	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitializeAPI(configuration configuration.Configuration) {
-	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
-	var messageRepository repository.MessageRepository
-	var messageHandler controllers.MessageHandler
+type handlers struct {
+	message    controllers.MessageHandler
+	messageV2  controllers.MessageHandlerV2
+	rateLimit  controllers.RateLimitHandler
+	realtime   controllers.RealtimeHandler
+	search     controllers.SearchHandler
+	export     controllers.ExportHandler
+	deletion   controllers.DeletionHandler
+	retention  controllers.RetentionHandler
+	metrics    controllers.MetricsHandler
+	hold       controllers.HoldHandler
+	moderation controllers.ModerationHandler
+	pin        controllers.PinHandler
+	mention    controllers.MentionHandler
+	unread     controllers.UnreadHandler
+	scheduled  controllers.ScheduledHandler
+	draft      controllers.DraftHandler
+	poll       controllers.PollHandler
+	system     controllers.SystemHandler
+	docs       controllers.DocsHandler
+}
+
+// services are shared by the REST and the gRPC API.
+type services struct {
+	messages    repository.MessageRepository
+	keys        repository.KeyRepository
+	keyring     *encryption.Keyring
+	idempotency repository.IdempotencyRepository
+	hub         *realtime.Hub
+	search      search.SearchIndex
+	indexer     *search.Indexer
+	exports     repository.ExportRepository
+	exporter    *export.Exporter
+	deletions   repository.DeletionRepository
+	holdStore   repository.HoldRepository
+	holds       *legalhold.Holds
+	deleter     *deletion.Deleter
+	retention   repository.RetentionRepository
+	worker      *retention.Worker
+	moderation  repository.ModerationRepository
+	moderator   *moderation.Moderator
+	pinStore    repository.PinRepository
+	pins        *pins.Pins
+	mentions    repository.MentionRepository
+	inbox       *mentions.Inbox
+	readStates  repository.ReadStateRepository
+	unread      *unread.ReadStates
+	scheduled   repository.ScheduledRepository
+	scheduler   *scheduler.Scheduler
+	draftStore  repository.DraftRepository
+	drafts      *drafts.Drafts
+	pollStore   repository.PollRepository
+	polls       *polls.Polls
+	limiter     *ratelimit.Limiter
+	metrics     *metrics.Registry
+	publisher   messaging.Publisher // events for other services
+	close       func()              // releases the storage
+}
+
+func InitializeAPI(configuration configuration.Configuration, publisher messaging.Publisher) {
+	services := newServices(configuration, publisher)
+	defer services.close()
+
+	router, _ := newRouter(configuration, services)
+	go InitializeGRPC(configuration, services)
+	go services.worker.Run()
+	go services.scheduler.Run()
+
+	fullAddress :=
+		configuration.APISettings.Address + ":" + configuration.APISettings.Port
+
+	logger.LOG.Printf("Starting API server on %v...\n", fullAddress)
+	logger.LOG.Printf("API server started on %v!\n", fullAddress)
+	logger.FailOnError(router.Run(fullAddress), "Failed to run the server")
+}
+
+func newServices(configuration configuration.Configuration, publisher messaging.Publisher) services {
+	services := services{
+		hub:       realtime.NewHub(configuration.APISettings.RealtimeHistory),
+		search:    search.NewInMemoryIndex(),
+		metrics:   metrics.NewRegistry(),
+		publisher: publisher,
+		close:     func() {},
+	}
+	services.limiter = ratelimit.NewLimiter(ratelimit.NewInMemoryStore(), ratelimit.ServerLimits{
+		User: ratelimit.Limit{
+			Rate:  configuration.RateLimitSettings.UserRate,
+			Burst: configuration.RateLimitSettings.UserBurst,
+		},
+		Channel: ratelimit.Limit{
+			Rate:  configuration.RateLimitSettings.ChannelRate,
+			Burst: configuration.RateLimitSettings.ChannelBurst,
+		},
+	})
+	services.indexer = search.NewIndexer(services.search)
 
 	if os.Getenv("DISCARD_STATE") != "INTEGRATION" {
 		databaseSession := database.ConnectToDatabase(
 			configuration,
 		)
 
-		defer databaseSession.Close()
+		services.close = databaseSession.Close
+		database.MigrateSchema(databaseSession, configuration.DatabaseSettings.Keyspace)
+
+		provider, err := encryption.NewFileKeyProvider(configuration.EncryptionSettings.MasterKeyFile,
+			configuration.EncryptionSettings.CreateMasterKey)
+		if err != nil {
+			// without the key no stored content can be read, never start with another one
+			logger.ERROR.Fatalln("Failed to load the master key:", err)
+		}
+		services.keys = repository.NewKeyRepository(databaseSession)
+		services.keyring = encryption.NewKeyring(&services.keys, provider)
 
-		messageRepository = repository.NewMessageRepository(databaseSession)
-		messageHandler = controllers.NewMessageHandler(&messageRepository)
+		services.messages = repository.NewMessageRepository(databaseSession, services.keyring)
+		services.idempotency = repository.NewIdempotencyRepository(databaseSession)
+		services.exports = repository.NewExportRepository(databaseSession)
+		services.deletions = repository.NewDeletionRepository(databaseSession)
+		services.retention = repository.NewRetentionRepository(databaseSession)
+		services.holdStore = repository.NewHoldRepository(databaseSession)
+		services.moderation = repository.NewModerationRepository(databaseSession)
+		services.pinStore = repository.NewPinRepository(databaseSession)
+		services.mentions = repository.NewMentionRepository(databaseSession)
+		services.readStates = repository.NewReadStateRepository(databaseSession)
+		services.scheduled = repository.NewScheduledRepository(databaseSession, services.keyring)
+		services.draftStore = repository.NewDraftRepository(databaseSession, services.keyring)
+		services.pollStore = repository.NewPollRepository(databaseSession)
 	} else {
-		messageRepository = repository.NewInMemoryMessageRepository()
-		messageHandler = controllers.NewMessageHandler(&messageRepository)
+		services.keys = repository.NewInMemoryKeyRepository()
+		services.keyring = encryption.NewKeyring(&services.keys, encryption.NewInMemoryKeyProvider())
+
+		services.messages = repository.NewInMemoryMessageRepository()
+		services.idempotency = repository.NewInMemoryIdempotencyRepository()
+		services.exports = repository.NewInMemoryExportRepository()
+		services.deletions = repository.NewInMemoryDeletionRepository()
+		services.retention = repository.NewInMemoryRetentionRepository()
+		services.holdStore = repository.NewInMemoryHoldRepository()
+		services.moderation = repository.NewInMemoryModerationRepository()
+		services.pinStore = repository.NewInMemoryPinRepository()
+		services.mentions = repository.NewInMemoryMentionRepository()
+		services.readStates = repository.NewInMemoryReadStateRepository()
+		services.scheduled = repository.NewInMemoryScheduledRepository()
+		services.draftStore = repository.NewInMemoryDraftRepository()
+		services.pollStore = repository.NewInMemoryPollRepository()
 	}
 
-	// endpoints
-	router.GET("/api/v1/message/ping", controllers.Ping)
-	router.POST("/api/v1/message", messageHandler.SaveMessage)
-	router.GET("/api/v1/message/:id", messageHandler.GetMessageById)
-	router.GET("/api/v1/message/user/:id", messageHandler.GetMessagesByUserId)
-	router.DELETE("/api/v1/message/user/:id", messageHandler.DeleteMessagesByUserId)
+	// before anything publishing events, they follow the changes of messages
+	services.pins = pins.NewPins(&services.pinStore, &services.messages, configuration.PinSettings)
+	services.inbox = mentions.NewInbox(&services.mentions, &services.messages, publisher)
+	services.unread = unread.NewReadStates(&services.readStates, &services.messages)
+	services.polls = polls.NewPolls(&services.pollStore)
+	services.exporter = export.NewExporter(&services.messages, &services.draftStore, &services.pollStore, &services.exports, publisher, configuration.ExportSettings)
+	services.holds = legalhold.NewHolds(&services.holdStore)
+	services.deleter = deletion.NewDeleter(&services.messages, &services.deletions, services.holds, services.keyring,
+		services.events(), publisher)
+	services.drafts = drafts.NewDrafts(&services.draftStore, configuration.DraftSettings)
+	services.moderator = moderation.NewModerator(&services.moderation, &services.messages, services.deleter,
+		publisher, services.metrics)
+	services.worker = retention.NewWorker(&services.messages, &services.retention, services.holds, services.events(),
+		services.metrics, configuration.RetentionSettings)
 
-	fullAddress :=
-		configuration.APISettings.Address + ":" + configuration.APISettings.Port
+	services.scheduler = scheduler.NewScheduler(&services.scheduled,
+		controllers.NewMessageSender(&services.messages, services.messageHandlerOptions(configuration)...),
+		services.metrics, configuration.SchedulerSettings)
 
-	logger.LOG.Printf("Starting API server on %v...\n", fullAddress)
-	logger.LOG.Printf("API server started on %v!\n", fullAddress)
-	logger.FailOnError(router.Run(fullAddress), "Failed to run the server")
+	// the other data of a user goes together with their messages
+	for _, cleanup := range []func(userID string) error{
+		services.polls.DeleteUser,
+		services.drafts.DeleteUser,
+		services.inbox.DeleteUser,
+		services.unread.DeleteUser,
+		services.moderator.DeleteUser,
+		services.scheduler.DeleteUser,
+	} {
+		services.deleter.OnUserDeleted(cleanup)
+	}
+
+	// finish the deletions and exports a restart interrupted, and the ones
+	// legal holds released before it deferred
+	go func() {
+		services.deleter.ResumeRunning()
+		services.holds.RetryReleased()
+		services.deleter.ResumeDeferred()
+	}()
+	go services.exporter.ResumeRunning()
+
+	// the embedded index lives in memory, fill it with what is already stored
+	go func() {
+		if err := services.indexer.Rebuild(services.messages.ForEach); err != nil {
+			logger.ERROR.Println("Failed to rebuild the search index:", err)
+		}
+	}()
+
+	return services
+}
+
+func (services *services) messageHandlerOptions(configuration configuration.Configuration) []controllers.MessageHandlerOption {
+	return []controllers.MessageHandlerOption{
+		controllers.WithIdempotency(&services.idempotency, configuration.APISettings.IdempotencyTTL),
+		controllers.WithPublisher(services.events()),
+		controllers.WithDeleter(services.deleter),
+		controllers.WithModerator(services.moderator),
+		controllers.WithPolls(services.polls),
+	}
+}
+
+// events receives every change of a message.
+func (services *services) events() events.Publisher {
+	return events.Publishers{services.hub, services.indexer, services.pins, services.inbox, services.unread, services.polls}
+}
+
+// NewRouter connects to the storage and registers every endpoint together with
+// its documentation. The returned function releases the storage.
+func NewRouter(configuration configuration.Configuration, publisher messaging.Publisher) (*gin.Engine, *openapi.Document, func()) {
+	services := newServices(configuration, publisher)
+	router, document := newRouter(configuration, services)
+	return router, document, services.close
+}
+
+func newRouter(configuration configuration.Configuration, services services) (*gin.Engine, *openapi.Document) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.Use(controllers.RequestID)
+
+	messageHandlerOptions := services.messageHandlerOptions(configuration)
+
+	document := openapi.New("Discard message-service", "1.0.0")
+	registerRoutes(&routes{router: router, document: document}, configuration, handlers{
+		message:    controllers.NewMessageHandler(&services.messages, messageHandlerOptions...),
+		messageV2:  controllers.NewMessageHandlerV2(&services.messages, messageHandlerOptions...),
+		rateLimit:  controllers.NewRateLimitHandler(services.limiter),
+		realtime:   controllers.NewRealtimeHandler(services.hub, &services.messages),
+		search:     controllers.NewSearchHandler(services.search),
+		export:     controllers.NewExportHandler(services.exporter),
+		deletion:   controllers.NewDeletionHandler(services.deleter),
+		retention:  controllers.NewRetentionHandler(services.worker),
+		metrics:    controllers.NewMetricsHandler(services.metrics),
+		hold:       controllers.NewHoldHandler(services.holds),
+		moderation: controllers.NewModerationHandler(services.moderator, &services.messages),
+		pin:        controllers.NewPinHandler(services.pins, &services.messages),
+		mention:    controllers.NewMentionHandler(services.inbox),
+		unread:     controllers.NewUnreadHandler(services.unread),
+		scheduled:  controllers.NewScheduledHandler(services.scheduler),
+		draft:      controllers.NewDraftHandler(services.drafts),
+		poll:       controllers.NewPollHandler(services.polls, &services.messages),
+		system:     controllers.NewSystemHandler(&services.messages, messageHandlerOptions...),
+		docs:       controllers.NewDocsHandler(document),
+	})
+
+	return router, document
 }
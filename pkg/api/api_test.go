@@ -0,0 +1,45 @@
+package api
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTheDataOfDeletedUsersIsRemoved(t *testing.T) {
+	t.Setenv("DISCARD_STATE", "INTEGRATION")
+	services := newServices(configuration.Configuration{}, messaging.NewAMQPPublisher())
+	t.Cleanup(services.close)
+
+	mentioned := models.Mention{UserID: alice, MessageID: gocql.TimeUUID().String(), ServerID: "server", ChannelID: "channel", AuthorID: bob}
+	assert.NoError(t, services.mentions.SaveMentions([]models.Mention{mentioned}))
+	assert.NoError(t, services.readStates.SetReadState(models.ReadState{UserID: alice, ChannelID: "channel", LastReadID: mentioned.MessageID}))
+	report, err := services.moderator.Report(models.Message{ID: mentioned.MessageID, UserID: bob, ServerID: "server"}, alice,
+		models.ReportRequest{Category: "spam", Details: "written by the reporter"})
+	assert.NoError(t, err)
+	scheduled, err := services.scheduler.Schedule(models.ScheduleRequest{
+		Message: models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: "later"},
+		SendAt:  time.Now().Add(time.Hour),
+	}, alice)
+	assert.NoError(t, err)
+
+	job, err := services.deleter.DeleteUser(alice)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionCompleted, job.Status)
+
+	inbox, _ := services.mentions.GetMentions(alice, models.Page{})
+	assert.Empty(t, inbox)
+	states, _ := services.readStates.GetReadStates(alice)
+	assert.Empty(t, states)
+	kept, err := services.moderation.GetReport("server", report.ID)
+	assert.NoError(t, err, "the report stays with the moderators")
+	assert.Empty(t, kept.ReporterID)
+	assert.Empty(t, kept.Details)
+	cancelled, _ := services.scheduler.Get("server", scheduled.ID)
+	assert.Equal(t, models.ScheduledCancelled, cancelled.Status)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/controllers"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/proto/messagepb"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// InitializeGRPC serves the gRPC API on its own port next to the REST API.
+func InitializeGRPC(configuration configuration.Configuration, services services) {
+	fullAddress :=
+		configuration.APISettings.Address + ":" + configuration.APISettings.GRPCPort
+
+	listener, err := net.Listen("tcp", fullAddress)
+	logger.FailOnError(err, "Failed to listen for gRPC")
+
+	logger.LOG.Printf("gRPC server started on %v!\n", fullAddress)
+	logger.FailOnError(newGRPCServer(configuration, services).Serve(listener), "Failed to run the gRPC server")
+}
+
+func newGRPCServer(configuration configuration.Configuration, services services) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(controllers.AuthenticateUnary))
+
+	messagepb.RegisterMessageServiceServer(server, controllers.NewMessageServer(
+		&services.messages, services.hub, services.limiter, services.messageHandlerOptions(configuration)...))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(messagepb.MessageService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
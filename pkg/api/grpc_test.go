@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/proto/messagepb"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	alice = "6f1c54c4-93a1-4c7e-9a52-8d4cf0d3d0a1"
+	bob   = "0e6c1f4e-3a55-4b0f-8d38-7c0b5e9f2b7d"
+)
+
+func newTestClient(t *testing.T) messagepb.MessageServiceClient {
+	client, _ := newTestServer(t)
+	return client
+}
+
+func newTestServer(t *testing.T) (messagepb.MessageServiceClient, services) {
+	t.Setenv("DISCARD_STATE", "INTEGRATION")
+	configuration := configuration.Configuration{
+		RateLimitSettings: configuration.RateLimitSettings{UserRate: 0.001, UserBurst: 2},
+	}
+	services := newServices(configuration, messaging.NewAMQPPublisher())
+	t.Cleanup(services.close)
+
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(configuration, services)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { connection.Close() })
+	return messagepb.NewMessageServiceClient(connection), services
+}
+
+func as(userID string, roles string, servers string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(),
+		auth.UserIDHeader, userID, auth.RolesHeader, roles, auth.ServersHeader, servers)
+}
+
+func codeOf(err error) codes.Code {
+	return status.Code(err)
+}
+
+func TestGRPCCallsAreAuthenticated(t *testing.T) {
+	client := newTestClient(t)
+	save := &messagepb.SaveRequest{Message: &messagepb.Message{UserId: alice, ServerId: "server", ChannelId: "general", Message: "hi"}}
+
+	_, err := client.Save(context.Background(), save)
+	assert.Equal(t, codes.Unauthenticated, codeOf(err))
+
+	_, err = client.Save(as(bob, "", "server"), save)
+	assert.Equal(t, codes.PermissionDenied, codeOf(err), "only as the caller")
+
+	_, err = client.Save(as(alice, "", "other"), save)
+	assert.Equal(t, codes.PermissionDenied, codeOf(err), "only in servers of the caller")
+
+	saved, err := client.Save(as(alice, "", "server"), save)
+	assert.NoError(t, err)
+	id := saved.GetMessage().GetId()
+
+	_, err = client.GetById(as(bob, "", "other"), &messagepb.GetByIdRequest{Id: id})
+	assert.Equal(t, codes.PermissionDenied, codeOf(err))
+	_, err = client.GetById(as(bob, "", "server"), &messagepb.GetByIdRequest{Id: id})
+	assert.NoError(t, err)
+
+	listed, err := client.ListByUser(as(bob, "", "other"), &messagepb.ListByUserRequest{UserId: alice})
+	assert.NoError(t, err)
+	assert.Empty(t, listed.GetMessages())
+	listed, err = client.ListByChannel(as(bob, "", "other"), &messagepb.ListByChannelRequest{ChannelId: "general"})
+	assert.NoError(t, err)
+	assert.Empty(t, listed.GetMessages())
+	listed, err = client.ListByChannel(as(bob, "", "server"), &messagepb.ListByChannelRequest{ChannelId: "general"})
+	assert.NoError(t, err)
+	assert.Len(t, listed.GetMessages(), 1)
+
+	_, err = client.DeleteByUser(as(alice, auth.RoleOwner, "server"), &messagepb.DeleteByUserRequest{UserId: bob})
+	assert.Equal(t, codes.PermissionDenied, codeOf(err))
+	_, err = client.DeleteByUser(as(bob, auth.RoleAdmin, ""), &messagepb.DeleteByUserRequest{UserId: alice})
+	assert.NoError(t, err)
+}
+
+func TestGRPCSaveIsRateLimited(t *testing.T) {
+	client := newTestClient(t)
+	save := &messagepb.SaveRequest{Message: &messagepb.Message{UserId: alice, ServerId: "server", ChannelId: "general", Message: "hi"}}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Save(as(alice, "", "server"), save)
+		assert.NoError(t, err)
+	}
+	_, err := client.Save(as(alice, "", "server"), save)
+	assert.Equal(t, codes.ResourceExhausted, codeOf(err))
+}
+
+func TestGRPCRejectedContentIsAnInvalidArgument(t *testing.T) {
+	client, services := newTestServer(t)
+	assert.NoError(t, services.moderator.SetRules("server", models.ModerationRules{Rules: []models.ModerationRule{
+		{Kind: models.ModerationWords, Action: models.ModerationReject, Words: []string{"forbidden"}},
+	}}, alice))
+
+	_, err := client.Save(as(alice, "", "server"), &messagepb.SaveRequest{
+		Message: &messagepb.Message{UserId: alice, ServerId: "server", ChannelId: "general", Message: "forbidden words"}})
+	assert.Equal(t, codes.InvalidArgument, codeOf(err))
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/openapi"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(t *testing.T) (http.Handler, *openapi.Document) {
+	t.Setenv("DISCARD_STATE", "INTEGRATION")
+	router, document, closeStorage := NewRouter(configuration.Configuration{
+		APISettings: configuration.APISettings{DocsEnabled: true},
+	}, messaging.NewAMQPPublisher())
+	t.Cleanup(closeStorage)
+	return router, document
+}
+
+// update rewrites the snapshot: go test ./pkg/api -run TestServedSpecification -update
+var update = flag.Bool("update", false, "rewrite the OpenAPI snapshot in testdata")
+
+const snapshot = "testdata/openapi.json"
+
+func serve(t *testing.T, router http.Handler) []byte {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/message/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	return recorder.Body.Bytes()
+}
+
+// TestServedSpecificationMatchesSnapshot catches any change to the routes or
+// models that reaches the published contract, review the diff of the snapshot.
+func TestServedSpecificationMatchesSnapshot(t *testing.T) {
+	router, _ := newTestRouter(t)
+	served := serve(t, router)
+
+	if *update {
+		assert.NoError(t, os.WriteFile(snapshot, served, 0o644))
+	}
+	expected, err := os.ReadFile(snapshot)
+	if assert.NoError(t, err, "run the test with -update to create the snapshot") {
+		assert.Equal(t, string(expected), string(served), "the OpenAPI document changed, run the test with -update and review the diff")
+	}
+}
+
+var templateParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestSpecificationIsConsistent(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	var served openapi.Document
+	assert.NoError(t, json.Unmarshal(serve(t, router), &served))
+
+	var references func(schema *openapi.Schema, where string)
+	references = func(schema *openapi.Schema, where string) {
+		if schema == nil {
+			return
+		}
+		if schema.Ref != "" {
+			_, found := served.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+			assert.True(t, found, "%s refers to the missing schema %s", where, schema.Ref)
+		}
+		references(schema.Items, where)
+		references(schema.AdditionalProperties, where)
+		for _, property := range schema.Properties {
+			references(property, where)
+		}
+	}
+	for name, schema := range served.Components.Schemas {
+		references(schema, "schema "+name)
+	}
+
+	for path, operations := range served.Paths {
+		var templated []string
+		for _, match := range templateParameter.FindAllStringSubmatch(path, -1) {
+			templated = append(templated, match[1])
+		}
+
+		for method, operation := range operations {
+			where := method + " " + path
+			assert.NotEmpty(t, operation.Summary, "%s has no summary", where)
+			assert.NotEmpty(t, operation.Responses, "%s documents no response", where)
+
+			var declared []string
+			seen := make(map[string]bool)
+			for _, parameter := range operation.Parameters {
+				key := parameter.In + " " + parameter.Name
+				assert.False(t, seen[key], "%s declares the %s parameter %s twice", where, parameter.In, parameter.Name)
+				seen[key] = true
+				if parameter.In == "path" {
+					assert.True(t, parameter.Required, "%s has the optional path parameter %s", where, parameter.Name)
+					declared = append(declared, parameter.Name)
+				}
+			}
+			assert.ElementsMatch(t, templated, declared, "%s declares other path parameters than its path", where)
+
+			if operation.RequestBody != nil {
+				for _, media := range operation.RequestBody.Content {
+					references(media.Schema, where)
+				}
+			}
+			for status, response := range operation.Responses {
+				_, err := strconv.Atoi(status)
+				assert.NoError(t, err, "%s documents the status %s", where, status)
+				for _, media := range response.Content {
+					references(media.Schema, where)
+				}
+			}
+		}
+	}
+}
+
+// TestEveryRouteIsDocumented catches routes registered on the engine
+// without going through routes.handle, which never reach the document.
+func TestEveryRouteIsDocumented(t *testing.T) {
+	router, document := newTestRouter(t)
+
+	var registered, documented []string
+	for _, route := range router.(*gin.Engine).Routes() {
+		registered = append(registered, route.Method+" "+openapi.Path(route.Path))
+	}
+	for path, operations := range document.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	assert.ElementsMatch(t, registered, documented)
+}
+
+func TestSpecificationIsServed(t *testing.T) {
+	router, document := newTestRouter(t)
+
+	var served openapi.Document
+	assert.NoError(t, json.Unmarshal(serve(t, router), &served))
+	assert.Equal(t, openapi.Version, served.OpenAPI)
+	assert.Equal(t, len(document.Paths), len(served.Paths))
+
+	// validation rules of models.Message end up in its schema
+	message := served.Components.Schemas["Message"]
+	if assert.NotNil(t, message) {
+		assert.Contains(t, message.Required, "user_id")
+		assert.Equal(t, "uuid", message.Properties["user_id"].Format)
+	}
+}
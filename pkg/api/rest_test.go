@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bytes"
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/controllers"
+	"discard/message-service/pkg/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+// identity returns the headers the gateway sets for a caller.
+func identity(userID string, roles string, servers string) http.Header {
+	header := make(http.Header)
+	header.Set(auth.UserIDHeader, userID)
+	header.Set(auth.RolesHeader, roles)
+	header.Set(auth.ServersHeader, servers)
+	return header
+}
+
+// call sends a request with a JSON body unless body is nil.
+func call(router http.Handler, method string, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestV1MessagesWithoutIdentityAreSaved(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	recorder := call(router, http.MethodPost, "/api/v1/message",
+		models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: "hello"}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+}
+
+func TestMessagesToServersOfOthersAreForbidden(t *testing.T) {
+	router, _ := newTestRouter(t)
+	message := models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: "hello"}
+
+	recorder := call(router, http.MethodPost, "/api/v1/message", message, identity(alice, "", "other"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = call(router, http.MethodPost, "/api/v2/message", message, identity(alice, "", "other"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = call(router, http.MethodPost, "/api/v1/message", message, identity(alice, "", "server"))
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+}
+
+// post saves a message as a member of its server and returns its ID.
+func post(t *testing.T, router http.Handler, message models.Message) string {
+	recorder := call(router, http.MethodPost, "/api/v2/message", message, identity(message.UserID, "", message.ServerID))
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var response struct{ Data models.Message }
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response.Data.ID
+}
+
+func TestMessageContext(t *testing.T) {
+	router, _ := newTestRouter(t)
+	var ids []string
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		ids = append(ids, post(t, router, models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: text}))
+	}
+	member := identity(bob, "", "server")
+
+	recorder := call(router, http.MethodGet, "/api/v1/message/"+ids[2]+"/context?before=1&after=1", nil, member)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct{ Data models.MessageContext }
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	var texts []string
+	for _, message := range response.Data.Messages {
+		texts = append(texts, message.Message)
+	}
+	assert.Equal(t, []string{"two", "three", "four"}, texts)
+	assert.Equal(t, ids[1], response.Data.Before)
+	assert.Equal(t, ids[3], response.Data.After)
+
+	// the window ends with the channel
+	recorder = call(router, http.MethodGet, "/api/v1/message/"+ids[0]+"/context?before=5&after=0", nil, member)
+	response.Data = models.MessageContext{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(t, response.Data.Messages, 1)
+	assert.Empty(t, response.Data.Before)
+	assert.Equal(t, ids[0], response.Data.After)
+
+	recorder = call(router, http.MethodGet, "/api/v1/message/"+ids[2]+"/context?before=51", nil, member)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = call(router, http.MethodGet, "/api/v1/message/"+ids[2]+"/context", nil, identity(bob, "", "other"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = call(router, http.MethodGet, "/api/v1/message/"+ids[2]+"/context", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = call(router, http.MethodGet, "/api/v1/message/"+gocql.TimeUUID().String()+"/context", nil, member)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestPinsOfServersOfOthersAreForbidden(t *testing.T) {
+	router, _ := newTestRouter(t)
+	path := "/api/v1/message/server/server/channel/channel/pins"
+
+	recorder := call(router, http.MethodGet, path, nil, identity(bob, "", "other"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = call(router, http.MethodPut, path+"/limit", models.PinLimit{Limit: 5}, identity(bob, auth.RoleOwner, "other"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = call(router, http.MethodPut, path+"/limit", models.PinLimit{Limit: 5}, identity(bob, auth.RoleOwner, "server"))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = call(router, http.MethodGet, path, nil, identity(bob, "", "server"))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestUnreadCountsOnlyCoverServersOfTheCaller(t *testing.T) {
+	router, _ := newTestRouter(t)
+	marker := models.Ack{MessageID: gocql.TimeUUID().String()}
+
+	recorder := call(router, http.MethodPut, "/api/v1/message/server/other/channel/channel/ack", marker, identity(bob, "", "server"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = call(router, http.MethodPut, "/api/v1/message/server/server/channel/channel/ack", marker, identity(bob, "", "server"))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	unread := func(servers string) []models.Unread {
+		recorder := call(router, http.MethodGet, "/api/v1/message/unread", nil, identity(bob, "", servers))
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response struct{ Data []models.Unread }
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response.Data
+	}
+	assert.Len(t, unread("server"), 1)
+	assert.Empty(t, unread("other"), "the channels of servers the caller left are not counted")
+}
+
+func TestMessagesAreOnlyScheduledAsTheCaller(t *testing.T) {
+	router, _ := newTestRouter(t)
+	request := models.ScheduleRequest{
+		Message: models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: "later"},
+		SendAt:  time.Now().Add(time.Hour),
+	}
+
+	recorder := call(router, http.MethodPost, "/api/v1/message/scheduled", request, identity(bob, auth.RoleModerator, "server"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = call(router, http.MethodPost, "/api/v1/message/scheduled", request, identity(alice, auth.RoleModerator, "server"))
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var response struct{ Data models.ScheduledMessage }
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, alice, response.Data.UserID)
+}
+
+// errorCode returns the status and error code of a v2 response.
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) (int, string) {
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response), recorder.Body.String())
+	assert.NotEmpty(t, response.Error.RequestID)
+	return recorder.Code, response.Error.Code
+}
+
+func TestV2ErrorCodes(t *testing.T) {
+	router, _ := newTestRouter(t)
+	member := identity(alice, "", "server")
+	message := models.Message{UserID: alice, ServerID: "server", ChannelID: "channel", Message: "hello"}
+	rules := models.ModerationRules{Rules: []models.ModerationRule{
+		{Kind: models.ModerationWords, Action: models.ModerationReject, Words: []string{"forbidden"}},
+	}}
+	recorder := call(router, http.MethodPut, "/api/v1/message/server/server/moderation", rules, identity(bob, auth.RoleOwner, "server"))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	invalid := message
+	invalid.UserID = ""
+	rejected := message
+	rejected.Message = "forbidden words"
+	for name, test := range map[string]struct {
+		recorder *httptest.ResponseRecorder
+		status   int
+		code     string
+	}{
+		"validation": {call(router, http.MethodPost, "/api/v2/message", invalid, member),
+			http.StatusBadRequest, controllers.CodeValidationFailed},
+		"other server": {call(router, http.MethodPost, "/api/v2/message", message, identity(alice, "", "other")),
+			http.StatusForbidden, controllers.CodeForbidden},
+		"moderation": {call(router, http.MethodPost, "/api/v2/message", rejected, member),
+			http.StatusUnprocessableEntity, controllers.CodeContentRejected},
+		"missing message": {call(router, http.MethodGet, "/api/v2/message/"+gocql.TimeUUID().String(), nil, member),
+			http.StatusNotFound, controllers.CodeNotFound},
+		"no identity": {call(router, http.MethodDelete, "/api/v2/message/user/"+alice, nil, nil),
+			http.StatusUnauthorized, controllers.CodeUnauthenticated},
+		"no role": {call(router, http.MethodDelete, "/api/v2/message/user/"+alice, nil, member),
+			http.StatusForbidden, controllers.CodeForbidden},
+	} {
+		status, code := errorCode(t, test.recorder)
+		assert.Equal(t, test.status, status, name)
+		assert.Equal(t, test.code, code, name)
+	}
+
+	recorder = call(router, http.MethodDelete, "/api/v2/message/user/"+alice, nil, identity(bob, auth.RoleAdmin, ""))
+	assert.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+}
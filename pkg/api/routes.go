@@ -0,0 +1,797 @@
+package api
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/controllers"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/openapi"
+	"discard/message-service/pkg/ratelimit"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type routes struct {
+	router   *gin.Engine
+	document *openapi.Document
+}
+
+// handle registers an endpoint together with its documentation. Routes with
+// roles only let callers holding one of them through, answering the others
+// with the error body of their API version.
+func (routes *routes) handle(method string, path string, route openapi.Route, handlers ...gin.HandlerFunc) {
+	if len(route.Roles) > 0 {
+		requireRole, rejected := auth.RequireRole(route.Roles...), any(v1Error)
+		if strings.HasPrefix(path, "/api/v2/") {
+			requireRole, rejected = auth.RequireRoleWith(controllers.RejectV2, route.Roles...), v2Error
+		}
+		handlers = append([]gin.HandlerFunc{requireRole}, handlers...)
+		route.Headers = append(route.Headers,
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.RolesHeader, "Comma separated roles of the user, set by the gateway"),
+		)
+		if route.Responses == nil {
+			route.Responses = make(map[int]any)
+		}
+		route.Responses[http.StatusUnauthorized] = rejected
+		route.Responses[http.StatusForbidden] = rejected
+	}
+
+	routes.router.Handle(method, path, handlers...)
+	routes.document.Register(method, path, route)
+}
+
+var (
+	idempotencyKey = openapi.Header(controllers.IdempotencyKeyHeader,
+		"Retries with the same key return the message created by the first attempt")
+	v1Error   = models.Response{}
+	v2Error   = models.ErrorResponse{}
+	pageQuery = []openapi.Parameter{
+		openapi.Query("before", "string", "Only messages older than this message ID"),
+		openapi.Query("after", "string", "Only messages newer than this message ID"),
+		openapi.Query("limit", "integer", "Page size, at most 100"),
+	}
+)
+
+func registerRoutes(routes *routes, configuration configuration.Configuration, handlers handlers) {
+	// === API v1 ===
+	routes.handle(http.MethodGet, "/api/v1/message/ping", openapi.Route{
+		Summary:   "Check whether the service is up",
+		Tags:      []string{"health"},
+		Responses: map[int]any{http.StatusOK: models.Response{}},
+	}, controllers.Ping)
+
+	routes.handle(http.MethodGet, "/api/v1/message/openapi.json", openapi.Route{
+		Summary:   "OpenAPI specification of this service",
+		Tags:      []string{"docs"},
+		Responses: map[int]any{http.StatusOK: map[string]any{}},
+	}, handlers.docs.GetSpecification)
+
+	if configuration.APISettings.DocsEnabled {
+		routes.handle(http.MethodGet, "/api/v1/message/docs", openapi.Route{
+			Summary:     "Interactive API documentation",
+			Tags:        []string{"docs"},
+			ContentType: "text/html",
+			Responses:   map[int]any{http.StatusOK: ""},
+		}, handlers.docs.GetDocs)
+	}
+
+	routes.handle(http.MethodGet, "/api/v1/message/metrics", openapi.Route{
+		Summary:     "Metrics of the service in the Prometheus text format",
+		Tags:        []string{"health"},
+		ContentType: "text/plain",
+		Responses:   map[int]any{http.StatusOK: ""},
+	}, handlers.metrics.GetMetrics)
+
+	routes.handle(http.MethodPost, "/api/v1/message", openapi.Route{
+		Summary: "Send a message, system messages are only written by the service",
+		Tags:    []string{"messages"},
+		Headers: []openapi.Parameter{idempotencyKey},
+		Body:    models.Message{},
+		Responses: map[int]any{
+			http.StatusCreated:         models.Response{},
+			http.StatusBadRequest:      v1Error,
+			http.StatusForbidden:       v1Error,
+			http.StatusConflict:        v1Error,
+			http.StatusTooManyRequests: v1Error,
+		},
+	}, handlers.rateLimit.LimitMessages, handlers.message.SaveMessage)
+
+	routes.handle(http.MethodPost, "/api/v1/message/system", openapi.Route{
+		Summary: "Write the system message of a membership or channel event, once per event ID",
+		Tags:    []string{"system messages"},
+		Body:    models.SystemEvent{},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusCreated:    models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusConflict:   v1Error,
+		},
+	}, handlers.system.SaveSystemMessage)
+
+	routes.handle(http.MethodPost, "/api/v1/message/scheduled", openapi.Route{
+		Summary: "Schedule a message to be sent at send_at, moderation applies when it is sent",
+		Tags:    []string{"scheduled messages"},
+		Body:    models.ScheduleRequest{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Roles: []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusCreated:      models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+		},
+	}, handlers.scheduled.ScheduleMessage)
+
+	routes.handle(http.MethodGet, "/api/v1/message/search", openapi.Route{
+		Summary: "Search the messages of the servers the caller is a member of, newest first",
+		Tags:    []string{"messages"},
+		Query: append([]openapi.Parameter{
+			openapi.Query("q", "string", `Words that all have to occur, "quoted phrases" have to occur in order`),
+			openapi.Query("server_id", "string", "Only messages of this server"),
+			openapi.Query("channel_id", "string", "Only messages of this channel"),
+			openapi.Query("author", "string", "Only messages of this user"),
+		}, pageQuery...),
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+		},
+	}, handlers.search.Search)
+
+	routes.handle(http.MethodGet, "/api/v1/message/unread", openapi.Route{
+		Summary: "Count the unread messages and mentions in every channel the caller has read in their servers",
+		Tags:    []string{"read states"},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusUnauthorized: v1Error,
+		},
+	}, handlers.unread.GetUnread)
+
+	routes.handle(http.MethodPut, "/api/v1/message/drafts/:channelId", openapi.Route{
+		Summary: "Save the draft of the caller in a channel, the edit with the latest updated_at wins",
+		Tags:    []string{"drafts"},
+		Body:    models.DraftRequest{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusConflict:     models.Response{},
+		},
+	}, handlers.draft.SaveDraft)
+
+	routes.handle(http.MethodGet, "/api/v1/message/drafts/:channelId", openapi.Route{
+		Summary: "Get the draft of the caller in a channel",
+		Tags:    []string{"drafts"},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusUnauthorized: v1Error,
+			http.StatusNotFound:     v1Error,
+		},
+	}, handlers.draft.GetDraft)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/drafts/:channelId", openapi.Route{
+		Summary: "Delete the draft of the caller in a channel, keeping edits made after updated_at",
+		Tags:    []string{"drafts"},
+		Query: []openapi.Parameter{
+			openapi.Query("updated_at", "string", "When the draft was discarded, now by default"),
+		},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+		},
+	}, handlers.draft.DeleteDraft)
+
+	routes.handle(http.MethodGet, "/api/v1/message/mentions/:userId", openapi.Route{
+		Summary: "Page through the recent messages mentioning a user, newest first",
+		Tags:    []string{"messages"},
+		Query:   pageQuery,
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+		},
+	}, handlers.mention.GetMentions)
+
+	routes.handle(http.MethodGet, "/api/v1/message/:id", openapi.Route{
+		Summary: "Get a message, answers 201 on success for backwards compatibility",
+		Tags:    []string{"messages"},
+		Responses: map[int]any{
+			http.StatusCreated:  models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.message.GetMessageById)
+
+	routes.handle(http.MethodGet, "/api/v1/message/:id/context", openapi.Route{
+		Summary: "Get a message with its neighbours in the channel, oldest first",
+		Tags:    []string{"messages"},
+		Query: []openapi.Parameter{
+			openapi.Query("before", "integer", "Older messages to include, 25 by default and at most 50"),
+			openapi.Query("after", "integer", "Newer messages to include, 25 by default and at most 50"),
+		},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+			http.StatusNotFound:     v1Error,
+		},
+	}, handlers.message.GetMessageContext)
+
+	routes.handle(http.MethodPost, "/api/v1/message/:id/report", openapi.Route{
+		Summary: "Report a message to the moderators of its server",
+		Tags:    []string{"moderation"},
+		Body:    models.ReportRequest{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusCreated:    models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusForbidden:  v1Error,
+			http.StatusNotFound:   v1Error,
+		},
+	}, handlers.moderation.ReportMessage)
+
+	routes.handle(http.MethodPut, "/api/v1/message/:id/pin", openapi.Route{
+		Summary: "Pin a message in its channel, up to the pin limit of the channel",
+		Tags:    []string{"pins"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusNotFound:   v1Error,
+			http.StatusConflict:   v1Error,
+		},
+	}, handlers.pin.PinMessage)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/:id/pin", openapi.Route{
+		Summary: "Unpin a message",
+		Tags:    []string{"pins"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.pin.UnpinMessage)
+
+	routes.handle(http.MethodPost, "/api/v1/message/:id/votes", openapi.Route{
+		Summary: "Vote in a poll, once and for a single option unless the poll allows multiple choices",
+		Tags:    []string{"polls"},
+		Body:    models.Vote{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+			http.StatusNotFound:     v1Error,
+			http.StatusConflict:     v1Error,
+		},
+	}, handlers.poll.Vote)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/:id/votes", openapi.Route{
+		Summary: "Retract the vote of the caller in a poll that is still open",
+		Tags:    []string{"polls"},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+			http.StatusNotFound:     v1Error,
+			http.StatusConflict:     v1Error,
+		},
+	}, handlers.poll.RetractVote)
+
+	routes.handle(http.MethodGet, "/api/v1/message/user/:id", openapi.Route{
+		Summary: "List the messages of a user",
+		Tags:    []string{"messages"},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.message.GetMessagesByUserId)
+
+	routes.handle(http.MethodGet, "/api/v1/message/channel/:id", openapi.Route{
+		Summary: "Page through the history of a channel, oldest message first",
+		Tags:    []string{"messages"},
+		Query:   pageQuery,
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.message.GetMessagesByChannelId)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/channel/:channelId/ack", openapi.Route{
+		Summary: "Mark a channel read up to a message, the read marker never moves back",
+		Tags:    []string{"read states"},
+		Body:    models.Ack{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:           models.Response{},
+			http.StatusBadRequest:   v1Error,
+			http.StatusUnauthorized: v1Error,
+			http.StatusForbidden:    v1Error,
+		},
+	}, handlers.unread.AckChannel)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/channel/:channelId/pins", openapi.Route{
+		Summary: "List the pinned messages of a channel in the order they were pinned",
+		Tags:    []string{"pins"},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusOK:        models.Response{},
+			http.StatusForbidden: v1Error,
+		},
+	}, handlers.pin.GetPins)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/:id", openapi.Route{
+		Summary: "Delete a message as its author or as a moderator of its server, deferred while a legal hold covers it",
+		Tags:    []string{"messages"},
+		Responses: map[int]any{
+			http.StatusOK:        models.Response{},
+			http.StatusAccepted:  models.Response{},
+			http.StatusForbidden: v1Error,
+			http.StatusNotFound:  v1Error,
+		},
+	}, handlers.message.DeleteMessage)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/user/:id", openapi.Route{
+		Summary: "Start deleting all messages of a user",
+		Tags:    []string{"messages"},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.message.DeleteMessagesByUserId)
+
+	routes.handle(http.MethodGet, "/api/v1/message/deletion/audit", openapi.Route{
+		Summary: "Get the audit log of completed user deletions and whether its hash chain is intact",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.deletion.GetAudit)
+
+	routes.handle(http.MethodGet, "/api/v1/message/deletion/:id", openapi.Route{
+		Summary: "Get the state and progress of a user deletion job",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.deletion.GetDeletionJob)
+
+	routes.handle(http.MethodPost, "/api/v1/message/deletion/:id/resume", openapi.Route{
+		Summary: "Resume a user deletion job that failed or was interrupted, it continues in the background",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:                 models.Response{},
+			http.StatusNotFound:           v1Error,
+			http.StatusConflict:           v1Error,
+			http.StatusServiceUnavailable: v1Error,
+		},
+	}, handlers.deletion.ResumeDeletionJob)
+
+	routes.handle(http.MethodPost, "/api/v1/message/hold", openapi.Route{
+		Summary: "Place a legal hold keeping the messages of a user, server or channel from deletion",
+		Tags:    []string{"privacy"},
+		Body:    models.HoldRequest{},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusCreated:    models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.hold.PlaceHold)
+
+	routes.handle(http.MethodGet, "/api/v1/message/hold", openapi.Route{
+		Summary: "List every legal hold, released ones included",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.hold.GetHolds)
+
+	routes.handle(http.MethodGet, "/api/v1/message/hold/:id", openapi.Route{
+		Summary: "Get a legal hold and the deletions it deferred",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.hold.GetHold)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/hold/:id", openapi.Route{
+		Summary: "Release a legal hold and retry the deletions it deferred",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+			http.StatusConflict: v1Error,
+		},
+	}, handlers.hold.ReleaseHold)
+
+	routes.handle(http.MethodPost, "/api/v1/message/user/:id/export", openapi.Route{
+		Summary: "Export all data stored about a user into a downloadable archive",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusAccepted: models.Response{},
+		},
+	}, handlers.export.StartExport)
+
+	routes.handle(http.MethodGet, "/api/v1/message/export/:id", openapi.Route{
+		Summary: "Get the status of a data export and its download link once completed",
+		Tags:    []string{"privacy"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+		},
+	}, handlers.export.GetExport)
+
+	routes.handle(http.MethodGet, "/api/v1/message/export/:id/download", openapi.Route{
+		Summary: "Download the archive of a data export through its signed link",
+		Tags:    []string{"privacy"},
+		Query: []openapi.Parameter{
+			openapi.Query("expires", "integer", "Unix time the link expires at"),
+			openapi.Query("signature", "string", "Signature of the link"),
+		},
+		ContentType: "application/zip",
+		Responses: map[int]any{
+			http.StatusOK:        []byte{},
+			http.StatusForbidden: v1Error,
+			http.StatusGone:      v1Error,
+		},
+	}, handlers.export.DownloadExport)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/channel/:channelId/slowmode", openapi.Route{
+		Summary: "Set the slow mode interval of a channel of the server, zero disables it",
+		Tags:    []string{"rate limiting"},
+		Body:    models.SlowMode{},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusForbidden:  v1Error,
+		},
+	}, handlers.rateLimit.SetSlowMode)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/scheduled", openapi.Route{
+		Summary: "List the scheduled messages of a server, the next one to be sent first",
+		Tags:    []string{"scheduled messages"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.scheduled.GetScheduledMessages)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/server/:id/scheduled/:scheduledId", openapi.Route{
+		Summary: "Cancel a scheduled message that is not sent yet",
+		Tags:    []string{"scheduled messages"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+			http.StatusConflict: v1Error,
+		},
+	}, handlers.scheduled.CancelScheduledMessage)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/channel/:channelId/pins/limit", openapi.Route{
+		Summary: "Set how many messages can be pinned in a channel of a server the caller is a member of",
+		Tags:    []string{"pins"},
+		Body:    models.PinLimit{},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Roles: []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.pin.SetPinLimit)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/ratelimit", openapi.Route{
+		Summary: "Override the default rate limits for a server",
+		Tags:    []string{"rate limiting"},
+		Body:    ratelimit.ServerLimits{},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.rateLimit.SetServerLimits)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/deletion-policy", openapi.Route{
+		Summary: "Get how the messages of deleted users are erased on a server",
+		Tags:    []string{"privacy"},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.deletion.GetDeletionPolicy)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/deletion-policy", openapi.Route{
+		Summary: "Set whether the messages of deleted users are purged, anonymized or kept as tombstones",
+		Tags:    []string{"privacy"},
+		Body:    models.DeletionPolicy{},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.deletion.SetDeletionPolicy)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/moderation", openapi.Route{
+		Summary: "Get the moderation rules applied to the messages of a server, in order",
+		Tags:    []string{"moderation"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.moderation.GetModerationRules)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/moderation", openapi.Route{
+		Summary: "Replace the moderation rules of a server",
+		Tags:    []string{"moderation"},
+		Body:    models.ModerationRules{},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.moderation.SetModerationRules)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/flagged", openapi.Route{
+		Summary: "List the messages of a server flagged by its moderation rules, oldest first",
+		Tags:    []string{"moderation"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.moderation.GetFlaggedMessages)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/server/:id/flagged/:messageId", openapi.Route{
+		Summary: "Take a flagged message off the review queue of its server",
+		Tags:    []string{"moderation"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.moderation.DismissFlaggedMessage)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/reports", openapi.Route{
+		Summary: "List the reports of a server, oldest first",
+		Tags:    []string{"moderation"},
+		Query: []openapi.Parameter{
+			openapi.Query("status", "string", "Only reports that are open, claimed or resolved"),
+		},
+		Roles: []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+		},
+	}, handlers.moderation.GetReports)
+
+	routes.handle(http.MethodPost, "/api/v1/message/server/:id/reports/:reportId/claim", openapi.Route{
+		Summary: "Claim an open report so no other moderator works on it",
+		Tags:    []string{"moderation"},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusNotFound: v1Error,
+			http.StatusConflict: v1Error,
+		},
+	}, handlers.moderation.ClaimReport)
+
+	routes.handle(http.MethodPost, "/api/v1/message/server/:id/reports/:reportId/resolve", openapi.Route{
+		Summary: "Resolve a report, removing leaves the message as a tombstone",
+		Tags:    []string{"moderation"},
+		Body:    models.ReportResolution{},
+		Roles:   []string{auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusNotFound:   v1Error,
+			http.StatusConflict:   v1Error,
+		},
+	}, handlers.moderation.ResolveReport)
+
+	routes.handle(http.MethodGet, "/api/v1/message/server/:id/moderation/audit", openapi.Route{
+		Summary: "Get the audit trail of every moderator action on a server, oldest first",
+		Tags:    []string{"moderation"},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.moderation.GetModerationAudit)
+
+	routes.handle(http.MethodGet, "/api/v1/message/retention", openapi.Route{
+		Summary: "List the retention rules of every server and channel",
+		Tags:    []string{"retention"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK: models.Response{},
+		},
+	}, handlers.retention.GetRetentionRules)
+
+	routes.handle(http.MethodGet, "/api/v1/message/retention/dry-run", openapi.Route{
+		Summary: "Report which messages a retention sweep would delete without deleting them",
+		Tags:    []string{"retention"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:       models.Response{},
+			http.StatusConflict: v1Error,
+		},
+	}, handlers.retention.DryRunRetention)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/retention", openapi.Route{
+		Summary: "Set how long and how many messages the channels of a server keep",
+		Tags:    []string{"retention"},
+		Body:    models.RetentionPolicy{},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusForbidden:  v1Error,
+		},
+	}, handlers.retention.SetServerRetention)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/server/:id/retention", openapi.Route{
+		Summary: "Keep the messages of a server forever",
+		Tags:    []string{"retention"},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:        models.Response{},
+			http.StatusForbidden: v1Error,
+		},
+	}, handlers.retention.DeleteServerRetention)
+
+	routes.handle(http.MethodPut, "/api/v1/message/server/:id/channel/:channelId/retention", openapi.Route{
+		Summary: "Set how long and how many messages a channel of the server keeps, replacing the rule of the server",
+		Tags:    []string{"retention"},
+		Body:    models.RetentionPolicy{},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:         models.Response{},
+			http.StatusBadRequest: v1Error,
+			http.StatusForbidden:  v1Error,
+		},
+	}, handlers.retention.SetChannelRetention)
+
+	routes.handle(http.MethodDelete, "/api/v1/message/server/:id/channel/:channelId/retention", openapi.Route{
+		Summary: "Remove the retention rule of a channel of the server so the rule of the server applies",
+		Tags:    []string{"retention"},
+		Roles:   []string{auth.RoleOwner, auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusOK:        models.Response{},
+			http.StatusForbidden: v1Error,
+		},
+	}, handlers.retention.DeleteChannelRetention)
+
+	routes.handle(http.MethodGet, "/api/v1/message/ws", openapi.Route{
+		Summary: "Open a WebSocket receiving the events of subscribed channels and servers",
+		Tags:    []string{"realtime"},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+		},
+		Responses: map[int]any{
+			http.StatusSwitchingProtocols: nil,
+			http.StatusUnauthorized:       v1Error,
+		},
+	}, handlers.realtime.Connect)
+
+	routes.handle(http.MethodGet, "/api/v1/message/channel/:id/stream", openapi.Route{
+		Summary: "Stream the events of a channel as Server-Sent Events, a resync event asks the client to reload the channel",
+		Tags:    []string{"realtime"},
+		Query: []openapi.Parameter{
+			openapi.Query("last_event_id", "string", "Resume after this event, for clients that cannot send Last-Event-ID"),
+		},
+		Headers: []openapi.Parameter{
+			openapi.Header(auth.UserIDHeader, "Authenticated user, set by the gateway"),
+			openapi.Header(auth.ServersHeader, "Comma separated servers the user is a member of, set by the gateway"),
+			openapi.Header(controllers.LastEventIDHeader, "Resume after this event"),
+		},
+		ContentType: "text/event-stream",
+		Responses: map[int]any{
+			http.StatusOK:                 "",
+			http.StatusBadRequest:         v1Error,
+			http.StatusUnauthorized:       v1Error,
+			http.StatusServiceUnavailable: v1Error,
+		},
+	}, handlers.realtime.StreamChannel)
+
+	// === API v2 ===
+	routes.handle(http.MethodPost, "/api/v2/message", openapi.Route{
+		Summary: "Send a message",
+		Tags:    []string{"messages v2"},
+		Headers: []openapi.Parameter{idempotencyKey},
+		Body:    models.Message{},
+		Responses: map[int]any{
+			http.StatusCreated:             models.DataResponse{},
+			http.StatusBadRequest:          v2Error,
+			http.StatusForbidden:           v2Error,
+			http.StatusConflict:            v2Error,
+			http.StatusUnprocessableEntity: v2Error,
+			http.StatusTooManyRequests:     v2Error,
+			http.StatusServiceUnavailable:  v2Error,
+		},
+	}, handlers.rateLimit.LimitMessagesV2, handlers.messageV2.SaveMessage)
+
+	routes.handle(http.MethodGet, "/api/v2/message/:id", openapi.Route{
+		Summary: "Get a message",
+		Tags:    []string{"messages v2"},
+		Responses: map[int]any{
+			http.StatusOK:       models.DataResponse{},
+			http.StatusNotFound: v2Error,
+		},
+	}, handlers.messageV2.GetMessageById)
+
+	routes.handle(http.MethodGet, "/api/v2/message/user/:id", openapi.Route{
+		Summary: "List the messages of a user",
+		Tags:    []string{"messages v2"},
+		Responses: map[int]any{
+			http.StatusOK:                 models.DataResponse{},
+			http.StatusServiceUnavailable: v2Error,
+		},
+	}, handlers.messageV2.GetMessagesByUserId)
+
+	routes.handle(http.MethodDelete, "/api/v2/message/user/:id", openapi.Route{
+		Summary: "Start a job deleting all messages of a user, the deletion job endpoint follows its progress",
+		Tags:    []string{"messages v2"},
+		Roles:   []string{auth.RoleAdmin},
+		Responses: map[int]any{
+			http.StatusAccepted:           models.DataResponse{},
+			http.StatusConflict:           v2Error,
+			http.StatusServiceUnavailable: v2Error,
+		},
+	}, handlers.messageV2.DeleteMessagesByUserId)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"discard/message-service/pkg/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// The API gateway authenticates callers and forwards who they are through
+// these headers. They must be stripped from any request coming from outside.
+const (
+	UserIDHeader  = "X-User-ID"
+	RolesHeader   = "X-User-Roles"
+	ServersHeader = "X-User-Servers"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleOwner     = "owner"
+)
+
+type Identity struct {
+	UserID  string
+	Roles   []string
+	Servers []string // servers the user is a member of
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func FromHeaders(header http.Header) Identity {
+	identity := Identity{
+		UserID:  strings.TrimSpace(header.Get(UserIDHeader)),
+		Servers: splitList(header.Get(ServersHeader)),
+	}
+	for _, role := range splitList(header.Get(RolesHeader)) {
+		identity.Roles = append(identity.Roles, strings.ToLower(role))
+	}
+	return identity
+}
+
+func FromContext(context *gin.Context) Identity {
+	return FromHeaders(context.Request.Header)
+}
+
+// FromIncomingContext reads the identity of a gRPC call, its metadata carries
+// the gateway headers with lower cased keys.
+func FromIncomingContext(ctx context.Context) Identity {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := make(http.Header, len(md))
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return FromHeaders(header)
+}
+
+func (identity Identity) Authenticated() bool {
+	return identity.UserID != ""
+}
+
+func (identity Identity) HasRole(roles ...string) bool {
+	for _, held := range identity.Roles {
+		for _, role := range roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanAccessServer reports whether the user may read the messages of a server.
+func (identity Identity) CanAccessServer(serverID string) bool {
+	if identity.HasRole(RoleAdmin) {
+		return true
+	}
+	for _, server := range identity.Servers {
+		if server == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// Reject replies to a caller RequireRole turns away with the status.
+type Reject func(context *gin.Context, status int, message string)
+
+// RequireRole only lets authenticated callers holding one of the given roles through.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return RequireRoleWith(rejectV1, roles...)
+}
+
+// RequireRoleWith is RequireRole for APIs with an error body of their own.
+func RequireRoleWith(reject Reject, roles ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		identity := FromContext(context)
+		if !identity.Authenticated() {
+			reject(context, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		if !identity.HasRole(roles...) {
+			reject(context, http.StatusForbidden, "Missing required role: "+strings.Join(roles, " or "))
+			return
+		}
+
+		context.Next()
+	}
+}
+
+func rejectV1(context *gin.Context, status int, message string) {
+	context.AbortWithStatusJSON(
+		status, models.Response{
+			Message:    message,
+			HttpStatus: status,
+			Success:    false,
+		})
+}
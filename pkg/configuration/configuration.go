@@ -1,8 +1,17 @@
 package configuration
 
+import "time"
+
 type Configuration struct {
-	DatabaseSettings DatabaseSettings
-	APISettings      APISettings
+	DatabaseSettings   DatabaseSettings
+	APISettings        APISettings
+	RateLimitSettings  RateLimitSettings
+	ExportSettings     ExportSettings
+	RetentionSettings  RetentionSettings
+	EncryptionSettings EncryptionSettings
+	PinSettings        PinSettings
+	SchedulerSettings  SchedulerSettings
+	DraftSettings      DraftSettings
 }
 
 type DatabaseSettings struct {
@@ -14,6 +23,48 @@ type DatabaseSettings struct {
 }
 
 type APISettings struct {
-	Address string
-	Port    string
+	Address         string
+	Port            string
+	GRPCPort        string
+	IdempotencyTTL  time.Duration // how long an Idempotency-Key is remembered
+	DocsEnabled     bool          // serve the Swagger UI next to the OpenAPI document
+	RealtimeHistory int           // events kept for clients resuming a realtime stream
+}
+
+// Defaults for servers without their own limits, rates are in messages per second
+type RateLimitSettings struct {
+	UserRate     float64 // per user within a server
+	UserBurst    int
+	ChannelRate  float64 // per channel, across all users
+	ChannelBurst int
+}
+
+type ExportSettings struct {
+	Directory  string        // where finished archives are kept
+	SigningKey string        // signs the download links
+	LinkTTL    time.Duration // how long a download link and its archive live
+}
+
+type RetentionSettings struct {
+	Interval  time.Duration // between two sweeps, zero disables the worker
+	BatchSize int           // messages deleted per batch, at most 100
+	DryRun    bool          // only report what the sweeps would delete
+}
+
+type EncryptionSettings struct {
+	MasterKeyFile   string // hex encoded key wrapping the data keys
+	CreateMasterKey bool   // create the key file when missing, for development only
+}
+
+type PinSettings struct {
+	DefaultLimit int // pins per channel unless the channel sets its own limit
+}
+
+type SchedulerSettings struct {
+	Interval time.Duration // between two looks for due messages, zero disables the scheduler
+	Lease    time.Duration // after which a message claimed by a stopped instance is sent by another
+}
+
+type DraftSettings struct {
+	TTL time.Duration // how long a draft is kept after its last edit
 }
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeletionHandler interface {
+	GetDeletionJob(*gin.Context)
+	ResumeDeletionJob(*gin.Context)
+	GetAudit(*gin.Context)
+	GetDeletionPolicy(*gin.Context)
+	SetDeletionPolicy(*gin.Context)
+}
+
+type deletionHandler struct {
+	deleter *deletion.Deleter
+}
+
+func NewDeletionHandler(deleter *deletion.Deleter) DeletionHandler {
+	return &deletionHandler{deleter: deleter}
+}
+
+func (handler *deletionHandler) GetDeletionJob(context *gin.Context) {
+	id := context.Param("id")
+
+	job, err := handler.deleter.GetJob(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such deletion job found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved deletion job with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       job,
+	})
+}
+
+func (handler *deletionHandler) ResumeDeletionJob(context *gin.Context) {
+	id := context.Param("id")
+
+	job, err := handler.deleter.StartResume(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to resume deletion job with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+				Data:       job,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully resumed deletion job with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       job,
+	})
+}
+
+func (handler *deletionHandler) GetAudit(context *gin.Context) {
+	log, err := handler.deleter.Audit()
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the deletion audit log: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the deletion audit log",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       log,
+	})
+}
+
+func (handler *deletionHandler) GetDeletionPolicy(context *gin.Context) {
+	id := context.Param("id")
+
+	strategy, err := handler.deleter.Policy(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the deletion policy of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the deletion policy of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       models.DeletionPolicy{Strategy: strategy},
+	})
+}
+
+func (handler *deletionHandler) SetDeletionPolicy(context *gin.Context) {
+	id := context.Param("id")
+
+	if !auth.FromContext(context).CanAccessServer(id) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of server: " + id,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	var policy models.DeletionPolicy
+	if err := context.ShouldBindJSON(&policy); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.deleter.SetPolicy(id, policy); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to set the deletion policy: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set the deletion policy of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       policy,
+	})
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/openapi"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8" />
+	<title>Discard message-service API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = () => {
+			window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+		};
+	</script>
+</body>
+</html>`
+
+type DocsHandler interface {
+	GetSpecification(*gin.Context)
+	GetDocs(*gin.Context)
+}
+
+type docsHandler struct {
+	document *openapi.Document
+}
+
+func NewDocsHandler(document *openapi.Document) DocsHandler {
+	return &docsHandler{document: document}
+}
+
+func (handler *docsHandler) GetSpecification(context *gin.Context) {
+	context.IndentedJSON(http.StatusOK, handler.document)
+}
+
+func (handler *docsHandler) GetDocs(context *gin.Context) {
+	context.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
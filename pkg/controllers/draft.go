@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/drafts"
+	"discard/message-service/pkg/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DraftHandler interface {
+	SaveDraft(*gin.Context)
+	GetDraft(*gin.Context)
+	DeleteDraft(*gin.Context)
+}
+
+type draftHandler struct {
+	drafts *drafts.Drafts
+}
+
+func NewDraftHandler(drafts *drafts.Drafts) DraftHandler {
+	return &draftHandler{drafts: drafts}
+}
+
+// SaveDraft stores the draft of the caller in a channel. An outdated edit is
+// refused with the draft that won, for the client to show instead.
+func (handler *draftHandler) SaveDraft(context *gin.Context) {
+	channelID := context.Param("channelId")
+	if !authenticated(context) {
+		return
+	}
+
+	var request models.DraftRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	draft, err := handler.drafts.Save(auth.FromContext(context).UserID, channelID, request)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to save the draft of channel " + channelID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+				Data:       draft,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully saved the draft of channel: " + channelID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       draft,
+	})
+}
+
+func (handler *draftHandler) GetDraft(context *gin.Context) {
+	channelID := context.Param("channelId")
+	if !authenticated(context) {
+		return
+	}
+
+	draft, err := handler.drafts.Get(auth.FromContext(context).UserID, channelID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the draft of channel " + channelID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the draft of channel: " + channelID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       draft,
+	})
+}
+
+func (handler *draftHandler) DeleteDraft(context *gin.Context) {
+	channelID := context.Param("channelId")
+	if !authenticated(context) {
+		return
+	}
+
+	var deletion models.DraftDeletion
+	if err := context.ShouldBindQuery(&deletion); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.drafts.Delete(auth.FromContext(context).UserID, channelID, deletion); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to delete the draft of channel " + channelID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully deleted the draft of channel: " + channelID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+	})
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/repository"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gocql/gocql"
+)
+
+// Stable error codes of API v2, clients are allowed to depend on these.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeContentRejected  = "content_rejected"
+	CodeRateLimited      = "rate_limited"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "discard/request_id"
+)
+
+// RequestID tags every request with an ID, reusing the one set by the gateway.
+func RequestID(context *gin.Context) {
+	id := context.GetHeader(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = gocql.TimeUUID().String()
+	}
+	context.Set(requestIDKey, id)
+	context.Header(RequestIDHeader, id)
+	context.Next()
+}
+
+func statusOf(err error) (int, string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, moderation.ErrRejected):
+		return http.StatusUnprocessableEntity, CodeContentRejected
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict, CodeConflict
+	case errors.Is(err, repository.ErrInvalidArgument):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable, CodeUnavailable
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+func abortWithCode(context *gin.Context, status int, code string, message string, details any) {
+	context.AbortWithStatusJSON(status, models.ErrorResponse{
+		Error: models.Error{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: context.GetString(requestIDKey),
+		},
+	})
+}
+
+// RejectV2 replies to the callers auth.RequireRoleWith turns away on API v2 routes.
+func RejectV2(context *gin.Context, status int, message string) {
+	code := CodeForbidden
+	if status == http.StatusUnauthorized {
+		code = CodeUnauthenticated
+	}
+	abortWithCode(context, status, code, message, nil)
+}
+
+func abortWithError(context *gin.Context, err error) {
+	status, code := statusOf(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = "Internal server error" // do not leak driver details
+	}
+	abortWithCode(context, status, code, message, nil)
+}
+
+// jsonPath turns the struct namespace of a validation error, e.g.
+// Message.UserID, into the JSON path the client sent, e.g. user_id.
+func jsonPath(target any, fieldError validator.FieldError) string {
+	current := reflect.TypeOf(target)
+	var path []string
+	for _, name := range strings.Split(fieldError.StructNamespace(), ".")[1:] {
+		for current.Kind() == reflect.Pointer || current.Kind() == reflect.Slice || current.Kind() == reflect.Map {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return fieldError.Field()
+		}
+
+		name, _, _ = strings.Cut(name, "[")
+		field, found := current.FieldByName(name)
+		if !found {
+			return fieldError.Field()
+		}
+
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "" {
+			tag = field.Name
+		}
+		path = append(path, tag)
+		current = field.Type
+	}
+	return strings.Join(path, ".")
+}
+
+// abortWithBindingError reports why binding the request into target failed.
+func abortWithBindingError(context *gin.Context, err error, target any) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		abortWithCode(context, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON data: "+err.Error(), nil)
+		return
+	}
+
+	details := make([]models.FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		details = append(details, models.FieldError{Field: jsonPath(target, fieldError), Rule: fieldError.Tag()})
+	}
+	abortWithCode(context, http.StatusBadRequest, CodeValidationFailed, "Request validation failed", details)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusOf(t *testing.T) {
+	for err, expected := range map[error]struct {
+		status int
+		code   string
+	}{
+		fmt.Errorf("%w: gone", repository.ErrNotFound):       {http.StatusNotFound, CodeNotFound},
+		fmt.Errorf("%w: spam", moderation.ErrRejected):       {http.StatusUnprocessableEntity, CodeContentRejected},
+		fmt.Errorf("%w: taken", repository.ErrConflict):      {http.StatusConflict, CodeConflict},
+		fmt.Errorf("%w: bad", repository.ErrInvalidArgument): {http.StatusBadRequest, CodeInvalidRequest},
+		fmt.Errorf("%w: timeout", repository.ErrUnavailable): {http.StatusServiceUnavailable, CodeUnavailable},
+		errors.New("no hosts available in the pool"):         {http.StatusInternalServerError, CodeInternal},
+	} {
+		status, code := statusOf(err)
+		assert.Equal(t, expected.status, status, err.Error())
+		assert.Equal(t, expected.code, code, err.Error())
+	}
+}
+
+func newTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID)
+	router.POST("/", handler)
+	return router
+}
+
+func send(router http.Handler, body string, header http.Header) (*httptest.ResponseRecorder, models.Error) {
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response models.ErrorResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response.Error
+}
+
+func TestRequestID(t *testing.T) {
+	router := newTestRouter(func(context *gin.Context) { abortWithError(context, repository.ErrNotFound) })
+
+	recorder, body := send(router, "{}", nil)
+	generated := recorder.Header().Get(RequestIDHeader)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, body.RequestID, "errors carry the ID of their request")
+
+	header := make(http.Header)
+	header.Set(RequestIDHeader, "from-the-gateway")
+	recorder, body = send(router, "{}", header)
+	assert.Equal(t, "from-the-gateway", recorder.Header().Get(RequestIDHeader))
+	assert.Equal(t, "from-the-gateway", body.RequestID)
+
+	header.Set(RequestIDHeader, strings.Repeat("x", 129))
+	recorder, _ = send(router, "{}", header)
+	assert.NotEqual(t, header.Get(RequestIDHeader), recorder.Header().Get(RequestIDHeader), "overlong IDs are replaced")
+}
+
+func TestInternalErrorsDoNotLeakDetails(t *testing.T) {
+	router := newTestRouter(func(context *gin.Context) { abortWithError(context, errors.New("no hosts available in the pool")) })
+
+	recorder, body := send(router, "{}", nil)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, CodeInternal, body.Code)
+	assert.Equal(t, "Internal server error", body.Message)
+}
+
+func TestBindingErrorsNameTheJSONFields(t *testing.T) {
+	router := newTestRouter(func(context *gin.Context) {
+		var message models.Message
+		if err := context.ShouldBindJSON(&message); err != nil {
+			abortWithBindingError(context, err, &message)
+		}
+	})
+
+	recorder, body := send(router, "{not json", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, CodeInvalidRequest, body.Code)
+
+	recorder, body = send(router, `{"server_id": "server", "message": "hi", "kind": "embed",
+		"embed": {"title": "news", "fields": [{"value": "no name"}]}}`, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, CodeValidationFailed, body.Code)
+	details, _ := json.Marshal(body.Details)
+	var fields []models.FieldError
+	assert.NoError(t, json.Unmarshal(details, &fields))
+	assert.ElementsMatch(t, []models.FieldError{
+		{Field: "user_id", Rule: "required"},
+		{Field: "embed.fields.name", Rule: "required"},
+	}, fields)
+}
+
+func TestRejectV2(t *testing.T) {
+	for status, code := range map[int]string{
+		http.StatusUnauthorized: CodeUnauthenticated,
+		http.StatusForbidden:    CodeForbidden,
+	} {
+		router := newTestRouter(func(context *gin.Context) { RejectV2(context, status, "turned away") })
+
+		recorder, body := send(router, "{}", nil)
+		assert.Equal(t, status, recorder.Code)
+		assert.Equal(t, code, body.Code)
+		assert.Equal(t, "turned away", body.Message)
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/export"
+	"discard/message-service/pkg/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler interface {
+	StartExport(*gin.Context)
+	GetExport(*gin.Context)
+	DownloadExport(*gin.Context)
+}
+
+type exportHandler struct {
+	exporter *export.Exporter
+}
+
+func NewExportHandler(exporter *export.Exporter) ExportHandler {
+	return &exportHandler{exporter: exporter}
+}
+
+func (handler *exportHandler) StartExport(context *gin.Context) {
+	id := context.Param("id")
+
+	started, err := handler.exporter.Start(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to start data export for user id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+	context.Header("Location", "/api/v1/message/export/"+started.ID)
+	context.IndentedJSON(http.StatusAccepted, models.Response{
+		Message:    "Started data export for user id: " + id,
+		HttpStatus: http.StatusAccepted,
+		Success:    true,
+		Data:       started,
+	})
+}
+
+func (handler *exportHandler) GetExport(context *gin.Context) {
+	id := context.Param("id")
+
+	found, err := handler.exporter.Get(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such export found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved export with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       found,
+	})
+}
+
+// DownloadExport serves an archive to whoever holds its signed link.
+func (handler *exportHandler) DownloadExport(context *gin.Context) {
+	id := context.Param("id")
+
+	path, err := handler.exporter.Open(id, context.Query("expires"), context.Query("signature"))
+	if err != nil {
+		status := http.StatusForbidden
+		if err == export.ErrNotFound {
+			status = http.StatusGone
+		}
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to download export with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.FileAttachment(path, "export-"+id+".zip")
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HoldHandler interface {
+	PlaceHold(*gin.Context)
+	GetHolds(*gin.Context)
+	GetHold(*gin.Context)
+	ReleaseHold(*gin.Context)
+}
+
+type holdHandler struct {
+	holds *legalhold.Holds
+}
+
+func NewHoldHandler(holds *legalhold.Holds) HoldHandler {
+	return &holdHandler{holds: holds}
+}
+
+func (handler *holdHandler) PlaceHold(context *gin.Context) {
+	var request models.HoldRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	hold, err := handler.holds.Place(request, auth.FromContext(context).UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to place the legal hold: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.Header("Location", "/api/v1/message/hold/"+hold.ID)
+	context.IndentedJSON(http.StatusCreated, models.Response{
+		Message:    "Successfully placed a legal hold on " + hold.Scope + ": " + hold.TargetID,
+		HttpStatus: http.StatusCreated,
+		Success:    true,
+		Data:       hold,
+	})
+}
+
+func (handler *holdHandler) GetHolds(context *gin.Context) {
+	holds, err := handler.holds.List()
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the legal holds: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the legal holds",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       holds,
+	})
+}
+
+func (handler *holdHandler) GetHold(context *gin.Context) {
+	id := context.Param("id")
+
+	hold, err := handler.holds.Get(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such legal hold found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved legal hold with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       hold,
+	})
+}
+
+// ReleaseHold lifts a hold, the deletions it deferred are retried afterwards.
+func (handler *holdHandler) ReleaseHold(context *gin.Context) {
+	id := context.Param("id")
+
+	hold, err := handler.holds.Release(id, auth.FromContext(context).UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to release legal hold with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully released legal hold with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       hold,
+	})
+}
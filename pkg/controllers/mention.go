@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/mentions"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MentionHandler interface {
+	GetMentions(*gin.Context)
+}
+
+type mentionHandler struct {
+	inbox *mentions.Inbox
+}
+
+func NewMentionHandler(inbox *mentions.Inbox) MentionHandler {
+	return &mentionHandler{inbox: inbox}
+}
+
+// GetMentions pages through the recent mentions of the caller, admins can
+// read those of any user.
+func (handler *mentionHandler) GetMentions(context *gin.Context) {
+	id := context.Param("userId")
+	identity := auth.FromContext(context)
+	if !authenticated(context) {
+		return
+	}
+	if identity.UserID != id && !identity.HasRole(auth.RoleAdmin) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not allowed to read the mentions of user: " + id,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	var page models.Page
+	err := context.ShouldBindQuery(&page)
+	for _, cursor := range []string{page.Before, page.After} {
+		if err == nil && cursor != "" && !timeuuid.Valid(cursor) {
+			err = errInvalidCursor
+		}
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	mentioned, err := handler.inbox.Mentions(id, page, identity.CanAccessServer)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the mentions of user " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the mentions of user: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       mentioned,
+	})
+}
@@ -1,27 +1,251 @@
 package controllers
 
 import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/embeds"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/markdown"
+	"discard/message-service/pkg/mentions"
+	"discard/message-service/pkg/messaging"
 	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/polls"
 	"discard/message-service/pkg/repository"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/gocql/gocql"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maximumIdempotencyKeySize = 255
+	// how long a key stays claimed while its message is being saved, a crash
+	// in between blocks retries only this long
+	idempotencyClaimTTL = 30 * time.Second
+)
+
+var (
+	errIdempotencyKeyTooLong = fmt.Errorf("%w: idempotency key is too long", repository.ErrInvalidArgument)
+	errIdempotencyInProgress = fmt.Errorf("%w: a request with this idempotency key is still being processed", repository.ErrConflict)
+	errSystemMessage         = fmt.Errorf("%w: system messages are only written by the service", repository.ErrInvalidArgument)
 )
 
 type MessageHandler interface {
 	SaveMessage(*gin.Context)
 	GetMessageById(*gin.Context)
 	GetMessagesByUserId(*gin.Context)
+	GetMessagesByChannelId(*gin.Context)
+	GetMessageContext(*gin.Context)
+	DeleteMessage(*gin.Context)
 	DeleteMessagesByUserId(*gin.Context)
 }
 
 type messageHandler struct {
-	repository repository.MessageRepository
+	repository     repository.MessageRepository
+	idempotency    repository.IdempotencyRepository
+	idempotencyTTL time.Duration
+	publisher      events.Publisher
+	deleter        *deletion.Deleter
+	moderator      *moderation.Moderator
+	polls          *polls.Polls
+}
+
+type MessageHandlerOption func(*messageHandler)
+
+// WithIdempotency makes retries carrying the same Idempotency-Key header or
+// client_nonce return the message created by the first attempt.
+func WithIdempotency(idempotency *repository.IdempotencyRepository, ttl time.Duration) MessageHandlerOption {
+	return func(handler *messageHandler) {
+		handler.idempotency = *idempotency
+		handler.idempotencyTTL = ttl
+	}
+}
+
+// WithPublisher announces every message written through the handler.
+func WithPublisher(publisher events.Publisher) MessageHandlerOption {
+	return func(handler *messageHandler) {
+		handler.publisher = publisher
+	}
+}
+
+// WithDeleter runs user deletions as tracked jobs of deleter. Without it the
+// jobs are only kept in memory.
+func WithDeleter(deleter *deletion.Deleter) MessageHandlerOption {
+	return func(handler *messageHandler) {
+		handler.deleter = deleter
+	}
+}
+
+// WithModerator applies the moderation rules of their server to new messages.
+func WithModerator(moderator *moderation.Moderator) MessageHandlerOption {
+	return func(handler *messageHandler) {
+		handler.moderator = moderator
+	}
+}
+
+// WithPolls tallies the votes of the polls among the messages read.
+func WithPolls(polls *polls.Polls) MessageHandlerOption {
+	return func(handler *messageHandler) {
+		handler.polls = polls
+	}
+}
+
+func NewMessageHandler(repository *repository.MessageRepository, options ...MessageHandlerOption) MessageHandler {
+	handler := &messageHandler{repository: *repository, publisher: events.Publishers{}}
+	for _, option := range options {
+		option(handler)
+	}
+	if handler.deleter == nil {
+		handler.deleter = inMemoryDeleter(repository, handler.publisher)
+	}
+	return handler
+}
+
+// NewMessageSender sends messages the way SaveMessage does, for senders
+// within the service. Calls repeating a key return the message of the first.
+func NewMessageSender(repository *repository.MessageRepository, options ...MessageHandlerOption) func(string, models.Message) (*models.Message, error) {
+	handler := NewMessageHandler(repository, options...).(*messageHandler)
+	return func(key string, message models.Message) (*models.Message, error) {
+		response, _, err := handler.create(key, message)
+		return response, err
+	}
+}
+
+func inMemoryDeleter(messages *repository.MessageRepository, publisher events.Publisher) *deletion.Deleter {
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	keyring := encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider())
+	return deletion.NewDeleter(messages, &jobs, legalhold.NewHolds(&holds), keyring, publisher, messaging.NewAMQPPublisher())
+}
+
+// tally fills in the votes of the polls among the messages.
+func (handler *messageHandler) tally(messages ...*models.Message) error {
+	if handler.polls == nil {
+		return nil
+	}
+	return handler.polls.Tally(messages...)
+}
+
+// idempotencyKey scopes the client provided key to the author so keys of
+// different users can never collide.
+func idempotencyKey(key string, message models.Message) string {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		key = strings.TrimSpace(message.ClientNonce)
+	}
+	if key == "" {
+		return ""
+	}
+	return message.UserID + ":" + key
+}
+
+// create saves the message, or returns the message created by an earlier
+// request with the same idempotency key with replayed set.
+func (handler *messageHandler) create(clientKey string, message models.Message) (*models.Message, bool, error) {
+	message.ID = "" // never trust a client provided ID
+	if message.Kind == models.KindSystem || message.System != nil {
+		return nil, false, errSystemMessage
+	}
+	if err := polls.Prepare(&message, time.Now().UTC()); err != nil {
+		return nil, false, err
+	}
+	if err := embeds.Prepare(&message); err != nil {
+		return nil, false, err
+	}
+
+	verdict := moderation.Verdict{Action: models.ModerationAllow, Content: message.Message}
+	if handler.moderator != nil {
+		var err error
+		if verdict, err = handler.moderator.Check(message); err != nil {
+			return nil, false, err
+		}
+		verdict.Apply(&message)
+	}
+	message.Mentions = mentions.Parse(message.Message)
+	nodes, err := markdown.Parse(message.Message)
+	if err != nil {
+		return nil, false, err
+	}
+	message.Markdown = nodes
+
+	key := ""
+	if handler.idempotency != nil {
+		key = idempotencyKey(clientKey, message)
+	}
+	if len(key) > maximumIdempotencyKeySize {
+		return nil, false, errIdempotencyKeyTooLong
+	}
+	message.ClientNonce = ""
+	return handler.store(key, message, verdict)
 }
 
-func NewMessageHandler(repository *repository.MessageRepository) MessageHandler {
-	return &messageHandler{repository: *repository}
+// store saves the message once per idempotency key, a repeated key returns
+// the message saved first with replayed set. Without a key it always saves.
+func (handler *messageHandler) store(key string, message models.Message, verdict moderation.Verdict) (*models.Message, bool, error) {
+	if key == "" || handler.idempotency == nil {
+		response, err := handler.save(message, verdict)
+		return response, false, err
+	}
+
+	message.ID = gocql.TimeUUID().String()
+	existingID, claimed, err := handler.idempotency.Claim(key, message.ID, min(idempotencyClaimTTL, handler.idempotencyTTL))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !claimed {
+		original, err := handler.repository.GetById(existingID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, false, errIdempotencyInProgress
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return original, true, nil
+	}
+
+	response, err := handler.save(message, verdict)
+	if err != nil {
+		handler.idempotency.Release(key, message.ID) // let the client retry
+		return nil, false, err
+	}
+	if err := handler.idempotency.Confirm(key, message.ID, handler.idempotencyTTL); err != nil {
+		logger.WARN.Printf("Failed to keep idempotency key %v of message %v: %v\n", key, message.ID, err)
+	}
+	return response, false, nil
+}
+
+// save stores a new message, announces it and queues it for review if it was flagged.
+func (handler *messageHandler) save(message models.Message, verdict moderation.Verdict) (*models.Message, error) {
+	response, err := handler.repository.Save(message)
+	if err != nil {
+		return nil, err
+	}
+	handler.publisher.Publish(events.New(events.MessageCreated, *response))
+
+	if handler.moderator != nil {
+		if err := handler.moderator.Flag(*response, verdict); err != nil {
+			logger.WARN.Printf("Failed to queue flagged message %v for review: %v\n", response.ID, err)
+		}
+	}
+	return response, nil
+}
+
+// deleteAllByUserId starts a tracked job deleting the messages of a user.
+func (handler *messageHandler) deleteAllByUserId(userID string) (models.DeletionJob, error) {
+	return handler.deleter.Start(userID)
 }
 
 func (handler *messageHandler) SaveMessage(context *gin.Context) {
@@ -36,17 +260,24 @@ func (handler *messageHandler) SaveMessage(context *gin.Context) {
 		return
 	}
 
-	response, err := handler.repository.Save(message)
+	response, replayed, err := handler.create(context.GetHeader(IdempotencyKeyHeader), message)
 	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, repository.ErrConflict) {
+			status = http.StatusConflict
+		}
 		context.AbortWithStatusJSON(
-			http.StatusBadRequest, models.Response{
+			status, models.Response{
 				Message:    "Not able to send message: " + err.Error(),
-				HttpStatus: http.StatusBadRequest,
+				HttpStatus: status,
 				Success:    false,
 			})
 		return
 	}
 
+	if replayed {
+		context.Header(IdempotentReplayedHeader, "true")
+	}
 	context.IndentedJSON(http.StatusCreated, models.Response{
 		Message:    "Successfully sent message: " + response.ID,
 		HttpStatus: http.StatusCreated,
@@ -58,6 +289,9 @@ func (handler *messageHandler) GetMessageById(context *gin.Context) {
 	id := context.Param("id")
 
 	message, err := handler.repository.GetById(id)
+	if err == nil {
+		err = handler.tally(message)
+	}
 	if err != nil {
 		context.AbortWithStatusJSON(
 			http.StatusNotFound, models.Response{
@@ -80,6 +314,9 @@ func (handler *messageHandler) GetMessagesByUserId(context *gin.Context) {
 	id := context.Param("id")
 
 	messages, err := handler.repository.GetAllByUserId(id)
+	if err == nil {
+		err = handler.tally(messages...)
+	}
 	if err != nil {
 		context.AbortWithStatusJSON(
 			http.StatusNotFound, models.Response{
@@ -107,10 +344,206 @@ func (handler *messageHandler) GetMessagesByUserId(context *gin.Context) {
 	})
 }
 
+func (handler *messageHandler) GetMessagesByChannelId(context *gin.Context) {
+	id := context.Param("id")
+
+	var page models.Page
+	if err := context.ShouldBindQuery(&page); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	messages, err := handler.repository.GetAllByChannelId(id, page)
+	if err == nil {
+		err = handler.tally(messages...)
+	}
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve messages with channel id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.Message{}
+	}
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved messages with channel id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       messages,
+	})
+}
+
+// messageContext returns the message with up to before older and after newer
+// messages of its channel.
+func (handler *messageHandler) messageContext(message *models.Message, before int, after int) (*models.MessageContext, error) {
+	id := message.ID
+	window := &models.MessageContext{Messages: []*models.Message{message}}
+	if message.ChannelID == "" { // stored before messages had channels
+		return window, nil
+	}
+
+	// ask for one more message each way to know whether the window ends there
+	older, err := handler.repository.GetAllByChannelId(message.ChannelID, models.Page{Before: id, Limit: before + 1})
+	if err != nil {
+		return nil, err
+	}
+	newer, err := handler.repository.GetAllByChannelId(message.ChannelID, models.Page{After: id, Limit: after + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(older) > before {
+		older = older[len(older)-before:]
+		window.Before = message.ID
+		if len(older) > 0 {
+			window.Before = older[0].ID
+		}
+	}
+	if len(newer) > after {
+		newer = newer[:after]
+		window.After = message.ID
+		if len(newer) > 0 {
+			window.After = newer[len(newer)-1].ID
+		}
+	}
+
+	window.Messages = append(append(older, message), newer...)
+	return window, handler.tally(window.Messages...)
+}
+
+// GetMessageContext only shows the neighbours of messages of servers the
+// caller is a member of.
+func (handler *messageHandler) GetMessageContext(context *gin.Context) {
+	id := context.Param("id")
+	if !authenticated(context) {
+		return
+	}
+
+	var query models.ContextQuery
+	if err := context.ShouldBindQuery(&query); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	message, err := handler.repository.GetById(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such message found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+	if !auth.FromContext(context).CanAccessServer(message.ServerID) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of the server of message with id: " + id,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	window, err := handler.messageContext(message, query.Before, query.After)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the context of message with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the context of message with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       window,
+	})
+}
+
+// DeleteMessage lets authors delete their own messages and moderators any
+// message of their servers. Messages under a legal hold are only deleted
+// once the hold is released.
+func (handler *messageHandler) DeleteMessage(context *gin.Context) {
+	id := context.Param("id")
+	identity := auth.FromContext(context)
+
+	message, err := handler.repository.GetById(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such message found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	moderates := identity.HasRole(auth.RoleModerator, auth.RoleOwner, auth.RoleAdmin) && identity.CanAccessServer(message.ServerID)
+	if !identity.Authenticated() || (message.UserID != identity.UserID && !moderates) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not allowed to delete message with id: " + id,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	deferred, err := handler.deleter.DeleteMessage(*message, identity.UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to delete message with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	if deferred {
+		context.IndentedJSON(http.StatusAccepted, models.Response{
+			Message:    "Deletion of message with id " + id + " is deferred",
+			HttpStatus: http.StatusAccepted,
+			Success:    true,
+		})
+		return
+	}
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully deleted message with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+	})
+}
+
 func (handler *messageHandler) DeleteMessagesByUserId(context *gin.Context) {
 	id := context.Param("id")
 
-	err := handler.repository.DeleteAllByUserId(id)
+	// v1 keeps its original responses, the job is only exposed by v2 and the deletion endpoints
+	_, err := handler.deleteAllByUserId(id)
 	if err != nil {
 		context.AbortWithStatusJSON(
 			http.StatusNotFound, models.Response{
@@ -122,7 +555,7 @@ func (handler *messageHandler) DeleteMessagesByUserId(context *gin.Context) {
 	}
 
 	context.IndentedJSON(http.StatusOK, models.Response{
-		Message:    "Successfully deleted messages with user id: " + id,
+		Message:    "Started deleting messages with user id: " + id,
 		HttpStatus: http.StatusOK,
 		Success:    true,
 	})
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/proto/messagepb"
+	"discard/message-service/pkg/ratelimit"
+	"discard/message-service/pkg/realtime"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/timeuuid"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// messageServer serves the operations of MessageHandler over gRPC.
+type messageServer struct {
+	messagepb.UnimplementedMessageServiceServer
+	*messageHandler
+	hub     *realtime.Hub
+	limiter *ratelimit.Limiter
+}
+
+// NewMessageServer serves the message API over gRPC, its calls are
+// authenticated by AuthenticateUnary and limited like the REST API.
+func NewMessageServer(repository *repository.MessageRepository, hub *realtime.Hub, limiter *ratelimit.Limiter,
+	options ...MessageHandlerOption) messagepb.MessageServiceServer {
+	return &messageServer{
+		messageHandler: NewMessageHandler(repository, options...).(*messageHandler),
+		hub:            hub,
+		limiter:        limiter,
+	}
+}
+
+type identityKey struct{}
+
+// grpcRoles are the roles the calls of the message service need, the other
+// calls only need an authenticated caller.
+var grpcRoles = map[string][]string{
+	messagepb.MessageService_DeleteByUser_FullMethodName: {auth.RoleAdmin},
+}
+
+// AuthenticateUnary is the auth layer of the unary calls of the message
+// service, the gateway forwards who the caller is as metadata like it does
+// with the headers of REST requests. Health and reflection stay open.
+func AuthenticateUnary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !strings.HasPrefix(info.FullMethod, "/"+messagepb.MessageService_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, request)
+	}
+
+	identity := auth.FromIncomingContext(ctx)
+	if !identity.Authenticated() {
+		return nil, status.Error(codes.Unauthenticated, "Authentication required")
+	}
+	if roles, found := grpcRoles[info.FullMethod]; found && !identity.HasRole(roles...) {
+		return nil, status.Error(codes.PermissionDenied, "Missing required role: "+strings.Join(roles, " or "))
+	}
+	return handler(context.WithValue(ctx, identityKey{}, identity), request)
+}
+
+// identityOf returns the caller authenticated by AuthenticateUnary.
+func identityOf(ctx context.Context) auth.Identity {
+	identity, _ := ctx.Value(identityKey{}).(auth.Identity)
+	return identity
+}
+
+// accessible keeps the messages of the servers the caller is a member of.
+func accessible(identity auth.Identity, messages []*models.Message) []*models.Message {
+	kept := make([]*models.Message, 0, len(messages))
+	for _, message := range messages {
+		if identity.CanAccessServer(message.ServerID) {
+			kept = append(kept, message)
+		}
+	}
+	return kept
+}
+
+func toProto(message *models.Message) *messagepb.Message {
+	return &messagepb.Message{
+		Id:        message.ID,
+		UserId:    message.UserID,
+		ServerId:  message.ServerID,
+		ChannelId: message.ChannelID,
+		Message:   message.Message,
+	}
+}
+
+func toProtoList(messages []*models.Message) *messagepb.ListResponse {
+	response := &messagepb.ListResponse{Messages: make([]*messagepb.Message, 0, len(messages))}
+	for _, message := range messages {
+		response.Messages = append(response.Messages, toProto(message))
+	}
+	return response
+}
+
+func toProtoEvent(event events.Event) *messagepb.Event {
+	return &messagepb.Event{
+		Id:        event.ID,
+		Type:      string(event.Type),
+		Message:   toProto(&event.Message),
+		Timestamp: timestamppb.New(event.Timestamp),
+	}
+}
+
+// grpcError maps repository errors onto gRPC status codes.
+func grpcError(err error) error {
+	httpStatus, _ := statusOf(err)
+	switch httpStatus {
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case http.StatusConflict:
+		return status.Error(codes.Aborted, err.Error())
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		// rejected content is the request's fault, permission denied is kept for auth failures
+		return status.Error(codes.InvalidArgument, err.Error())
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, "Internal server error") // do not leak driver details
+}
+
+// validationError applies the binding rules of the REST API to message.
+func validationError(message *models.Message) error {
+	err := binding.Validator.ValidateStruct(message)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	fields := make([]string, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields = append(fields, jsonPath(message, fieldError)+" ("+fieldError.Tag()+")")
+	}
+	return status.Error(codes.InvalidArgument, "Request validation failed: "+strings.Join(fields, ", "))
+}
+
+func (server *messageServer) Save(ctx context.Context, request *messagepb.SaveRequest) (*messagepb.SaveResponse, error) {
+	message := models.Message{
+		UserID:    request.GetMessage().GetUserId(),
+		ServerID:  request.GetMessage().GetServerId(),
+		ChannelID: request.GetMessage().GetChannelId(),
+		Message:   request.GetMessage().GetMessage(),
+	}
+	if err := validationError(&message); err != nil {
+		return nil, err
+	}
+
+	identity := identityOf(ctx)
+	if message.UserID != identity.UserID && !identity.HasRole(auth.RoleAdmin) {
+		return nil, status.Error(codes.PermissionDenied, "Messages can only be sent as the authenticated user")
+	}
+	if !identity.CanAccessServer(message.ServerID) {
+		return nil, status.Error(codes.PermissionDenied, "Not a member of server: "+message.ServerID)
+	}
+	if seconds := limitMessage(server.limiter, identity, message); seconds > 0 {
+		return nil, status.Errorf(codes.ResourceExhausted, "Too many messages, retry in %d seconds", seconds)
+	}
+
+	response, replayed, err := server.create(request.GetIdempotencyKey(), message)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &messagepb.SaveResponse{Message: toProto(response), Replayed: replayed}, nil
+}
+
+func (server *messageServer) GetById(ctx context.Context, request *messagepb.GetByIdRequest) (*messagepb.Message, error) {
+	message, err := server.repository.GetById(request.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if !identityOf(ctx).CanAccessServer(message.ServerID) {
+		return nil, status.Error(codes.PermissionDenied, "Not a member of server: "+message.ServerID)
+	}
+	return toProto(message), nil
+}
+
+func (server *messageServer) ListByUser(ctx context.Context, request *messagepb.ListByUserRequest) (*messagepb.ListResponse, error) {
+	messages, err := server.repository.GetAllByUserId(request.GetUserId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoList(accessible(identityOf(ctx), messages)), nil
+}
+
+func (server *messageServer) ListByChannel(ctx context.Context, request *messagepb.ListByChannelRequest) (*messagepb.ListResponse, error) {
+	messages, err := server.repository.GetAllByChannelId(request.GetChannelId(), models.Page{
+		Before: request.GetBefore(),
+		After:  request.GetAfter(),
+		Limit:  int(request.GetLimit()),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoList(accessible(identityOf(ctx), messages)), nil
+}
+
+func (server *messageServer) DeleteByUser(ctx context.Context, request *messagepb.DeleteByUserRequest) (*messagepb.DeleteByUserResponse, error) {
+	job, err := server.deleteAllByUserId(request.GetUserId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &messagepb.DeleteByUserResponse{JobId: job.ID, Deleted: int32(job.Deleted), Status: job.Status}, nil
+}
+
+func (server *messageServer) WatchChannel(request *messagepb.WatchChannelRequest, stream messagepb.MessageService_WatchChannelServer) error {
+	identity, err := watchIdentity(stream.Context(), request.GetCursor())
+	if err != nil {
+		return err
+	}
+
+	subscription := server.hub.Subscribe(subscriptionBuffer)
+	defer server.hub.Unsubscribe(subscription)
+
+	// like the SSE stream, replay from the channel history what the hub no longer buffers
+	replayed := ""
+	if !server.hub.Follow(subscription, []string{request.GetChannelId()}, nil, request.GetCursor()) {
+		history := &channelHistory{messages: server.repository, channelID: request.GetChannelId(), after: request.GetCursor()}
+		for {
+			page, err := history.next()
+			if errors.Is(err, errResync) {
+				return status.Error(codes.OutOfRange, err.Error()+" and watch without a cursor")
+			}
+			if err != nil {
+				return grpcError(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, message := range page {
+				if !identity.CanAccessServer(message.ServerID) {
+					continue
+				}
+				if err := stream.Send(toProtoEvent(events.New(events.MessageCreated, *message))); err != nil {
+					return err
+				}
+			}
+			replayed = history.after
+		}
+	}
+
+	return server.watch(stream.Context(), identity, subscription, replayed, stream.Send)
+}
+
+func (server *messageServer) WatchServer(request *messagepb.WatchServerRequest, stream messagepb.MessageService_WatchServerServer) error {
+	identity, err := watchIdentity(stream.Context(), request.GetCursor())
+	if err != nil {
+		return err
+	}
+	if !identity.CanAccessServer(request.GetServerId()) {
+		return status.Error(codes.PermissionDenied, "Not a member of server: "+request.GetServerId())
+	}
+
+	subscription := server.hub.Subscribe(subscriptionBuffer)
+	defer server.hub.Unsubscribe(subscription)
+
+	if !server.hub.Follow(subscription, nil, []string{request.GetServerId()}, request.GetCursor()) {
+		return status.Error(codes.OutOfRange, "Events after the cursor are no longer available, watch without a cursor")
+	}
+	return server.watch(stream.Context(), identity, subscription, "", stream.Send)
+}
+
+func watchIdentity(ctx context.Context, cursor string) (auth.Identity, error) {
+	identity := auth.FromIncomingContext(ctx)
+	if !identity.Authenticated() {
+		return identity, status.Error(codes.Unauthenticated, "Authentication required")
+	}
+	if cursor != "" && !timeuuid.Valid(cursor) {
+		return identity, status.Error(codes.InvalidArgument, "Invalid cursor: "+cursor)
+	}
+	return identity, nil
+}
+
+// watch sends the events of the subscription until the client goes away.
+// Created messages up to replayed were already sent from the history.
+func (server *messageServer) watch(ctx context.Context, identity auth.Identity, subscription *realtime.Subscription,
+	replayed string, send func(*messagepb.Event) error) error {
+	for {
+		select {
+		case event := <-subscription.Events():
+			if !identity.CanAccessServer(event.Message.ServerID) {
+				continue
+			}
+			if event.Type == events.MessageCreated && replayed != "" && timeuuid.Compare(event.ID, replayed) <= 0 {
+				continue
+			}
+			if err := send(toProtoEvent(event)); err != nil {
+				return err
+			}
+
+		case <-subscription.Done():
+			return status.Error(codes.Unavailable, "Too slow, resume from the last event")
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
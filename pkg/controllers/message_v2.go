@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MessageHandlerV2 serves the same operations as MessageHandler with correct
+// status codes and the models.ErrorResponse schema.
+type MessageHandlerV2 interface {
+	SaveMessage(*gin.Context)
+	GetMessageById(*gin.Context)
+	GetMessagesByUserId(*gin.Context)
+	DeleteMessagesByUserId(*gin.Context)
+}
+
+type messageHandlerV2 struct {
+	*messageHandler
+}
+
+func NewMessageHandlerV2(repository *repository.MessageRepository, options ...MessageHandlerOption) MessageHandlerV2 {
+	return &messageHandlerV2{NewMessageHandler(repository, options...).(*messageHandler)}
+}
+
+func (handler *messageHandlerV2) SaveMessage(context *gin.Context) {
+	var message models.Message
+	if err := context.ShouldBindBodyWith(&message, binding.JSON); err != nil {
+		abortWithBindingError(context, err, &message)
+		return
+	}
+
+	response, replayed, err := handler.create(context.GetHeader(IdempotencyKeyHeader), message)
+	if err != nil {
+		abortWithError(context, err)
+		return
+	}
+
+	if replayed {
+		context.Header(IdempotentReplayedHeader, "true")
+	}
+	context.Header("Location", "/api/v2/message/"+response.ID)
+	context.IndentedJSON(http.StatusCreated, models.DataResponse{Data: response})
+}
+
+func (handler *messageHandlerV2) GetMessageById(context *gin.Context) {
+	message, err := handler.repository.GetById(context.Param("id"))
+	if err == nil {
+		err = handler.tally(message)
+	}
+	if err != nil {
+		abortWithError(context, err)
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.DataResponse{Data: message})
+}
+
+func (handler *messageHandlerV2) GetMessagesByUserId(context *gin.Context) {
+	messages, err := handler.repository.GetAllByUserId(context.Param("id"))
+	if err == nil {
+		err = handler.tally(messages...)
+	}
+	if err != nil {
+		abortWithError(context, err)
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.Message{}
+	}
+	context.IndentedJSON(http.StatusOK, models.DataResponse{Data: messages})
+}
+
+func (handler *messageHandlerV2) DeleteMessagesByUserId(context *gin.Context) {
+	job, err := handler.deleteAllByUserId(context.Param("id"))
+	if err != nil {
+		abortWithError(context, err)
+		return
+	}
+
+	context.Header("Location", "/api/v1/message/deletion/"+job.ID)
+	context.IndentedJSON(http.StatusAccepted, models.DataResponse{Data: job})
+}
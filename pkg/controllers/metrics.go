@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/metrics"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler interface {
+	GetMetrics(*gin.Context)
+}
+
+type metricsHandler struct {
+	registry *metrics.Registry
+}
+
+func NewMetricsHandler(registry *metrics.Registry) MetricsHandler {
+	return &metricsHandler{registry: registry}
+}
+
+func (handler *metricsHandler) GetMetrics(context *gin.Context) {
+	context.Status(http.StatusOK)
+	context.Header("Content-Type", metrics.ContentType)
+	handler.registry.Write(context.Writer)
+}
@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ModerationHandler interface {
+	GetModerationRules(*gin.Context)
+	SetModerationRules(*gin.Context)
+	GetFlaggedMessages(*gin.Context)
+	DismissFlaggedMessage(*gin.Context)
+	ReportMessage(*gin.Context)
+	GetReports(*gin.Context)
+	ClaimReport(*gin.Context)
+	ResolveReport(*gin.Context)
+	GetModerationAudit(*gin.Context)
+}
+
+type moderationHandler struct {
+	moderator *moderation.Moderator
+	messages  repository.MessageRepository
+}
+
+func NewModerationHandler(moderator *moderation.Moderator, messages *repository.MessageRepository) ModerationHandler {
+	return &moderationHandler{moderator: moderator, messages: *messages}
+}
+
+// serverAccess aborts unless the caller is a member of the server in the path.
+func serverAccess(context *gin.Context) bool {
+	if auth.FromContext(context).CanAccessServer(context.Param("id")) {
+		return true
+	}
+	context.AbortWithStatusJSON(
+		http.StatusForbidden, models.Response{
+			Message:    "Not a member of server: " + context.Param("id"),
+			HttpStatus: http.StatusForbidden,
+			Success:    false,
+		})
+	return false
+}
+
+func (handler *moderationHandler) GetModerationRules(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	rules, err := handler.moderator.Rules(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the moderation rules of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the moderation rules of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       rules,
+	})
+}
+
+func (handler *moderationHandler) SetModerationRules(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	var rules models.ModerationRules
+	if err := context.ShouldBindJSON(&rules); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.moderator.SetRules(id, rules, auth.FromContext(context).UserID); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to set the moderation rules: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set the moderation rules of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       rules,
+	})
+}
+
+func (handler *moderationHandler) GetFlaggedMessages(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	queue, err := handler.moderator.Flagged(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the flagged messages of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the flagged messages of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       queue,
+	})
+}
+
+func (handler *moderationHandler) DismissFlaggedMessage(context *gin.Context) {
+	id := context.Param("id")
+	messageID := context.Param("messageId")
+	if !serverAccess(context) {
+		return
+	}
+
+	if err := handler.moderator.Dismiss(id, messageID, auth.FromContext(context).UserID); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to dismiss flagged message " + messageID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully dismissed flagged message: " + messageID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+	})
+}
+
+// ReportMessage lets members of its server report a message to its moderators.
+func (handler *moderationHandler) ReportMessage(context *gin.Context) {
+	id := context.Param("id")
+	identity := auth.FromContext(context)
+
+	var request models.ReportRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	message, err := handler.messages.GetById(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such message found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	if !identity.Authenticated() || !identity.CanAccessServer(message.ServerID) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not allowed to report message with id: " + id,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	report, err := handler.moderator.Report(*message, identity.UserID, request)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to report message with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusCreated, models.Response{
+		Message:    "Successfully reported message with id: " + id,
+		HttpStatus: http.StatusCreated,
+		Success:    true,
+		Data:       report,
+	})
+}
+
+func (handler *moderationHandler) GetReports(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	var query models.ReportQuery
+	if err := context.ShouldBindQuery(&query); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	reports, err := handler.moderator.Reports(id, query.Status)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the reports of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the reports of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       reports,
+	})
+}
+
+func (handler *moderationHandler) ClaimReport(context *gin.Context) {
+	id := context.Param("id")
+	reportID := context.Param("reportId")
+	if !serverAccess(context) {
+		return
+	}
+
+	report, err := handler.moderator.Claim(id, reportID, auth.FromContext(context).UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to claim report " + reportID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully claimed report: " + reportID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       report,
+	})
+}
+
+func (handler *moderationHandler) ResolveReport(context *gin.Context) {
+	id := context.Param("id")
+	reportID := context.Param("reportId")
+	if !serverAccess(context) {
+		return
+	}
+
+	var resolution models.ReportResolution
+	if err := context.ShouldBindJSON(&resolution); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	report, err := handler.moderator.Resolve(id, reportID, auth.FromContext(context).UserID, resolution)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to resolve report " + reportID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully resolved report: " + reportID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       report,
+	})
+}
+
+func (handler *moderationHandler) GetModerationAudit(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	actions, err := handler.moderator.Audit(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the moderation audit trail of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the moderation audit trail of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       actions,
+	})
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/pins"
+	"discard/message-service/pkg/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PinHandler interface {
+	PinMessage(*gin.Context)
+	UnpinMessage(*gin.Context)
+	GetPins(*gin.Context)
+	SetPinLimit(*gin.Context)
+}
+
+type pinHandler struct {
+	pins     *pins.Pins
+	messages repository.MessageRepository
+}
+
+func NewPinHandler(pins *pins.Pins, messages *repository.MessageRepository) PinHandler {
+	return &pinHandler{pins: pins, messages: *messages}
+}
+
+// accessibleMessage looks up the message in the path and aborts unless the
+// caller is a member of its server.
+func accessibleMessage(context *gin.Context, messages repository.MessageRepository) (*models.Message, bool) {
+	id := context.Param("id")
+
+	message, err := messages.GetById(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "No such message found with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return nil, false
+	}
+
+	if !auth.FromContext(context).CanAccessServer(message.ServerID) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of server: " + message.ServerID,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return nil, false
+	}
+	return message, true
+}
+
+func (handler *pinHandler) PinMessage(context *gin.Context) {
+	id := context.Param("id")
+	message, ok := accessibleMessage(context, handler.messages)
+	if !ok {
+		return
+	}
+
+	pin, err := handler.pins.Pin(*message, auth.FromContext(context).UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to pin message with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully pinned message with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       pin,
+	})
+}
+
+func (handler *pinHandler) UnpinMessage(context *gin.Context) {
+	id := context.Param("id")
+	message, ok := accessibleMessage(context, handler.messages)
+	if !ok {
+		return
+	}
+
+	if err := handler.pins.Unpin(*message); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to unpin message with id " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully unpinned message with id: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+	})
+}
+
+// GetPins lists the pins of a channel of a server the caller is a member of.
+func (handler *pinHandler) GetPins(context *gin.Context) {
+	serverID := context.Param("id")
+	id := context.Param("channelId")
+	if !serverAccess(context) {
+		return
+	}
+
+	pinned, err := handler.pins.List(serverID, id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the pins of channel " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the pins of channel: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       pinned,
+	})
+}
+
+func (handler *pinHandler) SetPinLimit(context *gin.Context) {
+	serverID := context.Param("id")
+	id := context.Param("channelId")
+	if !serverAccess(context) {
+		return
+	}
+
+	var limit models.PinLimit
+	if err := context.ShouldBindJSON(&limit); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.pins.SetLimit(serverID, id, limit); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to set the pin limit: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set the pin limit of channel: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       limit,
+	})
+}
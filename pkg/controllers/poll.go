@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/polls"
+	"discard/message-service/pkg/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PollHandler interface {
+	Vote(*gin.Context)
+	RetractVote(*gin.Context)
+}
+
+type pollHandler struct {
+	polls    *polls.Polls
+	messages repository.MessageRepository
+}
+
+func NewPollHandler(polls *polls.Polls, messages *repository.MessageRepository) PollHandler {
+	return &pollHandler{polls: polls, messages: *messages}
+}
+
+// Vote records the vote of the caller and returns the poll with its new tally.
+func (handler *pollHandler) Vote(context *gin.Context) {
+	id := context.Param("id")
+	if !authenticated(context) {
+		return
+	}
+
+	var vote models.Vote
+	if err := context.ShouldBindJSON(&vote); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	message, ok := accessibleMessage(context, handler.messages)
+	if !ok {
+		return
+	}
+
+	message, err := handler.polls.Vote(*message, auth.FromContext(context).UserID, vote)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to vote in poll " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully voted in poll: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       message,
+	})
+}
+
+// RetractVote removes the vote of the caller, who can then vote again.
+func (handler *pollHandler) RetractVote(context *gin.Context) {
+	id := context.Param("id")
+	if !authenticated(context) {
+		return
+	}
+
+	message, ok := accessibleMessage(context, handler.messages)
+	if !ok {
+		return
+	}
+
+	message, err := handler.polls.Retract(*message, auth.FromContext(context).UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retract the vote in poll " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retracted the vote in poll: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       message,
+	})
+}
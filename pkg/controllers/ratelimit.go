@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type RateLimitHandler interface {
+	LimitMessages(*gin.Context)
+	LimitMessagesV2(*gin.Context)
+	SetSlowMode(*gin.Context)
+	SetServerLimits(*gin.Context)
+}
+
+type rateLimitHandler struct {
+	limiter *ratelimit.Limiter
+}
+
+func NewRateLimitHandler(limiter *ratelimit.Limiter) RateLimitHandler {
+	return &rateLimitHandler{limiter: limiter}
+}
+
+// retryAfter returns how many seconds the author of the message in the body
+// has to wait, or zero when it may be sent. Invalid bodies are let through so
+// the handler can report them. member is false when the gateway identified
+// the caller and they may not post to the server of the message.
+func (handler *rateLimitHandler) retryAfter(context *gin.Context) (seconds int, member bool) {
+	var message models.Message
+	if err := context.ShouldBindBodyWith(&message, binding.JSON); err != nil {
+		return 0, true
+	}
+
+	// the limits are looked up by the server in the body, never trust one an
+	// identified caller is not in. Without an identity the body is all there
+	// is, as it always was for v1 clients.
+	identity := auth.FromContext(context)
+	if identity.Authenticated() && !identity.CanAccessServer(message.ServerID) {
+		return 0, false
+	}
+
+	seconds = limitMessage(handler.limiter, identity, message)
+	if seconds > 0 {
+		context.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	return seconds, true
+}
+
+// limitMessage returns how many seconds the author of message has to wait,
+// or zero when it may be sent. Owners, moderators and admins skip slow mode.
+func limitMessage(limiter *ratelimit.Limiter, identity auth.Identity, message models.Message) int {
+	// prefer the gateway asserted user over the one in the body
+	userID := identity.UserID
+	if userID == "" {
+		userID = message.UserID
+	}
+
+	retryAfter, allowed := limiter.Allow(ratelimit.Request{
+		ServerID:       message.ServerID,
+		ChannelID:      message.ChannelID,
+		UserID:         userID,
+		BypassSlowMode: identity.HasRole(auth.RoleOwner, auth.RoleModerator, auth.RoleAdmin),
+	})
+	if allowed {
+		return 0
+	}
+	return max(int(math.Ceil(retryAfter.Seconds())), 1)
+}
+
+// LimitMessages is a middleware for the message creation route.
+func (handler *rateLimitHandler) LimitMessages(context *gin.Context) {
+	seconds, member := handler.retryAfter(context)
+	if !member {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of the server of the message",
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+	if seconds == 0 {
+		context.Next()
+		return
+	}
+
+	context.AbortWithStatusJSON(
+		http.StatusTooManyRequests, models.Response{
+			Message:    "Too many messages, retry in " + strconv.Itoa(seconds) + " seconds",
+			HttpStatus: http.StatusTooManyRequests,
+			Success:    false,
+		})
+}
+
+func (handler *rateLimitHandler) LimitMessagesV2(context *gin.Context) {
+	seconds, member := handler.retryAfter(context)
+	if !member {
+		abortWithCode(context, http.StatusForbidden, CodeForbidden, "Not a member of the server of the message", nil)
+		return
+	}
+	if seconds == 0 {
+		context.Next()
+		return
+	}
+
+	abortWithCode(context, http.StatusTooManyRequests, CodeRateLimited,
+		"Too many messages, retry in "+strconv.Itoa(seconds)+" seconds",
+		gin.H{"retry_after": seconds})
+}
+
+// SetSlowMode sets the slow mode of a channel of a server the caller is a
+// member of. The setting is kept per server, it never reaches the channel
+// when the server is not its own.
+func (handler *rateLimitHandler) SetSlowMode(context *gin.Context) {
+	serverID := context.Param("id")
+	id := context.Param("channelId")
+	if !serverAccess(context) {
+		return
+	}
+
+	var slowMode models.SlowMode
+	if err := context.ShouldBindJSON(&slowMode); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	interval := time.Duration(slowMode.Seconds) * time.Second
+	if err := handler.limiter.Store().SetSlowMode(serverID, id, interval); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError, models.Response{
+				Message:    "Not able to set slow mode: " + err.Error(),
+				HttpStatus: http.StatusInternalServerError,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set slow mode for channel: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       slowMode,
+	})
+}
+
+func (handler *rateLimitHandler) SetServerLimits(context *gin.Context) {
+	id := context.Param("id")
+
+	var limits ratelimit.ServerLimits
+	if err := context.ShouldBindJSON(&limits); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.limiter.Store().SetServerLimits(id, limits); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError, models.Response{
+				Message:    "Not able to set rate limits: " + err.Error(),
+				HttpStatus: http.StatusInternalServerError,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set rate limits for server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       limits,
+	})
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/realtime"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/timeuuid"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	heartbeatInterval  = 30 * time.Second
+	pongWait           = 2 * heartbeatInterval // connections silent for longer are dead
+	writeWait          = 10 * time.Second
+	subscriptionBuffer = 256
+	maximumFrameSize   = 8192
+)
+
+// Operations of the WebSocket protocol, clients send subscribe, unsubscribe
+// and heartbeat, everything else is sent by the server.
+const (
+	opHello        = "hello"
+	opSubscribe    = "subscribe"
+	opSubscribed   = "subscribed"
+	opUnsubscribe  = "unsubscribe"
+	opHeartbeat    = "heartbeat"
+	opHeartbeatAck = "heartbeat_ack"
+	opEvent        = "event"
+	opError        = "error"
+)
+
+type realtimeRequest struct {
+	Op       string   `json:"op"`
+	Channels []string `json:"channels"`
+	Servers  []string `json:"servers"`
+	Cursor   string   `json:"cursor"` // ID of the last event received before reconnecting
+}
+
+type realtimeFrame struct {
+	Op                string        `json:"op"`
+	Event             *events.Event `json:"event,omitempty"`
+	HeartbeatInterval int64         `json:"heartbeat_interval,omitempty"` // milliseconds
+	Channels          []string      `json:"channels,omitempty"`
+	Servers           []string      `json:"servers,omitempty"`
+	Complete          *bool         `json:"complete,omitempty"` // false when events before the cursor were lost
+	Message           string        `json:"message,omitempty"`
+}
+
+type RealtimeHandler interface {
+	Connect(*gin.Context)
+	StreamChannel(*gin.Context)
+}
+
+type realtimeHandler struct {
+	hub        *realtime.Hub
+	repository repository.MessageRepository
+	upgrader   websocket.Upgrader
+}
+
+func NewRealtimeHandler(hub *realtime.Hub, repository *repository.MessageRepository) RealtimeHandler {
+	return &realtimeHandler{
+		hub:        hub,
+		repository: *repository,
+		upgrader: websocket.Upgrader{
+			// the gateway in front of the service already enforces allowed origins
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+type realtimeSession struct {
+	connection   *websocket.Conn
+	identity     auth.Identity
+	hub          *realtime.Hub
+	subscription *realtime.Subscription
+	replies      chan realtimeFrame
+	closed       chan struct{}
+}
+
+func (handler *realtimeHandler) Connect(context *gin.Context) {
+	identity := auth.FromContext(context)
+	if !identity.Authenticated() {
+		context.AbortWithStatusJSON(
+			http.StatusUnauthorized, models.Response{
+				Message:    "Authentication required",
+				HttpStatus: http.StatusUnauthorized,
+				Success:    false,
+			})
+		return
+	}
+
+	connection, err := handler.upgrader.Upgrade(context.Writer, context.Request, nil)
+	if err != nil {
+		return // the upgrader already answered the request
+	}
+
+	session := &realtimeSession{
+		connection:   connection,
+		identity:     identity,
+		hub:          handler.hub,
+		subscription: handler.hub.Subscribe(subscriptionBuffer),
+		replies:      make(chan realtimeFrame, 16),
+		closed:       make(chan struct{}),
+	}
+	defer handler.hub.Unsubscribe(session.subscription)
+
+	go session.write()
+	session.read()
+}
+
+func (session *realtimeSession) read() {
+	defer close(session.closed)
+
+	session.connection.SetReadLimit(maximumFrameSize)
+	session.connection.SetReadDeadline(time.Now().Add(pongWait))
+	session.connection.SetPongHandler(func(string) error {
+		return session.connection.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var request realtimeRequest
+		if err := session.connection.ReadJSON(&request); err != nil {
+			return
+		}
+		session.connection.SetReadDeadline(time.Now().Add(pongWait))
+
+		if !session.handle(request) {
+			return
+		}
+	}
+}
+
+// handle answers a client request, it returns false when the client sends
+// requests faster than their replies can be written.
+func (session *realtimeSession) handle(request realtimeRequest) bool {
+	switch request.Op {
+	case opHeartbeat:
+		return session.reply(realtimeFrame{Op: opHeartbeatAck})
+
+	case opSubscribe:
+		if request.Cursor != "" && !timeuuid.Valid(request.Cursor) {
+			return session.reply(realtimeFrame{Op: opError, Message: "Invalid cursor: " + request.Cursor})
+		}
+
+		var servers []string
+		for _, server := range request.Servers {
+			if !session.identity.CanAccessServer(server) {
+				if !session.reply(realtimeFrame{Op: opError, Message: "Not a member of server: " + server}) {
+					return false
+				}
+				continue
+			}
+			servers = append(servers, server)
+		}
+
+		complete := session.hub.Follow(session.subscription, request.Channels, servers, request.Cursor)
+		frame := realtimeFrame{Op: opSubscribed, Channels: request.Channels, Servers: servers}
+		if request.Cursor != "" {
+			frame.Complete = &complete
+		}
+		return session.reply(frame)
+
+	case opUnsubscribe:
+		session.hub.Unfollow(session.subscription, request.Channels, request.Servers)
+		return true
+	}
+
+	return session.reply(realtimeFrame{Op: opError, Message: "Unknown op: " + request.Op})
+}
+
+func (session *realtimeSession) reply(frame realtimeFrame) bool {
+	select {
+	case session.replies <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+func (session *realtimeSession) send(frame realtimeFrame) error {
+	session.connection.SetWriteDeadline(time.Now().Add(writeWait))
+	return session.connection.WriteJSON(frame)
+}
+
+// write is the only goroutine writing to the connection.
+func (session *realtimeSession) write() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	defer session.connection.Close()
+
+	if err := session.send(realtimeFrame{Op: opHello, HeartbeatInterval: heartbeatInterval.Milliseconds()}); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-session.closed:
+			return
+
+		case frame := <-session.replies:
+			if err := session.send(frame); err != nil {
+				return
+			}
+
+		case event := <-session.subscription.Events():
+			// channel subscriptions are not checked up front, only deliver what the user may see
+			if !session.identity.CanAccessServer(event.Message.ServerID) {
+				continue
+			}
+			if err := session.send(realtimeFrame{Op: opEvent, Event: &event}); err != nil {
+				return
+			}
+
+		case <-session.subscription.Done():
+			session.connection.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, resume from the last event"),
+				time.Now().Add(writeWait))
+			return
+
+		case <-ticker.C:
+			if err := session.connection.WriteControl(
+				websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/retention"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler interface {
+	GetRetentionRules(*gin.Context)
+	SetServerRetention(*gin.Context)
+	SetChannelRetention(*gin.Context)
+	DeleteServerRetention(*gin.Context)
+	DeleteChannelRetention(*gin.Context)
+	DryRunRetention(*gin.Context)
+}
+
+type retentionHandler struct {
+	worker *retention.Worker
+}
+
+func NewRetentionHandler(worker *retention.Worker) RetentionHandler {
+	return &retentionHandler{worker: worker}
+}
+
+func (handler *retentionHandler) GetRetentionRules(context *gin.Context) {
+	rules, err := handler.worker.Rules()
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the retention rules: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the retention rules",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       rules,
+	})
+}
+
+func (handler *retentionHandler) SetServerRetention(context *gin.Context) {
+	if !serverAccess(context) {
+		return
+	}
+	id := context.Param("id")
+	handler.setRule(context, models.RetentionRule{Scope: models.RetentionScopeServer, ServerID: id, TargetID: id})
+}
+
+// SetChannelRetention stores the rule with the server it was set through, it
+// only applies to the messages of that server.
+func (handler *retentionHandler) SetChannelRetention(context *gin.Context) {
+	if !serverAccess(context) {
+		return
+	}
+	handler.setRule(context, models.RetentionRule{
+		Scope: models.RetentionScopeChannel, ServerID: context.Param("id"), TargetID: context.Param("channelId")})
+}
+
+func (handler *retentionHandler) setRule(context *gin.Context, rule models.RetentionRule) {
+	if err := context.ShouldBindJSON(&rule.RetentionPolicy); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if err := handler.worker.SetRule(rule); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to set the retention rule: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully set the retention rule of " + rule.Scope + ": " + rule.TargetID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       rule,
+	})
+}
+
+func (handler *retentionHandler) DeleteServerRetention(context *gin.Context) {
+	if !serverAccess(context) {
+		return
+	}
+	handler.deleteRule(context, models.RetentionScopeServer, context.Param("id"))
+}
+
+func (handler *retentionHandler) DeleteChannelRetention(context *gin.Context) {
+	if !serverAccess(context) {
+		return
+	}
+	handler.deleteRule(context, models.RetentionScopeChannel, context.Param("channelId"))
+}
+
+func (handler *retentionHandler) deleteRule(context *gin.Context, scope string, targetID string) {
+	serverID := context.Param("id")
+
+	if err := handler.worker.DeleteRule(scope, serverID, targetID); err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to remove the retention rule: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully removed the retention rule of " + scope + ": " + targetID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+	})
+}
+
+// DryRunRetention sweeps without deleting and reports what would be deleted.
+func (handler *retentionHandler) DryRunRetention(context *gin.Context) {
+	report, err := handler.worker.Sweep(true)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to run the retention dry run: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully ran the retention dry run",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       report,
+	})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/scheduler"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduledHandler interface {
+	ScheduleMessage(*gin.Context)
+	GetScheduledMessages(*gin.Context)
+	CancelScheduledMessage(*gin.Context)
+}
+
+type scheduledHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+func NewScheduledHandler(scheduler *scheduler.Scheduler) ScheduledHandler {
+	return &scheduledHandler{scheduler: scheduler}
+}
+
+func (handler *scheduledHandler) ScheduleMessage(context *gin.Context) {
+	var request models.ScheduleRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if !authenticated(context) {
+		return
+	}
+	identity := auth.FromContext(context)
+	if request.UserID != identity.UserID {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not able to schedule messages as user: " + request.UserID,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+	if !identity.CanAccessServer(request.ServerID) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of server: " + request.ServerID,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	scheduled, err := handler.scheduler.Schedule(request, identity.UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to schedule message: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusCreated, models.Response{
+		Message:    "Successfully scheduled message: " + scheduled.ID,
+		HttpStatus: http.StatusCreated,
+		Success:    true,
+		Data:       scheduled,
+	})
+}
+
+func (handler *scheduledHandler) GetScheduledMessages(context *gin.Context) {
+	id := context.Param("id")
+	if !serverAccess(context) {
+		return
+	}
+
+	scheduled, err := handler.scheduler.List(id)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to retrieve the scheduled messages of server " + id + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully retrieved the scheduled messages of server: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       scheduled,
+	})
+}
+
+func (handler *scheduledHandler) CancelScheduledMessage(context *gin.Context) {
+	id := context.Param("id")
+	scheduledID := context.Param("scheduledId")
+	if !serverAccess(context) {
+		return
+	}
+
+	scheduled, err := handler.scheduler.Cancel(id, scheduledID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to cancel scheduled message " + scheduledID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+				Data:       scheduled,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully cancelled scheduled message: " + scheduledID,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       scheduled,
+	})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/search"
+	"discard/message-service/pkg/timeuuid"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidSearch = fmt.Errorf("%w: the search contains no words", repository.ErrInvalidArgument)
+	errInvalidCursor = fmt.Errorf("%w: before and after have to be message IDs", repository.ErrInvalidArgument)
+)
+
+type SearchHandler interface {
+	Search(*gin.Context)
+}
+
+type searchHandler struct {
+	index search.SearchIndex
+}
+
+func NewSearchHandler(index search.SearchIndex) SearchHandler {
+	return &searchHandler{index: index}
+}
+
+// Search finds messages of the servers the caller is a member of.
+func (handler *searchHandler) Search(context *gin.Context) {
+	identity := auth.FromContext(context)
+	if !identity.Authenticated() {
+		context.AbortWithStatusJSON(
+			http.StatusUnauthorized, models.Response{
+				Message:    "Authentication required",
+				HttpStatus: http.StatusUnauthorized,
+				Success:    false,
+			})
+		return
+	}
+
+	var query models.SearchQuery
+	err := context.ShouldBindQuery(&query)
+	if err == nil && !search.Valid(query.Q) {
+		err = errInvalidSearch
+	}
+	for _, cursor := range []string{query.Before, query.After} {
+		if err == nil && cursor != "" && !timeuuid.Valid(cursor) {
+			err = errInvalidCursor
+		}
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid query: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	if query.ServerID != "" && !identity.CanAccessServer(query.ServerID) {
+		context.AbortWithStatusJSON(
+			http.StatusForbidden, models.Response{
+				Message:    "Not a member of server: " + query.ServerID,
+				HttpStatus: http.StatusForbidden,
+				Success:    false,
+			})
+		return
+	}
+
+	hits, err := handler.index.Search(search.Query{
+		Text:      query.Q,
+		ServerID:  query.ServerID,
+		ChannelID: query.ChannelID,
+		AuthorID:  query.Author,
+		Before:    query.Before,
+		After:     query.After,
+		Limit:     query.Limit,
+		CanAccess: identity.CanAccessServer,
+	})
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to search messages: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully searched messages",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       hits,
+	})
+}
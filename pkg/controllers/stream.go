@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/timeuuid"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LastEventIDHeader = "Last-Event-ID"
+	streamRetry       = 3 * time.Second // reconnection delay suggested to EventSource clients
+	streamHistoryPage = 100
+	// the most messages replayed from the history, further behind the client
+	// has to reload the channel
+	streamHistoryLimit = 2000
+	resyncEvent        = "resync"
+)
+
+var errResync = fmt.Errorf("%w: more than %d messages to replay, reload the channel", repository.ErrInvalidArgument, streamHistoryLimit)
+
+// StreamChannel sends the events of a channel as Server-Sent Events. A
+// Last-Event-ID header, or last_event_id query for clients that cannot set
+// headers, resumes after that event. What the hub no longer buffers is
+// replayed from the channel history, which only knows about created messages.
+// A cursor too far behind ends the stream with a resync event, the client
+// then reloads the channel and streams without a cursor.
+func (handler *realtimeHandler) StreamChannel(context *gin.Context) {
+	identity := auth.FromContext(context)
+	if !identity.Authenticated() {
+		context.AbortWithStatusJSON(
+			http.StatusUnauthorized, models.Response{
+				Message:    "Authentication required",
+				HttpStatus: http.StatusUnauthorized,
+				Success:    false,
+			})
+		return
+	}
+
+	cursor := context.GetHeader(LastEventIDHeader)
+	if cursor == "" {
+		cursor = context.Query("last_event_id")
+	}
+	if cursor != "" && !timeuuid.Valid(cursor) {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid Last-Event-ID: " + cursor,
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	channelID := context.Param("id")
+	subscription := handler.hub.Subscribe(subscriptionBuffer)
+	defer handler.hub.Unsubscribe(subscription)
+
+	// follow before reading the history so nothing published in between is missed
+	history := &channelHistory{messages: handler.repository, channelID: channelID, after: cursor}
+	var page []*models.Message
+	replaying := !handler.hub.Follow(subscription, []string{channelID}, nil, cursor)
+	if replaying {
+		var err error
+		if page, err = history.next(); err != nil {
+			status, _ := statusOf(err)
+			context.AbortWithStatusJSON(
+				status, models.Response{
+					Message:    "Not able to replay messages with channel id " + channelID + ": " + err.Error(),
+					HttpStatus: status,
+					Success:    false,
+				})
+			return
+		}
+	}
+
+	header := context.Writer.Header()
+	header.Set("Content-Type", sse.ContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // keep reverse proxies from buffering the stream
+	context.Status(http.StatusOK)
+
+	send := func(writer io.Writer, event events.Event) bool {
+		if !identity.CanAccessServer(event.Message.ServerID) {
+			return true
+		}
+		return sse.Encode(writer, sse.Event{Id: event.ID, Event: string(event.Type), Data: event}) == nil
+	}
+
+	if _, err := fmt.Fprintf(context.Writer, "retry:%d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	for len(page) > 0 {
+		for _, message := range page {
+			if !send(context.Writer, events.New(events.MessageCreated, *message)) {
+				return
+			}
+		}
+		context.Writer.Flush()
+
+		var err error
+		page, err = history.next()
+		if errors.Is(err, errResync) {
+			sse.Encode(context.Writer, sse.Event{Event: resyncEvent, Data: gin.H{"message": err.Error()}})
+			return
+		}
+		if err != nil {
+			logger.WARN.Printf("Failed to replay channel %v: %v\n", channelID, err)
+			return // the client resumes from the last event it received
+		}
+	}
+	context.Writer.Flush()
+
+	keepAlive := time.NewTicker(heartbeatInterval)
+	defer keepAlive.Stop()
+
+	context.Stream(func(writer io.Writer) bool {
+		select {
+		case event := <-subscription.Events():
+			// the history may already contain messages created while it was read
+			if event.Type == events.MessageCreated && replaying && timeuuid.Compare(event.ID, history.after) <= 0 {
+				return true
+			}
+			return send(writer, event)
+
+		case <-keepAlive.C:
+			_, err := io.WriteString(writer, ": keep-alive\n\n")
+			return err == nil
+
+		case <-subscription.Done(): // too slow, the client reconnects with its Last-Event-ID
+			return false
+
+		case <-context.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// channelHistory reads the messages of a channel created after a cursor a
+// page at a time, so a stale cursor never loads the whole channel.
+type channelHistory struct {
+	messages  repository.MessageRepository
+	channelID string
+	after     string // the last message read
+	read      int
+	done      bool
+}
+
+// next returns the next page of the history, empty once all of it was read.
+// It fails with errResync once more than streamHistoryLimit messages were read.
+func (history *channelHistory) next() ([]*models.Message, error) {
+	if history.done {
+		return nil, nil
+	}
+	if history.read >= streamHistoryLimit {
+		return nil, errResync
+	}
+
+	page, err := history.messages.GetAllByChannelId(history.channelID, models.Page{After: history.after, Limit: streamHistoryPage})
+	if err != nil {
+		return nil, err
+	}
+	history.read += len(page)
+	history.done = len(page) < streamHistoryPage
+	if len(page) > 0 {
+		history.after = page[len(page)-1].ID
+	}
+	return page, nil
+}
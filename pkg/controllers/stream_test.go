@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/realtime"
+	"discard/message-service/pkg/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStreamServer serves the stream of a hub without history, so every
+// cursor is resumed from the messages stored in the returned repository.
+func newStreamServer(t *testing.T) (*httptest.Server, *realtime.Hub, repository.MessageRepository) {
+	gin.SetMode(gin.TestMode)
+	hub := realtime.NewHub(0)
+	messages := repository.NewInMemoryMessageRepository()
+	router := gin.New()
+	router.GET("/channel/:id/stream", NewRealtimeHandler(hub, &messages).StreamChannel)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, hub, messages
+}
+
+func store(t *testing.T, messages repository.MessageRepository, channelID string, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		message, err := messages.Save(models.Message{
+			ID: gocql.TimeUUID().String(), UserID: "user", ServerID: "server", ChannelID: channelID, Message: "hello"})
+		assert.NoError(t, err)
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+type streamed struct {
+	id    string
+	event string
+}
+
+// stream opens the stream of a channel as a member of its server, it is
+// closed with the test.
+func stream(t *testing.T, server *httptest.Server, path string, cursor string) (*http.Response, *bufio.Scanner) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+	request.Header.Set(auth.UserIDHeader, "user")
+	request.Header.Set(auth.ServersHeader, "server")
+	if cursor != "" {
+		request.Header.Set(LastEventIDHeader, cursor)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	scanner := bufio.NewScanner(response.Body)
+	// the retry line is written once the stream follows the channel
+	for scanner.Scan() && !strings.HasPrefix(scanner.Text(), "retry:") {
+	}
+	return response, scanner
+}
+
+// next reads up to n events, fewer when the stream ends.
+func next(scanner *bufio.Scanner, n int) []streamed {
+	var read []streamed
+	var current streamed
+	for len(read) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			current.id = strings.TrimPrefix(line, "id:")
+		case strings.HasPrefix(line, "event:"):
+			current.event = strings.TrimPrefix(line, "event:")
+		case line == "" && current.event != "":
+			read = append(read, current)
+			current = streamed{}
+		}
+	}
+	return read
+}
+
+func ids(read []streamed) []string {
+	var ids []string
+	for _, event := range read {
+		ids = append(ids, event.id)
+	}
+	return ids
+}
+
+func TestStreamSendsTheEventsOfTheChannel(t *testing.T) {
+	server, hub, _ := newStreamServer(t)
+	response, scanner := stream(t, server, "/channel/general/stream", "")
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	elsewhere := events.New(events.MessageCreated, models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", ChannelID: "random"})
+	foreign := events.New(events.MessageCreated, models.Message{ID: gocql.TimeUUID().String(), ServerID: "other", ChannelID: "general"})
+	sent := events.New(events.MessageCreated, models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", ChannelID: "general"})
+	hub.Publish(elsewhere)
+	hub.Publish(foreign)
+	hub.Publish(sent)
+
+	assert.Equal(t, []streamed{{id: sent.ID, event: string(events.MessageCreated)}}, next(scanner, 1))
+}
+
+func TestStreamResumesAfterTheLastEventID(t *testing.T) {
+	server, hub, messages := newStreamServer(t)
+	stored := store(t, messages, "general", 2*streamHistoryPage+10)
+	store(t, messages, "random", 5)
+
+	_, scanner := stream(t, server, "/channel/general/stream", stored[9])
+	assert.Equal(t, stored[10:], ids(next(scanner, len(stored)-10)), "the history is replayed page by page")
+
+	// the hub publishes what was created while the history was read, it is sent once
+	hub.Publish(events.New(events.MessageCreated, models.Message{ID: stored[len(stored)-1], ServerID: "server", ChannelID: "general"}))
+	live := events.New(events.MessageCreated, models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", ChannelID: "general"})
+	hub.Publish(live)
+	assert.Equal(t, []string{live.ID}, ids(next(scanner, 1)))
+}
+
+func TestStreamCursorFromTheQuery(t *testing.T) {
+	server, _, messages := newStreamServer(t)
+	stored := store(t, messages, "general", 3)
+
+	_, scanner := stream(t, server, "/channel/general/stream?last_event_id="+stored[0], "")
+	assert.Equal(t, stored[1:], ids(next(scanner, 2)))
+}
+
+func TestStreamFarBehindAsksToResync(t *testing.T) {
+	server, _, messages := newStreamServer(t)
+	stored := store(t, messages, "general", streamHistoryLimit+2)
+
+	_, scanner := stream(t, server, "/channel/general/stream", stored[0])
+	read := next(scanner, streamHistoryLimit+2)
+	if assert.Len(t, read, streamHistoryLimit+1) {
+		assert.Equal(t, stored[streamHistoryLimit], read[streamHistoryLimit-1].id)
+		assert.Equal(t, resyncEvent, read[streamHistoryLimit].event)
+	}
+	assert.Empty(t, next(scanner, 1), "the stream ends with the resync event")
+}
+
+func TestStreamRejectsInvalidRequests(t *testing.T) {
+	server, _, _ := newStreamServer(t)
+
+	response, err := http.Get(server.URL + "/channel/general/stream")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/channel/general/stream", nil)
+	request.Header.Set(auth.UserIDHeader, "user")
+	request.Header.Set(LastEventIDHeader, "not-a-message-id")
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
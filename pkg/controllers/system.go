@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/moderation"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/system"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemHandler writes the system messages announcing the events of other
+// services, which are consumed from RabbitMQ and posted by the service itself.
+type SystemHandler interface {
+	SaveSystemMessage(*gin.Context)
+}
+
+type systemHandler struct {
+	*messageHandler
+}
+
+func NewSystemHandler(repository *repository.MessageRepository, options ...MessageHandlerOption) SystemHandler {
+	return &systemHandler{NewMessageHandler(repository, options...).(*messageHandler)}
+}
+
+// announce saves the system message of an event through the normal save
+// path, skipping moderation and mentions. Repeated events return the message
+// written for the first one.
+func (handler *systemHandler) announce(event models.SystemEvent) (*models.Message, bool, error) {
+	message, err := system.Render(event)
+	if err != nil {
+		return nil, false, err
+	}
+	verdict := moderation.Verdict{Action: models.ModerationAllow, Content: message.Message}
+	return handler.store("system:"+event.ID, message, verdict)
+}
+
+func (handler *systemHandler) SaveSystemMessage(context *gin.Context) {
+	var event models.SystemEvent
+	if err := context.ShouldBindJSON(&event); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	response, replayed, err := handler.announce(event)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to write system message for event " + event.ID + ": " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	if replayed {
+		context.Header(IdempotentReplayedHeader, "true")
+	}
+	context.IndentedJSON(http.StatusCreated, models.Response{
+		Message:    "Successfully wrote system message: " + response.ID,
+		HttpStatus: http.StatusCreated,
+		Success:    true,
+		Data:       response,
+	})
+}
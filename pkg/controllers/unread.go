@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"discard/message-service/pkg/auth"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/unread"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UnreadHandler interface {
+	AckChannel(*gin.Context)
+	GetUnread(*gin.Context)
+}
+
+type unreadHandler struct {
+	states *unread.ReadStates
+}
+
+func NewUnreadHandler(states *unread.ReadStates) UnreadHandler {
+	return &unreadHandler{states: states}
+}
+
+// authenticated aborts unless the gateway identified the caller.
+func authenticated(context *gin.Context) bool {
+	if auth.FromContext(context).Authenticated() {
+		return true
+	}
+	context.AbortWithStatusJSON(
+		http.StatusUnauthorized, models.Response{
+			Message:    "Authentication required",
+			HttpStatus: http.StatusUnauthorized,
+			Success:    false,
+		})
+	return false
+}
+
+func (handler *unreadHandler) AckChannel(context *gin.Context) {
+	serverID := context.Param("id")
+	id := context.Param("channelId")
+	if !authenticated(context) || !serverAccess(context) {
+		return
+	}
+
+	var ack models.Ack
+	if err := context.ShouldBindJSON(&ack); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusBadRequest, models.Response{
+				Message:    "Invalid JSON data: " + err.Error(),
+				HttpStatus: http.StatusBadRequest,
+				Success:    false,
+			})
+		return
+	}
+
+	state, err := handler.states.Ack(auth.FromContext(context).UserID, serverID, id, ack)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to mark channel " + id + " read: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully marked channel read: " + id,
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       state,
+	})
+}
+
+func (handler *unreadHandler) GetUnread(context *gin.Context) {
+	if !authenticated(context) {
+		return
+	}
+
+	identity := auth.FromContext(context)
+	counts, err := handler.states.Unread(identity.UserID)
+	if err != nil {
+		status, _ := statusOf(err)
+		context.AbortWithStatusJSON(
+			status, models.Response{
+				Message:    "Not able to count the unread messages: " + err.Error(),
+				HttpStatus: status,
+				Success:    false,
+			})
+		return
+	}
+	// channels of servers the user left stay marked but are no longer counted
+	counts = slices.DeleteFunc(counts, func(unread *models.Unread) bool {
+		return !identity.CanAccessServer(unread.ServerID)
+	})
+
+	context.IndentedJSON(http.StatusOK, models.Response{
+		Message:    "Successfully counted the unread messages",
+		HttpStatus: http.StatusOK,
+		Success:    true,
+		Data:       counts,
+	})
+}
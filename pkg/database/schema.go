@@ -0,0 +1,315 @@
+package database
+
+import (
+	logger "discard/message-service/pkg/models/logger"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+var tables = []string{
+	`CREATE TABLE IF NOT EXISTS messages (
+		ID uuid PRIMARY KEY,
+		UserID text,
+		ServerID text,
+		Message text)`,
+	`CREATE TABLE IF NOT EXISTS messages_by_channel (
+		ChannelID text,
+		ID timeuuid,
+		UserID text,
+		ServerID text,
+		Message text,
+		PRIMARY KEY ((ChannelID), ID))
+		WITH CLUSTERING ORDER BY (ID DESC)`,
+	`CREATE TABLE IF NOT EXISTS server_channels (
+		ServerID text,
+		ChannelID text,
+		PRIMARY KEY ((ServerID), ChannelID))`,
+	`CREATE TABLE IF NOT EXISTS messages_without_channel (
+		ServerID text,
+		ID timeuuid,
+		PRIMARY KEY ((ServerID), ID))
+		WITH CLUSTERING ORDER BY (ID DESC)`,
+	`CREATE TABLE IF NOT EXISTS message_idempotency (
+		IdempotencyKey text PRIMARY KEY,
+		MessageID uuid)`,
+	`CREATE TABLE IF NOT EXISTS exports (
+		ID timeuuid PRIMARY KEY,
+		UserID text,
+		Status text,
+		Messages int,
+		CreatedAt timestamp,
+		CompletedAt timestamp,
+		Download text,
+		ExpiresAt timestamp,
+		Error text)`,
+	`CREATE TABLE IF NOT EXISTS exports_by_user (
+		UserID text,
+		ID timeuuid,
+		PRIMARY KEY ((UserID), ID))`,
+	`CREATE TABLE IF NOT EXISTS deletion_jobs (
+		ID timeuuid PRIMARY KEY,
+		UserID text,
+		Status text,
+		Deleted int,
+		Failed int,
+		Error text,
+		CreatedAt timestamp,
+		UpdatedAt timestamp,
+		CompletedAt timestamp)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		Log text,
+		ID timeuuid,
+		Action text,
+		UserID text,
+		JobID text,
+		Messages int,
+		At timestamp,
+		PreviousHash text,
+		Hash text,
+		PRIMARY KEY ((Log), ID))`,
+	`CREATE TABLE IF NOT EXISTS audit_log_head (
+		Log text PRIMARY KEY,
+		Hash text)`,
+	`CREATE TABLE IF NOT EXISTS deletion_leases (
+		UserID text PRIMARY KEY,
+		Instance text)`,
+	`CREATE TABLE IF NOT EXISTS deletion_policies (
+		ServerID text PRIMARY KEY,
+		Strategy text)`,
+	`CREATE TABLE IF NOT EXISTS retention_rules (
+		Scope text,
+		TargetID text,
+		MaxAgeSeconds bigint,
+		MaxCount int,
+		PRIMARY KEY ((Scope), TargetID))`,
+	`CREATE TABLE IF NOT EXISTS channel_retention_rules (
+		ServerID text,
+		ChannelID text,
+		MaxAgeSeconds bigint,
+		MaxCount int,
+		PRIMARY KEY ((ServerID), ChannelID))`,
+	`CREATE TABLE IF NOT EXISTS legal_holds (
+		ID timeuuid PRIMARY KEY,
+		Scope text,
+		TargetID text,
+		Reason text,
+		PlacedBy text,
+		PlacedAt timestamp,
+		ReleasedBy text,
+		ReleasedAt timestamp)`,
+	`CREATE TABLE IF NOT EXISTS legal_hold_deferrals (
+		HoldID timeuuid,
+		Kind text,
+		TargetID text,
+		Reason text,
+		At timestamp,
+		PRIMARY KEY ((HoldID), Kind, TargetID))`,
+	`CREATE TABLE IF NOT EXISTS user_keys (
+		UserID text PRIMARY KEY,
+		WrappedKey blob,
+		CreatedAt timestamp)`,
+	`CREATE TABLE IF NOT EXISTS moderation_rules (
+		ServerID text,
+		Position int,
+		Kind text,
+		Action text,
+		Words list<text>,
+		Pattern text,
+		Domains list<text>,
+		PRIMARY KEY ((ServerID), Position))`,
+	`CREATE TABLE IF NOT EXISTS flagged_messages (
+		ServerID text,
+		MessageID timeuuid,
+		ChannelID text,
+		UserID text,
+		Reasons list<text>,
+		FlaggedAt timestamp,
+		PRIMARY KEY ((ServerID), MessageID))`,
+	`CREATE TABLE IF NOT EXISTS reports (
+		ServerID text,
+		ID timeuuid,
+		ChannelID text,
+		MessageID text,
+		AuthorID text,
+		ReporterID text,
+		Category text,
+		Details text,
+		Status text,
+		ClaimedBy text,
+		Resolution text,
+		Note text,
+		CreatedAt timestamp,
+		ClaimedAt timestamp,
+		ResolvedAt timestamp,
+		PRIMARY KEY ((ServerID), ID))`,
+	`CREATE TABLE IF NOT EXISTS reports_by_reporter (
+		ReporterID text,
+		ServerID text,
+		ID timeuuid,
+		PRIMARY KEY ((ReporterID), ServerID, ID))`,
+	`CREATE TABLE IF NOT EXISTS moderation_audit (
+		ServerID text,
+		ID timeuuid,
+		ModeratorID text,
+		Action text,
+		ReportID text,
+		MessageID text,
+		Detail text,
+		At timestamp,
+		PRIMARY KEY ((ServerID), ID))`,
+	`CREATE TABLE IF NOT EXISTS pins (
+		ServerID text,
+		ChannelID text,
+		ID timeuuid,
+		MessageID text,
+		PinnedBy text,
+		PRIMARY KEY ((ServerID, ChannelID), ID))`,
+	`CREATE TABLE IF NOT EXISTS pin_limits (
+		ServerID text,
+		ChannelID text,
+		MaxPins int,
+		PRIMARY KEY ((ServerID, ChannelID)))`,
+	`CREATE TABLE IF NOT EXISTS pinned_messages (
+		ServerID text,
+		ChannelID text,
+		MessageID text,
+		PinID timeuuid,
+		PinnedBy text,
+		PRIMARY KEY ((ServerID, ChannelID), MessageID))`,
+	`CREATE TABLE IF NOT EXISTS pin_counts (
+		ServerID text,
+		ChannelID text,
+		Pinned int,
+		PRIMARY KEY ((ServerID, ChannelID)))`,
+	`CREATE TABLE IF NOT EXISTS mentions_by_user (
+		UserID text,
+		MessageID timeuuid,
+		ServerID text,
+		ChannelID text,
+		AuthorID text,
+		PRIMARY KEY ((UserID), MessageID))
+		WITH CLUSTERING ORDER BY (MessageID DESC)`,
+	`CREATE TABLE IF NOT EXISTS scheduled_messages (
+		ServerID text,
+		ID timeuuid,
+		ChannelID text,
+		UserID text,
+		Message text,
+		SendAt timestamp,
+		Status text,
+		ScheduledBy text,
+		ClaimedBy text,
+		ClaimedAt timestamp,
+		Attempts int,
+		MessageID text,
+		Error text,
+		CreatedAt timestamp,
+		SentAt timestamp,
+		PRIMARY KEY ((ServerID), ID))`,
+	`CREATE TABLE IF NOT EXISTS scheduled_due (
+		Shard int,
+		SendAt timestamp,
+		ServerID text,
+		ID timeuuid,
+		PRIMARY KEY ((Shard), SendAt, ServerID, ID))`,
+	`CREATE TABLE IF NOT EXISTS scheduled_by_user (
+		UserID text,
+		ServerID text,
+		ID timeuuid,
+		PRIMARY KEY ((UserID), ServerID, ID))`,
+	`CREATE TABLE IF NOT EXISTS read_states (
+		UserID text,
+		ChannelID text,
+		ServerID text,
+		LastReadID timeuuid,
+		UpdatedAt timestamp,
+		PRIMARY KEY ((UserID), ChannelID))`,
+	`CREATE TABLE IF NOT EXISTS drafts (
+		UserID text,
+		ChannelID text,
+		Message text,
+		UpdatedAt timestamp,
+		PRIMARY KEY ((UserID), ChannelID))`,
+	`CREATE TABLE IF NOT EXISTS poll_votes (
+		MessageID timeuuid,
+		UserID text,
+		Options list<int>,
+		VotedAt timestamp,
+		PRIMARY KEY ((MessageID), UserID))`,
+	`CREATE TABLE IF NOT EXISTS poll_votes_by_user (
+		UserID text,
+		MessageID timeuuid,
+		PRIMARY KEY ((UserID), MessageID))`,
+}
+
+type column struct {
+	table      string
+	name       string
+	columnType string
+}
+
+// columns added after their table was first created
+var columns = []column{
+	{"messages", "ChannelID", "text"},
+	{"deletion_jobs", "Anonymized", "int"},
+	{"deletion_jobs", "Tombstoned", "int"},
+	{"deletion_jobs", "Pseudonym", "text"},
+	{"deletion_jobs", "Deferred", "int"},
+	{"deletion_jobs", "KeyShredded", "boolean"},
+	{"user_keys", "ShreddedAt", "timestamp"},
+	{"messages", "MentionedUsers", "list<text>"},
+	{"messages", "MentionedRoles", "list<text>"},
+	{"messages", "MentionedChannels", "list<text>"},
+	{"messages", "MentionsEveryone", "boolean"},
+	{"messages_by_channel", "MentionedUsers", "list<text>"},
+	{"messages_by_channel", "MentionedRoles", "list<text>"},
+	{"messages_by_channel", "MentionedChannels", "list<text>"},
+	{"messages_by_channel", "MentionsEveryone", "boolean"},
+	{"messages", "Kind", "text"},
+	{"messages", "PollOptions", "list<text>"},
+	{"messages", "PollMultipleChoice", "boolean"},
+	{"messages", "PollExpiresAt", "timestamp"},
+	{"messages_by_channel", "Kind", "text"},
+	{"messages_by_channel", "PollOptions", "list<text>"},
+	{"messages_by_channel", "PollMultipleChoice", "boolean"},
+	{"messages_by_channel", "PollExpiresAt", "timestamp"},
+	{"messages", "System", "map<text, text>"},
+	{"messages_by_channel", "System", "map<text, text>"},
+	{"messages", "Embed", "text"},
+	{"messages", "Markdown", "text"},
+	{"messages_by_channel", "Embed", "text"},
+	{"messages_by_channel", "Markdown", "text"},
+	{"legal_hold_deferrals", "ProcessedAt", "timestamp"},
+}
+
+// MigrateSchema creates missing tables and columns. Every step can safely run
+// against a keyspace that is already up to date.
+func MigrateSchema(session *gocql.Session, keyspace string) {
+	for _, statement := range tables {
+		if err := session.Query(statement).Exec(); err != nil {
+			logger.WARN.Println("Failed to create table: ", err)
+		}
+	}
+
+	for _, column := range columns {
+		var name string
+		err := session.Query(
+			"SELECT column_name FROM system_schema.columns WHERE keyspace_name = ? AND table_name = ? AND column_name = ?",
+			keyspace, column.table, strings.ToLower(column.name)).Scan(&name)
+		if err == nil {
+			continue
+		}
+		if err != gocql.ErrNotFound {
+			logger.WARN.Println("Failed to look up column "+column.table+"."+column.name+": ", err)
+			continue
+		}
+
+		if err := session.Query(
+			"ALTER TABLE " + column.table + " ADD " + column.name + " " + column.columnType).Exec(); err != nil {
+			logger.WARN.Println("Failed to add column "+column.table+"."+column.name+": ", err)
+		}
+	}
+
+	logger.LOG.Println("Cassandra schema migration done!")
+}
@@ -0,0 +1,631 @@
+package deletion
+
+import (
+	"crypto/sha256"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// CompletedQueue tells the user-service that the messages of a user are gone
+	CompletedQueue = "user-deletion-completed"
+
+	ActionUserErased = "user_erased"
+
+	progressInterval = 100 // messages between two progress updates of a job
+	jobLease         = time.Minute
+)
+
+var (
+	ErrIncomplete = fmt.Errorf("%w: not every message could be deleted, resume the job", repository.ErrUnavailable)
+	errLeaseLost  = fmt.Errorf("%w: another instance took over the deletion", repository.ErrConflict)
+	errCovered    = errors.New("a legal hold covers a message of the user")
+)
+
+// Completed is the event published on CompletedQueue.
+type Completed struct {
+	JobID       string    `json:"job_id"`
+	UserID      string    `json:"user_id"`
+	Deleted     int       `json:"deleted"`
+	CompletedAt time.Time `json:"completed_at"`
+	AuditHash   string    `json:"audit_hash"`
+}
+
+// Deleter erases the messages of users as tracked jobs. A job that fails or
+// is interrupted keeps its progress and can be resumed, it only completes
+// once no message of the user is left, which is then recorded in the audit log.
+// Only the instance holding the lease on a user runs a job of theirs, the
+// messages are read page by page while it runs.
+// How a message is erased follows the deletion policy of its server, messages
+// under a legal hold are kept and the job waits for the hold to be released.
+// Unless a hold keeps some of them, the content key of the user is shredded
+// first, which makes every message of the user unreadable at once.
+type Deleter struct {
+	messages  repository.MessageRepository
+	jobs      repository.DeletionRepository
+	holds     *legalhold.Holds
+	keyring   *encryption.Keyring
+	events    events.Publisher
+	publisher messaging.Publisher
+
+	instance string
+
+	mutex    sync.Mutex
+	cleanups []func(userID string) error
+}
+
+func NewDeleter(messages *repository.MessageRepository, jobs *repository.DeletionRepository,
+	holds *legalhold.Holds, keyring *encryption.Keyring, events events.Publisher, publisher messaging.Publisher) *Deleter {
+	deleter := &Deleter{
+		messages:  *messages,
+		jobs:      *jobs,
+		holds:     holds,
+		keyring:   keyring,
+		events:    events,
+		publisher: publisher,
+		instance:  gocql.TimeUUID().String(),
+	}
+	holds.OnRelease(models.DeferredUserDeletion, deleter.resumeDeferred)
+	holds.OnRelease(models.DeferredMessageDeletion, deleter.deleteDeferred)
+	holds.OnRelease(models.DeferredMessageRemoval, deleter.removeDeferred)
+	return deleter
+}
+
+var errAlreadyRunning = fmt.Errorf("%w: the messages of this user are already being deleted", repository.ErrConflict)
+
+// acquire makes sure only one job per user runs across all instances at a time.
+func (deleter *Deleter) acquire(userID string) error {
+	acquired, err := deleter.jobs.AcquireLease(userID, deleter.instance, jobLease)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errAlreadyRunning
+	}
+	return nil
+}
+
+// renew keeps the lease of a running job, it fails once another instance took over.
+func (deleter *Deleter) renew(userID string) error {
+	renewed, err := deleter.jobs.RenewLease(userID, deleter.instance, jobLease)
+	if err != nil {
+		return err
+	}
+	if !renewed {
+		return errLeaseLost
+	}
+	return nil
+}
+
+func (deleter *Deleter) release(userID string) {
+	if err := deleter.jobs.ReleaseLease(userID, deleter.instance); err != nil {
+		logger.WARN.Printf("Failed to release the deletion lease of user %v, it expires: %v\n", userID, err)
+	}
+}
+
+// OnUserDeleted registers cleanup to remove the other data of users whose
+// messages are deleted. A failing cleanup fails the job, it runs again on resume.
+func (deleter *Deleter) OnUserDeleted(cleanup func(userID string) error) {
+	deleter.mutex.Lock()
+	defer deleter.mutex.Unlock()
+
+	deleter.cleanups = append(deleter.cleanups, cleanup)
+}
+
+// DeleteUser runs a new job deleting every message of the user.
+func (deleter *Deleter) DeleteUser(userID string) (models.DeletionJob, error) {
+	job, err := deleter.begin(userID)
+	if err != nil {
+		return job, err
+	}
+	defer deleter.release(userID)
+	return deleter.run(job)
+}
+
+// Start begins a new job deleting every message of the user and returns it
+// while it runs, GetJob follows its progress.
+func (deleter *Deleter) Start(userID string) (models.DeletionJob, error) {
+	job, err := deleter.begin(userID)
+	if err != nil {
+		return job, err
+	}
+	go deleter.runAndRelease(job)
+	return job, nil
+}
+
+// runAndRelease runs a job whose lease was acquired in the background.
+func (deleter *Deleter) runAndRelease(job models.DeletionJob) {
+	defer deleter.release(job.UserID)
+	if job, err := deleter.run(job); err != nil {
+		logger.WARN.Printf("Deletion job %v did not complete: %v\n", job.ID, err)
+	}
+}
+
+// begin acquires the user and stores a new job for them.
+func (deleter *Deleter) begin(userID string) (models.DeletionJob, error) {
+	if err := deleter.acquire(userID); err != nil {
+		return models.DeletionJob{}, err
+	}
+
+	now := time.Now().UTC()
+	job := models.DeletionJob{
+		ID:        gocql.TimeUUID().String(),
+		UserID:    userID,
+		Status:    models.DeletionRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := deleter.jobs.SaveJob(job); err != nil {
+		deleter.release(userID)
+		return job, err
+	}
+	return job, nil
+}
+
+func (deleter *Deleter) GetJob(id string) (*models.DeletionJob, error) {
+	return deleter.jobs.GetJob(id)
+}
+
+// Resume continues a job that failed or was interrupted.
+func (deleter *Deleter) Resume(id string) (models.DeletionJob, error) {
+	job, acquired, err := deleter.resume(id)
+	if !acquired {
+		return job, err
+	}
+	defer deleter.release(job.UserID)
+	return deleter.run(job)
+}
+
+// StartResume continues a job like Resume and returns it while it runs.
+func (deleter *Deleter) StartResume(id string) (models.DeletionJob, error) {
+	job, acquired, err := deleter.resume(id)
+	if !acquired {
+		return job, err
+	}
+	go deleter.runAndRelease(job)
+	return job, nil
+}
+
+// resume looks up a job to continue and acquires its user unless it completed.
+func (deleter *Deleter) resume(id string) (models.DeletionJob, bool, error) {
+	job, err := deleter.jobs.GetJob(id)
+	if err != nil {
+		return models.DeletionJob{}, false, err
+	}
+	if job.Status == models.DeletionCompleted {
+		return *job, false, nil
+	}
+	if err := deleter.acquire(job.UserID); err != nil {
+		return *job, false, err
+	}
+	return *job, true, nil
+}
+
+// ResumeRunning resumes the jobs interrupted by a restart.
+func (deleter *Deleter) ResumeRunning() {
+	jobs, err := deleter.jobs.GetJobsByStatus(models.DeletionRunning)
+	if err != nil {
+		logger.ERROR.Println("Failed to look up interrupted deletion jobs:", err)
+		return
+	}
+	for _, job := range jobs {
+		logger.LOG.Printf("Resuming deletion job %v of user %v\n", job.ID, job.UserID)
+		if _, err := deleter.Resume(job.ID); err != nil {
+			logger.WARN.Printf("Deletion job %v did not complete: %v\n", job.ID, err)
+		}
+	}
+}
+
+// run erases the remaining messages of the job, the caller acquired its user.
+func (deleter *Deleter) run(job models.DeletionJob) (models.DeletionJob, error) {
+	job.Status = models.DeletionRunning
+	job.Deferred = 0
+	job.Failed = 0
+	job.Error = ""
+	if job.Pseudonym == "" {
+		pseudonym, err := gocql.RandomUUID()
+		if err != nil {
+			return deleter.fail(job, err)
+		}
+		job.Pseudonym = pseudonym.String()
+	}
+
+	active, err := deleter.holds.Active()
+	if err != nil {
+		return deleter.fail(job, err)
+	}
+	covered := func(message *models.Message) error {
+		if len(active.Covering(*message)) > 0 {
+			return errCovered
+		}
+		return nil
+	}
+	// shredding is safe to repeat on resume, a shredded key is never created again
+	err = deleter.messages.ForEachByUserId(job.UserID, covered)
+	if err != nil && err != errCovered {
+		return deleter.fail(job, err)
+	}
+	if err == nil {
+		if err := deleter.keyring.Shred(job.UserID); err != nil {
+			return deleter.fail(job, err)
+		}
+		job.KeyShredded = true
+		job.UpdatedAt = time.Now().UTC()
+		if err := deleter.jobs.SaveJob(job); err != nil {
+			logger.WARN.Printf("Failed to save the progress of deletion job %v: %v\n", job.ID, err)
+		}
+	}
+
+	// keep going past failures so a single bad row never blocks the rest
+	var lastErr error
+	strategies := make(map[string]string) // server ID -> strategy
+	held := make(map[string]*models.LegalHold)
+	err = deleter.messages.ForEachByUserId(job.UserID, func(message *models.Message) error {
+		if covering := active.Covering(*message); len(covering) > 0 {
+			for _, hold := range covering {
+				held[hold.ID] = hold
+			}
+			job.Deferred++
+			return nil
+		}
+
+		strategy, found := strategies[message.ServerID]
+		if !found {
+			var err error
+			if strategy, err = deleter.Policy(message.ServerID); err != nil {
+				job.Failed++
+				lastErr = err
+				return nil
+			}
+			strategies[message.ServerID] = strategy
+		}
+
+		if err := deleter.erase(*message, strategy, &job); err != nil {
+			job.Failed++
+			lastErr = err
+			return nil
+		}
+
+		job.Deleted++
+		if job.Deleted%progressInterval != 0 {
+			return nil
+		}
+		job.UpdatedAt = time.Now().UTC()
+		if err := deleter.jobs.SaveJob(job); err != nil {
+			logger.WARN.Printf("Failed to save the progress of deletion job %v: %v\n", job.ID, err)
+		}
+		return deleter.renew(job.UserID)
+	})
+	if job.KeyShredded {
+		// after the loop, its events carry the content the key protected
+		deleter.events.Publish(events.New(events.UserErased, models.Message{UserID: job.UserID}))
+	}
+	if errors.Is(err, errLeaseLost) {
+		return job, err // the instance that took over records the job
+	}
+	if err != nil {
+		lastErr = err
+	}
+	if lastErr != nil {
+		return deleter.fail(job, lastErr)
+	}
+
+	if err := deleter.renew(job.UserID); err != nil {
+		return job, err
+	}
+	deleter.mutex.Lock()
+	cleanups := slices.Clone(deleter.cleanups)
+	deleter.mutex.Unlock()
+	for _, cleanup := range cleanups {
+		if err := cleanup(job.UserID); err != nil {
+			return deleter.fail(job, err)
+		}
+	}
+
+	// verify instead of trusting the loop, rows written meanwhile count too
+	remaining := 0
+	if err := deleter.messages.ForEachByUserId(job.UserID, func(message *models.Message) error {
+		if covered(message) == nil {
+			remaining++
+		}
+		return nil
+	}); err != nil {
+		return deleter.fail(job, err)
+	}
+	if remaining > 0 {
+		job.Failed = remaining
+		return deleter.fail(job, ErrIncomplete)
+	}
+
+	if job.Deferred > 0 {
+		return deleter.deferJob(job, held)
+	}
+	return deleter.complete(job)
+}
+
+// deferJob parks a job until the holds on the rest of the messages are released.
+func (deleter *Deleter) deferJob(job models.DeletionJob, held map[string]*models.LegalHold) (models.DeletionJob, error) {
+	job.Status = models.DeletionDeferred
+	job.Error = fmt.Sprintf("%v messages are under legal hold", job.Deferred)
+	job.UpdatedAt = time.Now().UTC()
+	if err := deleter.jobs.SaveJob(job); err != nil {
+		return job, err
+	}
+
+	holds := make([]*models.LegalHold, 0, len(held))
+	for _, hold := range held {
+		holds = append(holds, hold)
+	}
+	deleter.holds.Defer(holds, models.DeferredUserDeletion, job.ID,
+		fmt.Sprintf("%v messages of user %v", job.Deferred, job.UserID))
+	return job, nil
+}
+
+// ResumeDeferred resumes the deferred jobs no active hold covers anymore,
+// should the release of their holds not have resumed them.
+func (deleter *Deleter) ResumeDeferred() {
+	jobs, err := deleter.jobs.GetJobsByStatus(models.DeletionDeferred)
+	if err != nil {
+		logger.ERROR.Println("Failed to look up deferred deletion jobs:", err)
+		return
+	}
+	active, err := deleter.holds.Active()
+	if err != nil {
+		logger.ERROR.Println("Failed to look up the active legal holds:", err)
+		return
+	}
+	for _, job := range jobs {
+		err := deleter.messages.ForEachByUserId(job.UserID, func(message *models.Message) error {
+			if len(active.Covering(*message)) > 0 {
+				return errCovered
+			}
+			return nil
+		})
+		if err == errCovered {
+			continue
+		}
+		if err != nil {
+			logger.WARN.Printf("Failed to look up the messages of deferred deletion job %v: %v\n", job.ID, err)
+			continue
+		}
+		logger.LOG.Printf("Resuming deferred deletion job %v of user %v\n", job.ID, job.UserID)
+		if _, err := deleter.Resume(job.ID); err != nil {
+			logger.WARN.Printf("Deletion job %v did not complete: %v\n", job.ID, err)
+		}
+	}
+}
+
+// resumeDeferred continues a job once one of the holds deferring it is released.
+func (deleter *Deleter) resumeDeferred(deferral models.Deferral) error {
+	job, err := deleter.Resume(deferral.TargetID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		logger.WARN.Printf("Deletion job %v did not complete after legal hold %v was released: %v\n",
+			deferral.TargetID, deferral.HoldID, err)
+		return err
+	}
+	logger.LOG.Printf("Deletion job %v is %v after legal hold %v was released\n", job.ID, job.Status, deferral.HoldID)
+	return nil
+}
+
+// DeleteMessage deletes a single message unless a legal hold covers it, in
+// which case the deletion is recorded and deferred until the hold is released.
+func (deleter *Deleter) DeleteMessage(message models.Message, requestedBy string) (deferred bool, err error) {
+	active, err := deleter.holds.Active()
+	if err != nil {
+		return false, err
+	}
+	if covering := active.Covering(message); len(covering) > 0 {
+		deleter.holds.Defer(covering, models.DeferredMessageDeletion, message.ID, "deletion requested by "+requestedBy)
+		return true, nil
+	}
+
+	if err := deleter.messages.Delete(message); err != nil {
+		return false, err
+	}
+	deleter.events.Publish(events.New(events.MessageDeleted, message))
+	return false, nil
+}
+
+func (deleter *Deleter) deleteDeferred(deferral models.Deferral) error {
+	message, err := deleter.messages.GetById(deferral.TargetID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err == nil {
+		_, err = deleter.DeleteMessage(*message, "the release of legal hold "+deferral.HoldID)
+	}
+	if err != nil {
+		logger.WARN.Printf("Failed to delete message %v after legal hold %v was released: %v\n",
+			deferral.TargetID, deferral.HoldID, err)
+	}
+	return err
+}
+
+func (deleter *Deleter) removeDeferred(deferral models.Deferral) error {
+	message, err := deleter.messages.GetById(deferral.TargetID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err == nil {
+		_, err = deleter.RemoveMessage(*message, "the release of legal hold "+deferral.HoldID)
+	}
+	if err != nil {
+		logger.WARN.Printf("Failed to remove message %v after legal hold %v was released: %v\n",
+			deferral.TargetID, deferral.HoldID, err)
+	}
+	return err
+}
+
+// erase removes a message of the job or keeps it without its author and content.
+func (deleter *Deleter) erase(message models.Message, strategy string, job *models.DeletionJob) error {
+	switch strategy {
+	case models.DeletionAnonymize:
+		return deleter.replace(message, job.Pseudonym, &job.Anonymized)
+	case models.DeletionTombstone:
+		return deleter.replace(message, models.TombstoneUserID, &job.Tombstoned)
+	}
+
+	if err := deleter.messages.Delete(message); err != nil {
+		return err
+	}
+	deleter.events.Publish(events.New(events.MessageDeleted, message))
+	return nil
+}
+
+// replace keeps the message under another author with its content cleared.
+func (deleter *Deleter) replace(message models.Message, author string, count *int) error {
+	message.UserID = author
+	message.Message = ""
+	message.Mentions = models.Mentions{}
+	message.Poll = nil
+	message.Embed = nil
+	message.Markdown = nil
+	if err := deleter.messages.Update(message); err != nil {
+		return err
+	}
+	deleter.events.Publish(events.New(events.MessageUpdated, message))
+	*count++
+	return nil
+}
+
+func (deleter *Deleter) fail(job models.DeletionJob, err error) (models.DeletionJob, error) {
+	job.Status = models.DeletionFailed
+	job.Error = err.Error()
+	job.UpdatedAt = time.Now().UTC()
+	if saveErr := deleter.jobs.SaveJob(job); saveErr != nil {
+		logger.WARN.Printf("Failed to save deletion job %v: %v\n", job.ID, saveErr)
+	}
+	if err != ErrIncomplete {
+		err = fmt.Errorf("%w: %w", ErrIncomplete, err)
+	}
+	return job, err
+}
+
+func (deleter *Deleter) complete(job models.DeletionJob) (models.DeletionJob, error) {
+	completedAt := time.Now().UTC().Truncate(time.Millisecond) // the precision of a Cassandra timestamp
+	entry, err := deleter.jobs.AppendAudit(func(previousHash string) models.AuditEntry {
+		entry := models.AuditEntry{
+			ID:           gocql.TimeUUID().String(),
+			Action:       ActionUserErased,
+			UserID:       job.UserID,
+			JobID:        job.ID,
+			Messages:     job.Deleted,
+			At:           completedAt,
+			PreviousHash: previousHash,
+		}
+		entry.Hash = Hash(entry)
+		return entry
+	})
+	if err != nil {
+		return deleter.fail(job, err)
+	}
+
+	job.Status = models.DeletionCompleted
+	job.Pseudonym = "" // nothing may link the anonymized messages back to the user
+	job.UpdatedAt = completedAt
+	job.CompletedAt = &completedAt
+	if err := deleter.jobs.SaveJob(job); err != nil {
+		logger.WARN.Printf("Failed to save deletion job %v: %v\n", job.ID, err)
+	}
+
+	body, _ := json.Marshal(Completed{
+		JobID:       job.ID,
+		UserID:      job.UserID,
+		Deleted:     job.Deleted,
+		CompletedAt: completedAt,
+		AuditHash:   entry.Hash,
+	})
+	if err := deleter.publisher.Publish(CompletedQueue, body); err != nil {
+		logger.WARN.Printf("Failed to announce deletion job %v: %v\n", job.ID, err)
+	}
+	return job, nil
+}
+
+// RemoveMessage keeps a message as a tombstone, as moderators remove
+// messages, unless a legal hold covers it. Then the removal is deferred
+// until the hold is released.
+func (deleter *Deleter) RemoveMessage(message models.Message, requestedBy string) (deferred bool, err error) {
+	active, err := deleter.holds.Active()
+	if err != nil {
+		return false, err
+	}
+	if covering := active.Covering(message); len(covering) > 0 {
+		deleter.holds.Defer(covering, models.DeferredMessageRemoval, message.ID, "removal requested by "+requestedBy)
+		return true, nil
+	}
+
+	var removed int
+	return false, deleter.replace(message, models.TombstoneUserID, &removed)
+}
+
+// Policy returns the deletion strategy of a server, purge unless another one is set.
+func (deleter *Deleter) Policy(serverID string) (string, error) {
+	strategy, err := deleter.jobs.GetPolicy(serverID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.DeletionPurge, nil
+	}
+	return strategy, err
+}
+
+func (deleter *Deleter) SetPolicy(serverID string, policy models.DeletionPolicy) error {
+	return deleter.jobs.SetPolicy(serverID, policy.Strategy)
+}
+
+// Hash is the SHA-256 over every field of the entry but the hash itself.
+func Hash(entry models.AuditEntry) string {
+	sum := sha256.Sum256([]byte(entry.PreviousHash + "\n" + entry.ID + "\n" + entry.Action + "\n" +
+		entry.UserID + "\n" + entry.JobID + "\n" + strconv.Itoa(entry.Messages) + "\n" +
+		entry.At.UTC().Format(time.RFC3339Nano)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Audit returns the audit log and whether its hash chain is intact. The log
+// is the chain followed from the head through the previous hashes, entries
+// of appends that lost a race are not part of it.
+func (deleter *Deleter) Audit() (models.AuditLog, error) {
+	// the head first, every entry it reaches is stored before it moves
+	head, err := deleter.jobs.GetAuditHead()
+	if err != nil {
+		return models.AuditLog{}, err
+	}
+	entries, err := deleter.jobs.GetAudit()
+	if err != nil {
+		return models.AuditLog{}, err
+	}
+
+	byHash := make(map[string]*models.AuditEntry, len(entries))
+	for _, entry := range entries {
+		byHash[entry.Hash] = entry
+	}
+
+	log := models.AuditLog{Entries: []*models.AuditEntry{}, Valid: true}
+	for hash := head; hash != ""; {
+		entry, found := byHash[hash]
+		if !found || Hash(*entry) != entry.Hash || len(log.Entries) == len(entries) {
+			log.Valid = false
+			break
+		}
+		log.Entries = append(log.Entries, entry)
+		hash = entry.PreviousHash
+	}
+	slices.Reverse(log.Entries)
+	return log, nil
+}
@@ -0,0 +1,345 @@
+package deletion
+
+import (
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	bodies map[string][][]byte
+}
+
+func (publisher *recordingPublisher) Publish(queue string, body []byte) error {
+	publisher.bodies[queue] = append(publisher.bodies[queue], body)
+	return nil
+}
+
+// flakyRepository fails the first deletions it is asked for.
+type flakyRepository struct {
+	repository.MessageRepository
+	failures int
+}
+
+func (flaky *flakyRepository) Delete(message models.Message) error {
+	if flaky.failures > 0 {
+		flaky.failures--
+		return errors.New("timeout")
+	}
+	return flaky.MessageRepository.Delete(message)
+}
+
+func newDeleter(failures int) (*Deleter, repository.MessageRepository, *recordingPublisher) {
+	stored := repository.NewInMemoryMessageRepository()
+	var messages repository.MessageRepository = &flakyRepository{MessageRepository: stored, failures: failures}
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	keyring := encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider())
+	publisher := &recordingPublisher{bodies: make(map[string][][]byte)}
+	return NewDeleter(&messages, &jobs, legalhold.NewHolds(&holds), keyring, events.Publishers{}, publisher), stored, publisher
+}
+
+func save(t *testing.T, messages repository.MessageRepository, userID string, count int) {
+	for i := 0; i < count; i++ {
+		_, err := messages.Save(models.Message{
+			ID:        gocql.TimeUUID().String(),
+			UserID:    userID,
+			ServerID:  "server",
+			ChannelID: "channel",
+			Message:   "hello",
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	deleter, messages, publisher := newDeleter(0)
+	save(t, messages, "user", 3)
+	save(t, messages, "other", 1)
+
+	job, err := deleter.DeleteUser("user")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionCompleted, job.Status)
+	assert.Equal(t, 3, job.Deleted)
+	assert.True(t, job.KeyShredded)
+
+	remaining, _ := messages.GetAllByUserId("user")
+	assert.Empty(t, remaining)
+	remaining, _ = messages.GetAllByUserId("other")
+	assert.Len(t, remaining, 1)
+
+	log, err := deleter.Audit()
+	assert.NoError(t, err)
+	assert.True(t, log.Valid)
+	assert.Len(t, log.Entries, 1)
+
+	var completed Completed
+	assert.Len(t, publisher.bodies[CompletedQueue], 1)
+	assert.NoError(t, json.Unmarshal(publisher.bodies[CompletedQueue][0], &completed))
+	assert.Equal(t, job.ID, completed.JobID)
+	assert.Equal(t, log.Entries[0].Hash, completed.AuditHash)
+}
+
+func TestResumeFailedJob(t *testing.T) {
+	deleter, messages, publisher := newDeleter(2)
+	save(t, messages, "user", 5)
+
+	job, err := deleter.DeleteUser("user")
+	assert.ErrorIs(t, err, ErrIncomplete)
+	assert.ErrorIs(t, err, repository.ErrUnavailable)
+	assert.Equal(t, models.DeletionFailed, job.Status)
+	assert.Equal(t, 3, job.Deleted)
+	assert.Equal(t, 2, job.Failed)
+	assert.Empty(t, publisher.bodies[CompletedQueue])
+
+	job, err = deleter.Resume(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionCompleted, job.Status)
+	assert.Equal(t, 5, job.Deleted)
+	assert.Len(t, publisher.bodies[CompletedQueue], 1)
+}
+
+func TestAuditDetectsTampering(t *testing.T) {
+	deleter, messages, _ := newDeleter(0)
+	save(t, messages, "first", 1)
+	save(t, messages, "second", 1)
+	deleter.DeleteUser("first")
+	deleter.DeleteUser("second")
+
+	log, _ := deleter.Audit()
+	assert.True(t, log.Valid)
+	assert.Equal(t, log.Entries[0].Hash, log.Entries[1].PreviousHash)
+
+	log.Entries[0].Messages = 0 // the in-memory log hands out its own entries
+	log, _ = deleter.Audit()
+	assert.False(t, log.Valid)
+}
+
+// auditView changes what reading the audit log returns.
+type auditView struct {
+	repository.DeletionRepository
+	change func([]*models.AuditEntry) []*models.AuditEntry
+}
+
+func (view *auditView) GetAudit() ([]*models.AuditEntry, error) {
+	entries, err := view.DeletionRepository.GetAudit()
+	return view.change(entries), err
+}
+
+func TestAuditFollowsTheChainFromTheHead(t *testing.T) {
+	deleter, messages, _ := newDeleter(0)
+	save(t, messages, "first", 1)
+	save(t, messages, "second", 1)
+	deleter.DeleteUser("first")
+	deleter.DeleteUser("second")
+	jobs := deleter.jobs
+
+	// an append that lost the race to move the head after the first entry
+	deleter.jobs = &auditView{DeletionRepository: jobs, change: func(entries []*models.AuditEntry) []*models.AuditEntry {
+		orphan := models.AuditEntry{ID: gocql.TimeUUID().String(), Action: ActionUserErased, UserID: "third",
+			At: time.Now().UTC(), PreviousHash: entries[0].Hash}
+		orphan.Hash = Hash(orphan)
+		return append(entries, &orphan)
+	}}
+	log, err := deleter.Audit()
+	assert.NoError(t, err)
+	assert.True(t, log.Valid)
+	assert.Len(t, log.Entries, 2)
+	assert.Equal(t, "second", log.Entries[1].UserID)
+
+	deleter.jobs = &auditView{DeletionRepository: jobs, change: func(entries []*models.AuditEntry) []*models.AuditEntry {
+		return entries[1:]
+	}}
+	log, err = deleter.Audit()
+	assert.NoError(t, err)
+	assert.False(t, log.Valid, "a dropped entry breaks the chain")
+}
+
+func TestDeletionStrategies(t *testing.T) {
+	deleter, messages, _ := newDeleter(0)
+	assert.NoError(t, deleter.SetPolicy("anonymized", models.DeletionPolicy{Strategy: models.DeletionAnonymize}))
+	assert.NoError(t, deleter.SetPolicy("tombstoned", models.DeletionPolicy{Strategy: models.DeletionTombstone}))
+	for _, serverID := range []string{"purged", "anonymized", "anonymized", "tombstoned"} {
+		_, err := messages.Save(models.Message{
+			ID: gocql.TimeUUID().String(), UserID: "user", ServerID: serverID, ChannelID: serverID, Message: "hello",
+		})
+		assert.NoError(t, err)
+	}
+
+	job, err := deleter.DeleteUser("user")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, job.Deleted)
+	assert.Equal(t, 2, job.Anonymized)
+	assert.Equal(t, 1, job.Tombstoned)
+	assert.Empty(t, job.Pseudonym)
+
+	purged, _ := messages.GetAllByChannelId("purged", models.Page{})
+	assert.Empty(t, purged)
+
+	anonymized, _ := messages.GetAllByChannelId("anonymized", models.Page{})
+	assert.Len(t, anonymized, 2)
+	assert.NotEqual(t, "user", anonymized[0].UserID)
+	assert.Equal(t, anonymized[0].UserID, anonymized[1].UserID)
+	assert.Empty(t, anonymized[0].Message)
+
+	tombstoned, _ := messages.GetAllByChannelId("tombstoned", models.Page{})
+	assert.Len(t, tombstoned, 1)
+	assert.Equal(t, models.TombstoneUserID, tombstoned[0].UserID)
+	assert.Empty(t, tombstoned[0].Message)
+}
+
+func TestLegalHoldDefersDeletion(t *testing.T) {
+	deleter, messages, publisher := newDeleter(0)
+	save(t, messages, "user", 2)
+	held, _ := messages.Save(models.Message{
+		ID: gocql.TimeUUID().String(), UserID: "user", ServerID: "server", ChannelID: "investigated", Message: "hello",
+	})
+	hold, err := deleter.holds.Place(models.HoldRequest{
+		Scope: models.HoldScopeChannel, TargetID: "investigated", Reason: "case 42"}, "admin")
+	assert.NoError(t, err)
+
+	job, err := deleter.DeleteUser("user")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionDeferred, job.Status)
+	assert.Equal(t, 2, job.Deleted)
+	assert.Equal(t, 1, job.Deferred)
+	assert.False(t, job.KeyShredded) // the held message has to stay readable
+	assert.Empty(t, publisher.bodies[CompletedQueue])
+
+	deferred, err := deleter.DeleteMessage(*held, "user")
+	assert.NoError(t, err)
+	assert.True(t, deferred)
+	_, err = messages.GetById(held.ID)
+	assert.NoError(t, err)
+
+	found, _ := deleter.holds.Get(hold.ID)
+	assert.Len(t, found.Deferrals, 2)
+	assert.Equal(t, models.DeferredMessageDeletion, found.Deferrals[0].Kind)
+	assert.Equal(t, models.Deferral{
+		HoldID: hold.ID, Kind: models.DeferredUserDeletion, TargetID: job.ID,
+		Reason: "1 messages of user user", At: found.Deferrals[1].At,
+	}, *found.Deferrals[1])
+
+	_, err = deleter.holds.Release(hold.ID, "admin")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		job, _ := deleter.GetJob(job.ID)
+		return job.Status == models.DeletionCompleted
+	}, time.Second, 10*time.Millisecond)
+	remaining, _ := messages.GetAllByUserId("user")
+	assert.Empty(t, remaining)
+}
+
+func TestDeferredDeletionsSurviveARestart(t *testing.T) {
+	for name, recover := range map[string]func(*Deleter){
+		"the deferrals of released holds are retried": func(deleter *Deleter) { deleter.holds.RetryReleased() },
+		"deferred jobs no hold covers are resumed":    (*Deleter).ResumeDeferred,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var messages repository.MessageRepository = repository.NewInMemoryMessageRepository()
+			jobs := repository.NewInMemoryDeletionRepository()
+			holdStore := repository.NewInMemoryHoldRepository()
+			keys := repository.NewInMemoryKeyRepository()
+			start := func() *Deleter {
+				return NewDeleter(&messages, &jobs, legalhold.NewHolds(&holdStore),
+					encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider()), events.Publishers{},
+					&recordingPublisher{bodies: make(map[string][][]byte)})
+			}
+			deleter := start()
+			save(t, messages, "user", 2)
+			hold, err := deleter.holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "user", Reason: "case 42"}, "admin")
+			assert.NoError(t, err)
+			job, err := deleter.DeleteUser("user")
+			assert.NoError(t, err)
+			assert.Equal(t, models.DeletionDeferred, job.Status)
+
+			// released, but the process stopped before retrying the deferrals
+			releasedAt := time.Now().UTC()
+			hold.ReleasedBy, hold.ReleasedAt = "admin", &releasedAt
+			assert.NoError(t, holdStore.SaveHold(hold))
+
+			recover(start())
+			found, _ := deleter.GetJob(job.ID)
+			assert.Equal(t, models.DeletionCompleted, found.Status)
+			remaining, _ := messages.GetAllByUserId("user")
+			assert.Empty(t, remaining)
+		})
+	}
+}
+
+func TestProcessedDeferralsAreNotRetried(t *testing.T) {
+	deleter, messages, _ := newDeleter(0)
+	save(t, messages, "user", 1)
+	hold, _ := deleter.holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "user", Reason: "case 42"}, "admin")
+	job, _ := deleter.DeleteUser("user")
+
+	_, err := deleter.holds.Release(hold.ID, "admin")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		found, _ := deleter.holds.Get(hold.ID)
+		return len(found.Deferrals) == 1 && found.Deferrals[0].ProcessedAt != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// resuming the job again would also delete what the user wrote since
+	save(t, messages, "user", 1)
+	deleter.holds.RetryReleased()
+	found, _ := deleter.GetJob(job.ID)
+	assert.Equal(t, models.DeletionCompleted, found.Status)
+	remaining, _ := messages.GetAllByUserId("user")
+	assert.Len(t, remaining, 1)
+}
+
+func TestOnlyOneInstanceDeletesAUser(t *testing.T) {
+	var messages repository.MessageRepository = repository.NewInMemoryMessageRepository()
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	start := func() *Deleter {
+		return NewDeleter(&messages, &jobs, legalhold.NewHolds(&holds),
+			encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider()), events.Publishers{},
+			&recordingPublisher{bodies: make(map[string][][]byte)})
+	}
+	first, second := start(), start()
+	save(t, messages, "user", 3)
+
+	// the first instance holds the lease while its job runs
+	assert.NoError(t, first.acquire("user"))
+	_, err := second.DeleteUser("user")
+	assert.ErrorIs(t, err, repository.ErrConflict)
+	assert.NoError(t, first.renew("user"))
+	assert.ErrorIs(t, second.renew("user"), errLeaseLost)
+	first.release("user")
+
+	job, err := second.DeleteUser("user")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionCompleted, job.Status)
+	assert.NoError(t, first.acquire("user"), "the lease is released with the job")
+}
+
+func TestStartedJobsRunInTheBackground(t *testing.T) {
+	deleter, messages, _ := newDeleter(0)
+	save(t, messages, "user", 2*progressInterval+1)
+
+	job, err := deleter.Start("user")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionRunning, job.Status)
+	assert.Eventually(t, func() bool {
+		found, _ := deleter.GetJob(job.ID)
+		return found.Status == models.DeletionCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	found, _ := deleter.GetJob(job.ID)
+	assert.Equal(t, 2*progressInterval+1, found.Deleted)
+	remaining, _ := messages.GetAllByUserId("user")
+	assert.Empty(t, remaining)
+}
@@ -0,0 +1,102 @@
+package drafts
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultTTL = 30 * 24 * time.Hour
+	// how far ahead of the server a client clock may be, later edits would
+	// win over everything written until the server clock catches up
+	maximumSkew = time.Minute
+)
+
+var (
+	ErrInvalidTimestamp = fmt.Errorf("%w: updated_at can not be in the future", repository.ErrInvalidArgument)
+	ErrNotFound         = fmt.Errorf("%w: no draft in this channel", repository.ErrNotFound)
+	ErrOutdated         = fmt.Errorf("%w: the draft was changed more recently", repository.ErrConflict)
+)
+
+// Drafts keeps the draft of every user in every channel, so it follows them
+// between devices. Whichever device edited a draft last wins, no matter in
+// which order the edits arrive. A draft is dropped once it was not edited for
+// the TTL of the settings, and together with the messages of its user.
+type Drafts struct {
+	repository repository.DraftRepository
+	ttl        time.Duration
+}
+
+func NewDrafts(repository *repository.DraftRepository, settings configuration.DraftSettings) *Drafts {
+	ttl := settings.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Drafts{
+		repository: *repository,
+		ttl:        ttl,
+	}
+}
+
+// Save stores an edit of a draft. An edit older than the stored draft or its
+// deletion is discarded with ErrOutdated, returning the draft that won.
+func (drafts *Drafts) Save(userID string, channelID string, request models.DraftRequest) (models.Draft, error) {
+	draft := models.Draft{
+		UserID:    userID,
+		ChannelID: channelID,
+		Message:   request.Message,
+		UpdatedAt: request.UpdatedAt.UTC().Truncate(time.Millisecond), // the precision of a Cassandra timestamp
+	}
+	if draft.UpdatedAt.After(time.Now().Add(maximumSkew)) {
+		return models.Draft{}, ErrInvalidTimestamp
+	}
+	if err := drafts.repository.SaveDraft(draft, drafts.ttl); err != nil {
+		return models.Draft{}, err
+	}
+
+	stored, err := drafts.Get(userID, channelID)
+	if errors.Is(err, ErrNotFound) {
+		return models.Draft{}, ErrOutdated // deleted after the edit
+	}
+	if err != nil {
+		return models.Draft{}, err
+	}
+	if !stored.UpdatedAt.Equal(draft.UpdatedAt) {
+		return stored, ErrOutdated
+	}
+	return stored, nil
+}
+
+func (drafts *Drafts) Get(userID string, channelID string) (models.Draft, error) {
+	draft, err := drafts.repository.GetDraft(userID, channelID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.Draft{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Draft{}, err
+	}
+	return *draft, nil
+}
+
+// Delete discards a draft, typically because its message was sent at
+// deletion.UpdatedAt. Edits made later are kept.
+func (drafts *Drafts) Delete(userID string, channelID string, deletion models.DraftDeletion) error {
+	at := deletion.UpdatedAt.UTC().Truncate(time.Millisecond)
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	if at.After(time.Now().Add(maximumSkew)) {
+		return ErrInvalidTimestamp
+	}
+	return drafts.repository.DeleteDraft(userID, channelID, at)
+}
+
+// DeleteUser removes every draft of a user whose messages are deleted,
+// including those whose client clock is ahead.
+func (drafts *Drafts) DeleteUser(userID string) error {
+	return drafts.repository.DeleteDrafts(userID, time.Now().Add(maximumSkew))
+}
@@ -0,0 +1,101 @@
+package drafts
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(string, []byte) error { return nil }
+
+func newDrafts() (*Drafts, *deletion.Deleter) {
+	messages := repository.NewInMemoryMessageRepository()
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	keyring := encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider())
+	deleter := deletion.NewDeleter(&messages, &jobs, legalhold.NewHolds(&holds), keyring, events.Publishers{}, discardPublisher{})
+
+	store := repository.NewInMemoryDraftRepository()
+	drafts := NewDrafts(&store, configuration.DraftSettings{})
+	deleter.OnUserDeleted(drafts.DeleteUser)
+	return drafts, deleter
+}
+
+func TestTheLatestEditWins(t *testing.T) {
+	drafts, _ := newDrafts()
+	now := time.Now().UTC()
+
+	_, err := drafts.Get("alice", "general")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	saved, err := drafts.Save("alice", "general", models.DraftRequest{Message: "from the phone", UpdatedAt: now})
+	assert.NoError(t, err)
+	assert.Equal(t, "from the phone", saved.Message)
+
+	// the desktop was offline and syncs an edit made before
+	current, err := drafts.Save("alice", "general", models.DraftRequest{Message: "from the desktop", UpdatedAt: now.Add(-time.Second)})
+	assert.ErrorIs(t, err, ErrOutdated)
+	assert.Equal(t, "from the phone", current.Message)
+
+	_, err = drafts.Save("alice", "general", models.DraftRequest{Message: "too early", UpdatedAt: now.Add(time.Hour)})
+	assert.ErrorIs(t, err, ErrInvalidTimestamp)
+
+	_, err = drafts.Save("alice", "general", models.DraftRequest{Message: "edited again", UpdatedAt: now.Add(time.Second)})
+	assert.NoError(t, err)
+	draft, err := drafts.Get("alice", "general")
+	assert.NoError(t, err)
+	assert.Equal(t, "edited again", draft.Message)
+
+	_, err = drafts.Get("bob", "general")
+	assert.ErrorIs(t, err, ErrNotFound, "drafts are per user")
+}
+
+func TestDeletedDraftsStayDeleted(t *testing.T) {
+	drafts, _ := newDrafts()
+	now := time.Now().UTC()
+
+	_, _ = drafts.Save("alice", "general", models.DraftRequest{Message: "sent soon", UpdatedAt: now.Add(-time.Minute)})
+	assert.NoError(t, drafts.Delete("alice", "general", models.DraftDeletion{UpdatedAt: now}))
+	_, err := drafts.Get("alice", "general")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// an edit from before the message was sent arrives late
+	_, err = drafts.Save("alice", "general", models.DraftRequest{Message: "sent soon", UpdatedAt: now.Add(-time.Second)})
+	assert.ErrorIs(t, err, ErrOutdated)
+	_, err = drafts.Get("alice", "general")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = drafts.Save("alice", "general", models.DraftRequest{Message: "next message", UpdatedAt: now.Add(time.Second)})
+	assert.NoError(t, err)
+}
+
+func TestDraftsAreDeletedWithTheirUser(t *testing.T) {
+	drafts, deleter := newDrafts()
+	now := time.Now().UTC()
+
+	_, _ = drafts.Save("alice", "general", models.DraftRequest{Message: "hello", UpdatedAt: now})
+	_, _ = drafts.Save("alice", "random", models.DraftRequest{Message: "clock ahead", UpdatedAt: now.Add(30 * time.Second)})
+	_, _ = drafts.Save("bob", "general", models.DraftRequest{Message: "hi", UpdatedAt: now})
+
+	job, err := deleter.DeleteUser("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeletionCompleted, job.Status)
+
+	for _, channelID := range []string{"general", "random"} {
+		_, err = drafts.Get("alice", channelID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	_, err = drafts.Get("bob", "general")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,100 @@
+package embeds
+
+import (
+	"discard/message-service/pkg/markdown"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaximumTitle       = 256
+	MaximumDescription = 4096
+	MaximumURL         = 2048
+	MaximumFields      = 25
+	MaximumFieldName   = 256
+	MaximumFieldValue  = 1024
+	MaximumFooter      = 2048
+	// of all texts of an embed together
+	MaximumLength = 6000
+	MaximumColour = 0xFFFFFF
+)
+
+var ErrInvalidEmbed = fmt.Errorf("%w: invalid embed", repository.ErrInvalidArgument)
+
+// Prepare checks the embed of a new message. Only embeds carry one, with a
+// title, at most 25 fields and 6000 characters, a colour as 0xRRGGBB and a
+// link to an http or https URL. Surrounding spaces are trimmed.
+func Prepare(message *models.Message) error {
+	if message.Kind != models.KindEmbed {
+		if message.Embed != nil {
+			return fmt.Errorf("%w: only messages of kind %v carry an embed", ErrInvalidEmbed, models.KindEmbed)
+		}
+		return nil
+	}
+	if message.Embed == nil {
+		return fmt.Errorf("%w: a message of kind %v needs an embed", ErrInvalidEmbed, models.KindEmbed)
+	}
+
+	embed := *message.Embed
+	embed.Title = strings.TrimSpace(embed.Title)
+	embed.Description = strings.TrimSpace(embed.Description)
+	embed.URL = strings.TrimSpace(embed.URL)
+	embed.Footer = strings.TrimSpace(embed.Footer)
+	if embed.Title == "" {
+		return fmt.Errorf("%w: an embed needs a title", ErrInvalidEmbed)
+	}
+	if err := limit("title", embed.Title, MaximumTitle); err != nil {
+		return err
+	}
+	if err := limit("description", embed.Description, MaximumDescription); err != nil {
+		return err
+	}
+	if err := limit("footer", embed.Footer, MaximumFooter); err != nil {
+		return err
+	}
+	if err := limit("url", embed.URL, MaximumURL); err != nil {
+		return err
+	}
+	if embed.URL != "" && !markdown.IsWebURL(embed.URL) {
+		return fmt.Errorf("%w: the url has to be an http or https URL", ErrInvalidEmbed)
+	}
+	if embed.Colour < 0 || embed.Colour > MaximumColour {
+		return fmt.Errorf("%w: the colour is a 24 bit RGB value", ErrInvalidEmbed)
+	}
+
+	if len(embed.Fields) > MaximumFields {
+		return fmt.Errorf("%w: an embed has at most %d fields", ErrInvalidEmbed, MaximumFields)
+	}
+	length := utf8.RuneCountInString(embed.Title + embed.Description + embed.Footer)
+	embed.Fields = make([]models.EmbedField, 0, len(message.Embed.Fields))
+	for _, field := range message.Embed.Fields {
+		field.Name = strings.TrimSpace(field.Name)
+		field.Value = strings.TrimSpace(field.Value)
+		if field.Name == "" || field.Value == "" {
+			return fmt.Errorf("%w: fields need a name and a value", ErrInvalidEmbed)
+		}
+		if err := limit("field name", field.Name, MaximumFieldName); err != nil {
+			return err
+		}
+		if err := limit("field value", field.Value, MaximumFieldValue); err != nil {
+			return err
+		}
+		length += utf8.RuneCountInString(field.Name + field.Value)
+		embed.Fields = append(embed.Fields, field)
+	}
+	if length > MaximumLength {
+		return fmt.Errorf("%w: the texts of an embed have at most %d characters together", ErrInvalidEmbed, MaximumLength)
+	}
+	message.Embed = &embed
+	return nil
+}
+
+func limit(name string, text string, maximum int) error {
+	if utf8.RuneCountInString(text) > maximum {
+		return fmt.Errorf("%w: the %v has at most %d characters", ErrInvalidEmbed, name, maximum)
+	}
+	return nil
+}
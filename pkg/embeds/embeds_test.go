@@ -0,0 +1,61 @@
+package embeds
+
+import (
+	"discard/message-service/pkg/models"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func embedded(embed models.Embed) models.Message {
+	return models.Message{Message: "release notes", Kind: models.KindEmbed, Embed: &embed}
+}
+
+func TestPrepareTrimsEmbeds(t *testing.T) {
+	message := embedded(models.Embed{
+		Title:  " Release 1.2 ",
+		URL:    "https://example.com/releases",
+		Colour: 0x5865F2,
+		Fields: []models.EmbedField{{Name: " Fixes ", Value: "12", Inline: true}},
+		Footer: "deploy bot ",
+	})
+	assert.NoError(t, Prepare(&message))
+	assert.Equal(t, models.Embed{
+		Title:  "Release 1.2",
+		URL:    "https://example.com/releases",
+		Colour: 0x5865F2,
+		Fields: []models.EmbedField{{Name: "Fixes", Value: "12", Inline: true}},
+		Footer: "deploy bot",
+	}, *message.Embed)
+
+	text := models.Message{Message: "hi", Kind: models.KindText}
+	assert.NoError(t, Prepare(&text))
+}
+
+func TestPrepareRefusesInvalidEmbeds(t *testing.T) {
+	fields := make([]models.EmbedField, MaximumFields+1)
+	for i := range fields {
+		fields[i] = models.EmbedField{Name: "name", Value: "value"}
+	}
+	long := make([]models.EmbedField, 6)
+	for i := range long {
+		long[i] = models.EmbedField{Name: "name", Value: strings.Repeat("v", MaximumFieldValue)}
+	}
+
+	for _, message := range []models.Message{
+		{Message: "hi", Kind: models.KindText, Embed: &models.Embed{Title: "only embeds"}},
+		{Message: "hi", Kind: models.KindEmbed},
+		embedded(models.Embed{Title: "  "}),
+		embedded(models.Embed{Title: strings.Repeat("t", MaximumTitle+1)}),
+		embedded(models.Embed{Title: "t", URL: "javascript:alert(1)"}),
+		embedded(models.Embed{Title: "t", Colour: MaximumColour + 1}),
+		embedded(models.Embed{Title: "t", Fields: fields}),
+		embedded(models.Embed{Title: "t", Fields: []models.EmbedField{{Name: "name"}}}),
+		embedded(models.Embed{Title: "t", Fields: long}),
+	} {
+		err := Prepare(&message)
+		assert.True(t, errors.Is(err, ErrInvalidEmbed), "%+v: %v", message.Embed, err)
+	}
+}
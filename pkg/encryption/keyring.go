@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix marks encrypted content, content stored before encryption was
+// introduced has none and is read as it is.
+const prefix = "enc:v1:"
+
+// Keyring encrypts message content with a data key per author, wrapped by the
+// master key of a KeyProvider. Keys are looked up for every read, or once per
+// iteration with Opener, instead of being cached, so a shredded key takes
+// effect on every instance at once.
+type Keyring struct {
+	keys     repository.KeyRepository
+	provider KeyProvider
+}
+
+func NewKeyring(keys *repository.KeyRepository, provider KeyProvider) *Keyring {
+	return &Keyring{keys: *keys, provider: provider}
+}
+
+// Seal returns the content of a message encrypted with the key of its author.
+// The message ID is authenticated with it, so content cannot be moved to another row.
+func (keyring *Keyring) Seal(message models.Message) (string, error) {
+	if message.Message == "" {
+		return "", nil
+	}
+
+	aead, err := keyring.aead(message.UserID, true)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(message.Message), []byte(message.ID))
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts the content of the messages in place. Content of authors
+// whose key was shredded can never be read again and becomes empty, as does
+// content that fails to authenticate under the key of its author.
+func (keyring *Keyring) Open(messages ...*models.Message) error {
+	return keyring.Opener()(messages...)
+}
+
+// Opener returns an Open that keeps the keys it looked up across its calls, so
+// iterating over many messages reads the key of every author once. A key
+// shredded meanwhile stays usable to it, keep it for one iteration only.
+func (keyring *Keyring) Opener() func(messages ...*models.Message) error {
+	aeads := make(map[string]cipher.AEAD) // user ID -> AEAD, nil once shredded
+	return func(messages ...*models.Message) error {
+		return keyring.open(aeads, messages)
+	}
+}
+
+func (keyring *Keyring) open(aeads map[string]cipher.AEAD, messages []*models.Message) error {
+	for _, message := range messages {
+		if !strings.HasPrefix(message.Message, prefix) {
+			continue
+		}
+
+		aead, found := aeads[message.UserID]
+		if !found {
+			var err error
+			aead, err = keyring.aead(message.UserID, false)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+			aeads[message.UserID] = aead
+		}
+		if aead == nil {
+			message.Message = ""
+			continue
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(message.Message, prefix))
+		if err != nil {
+			return err
+		}
+		plaintext, err := open(aead, sealed, []byte(message.ID))
+		if err != nil {
+			// one unreadable row must not fail every page, export or sweep it is in
+			message.Message = ""
+			continue
+		}
+		message.Message = string(plaintext)
+	}
+	return nil
+}
+
+// Shred deletes the key of a user, which makes all of their content unreadable.
+// Sealing content of the user fails with repository.ErrShredded afterwards.
+// Content stored before encryption was introduced is not covered, it stays
+// readable wherever a copy of it is kept.
+func (keyring *Keyring) Shred(userID string) error {
+	return keyring.keys.DeleteKey(userID)
+}
+
+// aead returns the cipher of the data key of a user, creating the key if asked to.
+func (keyring *Keyring) aead(userID string, create bool) (cipher.AEAD, error) {
+	wrapped, err := keyring.keys.GetKey(userID)
+	if errors.Is(err, repository.ErrNotFound) && create {
+		wrapped, err = keyring.create(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := keyring.provider.Unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(dataKey)
+}
+
+func (keyring *Keyring) create(userID string) ([]byte, error) {
+	dataKey, err := randomBytes(keySize)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := keyring.provider.Wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	// another writer may have created a key first, everyone has to use the stored one
+	return keyring.keys.CreateKey(userID, wrapped)
+}
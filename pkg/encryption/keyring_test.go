@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newKeyring() *Keyring {
+	keys := repository.NewInMemoryKeyRepository()
+	return NewKeyring(&keys, NewInMemoryKeyProvider())
+}
+
+func TestSealAndOpen(t *testing.T) {
+	keyring := newKeyring()
+	message := models.Message{ID: "1", UserID: "user", Message: "hello"}
+
+	content, err := keyring.Seal(message)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content, prefix))
+	assert.NotContains(t, content, "hello")
+
+	stored := message
+	stored.Message = content
+	plaintext := models.Message{ID: "2", UserID: "user", Message: "written before encryption"}
+	assert.NoError(t, keyring.Open(&stored, &plaintext))
+	assert.Equal(t, "hello", stored.Message)
+	assert.Equal(t, "written before encryption", plaintext.Message)
+
+	// content moved to another row fails to authenticate and reads as shredded
+	moved := models.Message{ID: "3", UserID: "user", Message: content}
+	assert.NoError(t, keyring.Open(&moved))
+	assert.Empty(t, moved.Message)
+}
+
+func TestShredMakesContentUnreadable(t *testing.T) {
+	keyring := newKeyring()
+	content, err := keyring.Seal(models.Message{ID: "1", UserID: "user", Message: "hello"})
+	assert.NoError(t, err)
+	other, err := keyring.Seal(models.Message{ID: "2", UserID: "other", Message: "hi"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, keyring.Shred("user"))
+
+	shredded := models.Message{ID: "1", UserID: "user", Message: content}
+	kept := models.Message{ID: "2", UserID: "other", Message: other}
+	assert.NoError(t, keyring.Open(&shredded, &kept))
+	assert.Empty(t, shredded.Message)
+	assert.Equal(t, "hi", kept.Message)
+
+	// no new key is created, which would leave the old rows failing to authenticate
+	_, err = keyring.Seal(models.Message{ID: "3", UserID: "user", Message: "again"})
+	assert.ErrorIs(t, err, repository.ErrShredded)
+	assert.NoError(t, keyring.Shred("user"))
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "master.key")
+	_, err := NewFileKeyProvider(path, false)
+	assert.Error(t, err, "a missing key is only created when asked to")
+	_, err = NewFileKeyProvider("", true)
+	assert.Error(t, err)
+
+	created, err := NewFileKeyProvider(path, true)
+	assert.NoError(t, err)
+	wrapped, err := created.Wrap([]byte("data key"))
+	assert.NoError(t, err)
+
+	// a restart reads the same master key back
+	loaded, err := NewFileKeyProvider(path, false)
+	assert.NoError(t, err)
+	dataKey, err := loaded.Unwrap(wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data key"), dataKey)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not hex"), 0o600))
+	_, err = NewFileKeyProvider(path, false)
+	assert.Error(t, err)
+}
+
+type countingKeys struct {
+	repository.KeyRepository
+	reads int
+}
+
+func (keys *countingKeys) GetKey(userID string) ([]byte, error) {
+	keys.reads++
+	return keys.KeyRepository.GetKey(userID)
+}
+
+func TestOpenerReadsEveryKeyOnce(t *testing.T) {
+	var keys repository.KeyRepository = &countingKeys{KeyRepository: repository.NewInMemoryKeyRepository()}
+	keyring := NewKeyring(&keys, NewInMemoryKeyProvider())
+
+	var stored []models.Message
+	for _, id := range []string{"1", "2", "3"} {
+		content, err := keyring.Seal(models.Message{ID: id, UserID: "user", Message: "hello " + id})
+		assert.NoError(t, err)
+		stored = append(stored, models.Message{ID: id, UserID: "user", Message: content})
+	}
+
+	counting := keys.(*countingKeys)
+	counting.reads = 0
+	open := keyring.Opener()
+	for i := range stored {
+		assert.NoError(t, open(&stored[i]))
+		assert.Equal(t, "hello "+stored[i].ID, stored[i].Message)
+	}
+	assert.Equal(t, 1, counting.reads)
+}
@@ -0,0 +1,123 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const keySize = 32 // AES-256
+
+// KeyProvider wraps data keys with a master key it never hands out, as a key
+// management service does.
+type KeyProvider interface {
+	Wrap(dataKey []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// localKeyProvider holds the master key in memory.
+type localKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// NewFileKeyProvider reads the hex encoded master key from path. A missing
+// file is an error unless create is set, then a random key is written to it.
+// Creating is meant for development only: every data key wrapped by a lost or
+// per instance master key can never be unwrapped again.
+func NewFileKeyProvider(path string, create bool) (KeyProvider, error) {
+	if path == "" {
+		return nil, errors.New("no master key file is configured")
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, fmt.Errorf("master key file %v does not exist: %w", path, err)
+		}
+		masterKey, err := randomBytes(keySize)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(masterKey)+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+		return newLocalKeyProvider(masterKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("master key file %v is not hex encoded: %w", path, err)
+	}
+	return newLocalKeyProvider(masterKey)
+}
+
+// NewInMemoryKeyProvider uses a random master key that dies with the process.
+func NewInMemoryKeyProvider() KeyProvider {
+	masterKey, err := randomBytes(keySize)
+	if err != nil {
+		panic(err)
+	}
+	provider, _ := newLocalKeyProvider(masterKey)
+	return provider
+}
+
+func newLocalKeyProvider(masterKey []byte) (KeyProvider, error) {
+	if len(masterKey) != keySize {
+		return nil, fmt.Errorf("the master key has to be %v bytes, not %v", keySize, len(masterKey))
+	}
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &localKeyProvider{aead: aead}, nil
+}
+
+func (provider *localKeyProvider) Wrap(dataKey []byte) ([]byte, error) {
+	return seal(provider.aead, dataKey, nil)
+}
+
+func (provider *localKeyProvider) Unwrap(wrapped []byte) ([]byte, error) {
+	return open(provider.aead, wrapped, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext behind a random nonce.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	bytes := make([]byte, size)
+	_, err := rand.Read(bytes)
+	return bytes, err
+}
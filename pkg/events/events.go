@@ -0,0 +1,51 @@
+package events
+
+import (
+	"discard/message-service/pkg/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type Type string
+
+const (
+	MessageCreated Type = "message.created"
+	MessageUpdated Type = "message.updated"
+	MessageDeleted Type = "message.deleted"
+	// UserErased tells that the key of a user was shredded, the message only
+	// carries the user ID. Whatever keeps content in memory forgets theirs.
+	UserErased Type = "user.erased"
+)
+
+// Event is a change to a message. Its ID is a time UUID so it doubles as the
+// cursor clients resume from, for created messages it is the message ID.
+type Event struct {
+	ID        string         `json:"id"`
+	Type      Type           `json:"type"`
+	Message   models.Message `json:"message"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+type Publisher interface {
+	Publish(event Event)
+}
+
+func New(eventType Type, message models.Message) Event {
+	id := gocql.TimeUUID()
+	if eventType == MessageCreated {
+		if parsed, err := gocql.ParseUUID(message.ID); err == nil && parsed.Version() == 1 {
+			id = parsed
+		}
+	}
+	return Event{ID: id.String(), Type: eventType, Message: message, Timestamp: id.Time()}
+}
+
+// Publishers fans every event out to all of its publishers in order.
+type Publishers []Publisher
+
+func (publishers Publishers) Publish(event Event) {
+	for _, publisher := range publishers {
+		publisher.Publish(event)
+	}
+}
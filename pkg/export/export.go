@@ -0,0 +1,332 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// CompletedQueue receives an event for every finished export
+const CompletedQueue = "user-export-completed"
+
+var (
+	ErrNotFound         = fmt.Errorf("%w: no such export", repository.ErrNotFound)
+	ErrInvalidSignature = errors.New("invalid or expired download signature")
+)
+
+// Completed is the event published on CompletedQueue.
+type Completed struct {
+	ExportID  string     `json:"export_id"`
+	UserID    string     `json:"user_id"`
+	Status    string     `json:"status"`
+	Download  string     `json:"download,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type manifest struct {
+	ExportID    string            `json:"export_id"`
+	UserID      string            `json:"user_id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+	Files       []manifestFile    `json:"files"`
+	NotStored   map[string]string `json:"not_stored"`
+}
+
+type manifestFile struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// notStored explains the categories of a subject access request this service
+// has no data for.
+var notStored = map[string]string{
+	"edits":       "messages are stored in their latest version only",
+	"reactions":   "reactions are not stored by the message service",
+	"attachments": "attachments are not stored by the message service",
+}
+
+// Exporter writes the messages, drafts and poll votes of a user into a zip
+// archive of NDJSON files and a manifest, and announces finished archives
+// with a signed link. The state of every export is stored, so a restart
+// resumes the running ones.
+type Exporter struct {
+	messages  repository.MessageRepository
+	drafts    repository.DraftRepository
+	polls     repository.PollRepository
+	exports   repository.ExportRepository
+	publisher messaging.Publisher
+	settings  configuration.ExportSettings
+
+	mutex sync.Mutex // serializes starts on this instance
+}
+
+func NewExporter(messages *repository.MessageRepository, drafts *repository.DraftRepository, polls *repository.PollRepository,
+	exports *repository.ExportRepository, publisher messaging.Publisher, settings configuration.ExportSettings) *Exporter {
+	return &Exporter{
+		messages:  *messages,
+		drafts:    *drafts,
+		polls:     *polls,
+		exports:   *exports,
+		publisher: publisher,
+		settings:  settings,
+	}
+}
+
+// Start exports the data of a user in the background. While an export of the
+// user is running it is returned instead of starting another one.
+func (exporter *Exporter) Start(userID string) (models.Export, error) {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	exports, err := exporter.exports.GetExportsByUser(userID)
+	if err != nil {
+		return models.Export{}, err
+	}
+	for _, export := range exports {
+		if export.Status == models.ExportRunning {
+			return *export, nil
+		}
+	}
+
+	exporter.removeExpired()
+	export := models.Export{
+		ID:        gocql.TimeUUID().String(),
+		UserID:    userID,
+		Status:    models.ExportRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := exporter.exports.SaveExport(export, 0); err != nil {
+		return models.Export{}, err
+	}
+	go exporter.run(export)
+	return export, nil
+}
+
+// ResumeRunning restarts the exports interrupted by a restart.
+func (exporter *Exporter) ResumeRunning() {
+	exports, err := exporter.exports.GetRunningExports()
+	if err != nil {
+		logger.ERROR.Println("Failed to look up running exports:", err)
+		return
+	}
+	for _, export := range exports {
+		logger.LOG.Printf("Resuming export %v of user %v\n", export.ID, export.UserID)
+		go exporter.run(*export)
+	}
+}
+
+func (exporter *Exporter) Get(id string) (models.Export, error) {
+	export, err := exporter.exports.GetExport(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.Export{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Export{}, err
+	}
+	return *export, nil
+}
+
+// Open returns the path of an archive after checking its download signature.
+func (exporter *Exporter) Open(id string, expires string, signature string) (string, error) {
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > seconds {
+		return "", ErrInvalidSignature
+	}
+	expected := exporter.sign(id, seconds)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", ErrInvalidSignature
+	}
+
+	path := exporter.path(id)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+func (exporter *Exporter) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(exporter.settings.SigningKey))
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path only accepts time UUIDs so an ID can never point outside the directory.
+func (exporter *Exporter) path(id string) string {
+	if _, err := gocql.ParseUUID(id); err != nil {
+		id = "invalid"
+	}
+	return filepath.Join(exporter.settings.Directory, id+".zip")
+}
+
+// removeExpired deletes the archives, and what is left of interrupted ones,
+// older than their links.
+func (exporter *Exporter) removeExpired() {
+	entries, err := os.ReadDir(exporter.settings.Directory)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && !entry.IsDir() && time.Since(info.ModTime()) > exporter.settings.LinkTTL {
+			os.Remove(filepath.Join(exporter.settings.Directory, entry.Name()))
+		}
+	}
+}
+
+func (exporter *Exporter) run(export models.Export) {
+	count, err := exporter.write(export)
+
+	completedAt := time.Now().UTC()
+	export.CompletedAt = &completedAt
+	export.Messages = count
+	if err != nil {
+		logger.ERROR.Printf("Failed to export the data of user %v: %v\n", export.UserID, err)
+		export.Status = models.ExportFailed
+		export.Error = "Export failed, start a new one"
+	} else {
+		expiresAt := completedAt.Add(exporter.settings.LinkTTL)
+		export.Status = models.ExportCompleted
+		export.ExpiresAt = &expiresAt
+		export.Download = fmt.Sprintf("/api/v1/message/export/%v/download?expires=%v&signature=%v",
+			export.ID, expiresAt.Unix(), exporter.sign(export.ID, expiresAt.Unix()))
+	}
+	// the export is forgotten together with its archive
+	if err := exporter.exports.SaveExport(export, exporter.settings.LinkTTL); err != nil {
+		logger.ERROR.Printf("Failed to store the status of export %v: %v\n", export.ID, err)
+	}
+
+	event := Completed{
+		ExportID:  export.ID,
+		UserID:    export.UserID,
+		Status:    export.Status,
+		Download:  export.Download,
+		ExpiresAt: export.ExpiresAt,
+	}
+	body, _ := json.Marshal(event)
+	if err := exporter.publisher.Publish(CompletedQueue, body); err != nil {
+		logger.WARN.Printf("Failed to announce export %v: %v\n", export.ID, err)
+	}
+}
+
+// write creates the archive next to its final path and moves it there once
+// it is complete, so a download never sees a partial archive.
+func (exporter *Exporter) write(export models.Export) (int, error) {
+	if err := os.MkdirAll(exporter.settings.Directory, 0o700); err != nil {
+		return 0, err
+	}
+	file, err := os.CreateTemp(exporter.settings.Directory, export.ID+".*.partial")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	// messages are written as they are read, the history never sits in memory
+	messages, err := writeFile(archive, "messages.ndjson", func(encode func(any) error) error {
+		return exporter.messages.ForEachByUserId(export.UserID, func(message *models.Message) error {
+			return encode(message)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	drafts, err := writeFile(archive, "drafts.ndjson", func(encode func(any) error) error {
+		drafts, err := exporter.drafts.GetDrafts(export.UserID)
+		if err != nil {
+			return err
+		}
+		for _, draft := range drafts {
+			if err := encode(draft); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	votes, err := writeFile(archive, "poll_votes.ndjson", func(encode func(any) error) error {
+		polls, err := exporter.polls.GetVotedPolls(export.UserID)
+		if err != nil {
+			return err
+		}
+		for _, messageID := range polls {
+			vote, err := exporter.polls.GetVote(messageID, export.UserID)
+			if errors.Is(err, repository.ErrNotFound) { // withdrawn meanwhile
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := encode(vote); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return 0, err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest{
+		ExportID:    export.ID,
+		UserID:      export.UserID,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: time.Now().UTC(),
+		Files:       []manifestFile{messages, drafts, votes},
+		NotStored:   notStored,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return messages.Records, os.Rename(file.Name(), exporter.path(export.ID))
+}
+
+// writeFile adds an NDJSON file with every record each encodes to the archive.
+func writeFile(archive *zip.Writer, name string, each func(encode func(record any) error) error) (manifestFile, error) {
+	file := manifestFile{Name: name}
+	entry, err := archive.Create(name)
+	if err != nil {
+		return file, err
+	}
+	checksum := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(entry, checksum))
+	err = each(func(record any) error {
+		file.Records++
+		return encoder.Encode(record)
+	})
+	file.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	return file, err
+}
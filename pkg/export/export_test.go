@@ -0,0 +1,184 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	completed chan Completed
+}
+
+func (publisher *recordingPublisher) Publish(queue string, body []byte) error {
+	var event Completed
+	if err := json.Unmarshal(body, &event); err != nil {
+		return err
+	}
+	publisher.completed <- event
+	return nil
+}
+
+func newExporter(t *testing.T, messages repository.MessageRepository, exports repository.ExportRepository) (*Exporter, chan Completed) {
+	return newExporterWith(t, messages, repository.NewInMemoryDraftRepository(), repository.NewInMemoryPollRepository(), exports)
+}
+
+func newExporterWith(t *testing.T, messages repository.MessageRepository, drafts repository.DraftRepository,
+	polls repository.PollRepository, exports repository.ExportRepository) (*Exporter, chan Completed) {
+	publisher := &recordingPublisher{completed: make(chan Completed, 10)}
+	return NewExporter(&messages, &drafts, &polls, &exports, publisher, configuration.ExportSettings{
+		Directory:  t.TempDir(),
+		SigningKey: "secret",
+		LinkTTL:    time.Hour,
+	}), publisher.completed
+}
+
+func waitFor(t *testing.T, completed chan Completed) Completed {
+	select {
+	case event := <-completed:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("the export did not complete")
+		return Completed{}
+	}
+}
+
+func TestExportWritesEveryMessageOfTheUser(t *testing.T) {
+	messages := repository.NewInMemoryMessageRepository()
+	for _, message := range []models.Message{
+		{UserID: "alice", ChannelID: "general", Message: "one"},
+		{UserID: "bob", ChannelID: "general", Message: "not hers"},
+		{UserID: "alice", ChannelID: "random", Message: "two"},
+	} {
+		_, err := messages.Save(message)
+		assert.NoError(t, err)
+	}
+	exporter, completed := newExporter(t, messages, repository.NewInMemoryExportRepository())
+
+	started, err := exporter.Start("alice")
+	assert.NoError(t, err)
+	event := waitFor(t, completed)
+	assert.Equal(t, models.ExportCompleted, event.Status)
+
+	stored, err := exporter.Get(started.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stored.Messages)
+
+	archive, err := zip.OpenReader(exporter.path(started.ID))
+	assert.NoError(t, err)
+	defer archive.Close()
+	file, err := archive.Open("messages.ndjson")
+	assert.NoError(t, err)
+	var contents []string
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var message models.Message
+		assert.NoError(t, json.Unmarshal(lines.Bytes(), &message))
+		contents = append(contents, message.Message)
+	}
+	assert.ElementsMatch(t, []string{"one", "two"}, contents)
+}
+
+// records reads the records of an NDJSON file of an archive.
+func records[T any](t *testing.T, archive *zip.ReadCloser, name string) []T {
+	file, err := archive.Open(name)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var records []T
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var record T
+		assert.NoError(t, json.Unmarshal(lines.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestExportIncludesTheDraftsOfTheUser(t *testing.T) {
+	drafts := repository.NewInMemoryDraftRepository()
+	now := time.Now().UTC()
+	for _, draft := range []models.Draft{
+		{UserID: "alice", ChannelID: "general", Message: "almost done", UpdatedAt: now},
+		{UserID: "bob", ChannelID: "general", Message: "not hers", UpdatedAt: now},
+	} {
+		assert.NoError(t, drafts.SaveDraft(draft, time.Hour))
+	}
+	exporter, completed := newExporterWith(t, repository.NewInMemoryMessageRepository(), drafts,
+		repository.NewInMemoryPollRepository(), repository.NewInMemoryExportRepository())
+
+	started, err := exporter.Start("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportCompleted, waitFor(t, completed).Status)
+
+	archive, err := zip.OpenReader(exporter.path(started.ID))
+	assert.NoError(t, err)
+	defer archive.Close()
+	exported := records[models.Draft](t, archive, "drafts.ndjson")
+	assert.Len(t, exported, 1)
+	assert.Equal(t, "almost done", exported[0].Message)
+
+	file, err := archive.Open("manifest.json")
+	assert.NoError(t, err)
+	defer file.Close()
+	var listed manifest
+	assert.NoError(t, json.NewDecoder(file).Decode(&listed))
+	assert.Equal(t, "drafts.ndjson", listed.Files[1].Name)
+	assert.Equal(t, 1, listed.Files[1].Records)
+}
+
+func TestExportIncludesThePollVotesOfTheUser(t *testing.T) {
+	polls := repository.NewInMemoryPollRepository()
+	for _, vote := range []models.PollVote{
+		{MessageID: "6f1c54c4-93a1-11ee-9a52-8d4cf0d3d0a1", UserID: "alice", Options: []int{1}},
+		{MessageID: "6f1c54c4-93a1-11ee-9a52-8d4cf0d3d0a1", UserID: "bob", Options: []int{0}},
+	} {
+		_, err := polls.SaveVote(vote)
+		assert.NoError(t, err)
+	}
+	exporter, completed := newExporterWith(t, repository.NewInMemoryMessageRepository(), repository.NewInMemoryDraftRepository(),
+		polls, repository.NewInMemoryExportRepository())
+
+	started, err := exporter.Start("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportCompleted, waitFor(t, completed).Status)
+
+	archive, err := zip.OpenReader(exporter.path(started.ID))
+	assert.NoError(t, err)
+	defer archive.Close()
+	exported := records[models.PollVote](t, archive, "poll_votes.ndjson")
+	assert.Len(t, exported, 1)
+	assert.Equal(t, []int{1}, exported[0].Options)
+}
+
+func TestExportsSurviveARestart(t *testing.T) {
+	messages := repository.NewInMemoryMessageRepository()
+	exports := repository.NewInMemoryExportRepository()
+	interrupted := models.Export{ID: "6f1c54c4-93a1-11ee-9a52-8d4cf0d3d0a1", UserID: "alice",
+		Status: models.ExportRunning, CreatedAt: time.Now().UTC()}
+	assert.NoError(t, exports.SaveExport(interrupted, 0))
+
+	exporter, completed := newExporter(t, messages, exports)
+	started, err := exporter.Start("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, interrupted.ID, started.ID, "a running export is not started twice")
+
+	exporter.ResumeRunning()
+	assert.Equal(t, interrupted.ID, waitFor(t, completed).ExportID)
+
+	restarted, _ := newExporter(t, messages, exports)
+	stored, err := restarted.Get(interrupted.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportCompleted, stored.Status)
+	assert.NotEmpty(t, stored.Download)
+
+	_, err = restarted.Get("0e6c1f4e-3a55-11ee-8d38-7c0b5e9f2b7d")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
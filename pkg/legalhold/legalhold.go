@@ -0,0 +1,194 @@
+package legalhold
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrNotFound        = fmt.Errorf("%w: no such legal hold", repository.ErrNotFound)
+	ErrAlreadyReleased = fmt.Errorf("%w: the legal hold is already released", repository.ErrConflict)
+)
+
+// Holds places and releases legal holds. Whatever deletes messages asks it
+// for the active holds first and records the deletions they defer, which are
+// handed back to it through OnRelease once the hold is released. A deferral is
+// marked processed once handled, so a restart retries the rest.
+type Holds struct {
+	repository repository.HoldRepository
+
+	mutex     sync.Mutex
+	onRelease map[string]func(models.Deferral) error // kind -> handler
+}
+
+func NewHolds(repository *repository.HoldRepository) *Holds {
+	return &Holds{
+		repository: *repository,
+		onRelease:  make(map[string]func(models.Deferral) error),
+	}
+}
+
+// OnRelease calls handle with every deferral of a kind when its hold is
+// released. A deferral handle fails for is retried on the next start.
+func (holds *Holds) OnRelease(kind string, handle func(models.Deferral) error) {
+	holds.mutex.Lock()
+	defer holds.mutex.Unlock()
+
+	holds.onRelease[kind] = handle
+}
+
+func (holds *Holds) Place(request models.HoldRequest, placedBy string) (models.LegalHold, error) {
+	hold := models.LegalHold{
+		ID:       gocql.TimeUUID().String(),
+		Scope:    request.Scope,
+		TargetID: request.TargetID,
+		Reason:   request.Reason,
+		PlacedBy: placedBy,
+		PlacedAt: time.Now().UTC(),
+	}
+	return hold, holds.repository.SaveHold(hold)
+}
+
+// Get returns a hold together with the deletions it deferred.
+func (holds *Holds) Get(id string) (models.LegalHold, error) {
+	hold, err := holds.repository.GetHold(id)
+	if err == repository.ErrNotFound {
+		return models.LegalHold{}, ErrNotFound
+	}
+	if err != nil {
+		return models.LegalHold{}, err
+	}
+
+	hold.Deferrals, err = holds.repository.GetDeferrals(id)
+	return *hold, err
+}
+
+func (holds *Holds) List() ([]*models.LegalHold, error) {
+	list, err := holds.repository.GetHolds()
+	if list == nil {
+		list = []*models.LegalHold{}
+	}
+	return list, err
+}
+
+// Release lifts a hold and retries the deletions it deferred in the background.
+func (holds *Holds) Release(id string, releasedBy string) (models.LegalHold, error) {
+	hold, err := holds.Get(id)
+	if err != nil {
+		return hold, err
+	}
+	if hold.ReleasedAt != nil {
+		return hold, ErrAlreadyReleased
+	}
+
+	releasedAt := time.Now().UTC()
+	hold.ReleasedBy = releasedBy
+	hold.ReleasedAt = &releasedAt
+	if err := holds.repository.SaveHold(hold); err != nil {
+		return hold, err
+	}
+
+	go holds.retry(hold.Deferrals)
+	return hold, nil
+}
+
+// RetryReleased retries the deferrals of released holds that were not
+// processed before a restart.
+func (holds *Holds) RetryReleased() {
+	list, err := holds.repository.GetHolds()
+	if err != nil {
+		logger.ERROR.Println("Failed to look up released legal holds:", err)
+		return
+	}
+	for _, hold := range list {
+		if hold.ReleasedAt == nil {
+			continue
+		}
+		deferrals, err := holds.repository.GetDeferrals(hold.ID)
+		if err != nil {
+			logger.WARN.Printf("Failed to look up the deferrals of legal hold %v: %v\n", hold.ID, err)
+			continue
+		}
+		holds.retry(deferrals)
+	}
+}
+
+// retry hands the unprocessed deferrals to their handlers, kinds without one
+// are picked up by whatever deferred them, like the next retention sweep.
+func (holds *Holds) retry(deferrals []*models.Deferral) {
+	for _, deferral := range deferrals {
+		if deferral.ProcessedAt != nil {
+			continue
+		}
+		holds.mutex.Lock()
+		handle := holds.onRelease[deferral.Kind]
+		holds.mutex.Unlock()
+
+		if handle != nil {
+			if err := handle(*deferral); err != nil {
+				continue
+			}
+		}
+		processedAt := time.Now().UTC()
+		deferral.ProcessedAt = &processedAt
+		if err := holds.repository.SaveDeferral(*deferral); err != nil {
+			logger.WARN.Printf("Failed to mark the %v of %v deferred by legal hold %v processed: %v\n",
+				deferral.Kind, deferral.TargetID, deferral.HoldID, err)
+		}
+	}
+}
+
+// Active returns the holds in place right now.
+func (holds *Holds) Active() (Active, error) {
+	list, err := holds.repository.GetHolds()
+	if err != nil {
+		return nil, err
+	}
+
+	var active Active
+	for _, hold := range list {
+		if hold.ReleasedAt == nil {
+			active = append(active, hold)
+		}
+	}
+	return active, nil
+}
+
+// Defer records that the holds kept a deletion from happening.
+func (holds *Holds) Defer(held []*models.LegalHold, kind string, targetID string, reason string) {
+	for _, hold := range held {
+		err := holds.repository.SaveDeferral(models.Deferral{
+			HoldID:   hold.ID,
+			Kind:     kind,
+			TargetID: targetID,
+			Reason:   reason,
+			At:       time.Now().UTC(),
+		})
+		if err != nil {
+			logger.WARN.Printf("Failed to record the %v of %v deferred by legal hold %v: %v\n", kind, targetID, hold.ID, err)
+		}
+	}
+}
+
+// Active is a snapshot of the holds in place.
+type Active []*models.LegalHold
+
+// Covering returns the holds a message falls under.
+func (active Active) Covering(message models.Message) []*models.LegalHold {
+	var covering []*models.LegalHold
+	for _, hold := range active {
+		switch {
+		case hold.Scope == models.HoldScopeUser && hold.TargetID == message.UserID,
+			hold.Scope == models.HoldScopeServer && hold.TargetID == message.ServerID,
+			hold.Scope == models.HoldScopeChannel && hold.TargetID == message.ChannelID && message.ChannelID != "":
+			covering = append(covering, hold)
+		}
+	}
+	return covering
+}
@@ -0,0 +1,133 @@
+package legalhold
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHolds() (*Holds, repository.HoldRepository) {
+	store := repository.NewInMemoryHoldRepository()
+	return NewHolds(&store), store
+}
+
+func TestPlaceAndRelease(t *testing.T) {
+	holds, _ := newHolds()
+
+	hold, err := holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "alice", Reason: "litigation"}, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", hold.PlacedBy)
+	active, err := holds.Active()
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	released, err := holds.Release(hold.ID, "counsel")
+	assert.NoError(t, err)
+	assert.Equal(t, "counsel", released.ReleasedBy)
+	assert.NotNil(t, released.ReleasedAt)
+	active, _ = holds.Active()
+	assert.Empty(t, active)
+	list, _ := holds.List()
+	assert.Len(t, list, 1, "released holds stay listed")
+
+	_, err = holds.Release(hold.ID, "counsel")
+	assert.ErrorIs(t, err, ErrAlreadyReleased)
+	_, err = holds.Release("missing", "counsel")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCovering(t *testing.T) {
+	user := &models.LegalHold{ID: "user", Scope: models.HoldScopeUser, TargetID: "alice"}
+	server := &models.LegalHold{ID: "server", Scope: models.HoldScopeServer, TargetID: "server"}
+	channel := &models.LegalHold{ID: "channel", Scope: models.HoldScopeChannel, TargetID: "general"}
+	active := Active{user, server, channel}
+
+	assert.Equal(t, []*models.LegalHold{user, server, channel},
+		active.Covering(models.Message{UserID: "alice", ServerID: "server", ChannelID: "general"}))
+	assert.Equal(t, []*models.LegalHold{channel},
+		active.Covering(models.Message{UserID: "bob", ServerID: "other", ChannelID: "general"}))
+	assert.Empty(t, active.Covering(models.Message{UserID: "bob", ServerID: "other", ChannelID: "random"}))
+
+	unscoped := Active{&models.LegalHold{Scope: models.HoldScopeChannel, TargetID: ""}}
+	assert.Empty(t, unscoped.Covering(models.Message{UserID: "bob", ServerID: "other"}),
+		"messages without a channel fall under no channel hold")
+}
+
+func TestDeferralsAreHandedBackOnRelease(t *testing.T) {
+	holds, store := newHolds()
+	hold, _ := holds.Place(models.HoldRequest{Scope: models.HoldScopeServer, TargetID: "server", Reason: "audit"}, "admin")
+	other, _ := holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "alice", Reason: "audit"}, "admin")
+
+	active, _ := holds.Active()
+	holds.Defer(active, models.DeferredMessageDeletion, "message", "deleted by its author")
+	holds.Defer([]*models.LegalHold{&hold}, models.DeferredRetention, "general", "expired")
+	placed, err := holds.Get(hold.ID)
+	assert.NoError(t, err)
+	assert.Len(t, placed.Deferrals, 2)
+
+	handled := make(chan models.Deferral, 2)
+	holds.OnRelease(models.DeferredMessageDeletion, func(deferral models.Deferral) error {
+		handled <- deferral
+		return nil
+	})
+	_, err = holds.Release(hold.ID, "counsel")
+	assert.NoError(t, err)
+
+	select {
+	case deferral := <-handled:
+		assert.Equal(t, hold.ID, deferral.HoldID)
+		assert.Equal(t, "message", deferral.TargetID)
+	case <-time.After(time.Second):
+		t.Fatal("the deferred deletion was not handed back")
+	}
+	assert.Eventually(t, func() bool {
+		deferrals, _ := store.GetDeferrals(hold.ID)
+		for _, deferral := range deferrals {
+			if deferral.ProcessedAt == nil {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond, "kinds without a handler are marked processed as well")
+
+	deferrals, _ := store.GetDeferrals(other.ID)
+	if assert.Len(t, deferrals, 1) {
+		assert.Nil(t, deferrals[0].ProcessedAt, "the deferrals of holds still in place are kept")
+	}
+}
+
+func TestFailedDeferralsAreRetried(t *testing.T) {
+	holds, store := newHolds()
+	hold, _ := holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "alice", Reason: "audit"}, "admin")
+	holds.Defer([]*models.LegalHold{&hold}, models.DeferredUserDeletion, "job", "user deleted")
+
+	var attempts atomic.Int32
+	failed := make(chan struct{})
+	holds.OnRelease(models.DeferredUserDeletion, func(models.Deferral) error {
+		if attempts.Add(1) == 1 {
+			defer close(failed)
+			return errors.New("cassandra unavailable")
+		}
+		return nil
+	})
+	_, err := holds.Release(hold.ID, "counsel")
+	assert.NoError(t, err)
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("the deferred deletion was not handed back")
+	}
+
+	deferrals, _ := store.GetDeferrals(hold.ID)
+	assert.Nil(t, deferrals[0].ProcessedAt)
+
+	holds.RetryReleased()
+	deferrals, _ = store.GetDeferrals(hold.ID)
+	assert.NotNil(t, deferrals[0].ProcessedAt)
+	assert.Equal(t, int32(2), attempts.Load())
+}
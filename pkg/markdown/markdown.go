@@ -0,0 +1,348 @@
+package markdown
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaximumLength = 4000 // characters of the content
+	MaximumDepth  = 8    // of nested quotes and styles, deeper markup stays text
+	MaximumNodes  = 1000
+	// the longest language of a code block, longer ones are dropped
+	maximumLanguage = 32
+)
+
+var (
+	ErrTooLong    = fmt.Errorf("%w: a message has at most %d characters", repository.ErrInvalidArgument, MaximumLength)
+	ErrTooComplex = fmt.Errorf("%w: the markdown of a message has at most %d nodes", repository.ErrInvalidArgument, MaximumNodes)
+)
+
+// delimiters of the styles, longer ones are tried first so that ** is bold
+// and not two italics
+var styles = []struct {
+	delimiter string
+	node      string
+}{
+	{"**", models.NodeBold},
+	{"__", models.NodeUnderline},
+	{"~~", models.NodeStrikethrough},
+	{"||", models.NodeSpoiler},
+	{"*", models.NodeItalic},
+	{"_", models.NodeItalic},
+}
+
+// Parse turns the content of a message into the markdown every client
+// renders the same way. It knows paragraphs, quotes, fenced code blocks,
+// inline code, bold, italic, underline, strikethrough, spoilers and links to
+// http and https URLs, anything else is text. Line endings are normalized
+// and control characters dropped.
+func Parse(content string) ([]models.Node, error) {
+	if utf8.RuneCountInString(content) > MaximumLength {
+		return nil, ErrTooLong
+	}
+	parser := parser{}
+	nodes := parser.blocks(normalize(content), 0)
+	if parser.nodes > MaximumNodes {
+		return nil, ErrTooComplex
+	}
+	return nodes, nil
+}
+
+func normalize(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return '\n'
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, content)
+}
+
+type parser struct {
+	nodes int
+}
+
+func (parser *parser) node(node models.Node) models.Node {
+	parser.nodes++
+	return node
+}
+
+// blocks splits the content into paragraphs, quotes and code blocks.
+func (parser *parser) blocks(content string, depth int) []models.Node {
+	var nodes []models.Node
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case strings.HasPrefix(strings.TrimLeft(line, " "), "```"):
+			language := strings.TrimSpace(strings.TrimPrefix(strings.TrimLeft(line, " "), "```"))
+			if len(language) > maximumLanguage || strings.ContainsAny(language, " \t`") {
+				language = ""
+			}
+			i++
+			start := i
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "```" {
+				i++
+			}
+			code := strings.Join(lines[start:i], "\n")
+			i++ // the closing fence, an unclosed block runs to the end
+			nodes = append(nodes, parser.node(models.Node{Type: models.NodeCodeBlock, Text: code, Language: language}))
+		case strings.HasPrefix(line, ">") && depth < MaximumDepth:
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(lines[i], ">"); i++ {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(lines[i], ">"), " "))
+			}
+			nodes = append(nodes, parser.node(models.Node{
+				Type:     models.NodeBlockquote,
+				Children: parser.blocks(strings.Join(quoted, "\n"), depth+1),
+			}))
+		default:
+			start := i
+			for i++; i < len(lines) && !startsBlock(lines[i], depth); i++ {
+			}
+			nodes = append(nodes, parser.node(models.Node{
+				Type:     models.NodeParagraph,
+				Children: parser.inline(strings.Join(lines[start:i], "\n"), depth+1),
+			}))
+		}
+	}
+	return nodes
+}
+
+// startsBlock tells whether a line ends the paragraph before it.
+func startsBlock(line string, depth int) bool {
+	return strings.TrimSpace(line) == "" ||
+		strings.HasPrefix(strings.TrimLeft(line, " "), "```") ||
+		strings.HasPrefix(line, ">") && depth < MaximumDepth
+}
+
+// inline parses the styles, code and links of a paragraph. Text next to each
+// other ends up in a single node.
+func (parser *parser) inline(text string, depth int) []models.Node {
+	var nodes []models.Node
+	var buffer strings.Builder
+	scanner := scanner{text: text, spans: make(map[int]span)}
+	flush := func() {
+		if buffer.Len() > 0 {
+			nodes = append(nodes, parser.node(models.Node{Type: models.NodeText, Text: buffer.String()}))
+			buffer.Reset()
+		}
+	}
+	add := func(node models.Node) {
+		flush()
+		nodes = append(nodes, parser.node(node))
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunctuation(text[i+1]):
+			buffer.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '\n':
+			add(models.Node{Type: models.NodeLineBreak})
+			i++
+			continue
+		case c == '`':
+			if end, code, ok := codeSpan(text, i); ok {
+				add(models.Node{Type: models.NodeCode, Text: code})
+				i = end
+				continue
+			}
+			run := backticks(text, i)
+			buffer.WriteString(text[i : i+run])
+			i += run
+			continue
+		}
+
+		if depth < MaximumDepth {
+			if c == '[' {
+				if end, label, target, ok := link(text, i); ok {
+					add(models.Node{Type: models.NodeLink, URL: target, Children: parser.inline(label, depth+1)})
+					i = end
+					continue
+				}
+			}
+			if span := scanner.style(i); span.found {
+				add(models.Node{Type: span.node, Children: parser.inline(span.inner, depth+1)})
+				i = span.end
+				continue
+			}
+		}
+		buffer.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// span is a styled span found at some position of a text.
+type span struct {
+	end   int
+	node  string
+	inner string
+	found bool
+}
+
+// scanner finds the styled spans of a text. Finding where a span closes skips
+// the spans nested in it, so every position is looked at once.
+type scanner struct {
+	text  string
+	spans map[int]span
+}
+
+// style matches a styled span starting at i.
+func (scanner *scanner) style(i int) span {
+	if found, ok := scanner.spans[i]; ok {
+		return found
+	}
+	text := scanner.text
+	result := span{}
+	for _, style := range styles {
+		delimiter := style.delimiter
+		if !strings.HasPrefix(text[i:], delimiter) {
+			continue
+		}
+		open := i + len(delimiter)
+		if open >= len(text) || isSpace(text[open]) {
+			continue
+		}
+		if delimiter == "_" && i > 0 && isWord(lastRune(text[:i])) {
+			continue
+		}
+
+		if close := scanner.closing(open+1, delimiter); close >= 0 {
+			result = span{end: close + len(delimiter), node: style.node, inner: text[open:close], found: true}
+			break
+		}
+	}
+	scanner.spans[i] = result
+	return result
+}
+
+// closing finds the delimiter closing a span whose content starts at from. It
+// is not preceded by a space and outside of escapes, inline code and nested
+// spans. Of a longer run of the delimiter the last one closes, so ***a*** is
+// bold italic.
+func (scanner *scanner) closing(from int, delimiter string) int {
+	text := scanner.text
+	for j := from; j < len(text); j++ {
+		switch {
+		case text[j] == '\\':
+			j++
+			continue
+		case text[j] == '`':
+			if end, _, ok := codeSpan(text, j); ok {
+				j = end - 1
+			}
+			continue
+		case !strings.HasPrefix(text[j:], delimiter) || isSpace(text[j-1]):
+			if nested := scanner.style(j); nested.found {
+				j = nested.end - 1
+			}
+			continue
+		}
+
+		for j+len(delimiter) < len(text) && text[j+len(delimiter)] == delimiter[0] {
+			j++
+		}
+		if delimiter == "_" && j+1 < len(text) {
+			if next, _ := utf8.DecodeRuneInString(text[j+1:]); isWord(next) {
+				continue
+			}
+		}
+		return j
+	}
+	return -1
+}
+
+// codeSpan matches inline code starting at i, closed by as many backticks as
+// it was opened with.
+func codeSpan(text string, i int) (int, string, bool) {
+	run := backticks(text, i)
+	for j := i + run; j < len(text); {
+		if text[j] != '`' {
+			j++
+			continue
+		}
+		closing := backticks(text, j)
+		if closing == run && j > i+run {
+			return j + run, text[i+run : j], true
+		}
+		j += closing
+	}
+	return 0, "", false
+}
+
+func backticks(text string, i int) int {
+	run := 0
+	for i+run < len(text) && text[i+run] == '`' {
+		run++
+	}
+	return run
+}
+
+// link matches [label](url) starting at i. Only absolute http and https URLs
+// become links, anything else stays text so that clients never follow other
+// schemes.
+func link(text string, i int) (int, string, string, bool) {
+	labelEnd := strings.IndexByte(text[i:], ']')
+	if labelEnd <= 1 {
+		return 0, "", "", false
+	}
+	labelEnd += i
+	if !strings.HasPrefix(text[labelEnd:], "](") {
+		return 0, "", "", false
+	}
+	targetEnd := strings.IndexByte(text[labelEnd+2:], ')')
+	if targetEnd < 0 {
+		return 0, "", "", false
+	}
+	targetEnd += labelEnd + 2
+
+	target := text[labelEnd+2 : targetEnd]
+	if !IsWebURL(target) || strings.ContainsAny(target, " \t\n") {
+		return 0, "", "", false
+	}
+	return targetEnd + 1, text[i+1 : labelEnd], target, true
+}
+
+// IsWebURL tells whether a URL is absolute with the http or https scheme.
+func IsWebURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func isPunctuation(c byte) bool {
+	return c < utf8.RuneSelf && (unicode.IsPunct(rune(c)) || unicode.IsSymbol(rune(c)))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lastRune(text string) rune {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return r
+}
@@ -0,0 +1,100 @@
+package markdown
+
+import (
+	"discard/message-service/pkg/models"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func text(text string) models.Node {
+	return models.Node{Type: models.NodeText, Text: text}
+}
+
+func styled(typ string, children ...models.Node) models.Node {
+	return models.Node{Type: typ, Children: children}
+}
+
+func paragraph(children ...models.Node) models.Node {
+	return styled(models.NodeParagraph, children...)
+}
+
+func TestParseInline(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		nodes   []models.Node
+	}{
+		{"hello", []models.Node{text("hello")}},
+		{"**bold** and *italic*", []models.Node{styled(models.NodeBold, text("bold")), text(" and "), styled(models.NodeItalic, text("italic"))}},
+		{"__u__ ~~s~~ ||spoiler||", []models.Node{
+			styled(models.NodeUnderline, text("u")), text(" "),
+			styled(models.NodeStrikethrough, text("s")), text(" "),
+			styled(models.NodeSpoiler, text("spoiler"))}},
+		{"***both***", []models.Node{styled(models.NodeBold, styled(models.NodeItalic, text("both")))}},
+		{"*a **b** c*", []models.Node{styled(models.NodeItalic, text("a "), styled(models.NodeBold, text("b")), text(" c"))}},
+		{"2 * 3 * 4", []models.Node{text("2 * 3 * 4")}},
+		{"snake_case_name", []models.Node{text("snake_case_name")}},
+		{"**unclosed", []models.Node{text("**unclosed")}},
+		{`\*not italic\*`, []models.Node{text("*not italic*")}},
+		{"`**code**` ``a`b``", []models.Node{{Type: models.NodeCode, Text: "**code**"}, text(" "), {Type: models.NodeCode, Text: "a`b"}}},
+		{"one\r\ntwo", []models.Node{text("one"), {Type: models.NodeLineBreak}, text("two")}},
+		{"[docs](https://example.com/a) ok", []models.Node{
+			{Type: models.NodeLink, URL: "https://example.com/a", Children: []models.Node{text("docs")}}, text(" ok")}},
+		{"[click](javascript:alert(1))", []models.Node{text("[click](javascript:alert(1))")}},
+		{"bell\a", []models.Node{text("bell")}},
+	} {
+		nodes, err := Parse(test.content)
+		assert.NoError(t, err, test.content)
+		assert.Equal(t, []models.Node{paragraph(test.nodes...)}, nodes, test.content)
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	nodes, err := Parse("first\n\n> quoted\n> *still*\nafter\n```go\nfmt.Println(\"**\")\n```\n\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Node{
+		paragraph(text("first")),
+		styled(models.NodeBlockquote,
+			paragraph(text("quoted"), models.Node{Type: models.NodeLineBreak}, styled(models.NodeItalic, text("still")))),
+		paragraph(text("after")),
+		{Type: models.NodeCodeBlock, Language: "go", Text: `fmt.Println("**")`},
+	}, nodes)
+
+	nodes, err = Parse("```\nnever closed\n**x**")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Node{{Type: models.NodeCodeBlock, Text: "never closed\n**x**"}}, nodes)
+}
+
+func TestParseLimitsNesting(t *testing.T) {
+	nodes, err := Parse(strings.Repeat(">", 20) + " deep")
+	assert.NoError(t, err)
+	depth := 0
+	for len(nodes) > 0 && nodes[0].Type == models.NodeBlockquote {
+		nodes = nodes[0].Children
+		depth++
+	}
+	assert.Equal(t, MaximumDepth, depth)
+	assert.Equal(t, []models.Node{paragraph(text(strings.Repeat(">", 20-MaximumDepth) + " deep"))}, nodes)
+
+	content := strings.Repeat("*_", 10) + "x" + strings.Repeat("_*", 10)
+	nodes, err = Parse(content)
+	assert.NoError(t, err)
+	depth = 0
+	for node := nodes[0]; len(node.Children) > 0; node = node.Children[0] {
+		depth++
+	}
+	assert.LessOrEqual(t, depth, MaximumDepth)
+}
+
+func TestParseLimitsSize(t *testing.T) {
+	_, err := Parse(strings.Repeat("é", MaximumLength))
+	assert.NoError(t, err, "characters are counted, not bytes")
+
+	_, err = Parse(strings.Repeat("a", MaximumLength+1))
+	assert.True(t, errors.Is(err, ErrTooLong))
+
+	_, err = Parse(strings.Repeat("*a* ", MaximumNodes/2))
+	assert.True(t, errors.Is(err, ErrTooComplex))
+}
@@ -0,0 +1,177 @@
+package mentions
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	// MentionedQueue tells the notifications service whom a new message mentions
+	MentionedQueue = "message-mentioned"
+
+	// mentions of a kind beyond this stay plain text, so a single message
+	// cannot fan out to an unbounded number of inboxes
+	maximumMentions = 100
+)
+
+var (
+	users    = regexp.MustCompile(`<@!?([\w-]+)>`)
+	roles    = regexp.MustCompile(`<@&([\w-]+)>`)
+	channels = regexp.MustCompile(`<#([\w-]+)>`)
+	everyone = regexp.MustCompile(`(^|[^\w<])@everyone\b`)
+)
+
+// Parse returns the mentions in the content of a message, each one once in
+// the order they first occur.
+func Parse(content string) models.Mentions {
+	return models.Mentions{
+		Users:    ids(users, content),
+		Roles:    ids(roles, content),
+		Channels: ids(channels, content),
+		Everyone: everyone.MatchString(content),
+	}
+}
+
+func ids(pattern *regexp.Regexp, content string) []string {
+	var ids []string
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(ids, match[1]) {
+			ids = append(ids, match[1])
+		}
+		if len(ids) == maximumMentions {
+			break
+		}
+	}
+	return ids
+}
+
+// Mentioned is the event published on MentionedQueue. Roles and @everyone
+// are left to the notifications service, which knows who holds them.
+type Mentioned struct {
+	MessageID string    `json:"message_id"`
+	ServerID  string    `json:"server_id"`
+	ChannelID string    `json:"channel_id"`
+	AuthorID  string    `json:"author_id"`
+	Users     []string  `json:"users,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	Everyone  bool      `json:"everyone,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Inbox indexes the users mentioned by new messages and announces them. It
+// receives the message events, entries of deleted messages are removed with
+// them and listing drops those whose message no longer mentions the user.
+type Inbox struct {
+	repository repository.MentionRepository
+	messages   repository.MessageRepository
+	publisher  messaging.Publisher
+}
+
+func NewInbox(repository *repository.MentionRepository, messages *repository.MessageRepository,
+	publisher messaging.Publisher) *Inbox {
+	return &Inbox{
+		repository: *repository,
+		messages:   *messages,
+		publisher:  publisher,
+	}
+}
+
+func (inbox *Inbox) Publish(event events.Event) {
+	message := event.Message
+	var err error
+	switch event.Type {
+	case events.MessageCreated:
+		err = inbox.index(message, event.Timestamp)
+	case events.MessageDeleted:
+		if len(message.Mentions.Users) > 0 {
+			err = inbox.repository.DeleteMentions(message.Mentions.Users, message.ID)
+		}
+	}
+	if err != nil {
+		logger.WARN.Printf("Failed to index the mentions of message %v: %v\n", message.ID, err)
+	}
+}
+
+func (inbox *Inbox) index(message models.Message, at time.Time) error {
+	mentions := message.Mentions
+	if len(mentions.Users) == 0 && len(mentions.Roles) == 0 && !mentions.Everyone {
+		return nil
+	}
+
+	var entries []models.Mention
+	for _, userID := range mentions.Users {
+		if userID == message.UserID {
+			continue
+		}
+		entries = append(entries, models.Mention{
+			UserID:    userID,
+			MessageID: message.ID,
+			ServerID:  message.ServerID,
+			ChannelID: message.ChannelID,
+			AuthorID:  message.UserID,
+		})
+	}
+	if len(entries) > 0 {
+		if err := inbox.repository.SaveMentions(entries); err != nil {
+			return err
+		}
+	}
+
+	body, _ := json.Marshal(Mentioned{
+		MessageID: message.ID,
+		ServerID:  message.ServerID,
+		ChannelID: message.ChannelID,
+		AuthorID:  message.UserID,
+		Users:     mentions.Users,
+		Roles:     mentions.Roles,
+		Everyone:  mentions.Everyone,
+		At:        at,
+	})
+	if err := inbox.publisher.Publish(MentionedQueue, body); err != nil {
+		logger.WARN.Printf("Failed to announce the mentions of message %v: %v\n", message.ID, err)
+	}
+	return nil
+}
+
+// DeleteUser empties the inbox of a user whose messages are deleted.
+func (inbox *Inbox) DeleteUser(userID string) error {
+	return inbox.repository.DeleteInbox(userID)
+}
+
+// Mentions returns a page of the recent mentions of a user with their
+// messages, newest first. Mentions in servers canAccess refuses are left out,
+// so a user who left a server no longer reads what is written there.
+func (inbox *Inbox) Mentions(userID string, page models.Page, canAccess func(serverID string) bool) ([]*models.Mention, error) {
+	entries, err := inbox.repository.GetMentions(userID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := []*models.Mention{}
+	for _, mention := range entries {
+		if canAccess == nil || !canAccess(mention.ServerID) {
+			continue
+		}
+		message, err := inbox.messages.GetById(mention.MessageID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		if err != nil || !slices.Contains(message.Mentions.Users, userID) { // deleted or erased meanwhile
+			if err := inbox.repository.DeleteMentions([]string{userID}, mention.MessageID); err != nil {
+				logger.WARN.Printf("Failed to remove a stale mention of message %v: %v\n", mention.MessageID, err)
+			}
+			continue
+		}
+		mention.Message = message
+		mentions = append(mentions, mention)
+	}
+	return mentions, nil
+}
@@ -0,0 +1,106 @@
+package mentions
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	bodies map[string][][]byte
+}
+
+func (publisher *recordingPublisher) Publish(queue string, body []byte) error {
+	publisher.bodies[queue] = append(publisher.bodies[queue], body)
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		content  string
+		mentions models.Mentions
+	}{
+		{"hello", models.Mentions{}},
+		{"hi <@alice> and <@!bob>, <@alice> again", models.Mentions{Users: []string{"alice", "bob"}}},
+		{"<@&mods> see <#general>", models.Mentions{Roles: []string{"mods"}, Channels: []string{"general"}}},
+		{"@everyone look", models.Mentions{Everyone: true}},
+		{"mail me@everyone.example or @everyoneelse", models.Mentions{}},
+		{"<@> <#> @ everyone", models.Mentions{}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.mentions, Parse(test.content), test.content)
+	}
+}
+
+func member(serverID string) bool { return serverID == "server" }
+
+func TestInbox(t *testing.T) {
+	store := repository.NewInMemoryMentionRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	publisher := &recordingPublisher{bodies: make(map[string][][]byte)}
+	inbox := NewInbox(&store, &messages, publisher)
+
+	send := func(author string, content string) models.Message {
+		message, err := messages.Save(models.Message{
+			ID:        gocql.TimeUUID().String(),
+			UserID:    author,
+			ServerID:  "server",
+			ChannelID: "channel",
+			Message:   content,
+			Mentions:  Parse(content),
+		})
+		assert.NoError(t, err)
+		inbox.Publish(events.New(events.MessageCreated, *message))
+		return *message
+	}
+
+	var sent []models.Message
+	for i := 0; i < 3; i++ {
+		sent = append(sent, send("bob", "hey <@alice>"))
+	}
+	send("alice", "talking to myself <@alice>")
+	send("bob", "<@&mods> help")
+
+	page, err := inbox.Mentions("alice", models.Page{Limit: 2}, member)
+	assert.NoError(t, err)
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, sent[2].ID, page[0].MessageID)
+		assert.Equal(t, sent[1].ID, page[1].MessageID)
+		assert.Equal(t, "bob", page[0].AuthorID)
+		assert.Equal(t, "hey <@alice>", page[0].Message.Message)
+	}
+	page, err = inbox.Mentions("alice", models.Page{Before: sent[1].ID}, member)
+	assert.NoError(t, err)
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, sent[0].ID, page[0].MessageID)
+	}
+
+	assert.NoError(t, messages.Delete(sent[2]))
+	inbox.Publish(events.New(events.MessageDeleted, sent[2]))
+	erased := sent[1]
+	erased.Message, erased.Mentions = "", models.Mentions{}
+	assert.NoError(t, messages.Update(erased))
+	page, _ = inbox.Mentions("alice", models.Page{}, member)
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, sent[0].ID, page[0].MessageID)
+	}
+
+	// after leaving the server its mentions are no longer readable
+	page, err = inbox.Mentions("alice", models.Page{}, func(string) bool { return false })
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+	// the self mention is announced but not indexed, roles only announced
+	if assert.Len(t, publisher.bodies[MentionedQueue], 5) {
+		var event Mentioned
+		assert.NoError(t, json.Unmarshal(publisher.bodies[MentionedQueue][4], &event))
+		assert.Equal(t, []string{"mods"}, event.Roles)
+		assert.Empty(t, event.Users)
+	}
+}
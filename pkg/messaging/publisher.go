@@ -0,0 +1,94 @@
+package messaging
+
+import (
+	"context"
+	"discard/message-service/pkg/models/logger"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher sends events to other services over the message broker.
+type Publisher interface {
+	Publish(queue string, body []byte) error
+}
+
+const maximumPending = 1024
+
+// AMQPPublisher can be used before the broker is reachable, what is published
+// until Attach is called is held back and sent on attaching.
+type AMQPPublisher struct {
+	mutex    sync.Mutex
+	channel  *amqp.Channel
+	declared map[string]bool
+	pending  []pendingMessage
+}
+
+type pendingMessage struct {
+	queue string
+	body  []byte
+}
+
+func NewAMQPPublisher() *AMQPPublisher {
+	return &AMQPPublisher{declared: make(map[string]bool)}
+}
+
+func (publisher *AMQPPublisher) Attach(channel *amqp.Channel) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	publisher.channel = channel
+	for _, message := range publisher.pending {
+		if err := publisher.publish(message.queue, message.body); err != nil {
+			logger.WARN.Printf("Failed to publish held back message to %v: %v\n", message.queue, err)
+		}
+	}
+	publisher.pending = nil
+}
+
+func (publisher *AMQPPublisher) Publish(queue string, body []byte) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	if publisher.channel == nil {
+		if len(publisher.pending) >= maximumPending {
+			publisher.pending = publisher.pending[1:]
+			logger.WARN.Println("Broker still unavailable, dropped the oldest held back message")
+		}
+		publisher.pending = append(publisher.pending, pendingMessage{queue: queue, body: body})
+		return nil
+	}
+	return publisher.publish(queue, body)
+}
+
+// publish declares the queue like its consumers do and sends the body, the
+// caller holds the lock.
+func (publisher *AMQPPublisher) publish(queue string, body []byte) error {
+	if !publisher.declared[queue] {
+		_, err := publisher.channel.QueueDeclare(
+			queue, // name
+			false, // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			return err
+		}
+		publisher.declared[queue] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return publisher.channel.PublishWithContext(ctx,
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		})
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the Prometheus text exposition format Write produces.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metric interface {
+	write(writer io.Writer) error
+}
+
+// Registry holds the metrics of the service in the order they were created.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(metric metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.metrics = append(registry.metrics, metric)
+}
+
+// Write writes every metric in the Prometheus text format.
+func (registry *Registry) Write(writer io.Writer) error {
+	registry.mutex.Lock()
+	metrics := registry.metrics
+	registry.mutex.Unlock()
+
+	for _, metric := range metrics {
+		if err := metric.write(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter only ever goes up.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func (registry *Registry) Counter(name string, help string) *Counter {
+	counter := &Counter{name: name, help: help}
+	registry.register(counter)
+	return counter
+}
+
+func (counter *Counter) Add(delta int) {
+	counter.value.Add(int64(delta))
+}
+
+func (counter *Counter) Value() int64 {
+	return counter.value.Load()
+}
+
+func (counter *Counter) write(writer io.Writer) error {
+	return write(writer, counter.name, counter.help, "counter", strconv.FormatInt(counter.value.Load(), 10))
+}
+
+// Gauge holds the latest value of a measurement.
+type Gauge struct {
+	name string
+	help string
+	bits atomic.Uint64
+}
+
+func (registry *Registry) Gauge(name string, help string) *Gauge {
+	gauge := &Gauge{name: name, help: help}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64) {
+	gauge.bits.Store(math.Float64bits(value))
+}
+
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(gauge.bits.Load())
+}
+
+func (gauge *Gauge) write(writer io.Writer) error {
+	return write(writer, gauge.name, gauge.help, "gauge", strconv.FormatFloat(gauge.Value(), 'g', -1, 64))
+}
+
+func write(writer io.Writer, name string, help string, kind string, value string) error {
+	_, err := fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, value)
+	return err
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Response struct {
 	Message    string `json:"message"`
 	HttpStatus int    `json:"http_status"`
@@ -11,9 +13,583 @@ type User struct {
 	ID string `json:"id" binding:"required,alphanum"`
 }
 
+// Kinds of messages, messages stored before kinds have none and are text.
+const (
+	KindText   = "text"
+	KindPoll   = "poll"
+	KindSystem = "system"
+	KindEmbed  = "embed"
+)
+
 type Message struct {
-	ID       string `json:"id"`
-	UserID   string `json:"user_id" binding:"required,uuid"`
-	ServerID string `json:"server_id" binding:"required"`
-	Message  string `json:"message" binding:"required"`
+	ID        string `json:"id"`
+	UserID    string `json:"user_id" binding:"required,uuid"`
+	ServerID  string `json:"server_id" binding:"required"`
+	ChannelID string `json:"channel_id"`
+	Message   string `json:"message" binding:"required,max=4000"`
+	Kind      string `json:"kind" binding:"omitempty,oneof=text poll system embed"`
+
+	Poll   *Poll   `json:"poll,omitempty"`   // only set for polls
+	System *System `json:"system,omitempty"` // only set for system messages
+	Embed  *Embed  `json:"embed,omitempty"`  // only set for embeds
+
+	// parsed from the content when the message is sent, never taken from the client
+	Mentions Mentions `json:"mentions"`
+	Markdown []Node   `json:"markdown,omitempty"`
+
+	// alternative to the Idempotency-Key header, never stored with the message
+	ClientNonce string `json:"client_nonce,omitempty"`
+}
+
+// Mentions of a message, written <@id> for users, <@&id> for roles, <#id>
+// for channels and @everyone in its content.
+type Mentions struct {
+	Users    []string `json:"users,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+	Everyone bool     `json:"everyone,omitempty"`
+}
+
+// Embed is a card sent by bots below the content of its message. Together
+// its texts have at most 6000 characters.
+type Embed struct {
+	Title       string       `json:"title" binding:"required,max=256"`
+	Description string       `json:"description,omitempty" binding:"max=4096"`
+	URL         string       `json:"url,omitempty" binding:"omitempty,url,max=2048"`
+	Colour      int          `json:"colour" binding:"min=0,max=16777215"` // 0xRRGGBB
+	Fields      []EmbedField `json:"fields,omitempty" binding:"max=25,dive"`
+	Footer      string       `json:"footer,omitempty" binding:"max=2048"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name" binding:"required,max=256"`
+	Value  string `json:"value" binding:"required,max=1024"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Types of markdown nodes
+const (
+	NodeParagraph     = "paragraph"
+	NodeBlockquote    = "blockquote"
+	NodeCodeBlock     = "code_block"
+	NodeText          = "text"
+	NodeLineBreak     = "line_break"
+	NodeBold          = "bold"
+	NodeItalic        = "italic"
+	NodeUnderline     = "underline"
+	NodeStrikethrough = "strikethrough"
+	NodeSpoiler       = "spoiler"
+	NodeCode          = "code"
+	NodeLink          = "link"
+)
+
+// Node of the markdown of a message, as every client has to render it.
+type Node struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`     // of text, code and code blocks
+	Language string `json:"language,omitempty"` // of code blocks
+	URL      string `json:"url,omitempty"`      // of links, always http or https
+	Children []Node `json:"children,omitempty"`
+}
+
+// Poll asks the question in the content of its message. The votes are
+// tallied when the message is read, voting ends at ExpiresAt.
+type Poll struct {
+	Options        []PollOption `json:"options" binding:"required,min=2,max=10,dive"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ExpiresAt      time.Time    `json:"expires_at" binding:"required"`
+
+	// tallied when the poll is read, never taken from the client
+	Voters int  `json:"voters"`
+	Closed bool `json:"closed"`
+}
+
+type PollOption struct {
+	Text  string `json:"text" binding:"required,max=100"`
+	Votes int    `json:"votes"`
+}
+
+// Vote picks options of a poll by their index.
+type Vote struct {
+	Options []int `json:"options" binding:"required,min=1,max=10,dive,min=0"`
+}
+
+// PollVote is the vote of a user in a poll.
+type PollVote struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Options   []int     `json:"options"`
+	VotedAt   time.Time `json:"voted_at"`
+}
+
+// Types of system messages
+const (
+	SystemMemberJoined   = "member_joined"
+	SystemMemberLeft     = "member_left"
+	SystemMemberKicked   = "member_kicked"
+	SystemMemberBanned   = "member_banned"
+	SystemChannelCreated = "channel_created"
+	SystemChannelRenamed = "channel_renamed"
+)
+
+// SystemUserID is the author of system messages.
+const SystemUserID = "00000000-0000-0000-0000-000000000001"
+
+// System is what a system message announces, its content is the text shown
+// to clients that do not know the type.
+type System struct {
+	Type         string `json:"type" binding:"required,oneof=member_joined member_left member_kicked member_banned channel_created channel_renamed"`
+	UserID       string `json:"user_id,omitempty" binding:"max=128"`  // the member
+	ActorID      string `json:"actor_id,omitempty" binding:"max=128"` // who kicked, banned, created or renamed
+	Name         string `json:"name,omitempty" binding:"max=100"`     // of the channel
+	PreviousName string `json:"previous_name,omitempty" binding:"max=100"`
+}
+
+// SystemEvent is a change of the members or channels of a server, announced
+// by the services owning them. It is written as a system message into the
+// channel, once however often the event is delivered.
+type SystemEvent struct {
+	ID        string `json:"id" binding:"required,max=128"`
+	ServerID  string `json:"server_id" binding:"required"`
+	ChannelID string `json:"channel_id" binding:"required"`
+	System
+}
+
+// Mention is an entry in the mentions inbox of a user.
+type Mention struct {
+	UserID    string   `json:"user_id"` // the mentioned user
+	MessageID string   `json:"message_id"`
+	ServerID  string   `json:"server_id"`
+	ChannelID string   `json:"channel_id"`
+	AuthorID  string   `json:"author_id"`
+	Message   *Message `json:"message,omitempty"`
+}
+
+// ReadState is how far a user has read a channel.
+type ReadState struct {
+	UserID     string    `json:"user_id"`
+	ServerID   string    `json:"server_id"`
+	ChannelID  string    `json:"channel_id"`
+	LastReadID string    `json:"last_read_id"` // time UUID of the last read message
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type Ack struct {
+	MessageID string `json:"message_id" binding:"required"`
+}
+
+// Unread counts the messages of other users after the read marker of a
+// channel, and those of them mentioning the user. More is set when there
+// are more than the counts say.
+type Unread struct {
+	ServerID   string `json:"server_id"`
+	ChannelID  string `json:"channel_id"`
+	LastReadID string `json:"last_read_id"`
+	Unread     int    `json:"unread"`
+	Mentions   int    `json:"mentions"`
+	More       bool   `json:"more,omitempty"`
+}
+
+// Page selects messages by their time UUID, Before and After are exclusive
+type Page struct {
+	Before string `form:"before"`
+	After  string `form:"after"`
+	Limit  int    `form:"limit" binding:"min=0,max=100"`
+}
+
+// ContextQuery sizes the window around a message, in messages on each side
+type ContextQuery struct {
+	Before int `form:"before,default=25" binding:"min=0,max=50"`
+	After  int `form:"after,default=25" binding:"min=0,max=50"`
+}
+
+// MessageContext is a message with its neighbours in the channel, oldest
+// first. The cursors are only set when there are more messages that way and
+// page on through the history of the channel.
+type MessageContext struct {
+	Messages []*Message `json:"messages"`
+	Before   string     `json:"before,omitempty"`
+	After    string     `json:"after,omitempty"`
+}
+
+type SearchQuery struct {
+	Q         string `form:"q" binding:"required,max=512"`
+	ServerID  string `form:"server_id"`
+	ChannelID string `form:"channel_id"`
+	Author    string `form:"author"`
+	Page
+}
+
+type SearchHit struct {
+	Message     Message `json:"message"`
+	Highlighted string  `json:"highlighted"` // HTML escaped message with the matches in <mark> tags
+}
+
+// Export is a data export of everything stored about a user.
+type Export struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Status      string     `json:"status"` // running, completed or failed
+	Messages    int        `json:"messages"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Download    string     `json:"download,omitempty"` // signed link to the archive
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+const (
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+const (
+	DeletionRunning   = "running"
+	DeletionCompleted = "completed"
+	DeletionFailed    = "failed"
+	DeletionDeferred  = "deferred" // resumed once the legal holds on the remaining messages are released
+)
+
+// Deletion strategies, they decide what happens to the messages of a deleted
+// user per server.
+const (
+	DeletionPurge     = "purge"     // the messages are deleted
+	DeletionAnonymize = "anonymize" // the author becomes a pseudonym and the content is cleared
+	DeletionTombstone = "tombstone" // the author becomes TombstoneUserID and the content is cleared
+)
+
+// TombstoneUserID is the author of the placeholders left by the tombstone strategy.
+const TombstoneUserID = "00000000-0000-0000-0000-000000000000"
+
+type DeletionPolicy struct {
+	Strategy string `json:"strategy" binding:"required,oneof=purge anonymize tombstone"`
+}
+
+// DeletionJob tracks the erasure of all messages of a user.
+type DeletionJob struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Status      string     `json:"status"`     // running, completed or failed
+	Deleted     int        `json:"deleted"`    // every erased message, however it was erased
+	Anonymized  int        `json:"anonymized"` // of those kept under a pseudonym
+	Tombstoned  int        `json:"tombstoned"` // of those kept as a placeholder
+	Deferred    int        `json:"deferred"`   // messages kept for a legal hold
+	Failed      int        `json:"failed"`
+	KeyShredded bool       `json:"key_shredded"` // the content key of the user is destroyed
+	Pseudonym   string     `json:"-"`            // forgotten once the job completes
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// AuditEntry is a record of the append-only audit log. Every entry includes
+// the hash of the one before, so altering or dropping one breaks the chain.
+type AuditEntry struct {
+	ID           string    `json:"id"`
+	Action       string    `json:"action"`
+	UserID       string    `json:"user_id"`
+	JobID        string    `json:"job_id"`
+	Messages     int       `json:"messages"`
+	At           time.Time `json:"at"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+}
+
+type AuditLog struct {
+	Entries []*AuditEntry `json:"entries"`
+	Valid   bool          `json:"valid"` // whether every hash matches its entry and predecessor
+}
+
+const (
+	RetentionScopeServer  = "server"
+	RetentionScopeChannel = "channel"
+)
+
+// RetentionPolicy limits how long messages are kept, zero means no limit.
+type RetentionPolicy struct {
+	MaxAgeSeconds int64 `json:"max_age_seconds" binding:"min=0"`
+	MaxCount      int   `json:"max_count" binding:"min=0"` // newest messages kept per channel
+}
+
+// RetentionRule applies a policy to a server or a channel. The rule of a
+// channel replaces the one of its server and only applies to its messages.
+type RetentionRule struct {
+	Scope    string `json:"scope"` // server or channel
+	ServerID string `json:"server_id"`
+	TargetID string `json:"target_id"`
+	RetentionPolicy
+}
+
+// RetentionReport describes one sweep of the retention worker.
+type RetentionReport struct {
+	DryRun      bool               `json:"dry_run"` // nothing was deleted, Expired is what would have been
+	StartedAt   time.Time          `json:"started_at"`
+	CompletedAt time.Time          `json:"completed_at"`
+	Expired     int                `json:"expired"`
+	Deferred    int                `json:"deferred"` // expired but kept for a legal hold
+	Failed      int                `json:"failed"`
+	Channels    []RetentionChannel `json:"channels"` // the channels with expired messages
+}
+
+type RetentionChannel struct {
+	ChannelID string `json:"channel_id"` // empty for messages without a channel
+	ServerID  string `json:"server_id"`
+	Expired   int    `json:"expired"`
+	Deferred  int    `json:"deferred"`
+}
+
+const (
+	HoldScopeUser    = "user"
+	HoldScopeServer  = "server"
+	HoldScopeChannel = "channel"
+)
+
+type HoldRequest struct {
+	Scope    string `json:"scope" binding:"required,oneof=user server channel"`
+	TargetID string `json:"target_id" binding:"required"`
+	Reason   string `json:"reason" binding:"required,max=1000"`
+}
+
+// LegalHold keeps every message of a user, server or channel from being
+// deleted until it is released.
+type LegalHold struct {
+	ID         string      `json:"id"`
+	Scope      string      `json:"scope"` // user, server or channel
+	TargetID   string      `json:"target_id"`
+	Reason     string      `json:"reason"`
+	PlacedBy   string      `json:"placed_by"`
+	PlacedAt   time.Time   `json:"placed_at"`
+	ReleasedBy string      `json:"released_by,omitempty"`
+	ReleasedAt *time.Time  `json:"released_at,omitempty"`
+	Deferrals  []*Deferral `json:"deferrals,omitempty"`
+}
+
+// Kinds of deletion a legal hold defers
+const (
+	DeferredUserDeletion    = "user_deletion"    // TargetID is the deletion job
+	DeferredMessageDeletion = "message_deletion" // TargetID is the message
+	DeferredRetention       = "retention"        // TargetID is the channel
+	DeferredMessageRemoval  = "message_removal"  // TargetID is the message removed by a moderator
+)
+
+// Deferral records a deletion a legal hold kept from happening.
+type Deferral struct {
+	HoldID   string    `json:"hold_id"`
+	Kind     string    `json:"kind"`
+	TargetID string    `json:"target_id"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+	// when the deletion was retried after the release of the hold
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+// Moderation actions a rule takes on the messages it matches
+const (
+	ModerationAllow  = "allow"  // the message is sent without asking the rules after this one
+	ModerationFlag   = "flag"   // the message is sent and queued for review
+	ModerationMask   = "mask"   // the matched text is replaced before sending
+	ModerationReject = "reject" // the message is not sent
+)
+
+// Kinds of moderation rules
+const (
+	ModerationWords   = "words"   // Words, matched as whole words ignoring case
+	ModerationRegex   = "regex"   // Pattern, an RE2 regular expression
+	ModerationLinks   = "links"   // links to Domains or their subdomains
+	ModerationInvites = "invites" // invite links to other servers, Domains adds invite hosts
+	ModerationSpam    = "spam"    // zalgo text, long runs of a character and shouting
+)
+
+type ModerationRule struct {
+	Kind    string   `json:"kind" binding:"required,oneof=words regex links invites spam"`
+	Action  string   `json:"action" binding:"required,oneof=allow flag mask reject"`
+	Words   []string `json:"words,omitempty" binding:"max=1000,dive,required,max=100"`
+	Pattern string   `json:"pattern,omitempty" binding:"max=1000"`
+	Domains []string `json:"domains,omitempty" binding:"max=1000,dive,required,max=253"`
+}
+
+// ModerationRules of a server are applied in order to every message sent to it.
+type ModerationRules struct {
+	Rules []ModerationRule `json:"rules" binding:"max=50,dive"`
+}
+
+// FlaggedMessage waits in the review queue of its server.
+type FlaggedMessage struct {
+	MessageID string    `json:"message_id"`
+	ServerID  string    `json:"server_id"`
+	ChannelID string    `json:"channel_id"`
+	UserID    string    `json:"user_id"`
+	Reasons   []string  `json:"reasons"` // the rules that flagged it
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// Categories of user reports
+const (
+	ReportSpam       = "spam"
+	ReportHarassment = "harassment"
+	ReportHate       = "hate"
+	ReportNSFW       = "nsfw"
+	ReportViolence   = "violence"
+	ReportOther      = "other"
+)
+
+const (
+	ReportOpen     = "open"
+	ReportClaimed  = "claimed" // a moderator is looking into it
+	ReportResolved = "resolved"
+)
+
+// Resolutions of a report
+const (
+	ResolutionRemove  = "remove"  // the message is kept as a tombstone
+	ResolutionDismiss = "dismiss" // the message is left as it is
+)
+
+type ReportRequest struct {
+	Category string `json:"category" binding:"required,oneof=spam harassment hate nsfw violence other"`
+	Details  string `json:"details" binding:"max=1000"`
+}
+
+// Report is a message reported by a user to the moderators of its server.
+type Report struct {
+	ID         string     `json:"id"`
+	ServerID   string     `json:"server_id"`
+	ChannelID  string     `json:"channel_id"`
+	MessageID  string     `json:"message_id"`
+	AuthorID   string     `json:"author_id"`
+	ReporterID string     `json:"reporter_id"`
+	Category   string     `json:"category"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"` // open, claimed or resolved
+	ClaimedBy  string     `json:"claimed_by,omitempty"`
+	Resolution string     `json:"resolution,omitempty"` // remove or dismiss
+	Note       string     `json:"note,omitempty"`       // of the moderator who resolved it
+	CreatedAt  time.Time  `json:"created_at"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+type ReportQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=open claimed resolved"`
+}
+
+type ReportResolution struct {
+	Resolution string `json:"resolution" binding:"required,oneof=remove dismiss"`
+	Note       string `json:"note" binding:"max=1000"`
+}
+
+// Actions of moderators recorded in the moderation audit trail
+const (
+	ActionRulesSet       = "rules_set"
+	ActionFlagDismissed  = "flag_dismissed"
+	ActionReportClaimed  = "report_claimed"
+	ActionReportResolved = "report_resolved"
+)
+
+// ModerationAction is an entry of the audit trail of a server.
+type ModerationAction struct {
+	ID          string    `json:"id"`
+	ServerID    string    `json:"server_id"`
+	ModeratorID string    `json:"moderator_id"`
+	Action      string    `json:"action"`
+	ReportID    string    `json:"report_id,omitempty"`
+	MessageID   string    `json:"message_id,omitempty"`
+	Detail      string    `json:"detail,omitempty"` // e.g. the resolution of a report
+	At          time.Time `json:"at"`
+}
+
+// Pin keeps a message at hand in its channel, in the order it was pinned.
+type Pin struct {
+	ID        string    `json:"id"` // time UUID, orders the pins of a channel
+	ServerID  string    `json:"server_id"`
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+	Message   *Message  `json:"message,omitempty"`
+}
+
+type PinLimit struct {
+	Limit int `json:"limit" binding:"min=1,max=250"`
+}
+
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending" // claimed by a scheduler
+	ScheduledSent      = "sent"
+	ScheduledCancelled = "cancelled"
+	ScheduledFailed    = "failed"
+)
+
+// ScheduleRequest is a message to send at SendAt.
+type ScheduleRequest struct {
+	Message
+	SendAt time.Time `json:"send_at" binding:"required"`
+}
+
+// ScheduledMessage is a message waiting for its time, MessageID is set once
+// it was sent.
+type ScheduledMessage struct {
+	ID          string     `json:"id"`
+	ServerID    string     `json:"server_id"`
+	ChannelID   string     `json:"channel_id"`
+	UserID      string     `json:"user_id"`
+	Message     string     `json:"message"`
+	SendAt      time.Time  `json:"send_at"`
+	Status      string     `json:"status"`
+	ScheduledBy string     `json:"scheduled_by"`
+	ClaimedBy   string     `json:"-"` // the scheduler instance sending it
+	ClaimedAt   *time.Time `json:"-"`
+	Attempts    int        `json:"attempts"`
+	MessageID   string     `json:"message_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+}
+
+// Draft is a message a user started writing in a channel, kept so it follows
+// them to their other devices. The edit with the latest UpdatedAt wins.
+type Draft struct {
+	UserID    string    `json:"user_id"`
+	ChannelID string    `json:"channel_id"`
+	Message   string    `json:"message"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DraftRequest is an edit of a draft, UpdatedAt is when the client made it.
+type DraftRequest struct {
+	Message   string    `json:"message" binding:"required,max=4000"`
+	UpdatedAt time.Time `json:"updated_at" binding:"required"`
+}
+
+// DraftDeletion discards the edits of a draft made before UpdatedAt, now by default.
+type DraftDeletion struct {
+	UpdatedAt time.Time `form:"updated_at"`
+}
+
+type SlowMode struct {
+	Seconds int `json:"seconds" binding:"min=0,max=21600"`
+}
+
+// === API v2 ===
+type DataResponse struct {
+	Data any `json:"data"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
 }
@@ -0,0 +1,179 @@
+package moderation
+
+import (
+	"discard/message-service/pkg/models"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Thresholds of the spam heuristics
+const (
+	maximumCombiningMarks = 2  // per character, zalgo text stacks many more
+	maximumRun            = 10 // of the same character in a row
+	shoutingLetters       = 20 // shorter messages are never shouting
+	shoutingRatio         = 0.8
+)
+
+// hosts of invite links that are always recognized by the invites rule
+var inviteHosts = []string{"discord.gg", "discord.com/invite", "discordapp.com/invite"}
+
+var link = regexp.MustCompile(`(?i)\b(?:https?://)?((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,63})(?::\d+)?(?:[/?#]\S*)?`)
+
+// filter checks the content of a message against a single rule.
+type filter interface {
+	// check reports whether the rule matches content and what content looks
+	// like with the matched text masked.
+	check(content string) (matched bool, masked string)
+}
+
+func newFilter(rule models.ModerationRule) (filter, error) {
+	switch rule.Kind {
+	case models.ModerationWords:
+		if len(rule.Words) == 0 {
+			return nil, errors.New("a words rule needs words")
+		}
+		words := make(map[string]bool, len(rule.Words))
+		for _, word := range rule.Words {
+			words[strings.ToLower(word)] = true
+		}
+		return wordFilter(words), nil
+	case models.ModerationRegex:
+		if rule.Pattern == "" {
+			return nil, errors.New("a regex rule needs a pattern")
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return regexFilter{pattern}, nil
+	case models.ModerationLinks:
+		if len(rule.Domains) == 0 {
+			return nil, errors.New("a links rule needs domains")
+		}
+		return linkFilter(rule.Domains), nil
+	case models.ModerationInvites:
+		hosts := make([]string, 0, len(inviteHosts)+len(rule.Domains))
+		for _, host := range slices.Concat(inviteHosts, rule.Domains) {
+			hosts = append(hosts, regexp.QuoteMeta(strings.TrimSuffix(host, "/")))
+		}
+		return regexFilter{regexp.MustCompile(`(?i)\b(?:https?://)?(?:www\.)?(?:` + strings.Join(hosts, "|") + `)/[a-z0-9-]+`)}, nil
+	case models.ModerationSpam:
+		return spamFilter{}, nil
+	}
+	return nil, errors.New("unknown kind " + rule.Kind)
+}
+
+// mask replaces every character within the byte ranges with an asterisk.
+func mask(content string, ranges [][]int) string {
+	var masked strings.Builder
+	last := 0
+	for _, bounds := range ranges {
+		masked.WriteString(content[last:bounds[0]])
+		masked.WriteString(strings.Repeat("*", len([]rune(content[bounds[0]:bounds[1]]))))
+		last = bounds[1]
+	}
+	masked.WriteString(content[last:])
+	return masked.String()
+}
+
+// wordFilter matches whole words of letters and digits, lower cased.
+type wordFilter map[string]bool
+
+func (words wordFilter) check(content string) (bool, string) {
+	var ranges [][]int
+	start := -1
+	for offset, character := range content + " " {
+		if unicode.IsLetter(character) || unicode.IsDigit(character) {
+			if start < 0 {
+				start = offset
+			}
+			continue
+		}
+		if start >= 0 && words[strings.ToLower(content[start:offset])] {
+			ranges = append(ranges, []int{start, offset})
+		}
+		start = -1
+	}
+	return len(ranges) > 0, mask(content, ranges)
+}
+
+type regexFilter struct {
+	pattern *regexp.Regexp
+}
+
+func (filter regexFilter) check(content string) (bool, string) {
+	ranges := filter.pattern.FindAllStringIndex(content, -1)
+	return len(ranges) > 0, mask(content, ranges)
+}
+
+// linkFilter matches links to any of its domains or their subdomains.
+type linkFilter []string
+
+func (domains linkFilter) check(content string) (bool, string) {
+	var ranges [][]int
+	for _, bounds := range link.FindAllStringSubmatchIndex(content, -1) {
+		host := strings.ToLower(content[bounds[2]:bounds[3]])
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				ranges = append(ranges, bounds[:2])
+				break
+			}
+		}
+	}
+	return len(ranges) > 0, mask(content, ranges)
+}
+
+// spamFilter matches zalgo text, long runs of the same character and
+// messages written in capitals. Masking strips the marks, shortens the runs
+// and lower cases the message.
+type spamFilter struct{}
+
+func (spamFilter) check(content string) (bool, string) {
+	matched := false
+	var masked strings.Builder
+	var previous rune
+	marks, run, letters, upper := 0, 0, 0, 0
+	for _, character := range content {
+		if unicode.In(character, unicode.Mn, unicode.Me) {
+			if marks++; marks > maximumCombiningMarks {
+				matched = true
+				continue
+			}
+			masked.WriteRune(character)
+			continue
+		}
+		marks = 0
+
+		if character == previous {
+			if run++; run > maximumRun {
+				matched = true
+			}
+			if run > 3 {
+				continue
+			}
+		} else {
+			previous, run = character, 1
+		}
+
+		if unicode.IsLetter(character) {
+			letters++
+			if unicode.IsUpper(character) {
+				upper++
+			}
+		}
+		masked.WriteRune(character)
+	}
+
+	if !matched {
+		masked.Reset()
+		masked.WriteString(content)
+	}
+	if letters >= shoutingLetters && float64(upper) >= shoutingRatio*float64(letters) {
+		return true, strings.ToLower(masked.String())
+	}
+	return matched, masked.String()
+}
@@ -0,0 +1,248 @@
+package moderation
+
+import (
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/messaging"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrRejected    = fmt.Errorf("%w: the message was rejected by moderation", repository.ErrInvalidArgument)
+	ErrInvalidRule = fmt.Errorf("%w: invalid moderation rule", repository.ErrInvalidArgument)
+)
+
+// Verdict is the outcome of moderating a message.
+type Verdict struct {
+	Action  string        // flag or mask if any rule did, allow otherwise
+	Content string        // the content to send, masked where a rule asked for it
+	Embed   *models.Embed // the embed to send, masked like the content
+	Poll    *models.Poll  // the poll to send, masked like the content
+	Reasons []string      // the rules that matched
+}
+
+// Apply replaces the texts of the message with the ones to send.
+func (verdict Verdict) Apply(message *models.Message) {
+	message.Message = verdict.Content
+	if verdict.Embed != nil {
+		message.Embed = verdict.Embed
+	}
+	if verdict.Poll != nil {
+		message.Poll = verdict.Poll
+	}
+}
+
+// Moderator applies the rules of a server to every message before it is
+// stored. Rules run in order: a matching allow rule ends the check, a reject
+// rule refuses the message and a mask rule hands the masked content on to
+// the rules after it. Flagged messages are sent and queued for review.
+// Users report messages into the same queue, see Report. Every action of a
+// moderator is recorded in the audit trail of the server.
+type Moderator struct {
+	repository repository.ModerationRepository
+	messages   repository.MessageRepository
+	deleter    *deletion.Deleter
+	publisher  messaging.Publisher
+
+	flagged  *metrics.Counter
+	masked   *metrics.Counter
+	rejected *metrics.Counter
+}
+
+func NewModerator(repository *repository.ModerationRepository, messages *repository.MessageRepository,
+	deleter *deletion.Deleter, publisher messaging.Publisher, registry *metrics.Registry) *Moderator {
+	return &Moderator{
+		repository: *repository,
+		messages:   *messages,
+		deleter:    deleter,
+		publisher:  publisher,
+
+		flagged:  registry.Counter("message_moderation_flagged_total", "Messages sent and queued for review by a moderation rule."),
+		masked:   registry.Counter("message_moderation_masked_total", "Messages sent with text masked by a moderation rule."),
+		rejected: registry.Counter("message_moderation_rejected_total", "Messages refused by a moderation rule."),
+	}
+}
+
+// Rules returns the rules of a server, none unless they were set.
+func (moderator *Moderator) Rules(serverID string) (models.ModerationRules, error) {
+	rules, err := moderator.repository.GetRules(serverID)
+	if rules == nil {
+		rules = []models.ModerationRule{}
+	}
+	return models.ModerationRules{Rules: rules}, err
+}
+
+// SetRules replaces the rules of a server after checking they all compile.
+func (moderator *Moderator) SetRules(serverID string, rules models.ModerationRules, moderatorID string) error {
+	for position, rule := range rules.Rules {
+		if _, err := newFilter(rule); err != nil {
+			return fmt.Errorf("%w %v: %w", ErrInvalidRule, position+1, err)
+		}
+	}
+	if err := moderator.repository.SetRules(serverID, rules.Rules); err != nil {
+		return err
+	}
+	return moderator.record(models.ModerationAction{
+		ServerID:    serverID,
+		ModeratorID: moderatorID,
+		Action:      models.ActionRulesSet,
+		Detail:      fmt.Sprintf("%v rules", len(rules.Rules)),
+	})
+}
+
+// Check runs the rules of the server of a message over its content, every
+// text of its embed and the options of its poll, each on its own. Rejected
+// messages return an error wrapping ErrRejected, as do polls whose options
+// are alike once masked.
+func (moderator *Moderator) Check(message models.Message) (Verdict, error) {
+	verdict := Verdict{Action: models.ModerationAllow, Content: message.Message}
+	rules, err := moderator.repository.GetRules(message.ServerID)
+	if err != nil {
+		return verdict, err
+	}
+	filters := make([]filter, len(rules))
+	for position, rule := range rules {
+		// stored before the rule was checked, skip instead of blocking the server
+		filters[position], _ = newFilter(rule)
+	}
+
+	texts := []*string{&verdict.Content}
+	if message.Embed != nil {
+		embed := *message.Embed
+		embed.Fields = slices.Clone(embed.Fields)
+		texts = append(texts, &embed.Title, &embed.Description, &embed.Footer)
+		for i := range embed.Fields {
+			texts = append(texts, &embed.Fields[i].Name, &embed.Fields[i].Value)
+		}
+		verdict.Embed = &embed
+	}
+	if message.Poll != nil {
+		poll := *message.Poll
+		poll.Options = slices.Clone(poll.Options)
+		for i := range poll.Options {
+			texts = append(texts, &poll.Options[i].Text)
+		}
+		verdict.Poll = &poll
+	}
+	for _, text := range texts {
+		if *text, err = verdict.check(rules, filters, *text); err != nil {
+			moderator.rejected.Add(1)
+			return verdict, err
+		}
+	}
+	if verdict.Poll != nil {
+		for i, option := range verdict.Poll.Options {
+			if slices.ContainsFunc(verdict.Poll.Options[:i], func(other models.PollOption) bool { return other.Text == option.Text }) {
+				moderator.rejected.Add(1)
+				return verdict, fmt.Errorf("%w: masking left options of the poll alike", ErrRejected)
+			}
+		}
+	}
+	return moderator.count(verdict), nil
+}
+
+// check runs the rules over one text and returns it masked where a rule
+// asked for it.
+func (verdict *Verdict) check(rules []models.ModerationRule, filters []filter, text string) (string, error) {
+	if text == "" {
+		return text, nil
+	}
+	for position, rule := range rules {
+		if filters[position] == nil {
+			continue
+		}
+		matched, masked := filters[position].check(text)
+		if !matched {
+			continue
+		}
+
+		reason := fmt.Sprintf("rule %v (%v)", position+1, rule.Kind)
+		switch rule.Action {
+		case models.ModerationAllow:
+			return text, nil
+		case models.ModerationReject:
+			return text, fmt.Errorf("%w by %v", ErrRejected, reason)
+		case models.ModerationMask:
+			text = masked
+			if verdict.Action == models.ModerationAllow {
+				verdict.Action = models.ModerationMask
+			}
+		case models.ModerationFlag:
+			verdict.Action = models.ModerationFlag
+		}
+		if !slices.Contains(verdict.Reasons, reason) {
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+	return text, nil
+}
+
+func (moderator *Moderator) count(verdict Verdict) Verdict {
+	switch verdict.Action {
+	case models.ModerationFlag:
+		moderator.flagged.Add(1)
+	case models.ModerationMask:
+		moderator.masked.Add(1)
+	}
+	return verdict
+}
+
+// Flag queues a stored message for review when its verdict asks for it.
+func (moderator *Moderator) Flag(message models.Message, verdict Verdict) error {
+	if verdict.Action != models.ModerationFlag {
+		return nil
+	}
+	return moderator.repository.SaveFlagged(models.FlaggedMessage{
+		MessageID: message.ID,
+		ServerID:  message.ServerID,
+		ChannelID: message.ChannelID,
+		UserID:    message.UserID,
+		Reasons:   verdict.Reasons,
+		FlaggedAt: time.Now().UTC(),
+	})
+}
+
+// Flagged returns the review queue of a server, oldest message first.
+func (moderator *Moderator) Flagged(serverID string) ([]*models.FlaggedMessage, error) {
+	queue, err := moderator.repository.GetFlagged(serverID)
+	if queue == nil {
+		queue = []*models.FlaggedMessage{}
+	}
+	return queue, err
+}
+
+// Dismiss takes a message off the review queue of its server.
+func (moderator *Moderator) Dismiss(serverID string, messageID string, moderatorID string) error {
+	if err := moderator.repository.DeleteFlagged(serverID, messageID); err != nil {
+		return err
+	}
+	return moderator.record(models.ModerationAction{
+		ServerID:    serverID,
+		ModeratorID: moderatorID,
+		Action:      models.ActionFlagDismissed,
+		MessageID:   messageID,
+	})
+}
+
+// record appends an action to the audit trail of its server.
+func (moderator *Moderator) record(action models.ModerationAction) error {
+	id := gocql.TimeUUID()
+	action.ID = id.String()
+	action.At = id.Time().UTC()
+	return moderator.repository.AppendAction(action)
+}
+
+// Audit returns the audit trail of a server, oldest action first.
+func (moderator *Moderator) Audit(serverID string) ([]*models.ModerationAction, error) {
+	actions, err := moderator.repository.GetActions(serverID)
+	if actions == nil {
+		actions = []*models.ModerationAction{}
+	}
+	return actions, err
+}
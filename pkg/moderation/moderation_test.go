@@ -0,0 +1,277 @@
+package moderation
+
+import (
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	bodies map[string][][]byte
+}
+
+func (publisher *recordingPublisher) Publish(queue string, body []byte) error {
+	publisher.bodies[queue] = append(publisher.bodies[queue], body)
+	return nil
+}
+
+func newModerator(t *testing.T, rules ...models.ModerationRule) (*Moderator, *metrics.Registry) {
+	moderator, registry, _, _ := newModeratorWith(t, rules...)
+	return moderator, registry
+}
+
+func newModeratorWith(t *testing.T, rules ...models.ModerationRule) (*Moderator, *metrics.Registry,
+	repository.MessageRepository, *recordingPublisher) {
+	moderation := repository.NewInMemoryModerationRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	keyring := encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider())
+	publisher := &recordingPublisher{bodies: make(map[string][][]byte)}
+	deleter := deletion.NewDeleter(&messages, &jobs, legalhold.NewHolds(&holds), keyring, events.Publishers{}, publisher)
+
+	registry := metrics.NewRegistry()
+	moderator := NewModerator(&moderation, &messages, deleter, publisher, registry)
+	assert.NoError(t, moderator.SetRules("server", models.ModerationRules{Rules: rules}, "owner"))
+	return moderator, registry, messages, publisher
+}
+
+func check(moderator *Moderator, content string) (Verdict, error) {
+	return moderator.Check(models.Message{UserID: "user", ServerID: "server", ChannelID: "channel", Message: content})
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.ModerationRule
+		content string
+		masked  string // empty if the rule does not match
+	}{
+		{"word", models.ModerationRule{Kind: models.ModerationWords, Words: []string{"heck"}},
+			"What the HECK, heckler", "What the ****, heckler"},
+		{"no word", models.ModerationRule{Kind: models.ModerationWords, Words: []string{"heck"}},
+			"a heckler", ""},
+		{"regex", models.ModerationRule{Kind: models.ModerationRegex, Pattern: `\d{4}-\d{4}`},
+			"call 1234-5678 now", "call ********* now"},
+		{"link", models.ModerationRule{Kind: models.ModerationLinks, Domains: []string{"scam.example"}},
+			"see https://free.scam.example/gift and example.org", "see " + strings.Repeat("*", 30) + " and example.org"},
+		{"other link", models.ModerationRule{Kind: models.ModerationLinks, Domains: []string{"scam.example"}},
+			"see https://notscam.example", ""},
+		{"invite", models.ModerationRule{Kind: models.ModerationInvites},
+			"join discord.gg/abc123!", "join *****************!"},
+		{"custom invite", models.ModerationRule{Kind: models.ModerationInvites, Domains: []string{"discard.gg"}},
+			"https://discard.gg/xyz", "**********************"},
+		{"zalgo", models.ModerationRule{Kind: models.ModerationSpam},
+			"hé̂̃̄llo", "hé̂llo"},
+		{"run", models.ModerationRule{Kind: models.ModerationSpam},
+			"no" + strings.Repeat("o", 20), "nooo"},
+		{"shouting", models.ModerationRule{Kind: models.ModerationSpam},
+			"WHY IS NOBODY ANSWERING MY QUESTION", "why is nobody answering my question"},
+		{"not spam", models.ModerationRule{Kind: models.ModerationSpam},
+			"Héllo, OK?", ""},
+	}
+
+	for _, test := range tests {
+		filter, err := newFilter(test.rule)
+		assert.NoError(t, err, test.name)
+		matched, masked := filter.check(test.content)
+		assert.Equal(t, test.masked != "", matched, test.name)
+		if matched {
+			assert.Equal(t, test.masked, masked, test.name)
+		}
+	}
+}
+
+func TestRulesRunInOrder(t *testing.T) {
+	moderator, registry := newModerator(t,
+		models.ModerationRule{Kind: models.ModerationLinks, Action: models.ModerationAllow, Domains: []string{"docs.example"}},
+		models.ModerationRule{Kind: models.ModerationWords, Action: models.ModerationMask, Words: []string{"heck"}},
+		models.ModerationRule{Kind: models.ModerationInvites, Action: models.ModerationReject},
+		models.ModerationRule{Kind: models.ModerationRegex, Action: models.ModerationFlag, Pattern: `(?i)free nitro`},
+	)
+
+	verdict, err := check(moderator, "heck, read https://docs.example/free-nitro")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ModerationAllow, verdict.Action)
+	assert.Equal(t, "heck, read https://docs.example/free-nitro", verdict.Content)
+
+	verdict, err = check(moderator, "heck, FREE NITRO")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ModerationFlag, verdict.Action)
+	assert.Equal(t, "****, FREE NITRO", verdict.Content)
+	assert.Equal(t, []string{"rule 2 (words)", "rule 4 (regex)"}, verdict.Reasons)
+
+	_, err = check(moderator, "free nitro at discord.gg/scam")
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorIs(t, err, repository.ErrInvalidArgument)
+
+	verdict, err = check(moderator, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, Verdict{Action: models.ModerationAllow, Content: "hello"}, verdict)
+
+	var written strings.Builder
+	assert.NoError(t, registry.Write(&written))
+	assert.Contains(t, written.String(), "message_moderation_flagged_total 1\n")
+	assert.Contains(t, written.String(), "message_moderation_rejected_total 1\n")
+}
+
+func TestEmbedTextsAreModerated(t *testing.T) {
+	moderator, _ := newModerator(t,
+		models.ModerationRule{Kind: models.ModerationWords, Action: models.ModerationMask, Words: []string{"heck"}},
+		models.ModerationRule{Kind: models.ModerationInvites, Action: models.ModerationReject},
+	)
+	embed := &models.Embed{Title: "heck yes", Description: "fine", Footer: "by heck",
+		Fields: []models.EmbedField{{Name: "what the heck", Value: "nothing"}}}
+	message := models.Message{ServerID: "server", Kind: models.KindEmbed, Message: "hello", Embed: embed}
+
+	verdict, err := moderator.Check(message)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ModerationMask, verdict.Action)
+	assert.Equal(t, []string{"rule 1 (words)"}, verdict.Reasons)
+	verdict.Apply(&message)
+	assert.Equal(t, &models.Embed{Title: "**** yes", Description: "fine", Footer: "by ****",
+		Fields: []models.EmbedField{{Name: "what the ****", Value: "nothing"}}}, message.Embed)
+	assert.Equal(t, "heck yes", embed.Title, "the checked embed stays unchanged")
+
+	embed.Fields[0].Value = "join discord.gg/scam"
+	_, err = moderator.Check(models.Message{ServerID: "server", Kind: models.KindEmbed, Message: "hello", Embed: embed})
+	assert.ErrorIs(t, err, ErrRejected)
+}
+
+func TestPollOptionsAreModerated(t *testing.T) {
+	moderator, _ := newModerator(t,
+		models.ModerationRule{Kind: models.ModerationWords, Action: models.ModerationMask, Words: []string{"heck", "darn"}},
+		models.ModerationRule{Kind: models.ModerationInvites, Action: models.ModerationReject},
+	)
+	poll := func(options ...string) models.Message {
+		message := models.Message{ServerID: "server", Kind: models.KindPoll, Message: "vote", Poll: &models.Poll{}}
+		for _, option := range options {
+			message.Poll.Options = append(message.Poll.Options, models.PollOption{Text: option})
+		}
+		return message
+	}
+
+	message := poll("heck yes", "no")
+	verdict, err := moderator.Check(message)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ModerationMask, verdict.Action)
+	verdict.Apply(&message)
+	assert.Equal(t, []models.PollOption{{Text: "**** yes"}, {Text: "no"}}, message.Poll.Options)
+
+	_, err = moderator.Check(poll("yes", "discord.gg/scam"))
+	assert.ErrorIs(t, err, ErrRejected)
+
+	_, err = moderator.Check(poll("heck", "darn"))
+	assert.ErrorIs(t, err, ErrRejected)
+}
+
+func TestInvalidRulesAreRefused(t *testing.T) {
+	moderator, _ := newModerator(t)
+
+	err := moderator.SetRules("server", models.ModerationRules{Rules: []models.ModerationRule{
+		{Kind: models.ModerationSpam, Action: models.ModerationFlag},
+		{Kind: models.ModerationRegex, Action: models.ModerationReject, Pattern: "(unclosed"},
+	}}, "owner")
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.ErrorContains(t, err, "rule 2")
+
+	rules, err := moderator.Rules("server")
+	assert.NoError(t, err)
+	assert.Empty(t, rules.Rules)
+}
+
+func TestReviewQueue(t *testing.T) {
+	moderator, _ := newModerator(t,
+		models.ModerationRule{Kind: models.ModerationWords, Action: models.ModerationFlag, Words: []string{"sus"}})
+
+	var ids []string
+	for _, content := range []string{"sus", "fine", "very sus"} {
+		message := models.Message{ID: gocql.TimeUUID().String(), UserID: "user", ServerID: "server", Message: content}
+		verdict, err := moderator.Check(message)
+		assert.NoError(t, err)
+		assert.NoError(t, moderator.Flag(message, verdict))
+		ids = append(ids, message.ID)
+	}
+
+	queue, err := moderator.Flagged("server")
+	assert.NoError(t, err)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, ids[0], queue[0].MessageID)
+		assert.Equal(t, ids[2], queue[1].MessageID)
+		assert.Equal(t, []string{"rule 1 (words)"}, queue[0].Reasons)
+	}
+
+	assert.NoError(t, moderator.Dismiss("server", ids[0], "moderator"))
+	queue, _ = moderator.Flagged("server")
+	assert.Len(t, queue, 1)
+}
+
+func TestReportWorkflow(t *testing.T) {
+	moderator, _, messages, publisher := newModeratorWith(t)
+	message, err := messages.Save(models.Message{
+		ID: gocql.TimeUUID().String(), UserID: "author", ServerID: "server", ChannelID: "channel", Message: "buy now",
+	})
+	assert.NoError(t, err)
+
+	report, err := moderator.Report(*message, "reporter", models.ReportRequest{Category: models.ReportSpam})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReportOpen, report.Status)
+
+	open, err := moderator.Reports("server", models.ReportOpen)
+	assert.NoError(t, err)
+	assert.Len(t, open, 1)
+
+	claimed, err := moderator.Claim("server", report.ID, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReportClaimed, claimed.Status)
+	assert.Equal(t, "alice", claimed.ClaimedBy)
+
+	_, err = moderator.Claim("server", report.ID, "bob")
+	assert.ErrorIs(t, err, ErrClaimed)
+	_, err = moderator.Resolve("server", report.ID, "bob", models.ReportResolution{Resolution: models.ResolutionDismiss})
+	assert.ErrorIs(t, err, ErrClaimed)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	resolved, err := moderator.Resolve("server", report.ID, "alice", models.ReportResolution{Resolution: models.ResolutionRemove})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReportResolved, resolved.Status)
+	assert.NotNil(t, resolved.ResolvedAt)
+
+	_, err = moderator.Resolve("server", report.ID, "alice", models.ReportResolution{Resolution: models.ResolutionRemove})
+	assert.ErrorIs(t, err, ErrResolved)
+
+	removed, err := messages.GetById(message.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TombstoneUserID, removed.UserID)
+	assert.Empty(t, removed.Message)
+
+	if assert.Len(t, publisher.bodies[RemovedQueue], 1) {
+		var event Removed
+		assert.NoError(t, json.Unmarshal(publisher.bodies[RemovedQueue][0], &event))
+		assert.Equal(t, message.ID, event.MessageID)
+		assert.Equal(t, "alice", event.ModeratorID)
+		assert.False(t, event.Deferred)
+	}
+
+	actions, err := moderator.Audit("server")
+	assert.NoError(t, err)
+	var trail []string
+	for _, action := range actions {
+		trail = append(trail, action.Action)
+	}
+	assert.Equal(t, []string{models.ActionRulesSet, models.ActionReportClaimed, models.ActionReportResolved}, trail)
+
+	_, err = moderator.Claim("server", "missing", "alice")
+	assert.ErrorIs(t, err, ErrReportNotFound)
+}
@@ -0,0 +1,218 @@
+package moderation
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// RemovedQueue tells other services that a moderator removed a message
+	RemovedQueue = "message-removed"
+
+	ActionMessageRemoved = "message_removed"
+)
+
+var (
+	ErrReportNotFound = fmt.Errorf("%w: no such report", repository.ErrNotFound)
+	ErrClaimed        = fmt.Errorf("%w: the report is claimed by another moderator", repository.ErrConflict)
+	ErrResolved       = fmt.Errorf("%w: the report is already resolved", repository.ErrConflict)
+	ErrReportChanged  = fmt.Errorf("%w: the report changed meanwhile, try again", repository.ErrConflict)
+)
+
+// Removed is the event published on RemovedQueue.
+type Removed struct {
+	Action      string    `json:"action"`
+	ReportID    string    `json:"report_id"`
+	MessageID   string    `json:"message_id"`
+	ServerID    string    `json:"server_id"`
+	ChannelID   string    `json:"channel_id"`
+	AuthorID    string    `json:"author_id"`
+	ModeratorID string    `json:"moderator_id"`
+	Category    string    `json:"category"`
+	Deferred    bool      `json:"deferred"` // a legal hold keeps the message until it is released
+	At          time.Time `json:"at"`
+}
+
+// Report files a report of a user about a message into the queue of its server.
+func (moderator *Moderator) Report(message models.Message, reporterID string, request models.ReportRequest) (models.Report, error) {
+	report := models.Report{
+		ID:         gocql.TimeUUID().String(),
+		ServerID:   message.ServerID,
+		ChannelID:  message.ChannelID,
+		MessageID:  message.ID,
+		AuthorID:   message.UserID,
+		ReporterID: reporterID,
+		Category:   request.Category,
+		Details:    request.Details,
+		Status:     models.ReportOpen,
+		CreatedAt:  time.Now().UTC(),
+	}
+	return report, moderator.repository.SaveReport(report)
+}
+
+// DeleteUser removes a user whose messages are deleted from the reports they
+// filed, the reports stay with the moderators.
+func (moderator *Moderator) DeleteUser(userID string) error {
+	reports, err := moderator.repository.GetReportsByReporter(userID)
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if err := moderator.repository.RemoveReporter(*report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports returns the reports of a server with the given status, or all of
+// them without one, oldest first.
+func (moderator *Moderator) Reports(serverID string, status string) ([]*models.Report, error) {
+	reports, err := moderator.repository.GetReports(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := []*models.Report{}
+	for _, report := range reports {
+		if status == "" || report.Status == status {
+			queue = append(queue, report)
+		}
+	}
+	return queue, nil
+}
+
+// report returns a report unless another moderator claimed or resolved it.
+func (moderator *Moderator) report(serverID string, id string, moderatorID string) (*models.Report, error) {
+	report, err := moderator.repository.GetReport(serverID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case report.Status == models.ReportResolved:
+		return report, ErrResolved
+	case report.Status == models.ReportClaimed && report.ClaimedBy != moderatorID:
+		return report, ErrClaimed
+	}
+	return report, nil
+}
+
+// Claim assigns an open report to a moderator, so no one else works on it.
+func (moderator *Moderator) Claim(serverID string, id string, moderatorID string) (models.Report, error) {
+	report, err := moderator.report(serverID, id, moderatorID)
+	if err != nil {
+		return models.Report{}, err
+	}
+	if report.Status == models.ReportClaimed {
+		return *report, nil
+	}
+
+	claimed := *report
+	claimedAt := time.Now().UTC()
+	claimed.Status = models.ReportClaimed
+	claimed.ClaimedBy = moderatorID
+	claimed.ClaimedAt = &claimedAt
+	if err := moderator.update(claimed, *report); err != nil {
+		return models.Report{}, err
+	}
+
+	return claimed, moderator.record(models.ModerationAction{
+		ServerID:    serverID,
+		ModeratorID: moderatorID,
+		Action:      models.ActionReportClaimed,
+		ReportID:    claimed.ID,
+		MessageID:   claimed.MessageID,
+	})
+}
+
+// Resolve closes a report that is open or claimed by the moderator. Removing
+// the message keeps it as a tombstone, deferred while a legal hold covers it,
+// and announces the removal on RemovedQueue.
+func (moderator *Moderator) Resolve(serverID string, id string, moderatorID string, resolution models.ReportResolution) (models.Report, error) {
+	report, err := moderator.report(serverID, id, moderatorID)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	// remove first, a report resolved as removed must never leave the message behind
+	deferred := false
+	if resolution.Resolution == models.ResolutionRemove {
+		message, err := moderator.messages.GetById(report.MessageID)
+		if err == nil {
+			deferred, err = moderator.deleter.RemoveMessage(*message, moderatorID)
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return models.Report{}, err
+		}
+	}
+
+	resolved := *report
+	resolvedAt := time.Now().UTC()
+	if resolved.ClaimedAt == nil {
+		resolved.ClaimedAt = &resolvedAt
+	}
+	resolved.Status = models.ReportResolved
+	resolved.ClaimedBy = moderatorID
+	resolved.Resolution = resolution.Resolution
+	resolved.Note = resolution.Note
+	resolved.ResolvedAt = &resolvedAt
+	if err := moderator.update(resolved, *report); err != nil {
+		return models.Report{}, err
+	}
+
+	detail := resolved.Resolution
+	if deferred {
+		detail += ", deferred by a legal hold"
+	}
+	if err := moderator.record(models.ModerationAction{
+		ServerID:    serverID,
+		ModeratorID: moderatorID,
+		Action:      models.ActionReportResolved,
+		ReportID:    resolved.ID,
+		MessageID:   resolved.MessageID,
+		Detail:      detail,
+	}); err != nil {
+		return resolved, err
+	}
+
+	if resolved.Resolution == models.ResolutionRemove {
+		body, _ := json.Marshal(Removed{
+			Action:      ActionMessageRemoved,
+			ReportID:    resolved.ID,
+			MessageID:   resolved.MessageID,
+			ServerID:    resolved.ServerID,
+			ChannelID:   resolved.ChannelID,
+			AuthorID:    resolved.AuthorID,
+			ModeratorID: moderatorID,
+			Category:    resolved.Category,
+			Deferred:    deferred,
+			At:          resolvedAt,
+		})
+		if err := moderator.publisher.Publish(RemovedQueue, body); err != nil {
+			logger.WARN.Printf("Failed to announce the removal of message %v: %v\n", resolved.MessageID, err)
+		}
+	}
+	return resolved, nil
+}
+
+func (moderator *Moderator) update(report models.Report, expected models.Report) error {
+	updated, err := moderator.repository.UpdateReport(report, expected)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrReportChanged
+	}
+	return nil
+}
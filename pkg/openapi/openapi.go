@@ -0,0 +1,168 @@
+package openapi
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	Summary       string              `json:"summary,omitempty"`
+	Tags          []string            `json:"tags,omitempty"`
+	Parameters    []Parameter         `json:"parameters,omitempty"`
+	RequestBody   *RequestBody        `json:"requestBody,omitempty"`
+	Responses     map[string]Response `json:"responses"`
+	RequiredRoles []string            `json:"x-required-roles,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route describes one endpoint. Body and the response values are only used
+// for their types, a nil response documents an empty body.
+type Route struct {
+	Summary     string
+	Tags        []string
+	Query       []Parameter
+	Headers     []Parameter
+	Body        any
+	ContentType string // of the response bodies, defaults to application/json
+	Responses   map[int]any
+	Roles       []string
+}
+
+func New(title string, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]map[string]*Operation),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+}
+
+// Query and Header build parameters of a route, typ is a JSON schema type.
+func Query(name string, typ string, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+func Header(name string, description string) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Schema: &Schema{Type: "string"}}
+}
+
+var ginParameter = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Path converts a gin route path into its OpenAPI form, /user/:id becomes /user/{id}.
+func Path(ginPath string) string {
+	return ginParameter.ReplaceAllString(ginPath, "{$1}")
+}
+
+func (document *Document) Register(method string, ginPath string, route Route) {
+	operation := &Operation{
+		Summary:       route.Summary,
+		Tags:          route.Tags,
+		Responses:     make(map[string]Response),
+		RequiredRoles: route.Roles,
+	}
+
+	for _, match := range ginParameter.FindAllStringSubmatch(ginPath, -1) {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	operation.Parameters = append(operation.Parameters, route.Query...)
+	operation.Parameters = append(operation.Parameters, route.Headers...)
+
+	if route.Body != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: document.SchemaOf(route.Body)}},
+		}
+	}
+
+	contentType := route.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	for status, body := range route.Responses {
+		response := Response{Description: statusDescription(status)}
+		if body != nil {
+			response.Content = map[string]MediaType{contentType: {Schema: document.SchemaOf(body)}}
+		}
+		operation.Responses[strconv.Itoa(status)] = response
+	}
+
+	path := Path(ginPath)
+	if document.Paths[path] == nil {
+		document.Paths[path] = make(map[string]*Operation)
+	}
+	document.Paths[path][strings.ToLower(method)] = operation
+}
+
+// Operation returns the documented operation of a gin route, if any.
+func (document *Document) Operation(method string, ginPath string) (*Operation, bool) {
+	operation, found := document.Paths[Path(ginPath)][strings.ToLower(method)]
+	return operation, found
+}
+
+var statusDescriptions = map[int]string{
+	101: "Switching Protocols",
+	200: "OK",
+	201: "Created",
+	202: "Accepted",
+	204: "No Content",
+	400: "Bad Request",
+	401: "Unauthorized",
+	403: "Forbidden",
+	404: "Not Found",
+	409: "Conflict",
+	410: "Gone",
+	413: "Payload Too Large",
+	422: "Unprocessable Entity",
+	429: "Too Many Requests",
+	500: "Internal Server Error",
+	503: "Service Unavailable",
+}
+
+func statusDescription(status int) string {
+	if description, found := statusDescriptions[status]; found {
+		return description
+	}
+	return "Status " + strconv.Itoa(status)
+}
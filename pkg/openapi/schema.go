@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf describes the JSON form of value. Named structs are added to the
+// components and referenced, their binding tags become validation keywords.
+func (document *Document) SchemaOf(value any) *Schema {
+	return document.schemaOf(reflect.TypeOf(value))
+}
+
+func (document *Document) schemaOf(typ reflect.Type) *Schema {
+	switch typ.Kind() {
+	case reflect.Pointer:
+		schema := document.schemaOf(typ.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: document.schemaOf(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: document.schemaOf(typ.Elem())}
+	case reflect.Struct:
+		if typ == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if typ.Name() == "" {
+			return document.objectOf(typ)
+		}
+
+		name := componentName(typ)
+		if _, exists := document.Components.Schemas[name]; !exists {
+			document.Components.Schemas[name] = &Schema{} // placeholder for recursive types
+			document.Components.Schemas[name] = document.objectOf(typ)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func componentName(typ reflect.Type) string {
+	pkg := typ.PkgPath()
+	if index := strings.LastIndex(pkg, "/"); index >= 0 {
+		pkg = pkg[index+1:]
+	}
+	if pkg == "models" || pkg == "" {
+		return typ.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + typ.Name()
+}
+
+func (document *Document) objectOf(typ reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for index := 0; index < typ.NumField(); index++ {
+		field := typ.Field(index)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous {
+			embedded := document.objectOf(field.Type)
+			for property, propertySchema := range embedded.Properties {
+				schema.Properties[property] = propertySchema
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := document.schemaOf(field.Type)
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+
+	return schema
+}
+
+// applyBinding adds the validator rules of a binding tag to schema and
+// reports whether the field is required.
+func applyBinding(schema *Schema, tag string) bool {
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, parameter, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "uuid":
+			schema.Format = "uuid"
+		case "url":
+			schema.Format = "uri"
+		case "alphanum":
+			schema.Pattern = "^[a-zA-Z0-9]+$"
+		case "oneof":
+			schema.Enum = strings.Fields(parameter)
+		case "min", "max", "gte", "lte":
+			applyBound(schema, name == "min" || name == "gte", parameter)
+		case "dive":
+			return required // the remaining rules apply to the elements
+		}
+	}
+	return required
+}
+
+func applyBound(schema *Schema, lower bool, parameter string) {
+	value, err := strconv.ParseFloat(parameter, 64)
+	if err != nil || schema.Ref != "" {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		length := int(value)
+		if lower {
+			schema.MinLength = &length
+		} else {
+			schema.MaxLength = &length
+		}
+	case "array":
+		items := int(value)
+		if lower {
+			schema.MinItems = &items
+		} else {
+			schema.MaxItems = &items
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = &value
+		} else {
+			schema.Maximum = &value
+		}
+	}
+}
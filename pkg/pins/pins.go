@@ -0,0 +1,155 @@
+package pins
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+const DefaultLimit = 50
+
+var (
+	ErrLimitReached = fmt.Errorf("%w: the channel has reached its pin limit", repository.ErrConflict)
+	ErrNotPinned    = fmt.Errorf("%w: the message is not pinned", repository.ErrNotFound)
+	ErrNoChannel    = fmt.Errorf("%w: only messages of a channel can be pinned", repository.ErrInvalidArgument)
+)
+
+// Pins keeps the pinned messages of every channel of a server up to its limit. It
+// receives the message events, so pins go away together with their message
+// whichever way it is deleted, and listing skips pins an event was missed for.
+// The repository enforces the limit, so it holds across instances.
+type Pins struct {
+	repository   repository.PinRepository
+	messages     repository.MessageRepository
+	defaultLimit int
+}
+
+func NewPins(repository *repository.PinRepository, messages *repository.MessageRepository,
+	settings configuration.PinSettings) *Pins {
+	limit := settings.DefaultLimit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Pins{
+		repository:   *repository,
+		messages:     *messages,
+		defaultLimit: limit,
+	}
+}
+
+// Limit returns the pin limit of a channel, the default unless it set its own.
+func (pins *Pins) Limit(serverID string, channelID string) (int, error) {
+	limit, err := pins.repository.GetLimit(serverID, channelID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return pins.defaultLimit, nil
+	}
+	return limit, err
+}
+
+// SetLimit changes the limit of a channel. Pins beyond a lowered limit are
+// kept, new ones are refused until enough are unpinned.
+func (pins *Pins) SetLimit(serverID string, channelID string, limit models.PinLimit) error {
+	return pins.repository.SetLimit(serverID, channelID, limit.Limit)
+}
+
+// Pin pins a message in its channel, pinning it again changes nothing.
+func (pins *Pins) Pin(message models.Message, pinnedBy string) (models.Pin, error) {
+	if message.ChannelID == "" {
+		return models.Pin{}, ErrNoChannel
+	}
+
+	limit, err := pins.Limit(message.ServerID, message.ChannelID)
+	if err != nil {
+		return models.Pin{}, err
+	}
+
+	id := gocql.TimeUUID()
+	pin, full, err := pins.repository.SavePin(models.Pin{
+		ID:        id.String(),
+		ServerID:  message.ServerID,
+		ChannelID: message.ChannelID,
+		MessageID: message.ID,
+		PinnedBy:  pinnedBy,
+		PinnedAt:  id.Time().UTC(),
+	}, limit)
+	if err != nil {
+		return models.Pin{}, err
+	}
+	if full {
+		return models.Pin{}, fmt.Errorf("%w of %v", ErrLimitReached, limit)
+	}
+	return pin, nil
+}
+
+// Unpin removes the pin of a message from its channel.
+func (pins *Pins) Unpin(message models.Message) error {
+	pinned, err := pins.repository.GetPins(message.ServerID, message.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, pin := range pinned {
+		if pin.MessageID == message.ID {
+			if err := pins.repository.DeletePin(*pin); err != nil {
+				return err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return ErrNotPinned
+	}
+	return nil
+}
+
+// List returns the pins of a channel with their messages, in pin order.
+func (pins *Pins) List(serverID string, channelID string) ([]*models.Pin, error) {
+	pinned, err := pins.repository.GetPins(serverID, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*models.Pin{}
+	for _, pin := range pinned {
+		message, err := pins.messages.GetById(pin.MessageID)
+		if errors.Is(err, repository.ErrNotFound) {
+			pins.remove(*pin)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pin.Message = message
+		list = append(list, pin)
+	}
+	return list, nil
+}
+
+// Publish unpins messages as they are deleted, or erased by a deletion
+// strategy that keeps the message without its content.
+func (pins *Pins) Publish(event events.Event) {
+	erased := event.Type == events.MessageUpdated && event.Message.Message == ""
+	if event.Type != events.MessageDeleted && !erased {
+		return
+	}
+	if event.Message.ChannelID == "" {
+		return
+	}
+
+	if err := pins.Unpin(event.Message); err != nil && !errors.Is(err, ErrNotPinned) {
+		logger.WARN.Printf("Failed to unpin deleted message %v: %v\n", event.Message.ID, err)
+	}
+}
+
+func (pins *Pins) remove(pin models.Pin) {
+	if err := pins.repository.DeletePin(pin); err != nil {
+		logger.WARN.Printf("Failed to unpin deleted message %v: %v\n", pin.MessageID, err)
+	}
+}
@@ -0,0 +1,148 @@
+package pins
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/deletion"
+	"discard/message-service/pkg/encryption"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"sync"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(string, []byte) error { return nil }
+
+func newPins(limit int) (*Pins, repository.MessageRepository) {
+	store := repository.NewInMemoryPinRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	return NewPins(&store, &messages, configuration.PinSettings{DefaultLimit: limit}), messages
+}
+
+func save(t *testing.T, messages repository.MessageRepository, userID string) models.Message {
+	message, err := messages.Save(models.Message{
+		ID:        gocql.TimeUUID().String(),
+		UserID:    userID,
+		ServerID:  "server",
+		ChannelID: "channel",
+		Message:   "hello",
+	})
+	assert.NoError(t, err)
+	return *message
+}
+
+func TestPinsKeepTheirOrderAndLimit(t *testing.T) {
+	pins, messages := newPins(2)
+	first, second, third := save(t, messages, "user"), save(t, messages, "user"), save(t, messages, "user")
+
+	_, err := pins.Pin(first, "moderator")
+	assert.NoError(t, err)
+	_, err = pins.Pin(second, "moderator")
+	assert.NoError(t, err)
+	_, err = pins.Pin(second, "moderator")
+	assert.NoError(t, err, "pinning again changes nothing")
+
+	_, err = pins.Pin(third, "moderator")
+	assert.ErrorIs(t, err, ErrLimitReached)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	assert.NoError(t, pins.SetLimit("server", "channel", models.PinLimit{Limit: 3}))
+	_, err = pins.Pin(third, "moderator")
+	assert.NoError(t, err)
+
+	list, err := pins.List("server", "channel")
+	assert.NoError(t, err)
+	if assert.Len(t, list, 3) {
+		assert.Equal(t, first.ID, list[0].MessageID)
+		assert.Equal(t, second.ID, list[1].MessageID)
+		assert.Equal(t, third.ID, list[2].MessageID)
+		assert.Equal(t, "hello", list[0].Message.Message)
+	}
+
+	assert.NoError(t, pins.Unpin(second))
+	assert.ErrorIs(t, pins.Unpin(second), ErrNotPinned)
+	list, _ = pins.List("server", "channel")
+	assert.Len(t, list, 2)
+}
+
+func TestDeletedMessagesAreUnpinned(t *testing.T) {
+	pins, messages := newPins(0)
+	jobs := repository.NewInMemoryDeletionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	keys := repository.NewInMemoryKeyRepository()
+	keyring := encryption.NewKeyring(&keys, encryption.NewInMemoryKeyProvider())
+	deleter := deletion.NewDeleter(&messages, &jobs, legalhold.NewHolds(&holds), keyring,
+		events.Publishers{pins}, discardPublisher{})
+
+	deleted, erased, kept := save(t, messages, "user"), save(t, messages, "erased"), save(t, messages, "user")
+	for _, message := range []models.Message{deleted, erased, kept} {
+		_, err := pins.Pin(message, "moderator")
+		assert.NoError(t, err)
+	}
+
+	_, err := deleter.DeleteMessage(deleted, "user")
+	assert.NoError(t, err)
+	assert.NoError(t, deleter.SetPolicy("server", models.DeletionPolicy{Strategy: models.DeletionTombstone}))
+	_, err = deleter.DeleteUser("erased")
+	assert.NoError(t, err)
+
+	list, err := pins.List("server", "channel")
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, kept.ID, list[0].MessageID)
+	}
+}
+
+func TestLimitHoldsAcrossInstances(t *testing.T) {
+	store := repository.NewInMemoryPinRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	instances := []*Pins{
+		NewPins(&store, &messages, configuration.PinSettings{DefaultLimit: 3}),
+		NewPins(&store, &messages, configuration.PinSettings{DefaultLimit: 3}),
+	}
+	var saved []models.Message
+	for i := 0; i < 5; i++ {
+		saved = append(saved, save(t, messages, "user"))
+	}
+
+	var group sync.WaitGroup
+	for _, instance := range instances {
+		for _, message := range saved {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				instance.Pin(message, "moderator")
+			}()
+		}
+	}
+	group.Wait()
+
+	list, err := instances[0].List("server", "channel")
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+	pinned := make(map[string]bool)
+	for _, pin := range list {
+		assert.False(t, pinned[pin.MessageID], "message %v is pinned twice", pin.MessageID)
+		pinned[pin.MessageID] = true
+	}
+}
+
+func TestChannelsOfOtherServersKeepTheirPins(t *testing.T) {
+	pins, messages := newPins(1)
+	assert.NoError(t, pins.SetLimit("other", "channel", models.PinLimit{Limit: 5}))
+
+	_, err := pins.Pin(save(t, messages, "user"), "moderator")
+	assert.NoError(t, err)
+	_, err = pins.Pin(save(t, messages, "user"), "moderator")
+	assert.ErrorIs(t, err, ErrLimitReached, "the limit of the channel of another server does not apply")
+
+	list, err := pins.List("other", "channel")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
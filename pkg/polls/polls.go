@@ -0,0 +1,194 @@
+package polls
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	MinimumDuration = time.Minute
+	MaximumDuration = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidPoll  = fmt.Errorf("%w: invalid poll", repository.ErrInvalidArgument)
+	ErrNotAPoll     = fmt.Errorf("%w: the message is not a poll", repository.ErrInvalidArgument)
+	ErrInvalidVote  = fmt.Errorf("%w: invalid vote", repository.ErrInvalidArgument)
+	ErrPollClosed   = fmt.Errorf("%w: the poll is closed", repository.ErrConflict)
+	ErrAlreadyVoted = fmt.Errorf("%w: already voted in this poll, retract the vote first", repository.ErrConflict)
+)
+
+// Prepare checks the kind and poll of a new message, a message without a
+// kind is text. Only polls carry a poll, with between two and ten distinct
+// options and an expiry between a minute and 30 days after now. Tallies sent
+// by the client are dropped.
+func Prepare(message *models.Message, now time.Time) error {
+	if message.Kind == "" {
+		message.Kind = models.KindText
+	}
+	if message.Kind != models.KindPoll {
+		if message.Poll != nil {
+			return fmt.Errorf("%w: only messages of kind %v carry a poll", ErrInvalidPoll, models.KindPoll)
+		}
+		return nil
+	}
+	if message.Poll == nil {
+		return fmt.Errorf("%w: a message of kind %v needs a poll", ErrInvalidPoll, models.KindPoll)
+	}
+
+	poll := *message.Poll
+	if len(poll.Options) < 2 || len(poll.Options) > 10 {
+		return fmt.Errorf("%w: a poll has between 2 and 10 options", ErrInvalidPoll)
+	}
+	poll.Options = make([]models.PollOption, 0, len(message.Poll.Options))
+	for _, option := range message.Poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" || slices.ContainsFunc(poll.Options, func(other models.PollOption) bool { return other.Text == text }) {
+			return fmt.Errorf("%w: options have to be distinct and not empty", ErrInvalidPoll)
+		}
+		poll.Options = append(poll.Options, models.PollOption{Text: text})
+	}
+	if poll.ExpiresAt.Before(now.Add(MinimumDuration)) || poll.ExpiresAt.After(now.Add(MaximumDuration)) {
+		return fmt.Errorf("%w: a poll runs for at least a minute and at most 30 days", ErrInvalidPoll)
+	}
+	poll.ExpiresAt = poll.ExpiresAt.UTC().Truncate(time.Millisecond) // the precision of a Cassandra timestamp
+	poll.Voters = 0
+	poll.Closed = false
+	message.Poll = &poll
+	return nil
+}
+
+// Polls records the votes in polls and tallies them when polls are read. A
+// poll closes once it expired, without anything having to run at that time.
+// It receives the message events to drop the votes of deleted polls.
+type Polls struct {
+	repository repository.PollRepository
+}
+
+func NewPolls(repository *repository.PollRepository) *Polls {
+	return &Polls{repository: *repository}
+}
+
+func isPoll(message *models.Message) bool {
+	return message.Kind == models.KindPoll && message.Poll != nil
+}
+
+// Tally fills in the votes of the polls among the messages, as of now.
+func (polls *Polls) Tally(messages ...*models.Message) error {
+	now := time.Now()
+	for _, message := range messages {
+		if !isPoll(message) {
+			continue
+		}
+		votes, err := polls.repository.GetVotes(message.ID)
+		if err != nil {
+			return err
+		}
+
+		poll := *message.Poll
+		poll.Options = slices.Clone(poll.Options)
+		for i := range poll.Options {
+			poll.Options[i].Votes = 0
+		}
+		for _, vote := range votes {
+			for _, option := range vote.Options {
+				if option >= 0 && option < len(poll.Options) {
+					poll.Options[option].Votes++
+				}
+			}
+		}
+		poll.Voters = len(votes)
+		poll.Closed = !now.Before(poll.ExpiresAt)
+		message.Poll = &poll
+	}
+	return nil
+}
+
+// Vote records the vote of a user in the poll of the message and returns the
+// message with the new tally. Users vote once, for a single option unless
+// the poll allows multiple choices.
+func (polls *Polls) Vote(message models.Message, userID string, vote models.Vote) (*models.Message, error) {
+	if !isPoll(&message) {
+		return nil, ErrNotAPoll
+	}
+	now := time.Now().UTC()
+	if !now.Before(message.Poll.ExpiresAt) {
+		return nil, ErrPollClosed
+	}
+
+	if len(vote.Options) > 1 && !message.Poll.MultipleChoice {
+		return nil, fmt.Errorf("%w: the poll allows a single option", ErrInvalidVote)
+	}
+	options := slices.Clone(vote.Options)
+	slices.Sort(options)
+	if len(slices.Compact(slices.Clone(options))) != len(options) {
+		return nil, fmt.Errorf("%w: options can only be picked once", ErrInvalidVote)
+	}
+	if options[0] < 0 || options[len(options)-1] >= len(message.Poll.Options) {
+		return nil, fmt.Errorf("%w: no such option", ErrInvalidVote)
+	}
+
+	saved, err := polls.repository.SaveVote(models.PollVote{
+		MessageID: message.ID,
+		UserID:    userID,
+		Options:   options,
+		VotedAt:   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrAlreadyVoted
+	}
+	return &message, polls.Tally(&message)
+}
+
+// Retract removes the vote of a user from the poll of the message, so they
+// can vote again while the poll is open.
+func (polls *Polls) Retract(message models.Message, userID string) (*models.Message, error) {
+	if !isPoll(&message) {
+		return nil, ErrNotAPoll
+	}
+	if !time.Now().Before(message.Poll.ExpiresAt) {
+		return nil, ErrPollClosed
+	}
+
+	if err := polls.repository.DeleteVote(message.ID, userID); err != nil {
+		return nil, err
+	}
+	return &message, polls.Tally(&message)
+}
+
+// DeleteUser removes every vote of a user.
+func (polls *Polls) DeleteUser(userID string) error {
+	messageIDs, err := polls.repository.GetVotedPolls(userID)
+	if err != nil {
+		return err
+	}
+	for _, messageID := range messageIDs {
+		if err := polls.repository.DeleteVote(messageID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish drops the votes of deleted polls and of polls whose content was
+// removed.
+func (polls *Polls) Publish(event events.Event) {
+	switch {
+	case event.Message.Kind != models.KindPoll:
+		return
+	case event.Type == events.MessageDeleted,
+		event.Type == events.MessageUpdated && event.Message.Poll == nil:
+		if err := polls.repository.DeleteVotes(event.Message.ID); err != nil {
+			logger.WARN.Printf("Failed to delete the votes of poll %v: %v\n", event.Message.ID, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package polls
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPoll(t *testing.T, multipleChoice bool, options ...string) models.Message {
+	message := models.Message{
+		ID:        gocql.TimeUUID().String(),
+		UserID:    "alice",
+		ServerID:  "server",
+		ChannelID: "general",
+		Message:   "Lunch?",
+		Kind:      models.KindPoll,
+		Poll:      &models.Poll{MultipleChoice: multipleChoice, ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for _, option := range options {
+		message.Poll.Options = append(message.Poll.Options, models.PollOption{Text: option})
+	}
+	assert.NoError(t, Prepare(&message, time.Now()))
+	return message
+}
+
+func TestPrepare(t *testing.T) {
+	now := time.Now()
+	text := models.Message{Message: "hello"}
+	assert.NoError(t, Prepare(&text, now))
+	assert.Equal(t, models.KindText, text.Kind)
+
+	poll := &models.Poll{
+		Options:   []models.PollOption{{Text: " pizza "}, {Text: "sushi", Votes: 42}},
+		ExpiresAt: now.Add(time.Hour),
+		Voters:    42,
+	}
+	assert.ErrorIs(t, Prepare(&models.Message{Poll: poll}, now), ErrInvalidPoll, "only polls carry a poll")
+	assert.ErrorIs(t, Prepare(&models.Message{Kind: models.KindPoll}, now), ErrInvalidPoll)
+
+	message := models.Message{Kind: models.KindPoll, Poll: poll}
+	assert.NoError(t, Prepare(&message, now))
+	assert.Equal(t, []models.PollOption{{Text: "pizza"}, {Text: "sushi"}}, message.Poll.Options)
+	assert.Zero(t, message.Poll.Voters)
+
+	for _, invalid := range []models.Poll{
+		{Options: []models.PollOption{{Text: "pizza"}}, ExpiresAt: now.Add(time.Hour)},
+		{Options: []models.PollOption{{Text: "pizza"}, {Text: "pizza "}}, ExpiresAt: now.Add(time.Hour)},
+		{Options: []models.PollOption{{Text: "pizza"}, {Text: " "}}, ExpiresAt: now.Add(time.Hour)},
+		{Options: []models.PollOption{{Text: "pizza"}, {Text: "sushi"}}, ExpiresAt: now.Add(time.Second)},
+		{Options: []models.PollOption{{Text: "pizza"}, {Text: "sushi"}}, ExpiresAt: now.Add(MaximumDuration + time.Hour)},
+	} {
+		assert.ErrorIs(t, Prepare(&models.Message{Kind: models.KindPoll, Poll: &invalid}, now), ErrInvalidPoll)
+	}
+}
+
+func TestVotesAreTallied(t *testing.T) {
+	store := repository.NewInMemoryPollRepository()
+	polls := NewPolls(&store)
+	single := newPoll(t, false, "pizza", "sushi", "salad")
+	multiple := newPoll(t, true, "monday", "tuesday", "wednesday")
+
+	tallied, err := polls.Vote(single, "bob", models.Vote{Options: []int{1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tallied.Poll.Options[1].Votes)
+	_, err = polls.Vote(single, "bob", models.Vote{Options: []int{0}})
+	assert.ErrorIs(t, err, ErrAlreadyVoted)
+	_, err = polls.Vote(single, "carol", models.Vote{Options: []int{0, 1}})
+	assert.ErrorIs(t, err, ErrInvalidVote, "a single option only")
+	_, err = polls.Vote(single, "carol", models.Vote{Options: []int{3}})
+	assert.ErrorIs(t, err, ErrInvalidVote)
+	_, err = polls.Vote(models.Message{ID: gocql.TimeUUID().String(), Kind: models.KindText}, "carol", models.Vote{Options: []int{0}})
+	assert.ErrorIs(t, err, ErrNotAPoll)
+
+	_, err = polls.Retract(single, "bob")
+	assert.NoError(t, err)
+	_, err = polls.Vote(single, "bob", models.Vote{Options: []int{0}})
+	assert.NoError(t, err, "voting again after retracting")
+	_, _ = polls.Vote(single, "carol", models.Vote{Options: []int{0}})
+
+	_, err = polls.Vote(multiple, "bob", models.Vote{Options: []int{2, 0, 2}})
+	assert.ErrorIs(t, err, ErrInvalidVote, "an option once")
+	_, err = polls.Vote(multiple, "bob", models.Vote{Options: []int{2, 0}})
+	assert.NoError(t, err)
+	_, _ = polls.Vote(multiple, "carol", models.Vote{Options: []int{0}})
+
+	read := []*models.Message{&single, &multiple, {ID: gocql.TimeUUID().String(), Message: "hello"}}
+	assert.NoError(t, polls.Tally(read...))
+	assert.Equal(t, []int{2, 0, 0}, votes(single))
+	assert.Equal(t, 2, single.Poll.Voters)
+	assert.Equal(t, []int{2, 0, 1}, votes(multiple))
+	assert.False(t, multiple.Poll.Closed)
+}
+
+func votes(message models.Message) []int {
+	var votes []int
+	for _, option := range message.Poll.Options {
+		votes = append(votes, option.Votes)
+	}
+	return votes
+}
+
+func TestExpiredPollsAreClosed(t *testing.T) {
+	store := repository.NewInMemoryPollRepository()
+	polls := NewPolls(&store)
+	poll := newPoll(t, false, "yes", "no")
+	_, err := polls.Vote(poll, "bob", models.Vote{Options: []int{0}})
+	assert.NoError(t, err)
+
+	poll.Poll.ExpiresAt = time.Now().Add(-time.Second)
+	_, err = polls.Vote(poll, "carol", models.Vote{Options: []int{1}})
+	assert.ErrorIs(t, err, ErrPollClosed)
+	_, err = polls.Retract(poll, "bob")
+	assert.ErrorIs(t, err, ErrPollClosed)
+
+	assert.NoError(t, polls.Tally(&poll))
+	assert.True(t, poll.Poll.Closed)
+	assert.Equal(t, []int{1, 0}, votes(poll), "the results stay")
+}
+
+func TestVotesAreDeleted(t *testing.T) {
+	store := repository.NewInMemoryPollRepository()
+	polls := NewPolls(&store)
+	first, second := newPoll(t, false, "yes", "no"), newPoll(t, false, "yes", "no")
+	for _, user := range []string{"bob", "carol"} {
+		_, _ = polls.Vote(first, user, models.Vote{Options: []int{0}})
+		_, _ = polls.Vote(second, user, models.Vote{Options: []int{1}})
+	}
+
+	assert.NoError(t, polls.DeleteUser("bob"))
+	polls.Publish(events.New(events.MessageDeleted, first))
+	assert.NoError(t, polls.Tally(&first, &second))
+	assert.Equal(t, 0, first.Poll.Voters)
+	assert.Equal(t, []int{0, 1}, votes(second))
+
+	voted, _ := store.GetVotedPolls("carol")
+	assert.Equal(t, []string{second.ID}, voted)
+}
@@ -0,0 +1,4 @@
+// Package messagepb holds the code generated from proto/message/v1/message.proto.
+package messagepb
+
+//go:generate protoc --proto_path=../../../proto --go_out=../../.. --go_opt=module=discard/message-service --go-grpc_out=../../.. --go-grpc_opt=module=discard/message-service message/v1/message.proto
@@ -0,0 +1,396 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: message/v1/message.proto
+
+package messagepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MessageService_Save_FullMethodName          = "/discard.message.v1.MessageService/Save"
+	MessageService_GetById_FullMethodName       = "/discard.message.v1.MessageService/GetById"
+	MessageService_ListByUser_FullMethodName    = "/discard.message.v1.MessageService/ListByUser"
+	MessageService_ListByChannel_FullMethodName = "/discard.message.v1.MessageService/ListByChannel"
+	MessageService_DeleteByUser_FullMethodName  = "/discard.message.v1.MessageService/DeleteByUser"
+	MessageService_WatchChannel_FullMethodName  = "/discard.message.v1.MessageService/WatchChannel"
+	MessageService_WatchServer_FullMethodName   = "/discard.message.v1.MessageService/WatchServer"
+)
+
+// MessageServiceClient is the client API for MessageService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MessageServiceClient interface {
+	Save(ctx context.Context, in *SaveRequest, opts ...grpc.CallOption) (*SaveResponse, error)
+	GetById(ctx context.Context, in *GetByIdRequest, opts ...grpc.CallOption) (*Message, error)
+	ListByUser(ctx context.Context, in *ListByUserRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// ListByChannel pages through the history of a channel, oldest message first.
+	ListByChannel(ctx context.Context, in *ListByChannelRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	DeleteByUser(ctx context.Context, in *DeleteByUserRequest, opts ...grpc.CallOption) (*DeleteByUserResponse, error)
+	// WatchChannel streams the events of a channel. With a cursor it first
+	// replays what happened after that event.
+	WatchChannel(ctx context.Context, in *WatchChannelRequest, opts ...grpc.CallOption) (MessageService_WatchChannelClient, error)
+	// WatchServer streams the events of every channel of a server. It fails
+	// with OUT_OF_RANGE when the events after the cursor are no longer known.
+	WatchServer(ctx context.Context, in *WatchServerRequest, opts ...grpc.CallOption) (MessageService_WatchServerClient, error)
+}
+
+type messageServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMessageServiceClient(cc grpc.ClientConnInterface) MessageServiceClient {
+	return &messageServiceClient{cc}
+}
+
+func (c *messageServiceClient) Save(ctx context.Context, in *SaveRequest, opts ...grpc.CallOption) (*SaveResponse, error) {
+	out := new(SaveResponse)
+	err := c.cc.Invoke(ctx, MessageService_Save_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) GetById(ctx context.Context, in *GetByIdRequest, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := c.cc.Invoke(ctx, MessageService_GetById_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) ListByUser(ctx context.Context, in *ListByUserRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, MessageService_ListByUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) ListByChannel(ctx context.Context, in *ListByChannelRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, MessageService_ListByChannel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) DeleteByUser(ctx context.Context, in *DeleteByUserRequest, opts ...grpc.CallOption) (*DeleteByUserResponse, error) {
+	out := new(DeleteByUserResponse)
+	err := c.cc.Invoke(ctx, MessageService_DeleteByUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) WatchChannel(ctx context.Context, in *WatchChannelRequest, opts ...grpc.CallOption) (MessageService_WatchChannelClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MessageService_ServiceDesc.Streams[0], MessageService_WatchChannel_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &messageServiceWatchChannelClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MessageService_WatchChannelClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type messageServiceWatchChannelClient struct {
+	grpc.ClientStream
+}
+
+func (x *messageServiceWatchChannelClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *messageServiceClient) WatchServer(ctx context.Context, in *WatchServerRequest, opts ...grpc.CallOption) (MessageService_WatchServerClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MessageService_ServiceDesc.Streams[1], MessageService_WatchServer_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &messageServiceWatchServerClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MessageService_WatchServerClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type messageServiceWatchServerClient struct {
+	grpc.ClientStream
+}
+
+func (x *messageServiceWatchServerClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MessageServiceServer is the server API for MessageService service.
+// All implementations must embed UnimplementedMessageServiceServer
+// for forward compatibility
+type MessageServiceServer interface {
+	Save(context.Context, *SaveRequest) (*SaveResponse, error)
+	GetById(context.Context, *GetByIdRequest) (*Message, error)
+	ListByUser(context.Context, *ListByUserRequest) (*ListResponse, error)
+	// ListByChannel pages through the history of a channel, oldest message first.
+	ListByChannel(context.Context, *ListByChannelRequest) (*ListResponse, error)
+	DeleteByUser(context.Context, *DeleteByUserRequest) (*DeleteByUserResponse, error)
+	// WatchChannel streams the events of a channel. With a cursor it first
+	// replays what happened after that event.
+	WatchChannel(*WatchChannelRequest, MessageService_WatchChannelServer) error
+	// WatchServer streams the events of every channel of a server. It fails
+	// with OUT_OF_RANGE when the events after the cursor are no longer known.
+	WatchServer(*WatchServerRequest, MessageService_WatchServerServer) error
+	mustEmbedUnimplementedMessageServiceServer()
+}
+
+// UnimplementedMessageServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMessageServiceServer struct {
+}
+
+func (UnimplementedMessageServiceServer) Save(context.Context, *SaveRequest) (*SaveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Save not implemented")
+}
+func (UnimplementedMessageServiceServer) GetById(context.Context, *GetByIdRequest) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetById not implemented")
+}
+func (UnimplementedMessageServiceServer) ListByUser(context.Context, *ListByUserRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListByUser not implemented")
+}
+func (UnimplementedMessageServiceServer) ListByChannel(context.Context, *ListByChannelRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListByChannel not implemented")
+}
+func (UnimplementedMessageServiceServer) DeleteByUser(context.Context, *DeleteByUserRequest) (*DeleteByUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteByUser not implemented")
+}
+func (UnimplementedMessageServiceServer) WatchChannel(*WatchChannelRequest, MessageService_WatchChannelServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchChannel not implemented")
+}
+func (UnimplementedMessageServiceServer) WatchServer(*WatchServerRequest, MessageService_WatchServerServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchServer not implemented")
+}
+func (UnimplementedMessageServiceServer) mustEmbedUnimplementedMessageServiceServer() {}
+
+// UnsafeMessageServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MessageServiceServer will
+// result in compilation errors.
+type UnsafeMessageServiceServer interface {
+	mustEmbedUnimplementedMessageServiceServer()
+}
+
+func RegisterMessageServiceServer(s grpc.ServiceRegistrar, srv MessageServiceServer) {
+	s.RegisterService(&MessageService_ServiceDesc, srv)
+}
+
+func _MessageService_Save_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).Save(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_Save_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).Save(ctx, req.(*SaveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_GetById_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).GetById(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_GetById_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).GetById(ctx, req.(*GetByIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_ListByUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListByUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).ListByUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_ListByUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).ListByUser(ctx, req.(*ListByUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_ListByChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListByChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).ListByChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_ListByChannel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).ListByChannel(ctx, req.(*ListByChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_DeleteByUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteByUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).DeleteByUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_DeleteByUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).DeleteByUser(ctx, req.(*DeleteByUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_WatchChannel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChannelRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MessageServiceServer).WatchChannel(m, &messageServiceWatchChannelServer{stream})
+}
+
+type MessageService_WatchChannelServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type messageServiceWatchChannelServer struct {
+	grpc.ServerStream
+}
+
+func (x *messageServiceWatchChannelServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MessageService_WatchServer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchServerRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MessageServiceServer).WatchServer(m, &messageServiceWatchServerServer{stream})
+}
+
+type MessageService_WatchServerServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type messageServiceWatchServerServer struct {
+	grpc.ServerStream
+}
+
+func (x *messageServiceWatchServerServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// MessageService_ServiceDesc is the grpc.ServiceDesc for MessageService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MessageService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "discard.message.v1.MessageService",
+	HandlerType: (*MessageServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Save",
+			Handler:    _MessageService_Save_Handler,
+		},
+		{
+			MethodName: "GetById",
+			Handler:    _MessageService_GetById_Handler,
+		},
+		{
+			MethodName: "ListByUser",
+			Handler:    _MessageService_ListByUser_Handler,
+		},
+		{
+			MethodName: "ListByChannel",
+			Handler:    _MessageService_ListByChannel_Handler,
+		},
+		{
+			MethodName: "DeleteByUser",
+			Handler:    _MessageService_DeleteByUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchChannel",
+			Handler:       _MessageService_WatchChannel_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchServer",
+			Handler:       _MessageService_WatchServer_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "message/v1/message.proto",
+}
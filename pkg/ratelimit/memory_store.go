@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// buckets that have been full for a while are dropped every sweepInterval takes
+const sweepInterval = 1024
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func (bucket *bucket) refill(now time.Time) {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.limit.Burst), bucket.tokens+elapsed*bucket.limit.Rate)
+		bucket.updated = now
+	}
+}
+
+type inMemoryStore struct {
+	mutex        sync.Mutex
+	buckets      map[string]*bucket
+	serverLimits map[string]ServerLimits
+	slowModes    map[string]time.Duration // server ID/channel ID -> interval
+	takes        int
+}
+
+func NewInMemoryStore() Store {
+	return &inMemoryStore{
+		buckets:      make(map[string]*bucket),
+		serverLimits: make(map[string]ServerLimits),
+		slowModes:    make(map[string]time.Duration),
+	}
+}
+
+func (store *inMemoryStore) Take(buckets []Bucket, now time.Time) (time.Duration, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.takes++
+	if store.takes%sweepInterval == 0 {
+		store.sweep(now)
+	}
+
+	var retryAfter time.Duration
+	current := make([]*bucket, 0, len(buckets))
+	for _, requested := range buckets {
+		found, exists := store.buckets[requested.Key]
+		if !exists {
+			found = &bucket{tokens: float64(requested.Limit.Burst), updated: now, limit: requested.Limit}
+			store.buckets[requested.Key] = found
+		}
+		found.limit = requested.Limit
+		found.refill(now)
+		current = append(current, found)
+
+		if found.tokens < 1 {
+			missing := (1 - found.tokens) / requested.Limit.Rate
+			retryAfter = max(retryAfter, time.Duration(missing*float64(time.Second)))
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, false, nil
+	}
+
+	for _, found := range current {
+		found.tokens--
+	}
+	return 0, true, nil
+}
+
+func (store *inMemoryStore) sweep(now time.Time) {
+	for key, current := range store.buckets {
+		current.refill(now)
+		if current.tokens >= float64(current.limit.Burst) {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+func (store *inMemoryStore) ServerLimits(serverID string) (ServerLimits, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	limits, found := store.serverLimits[serverID]
+	return limits, found, nil
+}
+
+func (store *inMemoryStore) SetServerLimits(serverID string, limits ServerLimits) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.serverLimits[serverID] = limits
+	return nil
+}
+
+func (store *inMemoryStore) SlowMode(serverID string, channelID string) (time.Duration, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.slowModes[serverID+"/"+channelID], nil
+}
+
+func (store *inMemoryStore) SetSlowMode(serverID string, channelID string, interval time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if interval <= 0 {
+		delete(store.slowModes, serverID+"/"+channelID)
+		return nil
+	}
+	store.slowModes[serverID+"/"+channelID] = interval
+	return nil
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	logger "discard/message-service/pkg/models/logger"
+	"time"
+)
+
+// Limit describes a token bucket refilling Rate tokens per second up to Burst.
+// A zero Rate or Burst disables the bucket.
+type Limit struct {
+	Rate  float64 `json:"rate" binding:"min=0"`
+	Burst int     `json:"burst" binding:"min=0"`
+}
+
+func (limit Limit) Enabled() bool {
+	return limit.Rate > 0 && limit.Burst > 0
+}
+
+type ServerLimits struct {
+	User    Limit `json:"user"`
+	Channel Limit `json:"channel"`
+}
+
+// Bucket is a token bucket of a Limit, identified by its key.
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Store keeps bucket state and limiter settings. The in-memory store is enough
+// for a single instance; several instances need a shared implementation.
+type Store interface {
+	// Take takes a token from every bucket, or from none of them when one is
+	// empty. It then returns how long to wait for the emptiest bucket.
+	Take(buckets []Bucket, now time.Time) (retryAfter time.Duration, allowed bool, err error)
+	ServerLimits(serverID string) (limits ServerLimits, found bool, err error)
+	SetServerLimits(serverID string, limits ServerLimits) error
+	// SlowMode is kept per channel of a server, so setting it for a channel
+	// of another server has no effect on the channel itself.
+	SlowMode(serverID string, channelID string) (time.Duration, error)
+	SetSlowMode(serverID string, channelID string, interval time.Duration) error
+}
+
+type Request struct {
+	ServerID       string
+	ChannelID      string
+	UserID         string
+	BypassSlowMode bool
+}
+
+type Limiter struct {
+	store    Store
+	defaults ServerLimits
+	now      func() time.Time
+}
+
+func NewLimiter(store Store, defaults ServerLimits) *Limiter {
+	return &Limiter{store: store, defaults: defaults, now: time.Now}
+}
+
+func (limiter *Limiter) Store() Store {
+	return limiter.store
+}
+
+// Allow takes a token from every bucket the request falls under. A refused
+// request takes no token at all, so retrying in slow mode does not drain the
+// channel bucket of everybody else. It fails open when the store is
+// unavailable so an outage does not block all messaging.
+func (limiter *Limiter) Allow(request Request) (time.Duration, bool) {
+	now := limiter.now()
+
+	limits, found, err := limiter.store.ServerLimits(request.ServerID)
+	if err != nil {
+		logger.WARN.Println("Failed to load rate limits for server "+request.ServerID+": ", err)
+	}
+	if !found {
+		limits = limiter.defaults
+	}
+
+	var buckets []Bucket
+	add := func(key string, limit Limit) {
+		if limit.Enabled() {
+			buckets = append(buckets, Bucket{Key: key, Limit: limit})
+		}
+	}
+	// buckets are kept per server like their limits, channel IDs of
+	// different servers never share one
+	add("user:"+request.ServerID+":"+request.UserID, limits.User)
+
+	if request.ChannelID != "" {
+		add("channel:"+request.ServerID+":"+request.ChannelID, limits.Channel)
+
+		if !request.BypassSlowMode {
+			interval, err := limiter.store.SlowMode(request.ServerID, request.ChannelID)
+			if err != nil {
+				logger.WARN.Println("Failed to load slow mode for channel "+request.ChannelID+": ", err)
+			}
+			if interval > 0 {
+				add("slowmode:"+request.ServerID+":"+request.ChannelID+":"+request.UserID, Limit{Rate: 1 / interval.Seconds(), Burst: 1})
+			}
+		}
+	}
+	if len(buckets) == 0 {
+		return 0, true
+	}
+
+	retryAfter, allowed, err := limiter.store.Take(buckets, now)
+	if err != nil {
+		logger.WARN.Println("Failed to take rate limit tokens for user "+request.UserID+": ", err)
+		return 0, true
+	}
+	return retryAfter, allowed
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(defaults ServerLimits) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewInMemoryStore(), defaults)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestUserBucketRefills(t *testing.T) {
+	limiter, now := newTestLimiter(ServerLimits{User: Limit{Rate: 1, Burst: 2}})
+	request := Request{ServerID: "server", UserID: "user"}
+
+	_, allowed := limiter.Allow(request)
+	assert.True(t, allowed)
+	_, allowed = limiter.Allow(request)
+	assert.True(t, allowed)
+
+	retryAfter, allowed := limiter.Allow(request)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	*now = now.Add(time.Second)
+	_, allowed = limiter.Allow(request)
+	assert.True(t, allowed)
+
+	// other users are not affected
+	_, allowed = limiter.Allow(Request{ServerID: "server", UserID: "other"})
+	assert.True(t, allowed)
+}
+
+func TestServerLimitsOverrideDefaults(t *testing.T) {
+	limiter, _ := newTestLimiter(ServerLimits{User: Limit{Rate: 1, Burst: 1}})
+	assert.NoError(t, limiter.Store().SetServerLimits("big", ServerLimits{User: Limit{Rate: 1, Burst: 3}}))
+
+	for i := 0; i < 3; i++ {
+		_, allowed := limiter.Allow(Request{ServerID: "big", UserID: "user"})
+		assert.True(t, allowed)
+	}
+	_, allowed := limiter.Allow(Request{ServerID: "big", UserID: "user"})
+	assert.False(t, allowed)
+}
+
+func TestSlowMode(t *testing.T) {
+	limiter, now := newTestLimiter(ServerLimits{})
+	assert.NoError(t, limiter.Store().SetSlowMode("server", "channel", 10*time.Second))
+	request := Request{ServerID: "server", ChannelID: "channel", UserID: "user"}
+
+	_, allowed := limiter.Allow(request)
+	assert.True(t, allowed)
+
+	retryAfter, allowed := limiter.Allow(request)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, retryAfter)
+
+	request.BypassSlowMode = true
+	_, allowed = limiter.Allow(request)
+	assert.True(t, allowed)
+
+	request.BypassSlowMode = false
+	*now = now.Add(10 * time.Second)
+	_, allowed = limiter.Allow(request)
+	assert.True(t, allowed)
+}
+
+func TestSlowModeOfAnotherServerDoesNotApply(t *testing.T) {
+	limiter, _ := newTestLimiter(ServerLimits{})
+	assert.NoError(t, limiter.Store().SetSlowMode("other", "channel", time.Hour))
+
+	for i := 0; i < 3; i++ {
+		_, allowed := limiter.Allow(Request{ServerID: "server", ChannelID: "channel", UserID: "user"})
+		assert.True(t, allowed)
+	}
+}
+
+func TestRefusedRequestsTakeNoTokens(t *testing.T) {
+	limiter, _ := newTestLimiter(ServerLimits{Channel: Limit{Rate: 0.001, Burst: 3}})
+	assert.NoError(t, limiter.Store().SetSlowMode("server", "channel", time.Hour))
+	slow := Request{ServerID: "server", ChannelID: "channel", UserID: "slow"}
+
+	_, allowed := limiter.Allow(slow)
+	assert.True(t, allowed)
+	for i := 0; i < 5; i++ {
+		_, allowed = limiter.Allow(slow)
+		assert.False(t, allowed)
+	}
+
+	// the retries of the slow user left the channel bucket to the others
+	for _, user := range []string{"alice", "bob"} {
+		_, allowed = limiter.Allow(Request{ServerID: "server", ChannelID: "channel", UserID: user})
+		assert.True(t, allowed)
+	}
+}
+
+func TestBucketsArePerServer(t *testing.T) {
+	limiter, _ := newTestLimiter(ServerLimits{User: Limit{Rate: 0.001, Burst: 1}, Channel: Limit{Rate: 0.001, Burst: 1}})
+	assert.NoError(t, limiter.Store().SetSlowMode("one", "channel", time.Hour))
+	assert.NoError(t, limiter.Store().SetSlowMode("two", "channel", time.Hour))
+
+	_, allowed := limiter.Allow(Request{ServerID: "one", ChannelID: "channel", UserID: "user"})
+	assert.True(t, allowed)
+	_, allowed = limiter.Allow(Request{ServerID: "one", ChannelID: "channel", UserID: "user"})
+	assert.False(t, allowed)
+
+	// the channel of the same ID in another server keeps its tokens
+	_, allowed = limiter.Allow(Request{ServerID: "two", ChannelID: "channel", UserID: "user"})
+	assert.True(t, allowed)
+}
@@ -0,0 +1,183 @@
+package realtime
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"sync"
+)
+
+// Hub fans message events out to subscribers and keeps the most recent ones
+// around so reconnecting clients can resume from their last event ID.
+type Hub struct {
+	mutex         sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	recent        []events.Event // ring buffer ordered by publication
+	next          int
+	evicted       string // ID of the newest event that fell out of recent
+}
+
+func NewHub(history int) *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+		recent:        make([]events.Event, 0, history),
+	}
+}
+
+// Subscription receives the events of the channels and servers it follows.
+// It is closed when its buffer overflows, slow consumers have to resume.
+type Subscription struct {
+	events   chan events.Event
+	done     chan struct{}
+	channels map[string]bool
+	servers  map[string]bool
+	closed   bool
+}
+
+func (subscription *Subscription) Events() <-chan events.Event {
+	return subscription.events
+}
+
+// Done is closed once the hub dropped the subscription.
+func (subscription *Subscription) Done() <-chan struct{} {
+	return subscription.done
+}
+
+func (subscription *Subscription) matches(event events.Event) bool {
+	return subscription.channels[event.Message.ChannelID] || subscription.servers[event.Message.ServerID]
+}
+
+func (hub *Hub) Subscribe(buffer int) *Subscription {
+	subscription := &Subscription{
+		events:   make(chan events.Event, buffer),
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+		servers:  make(map[string]bool),
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+func (hub *Hub) Unsubscribe(subscription *Subscription) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.drop(subscription)
+}
+
+func (hub *Hub) drop(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	delete(hub.subscriptions, subscription)
+	close(subscription.done)
+}
+
+// Follow adds channels and servers to the subscription. With a cursor the
+// buffered events after it are queued first, complete is false when the
+// buffer no longer reaches back to the cursor or they did not fit.
+func (hub *Hub) Follow(subscription *Subscription, channels []string, servers []string, cursor string) (complete bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	added := &Subscription{channels: make(map[string]bool), servers: make(map[string]bool)}
+	for _, channel := range channels {
+		subscription.channels[channel] = true
+		added.channels[channel] = true
+	}
+	for _, server := range servers {
+		subscription.servers[server] = true
+		added.servers[server] = true
+	}
+
+	if cursor == "" {
+		return true
+	}
+	if cap(hub.recent) == 0 {
+		return false // without history nothing after the cursor can be replayed
+	}
+
+	var replay []events.Event
+	for _, event := range hub.ordered() {
+		if timeuuid.Compare(event.ID, cursor) > 0 && added.matches(event) {
+			replay = append(replay, event)
+		}
+	}
+
+	complete = hub.evicted == "" || timeuuid.Compare(hub.evicted, cursor) <= 0
+	if len(replay) > cap(subscription.events)-len(subscription.events) {
+		return false
+	}
+	for _, event := range replay {
+		subscription.events <- event
+	}
+	return complete
+}
+
+func (hub *Hub) Unfollow(subscription *Subscription, channels []string, servers []string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for _, channel := range channels {
+		delete(subscription.channels, channel)
+	}
+	for _, server := range servers {
+		delete(subscription.servers, server)
+	}
+}
+
+// ordered returns the buffered events oldest first, the caller holds the lock.
+func (hub *Hub) ordered() []events.Event {
+	if len(hub.recent) < cap(hub.recent) {
+		return hub.recent
+	}
+	return append(append([]events.Event{}, hub.recent[hub.next:]...), hub.recent[:hub.next]...)
+}
+
+// Publish never blocks, subscriptions that cannot keep up are dropped.
+func (hub *Hub) Publish(event events.Event) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if event.Type == events.UserErased {
+		hub.erase(event.Message.UserID)
+		return
+	}
+
+	if cap(hub.recent) > 0 {
+		if len(hub.recent) < cap(hub.recent) {
+			hub.recent = append(hub.recent, event)
+		} else {
+			hub.evicted = hub.recent[hub.next].ID
+			hub.recent[hub.next] = event
+			hub.next = (hub.next + 1) % cap(hub.recent)
+		}
+	}
+
+	for subscription := range hub.subscriptions {
+		if !subscription.matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			hub.drop(subscription)
+		}
+	}
+}
+
+// erase clears the content of the buffered events of a user, they are kept so
+// cursors and replays still line up. The caller holds the lock.
+func (hub *Hub) erase(userID string) {
+	for i, event := range hub.recent {
+		if event.Message.UserID != userID {
+			continue
+		}
+		message := event.Message
+		hub.recent[i].Message = models.Message{
+			ID: message.ID, UserID: message.UserID, ServerID: message.ServerID, ChannelID: message.ChannelID, Kind: message.Kind}
+	}
+}
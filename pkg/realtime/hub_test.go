@@ -0,0 +1,156 @@
+package realtime
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	start    = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sequence = 0
+)
+
+// published returns n events of the channel with IDs after all earlier ones.
+func published(n int, channelID string) []events.Event {
+	var published []events.Event
+	for i := 0; i < n; i++ {
+		sequence++
+		id := gocql.UUIDFromTime(start.Add(time.Duration(sequence) * time.Second)).String()
+		published = append(published, events.Event{
+			ID:      id,
+			Type:    events.MessageCreated,
+			Message: models.Message{ID: id, ServerID: "server", ChannelID: channelID},
+		})
+	}
+	return published
+}
+
+func received(subscription *Subscription) []string {
+	var ids []string
+	for {
+		select {
+		case event := <-subscription.Events():
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func ids(published []events.Event) []string {
+	var ids []string
+	for _, event := range published {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestFollowReplaysAfterTheCursor(t *testing.T) {
+	all := published(5, "general")
+	before := gocql.UUIDFromTime(start).String()
+	after := gocql.UUIDFromTime(start.Add(24 * time.Hour)).String()
+
+	for _, test := range []struct {
+		name     string
+		history  int
+		buffer   int
+		cursor   string
+		replayed []events.Event
+		complete bool
+	}{
+		{"without a cursor nothing is replayed", 10, 10, "", nil, true},
+		{"inside the buffer", 10, 10, all[1].ID, all[2:], true},
+		{"at the newest event", 10, 10, all[4].ID, nil, true},
+		{"after every event", 10, 10, after, nil, true},
+		{"before every event kept from the start", 10, 10, before, all, true},
+		{"at the newest evicted event", 3, 10, all[1].ID, all[2:], true},
+		{"before the evicted events", 3, 10, all[0].ID, all[2:], false},
+		{"without history", 0, 10, all[1].ID, nil, false},
+		{"more than the subscription holds", 10, 2, all[0].ID, nil, false},
+		{"not a time UUID", 10, 10, "not-an-id", all, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewHub(test.history)
+			for _, event := range all {
+				hub.Publish(event)
+			}
+
+			subscription := hub.Subscribe(test.buffer)
+			complete := hub.Follow(subscription, []string{"general"}, nil, test.cursor)
+			assert.Equal(t, test.complete, complete)
+			assert.Equal(t, ids(test.replayed), received(subscription))
+		})
+	}
+}
+
+func TestFollowReplaysOnlyWhatIsAdded(t *testing.T) {
+	hub := NewHub(10)
+	general, random := published(2, "general"), published(2, "random")
+	for i := range general {
+		hub.Publish(general[i])
+		hub.Publish(random[i])
+	}
+
+	subscription := hub.Subscribe(10)
+	assert.True(t, hub.Follow(subscription, []string{"general"}, nil, ""))
+	assert.True(t, hub.Follow(subscription, []string{"random"}, nil, gocql.UUIDFromTime(start).String()))
+	assert.Equal(t, ids(random), received(subscription))
+
+	hub.Unfollow(subscription, []string{"random"}, nil)
+	for _, event := range published(1, "random") {
+		hub.Publish(event)
+	}
+	assert.Empty(t, received(subscription))
+}
+
+func TestPublishDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(0)
+	slow, fast := hub.Subscribe(1), hub.Subscribe(10)
+	assert.True(t, hub.Follow(slow, []string{"general"}, nil, ""))
+	assert.True(t, hub.Follow(fast, nil, []string{"server"}, ""))
+
+	all := published(3, "general")
+	for _, event := range all {
+		hub.Publish(event)
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("the slow subscriber was not dropped")
+	}
+	assert.Equal(t, ids(all[:1]), received(slow), "what fit before the overflow is kept")
+	assert.Equal(t, ids(all), received(fast))
+
+	hub.Unsubscribe(slow) // dropping twice is harmless
+	hub.Unsubscribe(fast)
+	<-fast.Done()
+}
+
+func TestUserErasedClearsTheBufferedContent(t *testing.T) {
+	hub := NewHub(10)
+	all := published(2, "general")
+	all[0].Message.UserID, all[0].Message.Message = "erased", "secret"
+	all[1].Message.UserID, all[1].Message.Message = "other", "kept"
+	for _, event := range all {
+		hub.Publish(event)
+	}
+
+	subscription := hub.Subscribe(10)
+	assert.True(t, hub.Follow(subscription, []string{"general"}, nil, ""))
+	hub.Publish(events.New(events.UserErased, models.Message{UserID: "erased"}))
+	assert.Empty(t, received(subscription), "the erasure is not fanned out")
+
+	assert.True(t, hub.Follow(subscription, []string{"general"}, nil, gocql.UUIDFromTime(start).String()))
+	var contents []string
+	for i := 0; i < len(all); i++ {
+		event := <-subscription.Events()
+		contents = append(contents, event.Message.Message)
+	}
+	assert.Equal(t, []string{"", "kept"}, contents)
+}
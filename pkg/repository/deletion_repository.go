@@ -0,0 +1,330 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type DeletionRepository interface {
+	SaveJob(job models.DeletionJob) error
+	GetJob(id string) (*models.DeletionJob, error)
+	// GetJobsByStatus filters every job, it is only meant for startup.
+	GetJobsByStatus(status string) ([]*models.DeletionJob, error)
+
+	// AcquireLease gives instance the lease on deleting the messages of a
+	// user unless another instance holds it. It expires after ttl unless
+	// RenewLease extends it, so a stopped instance never keeps it.
+	AcquireLease(userID string, instance string, ttl time.Duration) (bool, error)
+	// RenewLease extends the lease while instance still holds it.
+	RenewLease(userID string, instance string, ttl time.Duration) (bool, error)
+	ReleaseLease(userID string, instance string) error
+
+	// AppendAudit adds the entry build returns for the hash of the newest
+	// entry, build may be called again when another entry won the race.
+	AppendAudit(build func(previousHash string) models.AuditEntry) (*models.AuditEntry, error)
+	// GetAuditHead returns the hash of the newest entry, empty if there is none.
+	GetAuditHead() (string, error)
+	// GetAudit returns every stored entry, those of appends that lost a race
+	// included. Only the entries reached from the head form the log.
+	GetAudit() ([]*models.AuditEntry, error)
+
+	// GetPolicy returns the deletion strategy of a server, ErrNotFound if none is set.
+	GetPolicy(serverID string) (string, error)
+	SetPolicy(serverID string, strategy string) error
+}
+
+const (
+	deletionAuditLog   = "deletion"
+	auditAppendRetries = 10
+)
+
+type deletionRepository struct { //_private
+	session *gocql.Session
+}
+
+const deletionJobColumns = "ID, UserID, Status, Deleted, Anonymized, Tombstoned, Deferred, Failed, KeyShredded, Pseudonym, Error, CreatedAt, UpdatedAt, CompletedAt"
+
+func NewDeletionRepository(session *gocql.Session) DeletionRepository {
+	return &deletionRepository{session: session}
+}
+
+func (repository *deletionRepository) SaveJob(job models.DeletionJob) error {
+	var query string = "INSERT INTO deletion_jobs (" + deletionJobColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		job.ID, job.UserID, job.Status, job.Deleted, job.Anonymized, job.Tombstoned, job.Deferred, job.Failed, job.KeyShredded, job.Pseudonym,
+		job.Error, job.CreatedAt, job.UpdatedAt, job.CompletedAt).Exec())
+}
+
+func scanDeletionJob(scan func(...any) bool) (*models.DeletionJob, bool) {
+	var job models.DeletionJob
+	var completedAt time.Time
+	if !scan(&job.ID, &job.UserID, &job.Status, &job.Deleted, &job.Anonymized, &job.Tombstoned, &job.Deferred, &job.Failed,
+		&job.KeyShredded, &job.Pseudonym, &job.Error, &job.CreatedAt, &job.UpdatedAt, &completedAt) {
+		return nil, false
+	}
+	if !completedAt.IsZero() {
+		job.CompletedAt = &completedAt
+	}
+	return &job, true
+}
+
+func (repository *deletionRepository) GetJob(id string) (*models.DeletionJob, error) {
+	var query string = "SELECT " + deletionJobColumns + " FROM deletion_jobs WHERE ID = ?"
+
+	iter := repository.session.Query(query, id).Iter()
+	job, found := scanDeletionJob(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+func (repository *deletionRepository) GetJobsByStatus(status string) ([]*models.DeletionJob, error) {
+	var jobs []*models.DeletionJob
+	var query string = "SELECT " + deletionJobColumns + " FROM deletion_jobs WHERE Status = ? ALLOW FILTERING"
+
+	iter := repository.session.Query(query, status).Iter()
+	for {
+		job, found := scanDeletionJob(iter.Scan)
+		if !found {
+			break
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, translate(iter.Close())
+}
+
+func (repository *deletionRepository) AcquireLease(userID string, instance string, ttl time.Duration) (bool, error) {
+	var query string = "INSERT INTO deletion_leases (UserID, Instance) VALUES (?, ?) IF NOT EXISTS USING TTL ?"
+	applied, err := repository.session.Query(query, userID, instance, int(ttl.Seconds())).MapScanCAS(map[string]any{})
+	return applied, translate(err)
+}
+
+func (repository *deletionRepository) RenewLease(userID string, instance string, ttl time.Duration) (bool, error) {
+	var query string = "UPDATE deletion_leases USING TTL ? SET Instance = ? WHERE UserID = ? IF Instance = ?"
+	applied, err := repository.session.Query(query, int(ttl.Seconds()), instance, userID, instance).MapScanCAS(map[string]any{})
+	return applied, translate(err)
+}
+
+func (repository *deletionRepository) ReleaseLease(userID string, instance string) error {
+	var query string = "DELETE FROM deletion_leases WHERE UserID = ? IF Instance = ?"
+	_, err := repository.session.Query(query, userID, instance).MapScanCAS(map[string]any{})
+	return translate(err)
+}
+
+// AppendAudit stores the entry first and then moves the head of the chain to
+// it with a lightweight transaction. Moving the head commits the entry, so
+// concurrent instances can never both append after the same entry and a
+// committed entry is always stored.
+func (repository *deletionRepository) AppendAudit(build func(previousHash string) models.AuditEntry) (*models.AuditEntry, error) {
+	var insertHeadQuery string = "INSERT INTO audit_log_head (Log, Hash) VALUES (?, ?) IF NOT EXISTS"
+	var moveHeadQuery string = "UPDATE audit_log_head SET Hash = ? WHERE Log = ? IF Hash = ?"
+	var query string = "INSERT INTO audit_log (Log, ID, Action, UserID, JobID, Messages, At, PreviousHash, Hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	var deleteQuery string = "DELETE FROM audit_log WHERE Log = ? AND ID = ?"
+
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		head, err := repository.GetAuditHead()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := build(head)
+		if err := repository.session.Query(query, deletionAuditLog, entry.ID, entry.Action, entry.UserID,
+			entry.JobID, entry.Messages, entry.At, entry.PreviousHash, entry.Hash).Exec(); err != nil {
+			return nil, translate(err)
+		}
+
+		var applied bool
+		if head == "" {
+			applied, err = repository.session.Query(insertHeadQuery, deletionAuditLog, entry.Hash).MapScanCAS(map[string]any{})
+		} else {
+			applied, err = repository.session.Query(moveHeadQuery, entry.Hash, deletionAuditLog, head).MapScanCAS(map[string]any{})
+		}
+		if err != nil {
+			return nil, translate(err)
+		}
+		if applied {
+			return &entry, nil
+		}
+		// never part of the chain, reading the log skips it should this fail
+		repository.session.Query(deleteQuery, deletionAuditLog, entry.ID).Exec()
+	}
+	return nil, ErrConflict
+}
+
+func (repository *deletionRepository) GetAuditHead() (string, error) {
+	var head string
+	err := repository.session.Query("SELECT Hash FROM audit_log_head WHERE Log = ?", deletionAuditLog).Scan(&head)
+	if err != nil && err != gocql.ErrNotFound {
+		return "", translate(err)
+	}
+	return head, nil
+}
+
+func (repository *deletionRepository) GetAudit() ([]*models.AuditEntry, error) {
+	var entries []*models.AuditEntry
+	var query string = "SELECT ID, Action, UserID, JobID, Messages, At, PreviousHash, Hash FROM audit_log WHERE Log = ? ORDER BY ID ASC"
+
+	iter := repository.session.Query(query, deletionAuditLog).Iter()
+	for {
+		var entry models.AuditEntry
+		if !iter.Scan(&entry.ID, &entry.Action, &entry.UserID, &entry.JobID, &entry.Messages,
+			&entry.At, &entry.PreviousHash, &entry.Hash) {
+			break
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, translate(iter.Close())
+}
+
+func (repository *deletionRepository) GetPolicy(serverID string) (string, error) {
+	var strategy string
+	var query string = "SELECT Strategy FROM deletion_policies WHERE ServerID = ?"
+
+	if err := repository.session.Query(query, serverID).Scan(&strategy); err != nil {
+		return "", translate(err)
+	}
+	return strategy, nil
+}
+
+func (repository *deletionRepository) SetPolicy(serverID string, strategy string) error {
+	var query string = "INSERT INTO deletion_policies (ServerID, Strategy) VALUES (?, ?)"
+	return translate(repository.session.Query(query, serverID, strategy).Exec())
+}
+
+// === Integration Test ===
+type inMemoryDeletionRepository struct {
+	mutex    sync.Mutex
+	jobs     map[string]models.DeletionJob
+	leases   map[string]deletionLease // user ID -> lease
+	audit    []*models.AuditEntry
+	head     string
+	policies map[string]string
+}
+
+type deletionLease struct {
+	instance string
+	expires  time.Time
+}
+
+func NewInMemoryDeletionRepository() DeletionRepository {
+	return &inMemoryDeletionRepository{
+		jobs:     make(map[string]models.DeletionJob),
+		leases:   make(map[string]deletionLease),
+		policies: make(map[string]string)}
+}
+
+func (repository *inMemoryDeletionRepository) SaveJob(job models.DeletionJob) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.jobs[job.ID] = job
+	return nil
+}
+
+func (repository *inMemoryDeletionRepository) GetJob(id string) (*models.DeletionJob, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	job, found := repository.jobs[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+func (repository *inMemoryDeletionRepository) GetJobsByStatus(status string) ([]*models.DeletionJob, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var jobs []*models.DeletionJob
+	for _, job := range repository.jobs {
+		if job.Status == status {
+			jobs = append(jobs, &job)
+		}
+	}
+	return jobs, nil
+}
+
+func (repository *inMemoryDeletionRepository) AcquireLease(userID string, instance string, ttl time.Duration) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if lease, found := repository.leases[userID]; found && time.Now().Before(lease.expires) {
+		return false, nil
+	}
+	repository.leases[userID] = deletionLease{instance: instance, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (repository *inMemoryDeletionRepository) RenewLease(userID string, instance string, ttl time.Duration) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	lease, found := repository.leases[userID]
+	if !found || lease.instance != instance || !time.Now().Before(lease.expires) {
+		return false, nil
+	}
+	repository.leases[userID] = deletionLease{instance: instance, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (repository *inMemoryDeletionRepository) ReleaseLease(userID string, instance string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if lease, found := repository.leases[userID]; found && lease.instance == instance {
+		delete(repository.leases, userID)
+	}
+	return nil
+}
+
+func (repository *inMemoryDeletionRepository) AppendAudit(build func(previousHash string) models.AuditEntry) (*models.AuditEntry, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	entry := build(repository.head)
+	repository.audit = append(repository.audit, &entry)
+	repository.head = entry.Hash
+	return &entry, nil
+}
+
+func (repository *inMemoryDeletionRepository) GetAuditHead() (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.head, nil
+}
+
+func (repository *inMemoryDeletionRepository) GetAudit() ([]*models.AuditEntry, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return slices.Clone(repository.audit), nil
+}
+
+func (repository *inMemoryDeletionRepository) GetPolicy(serverID string) (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	strategy, found := repository.policies[serverID]
+	if !found {
+		return "", ErrNotFound
+	}
+	return strategy, nil
+}
+
+func (repository *inMemoryDeletionRepository) SetPolicy(serverID string, strategy string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.policies[serverID] = strategy
+	return nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// DraftRepository keeps the last edit of every draft, writes and deletions
+// are ordered by their timestamp and not by when they arrive.
+type DraftRepository interface {
+	// SaveDraft keeps the draft for ttl unless a later edit or deletion is stored.
+	SaveDraft(draft models.Draft, ttl time.Duration) error
+	GetDraft(userID string, channelID string) (*models.Draft, error)
+	// GetDrafts returns every draft of a user ordered by channel.
+	GetDrafts(userID string) ([]*models.Draft, error)
+	// DeleteDraft removes the draft unless it was edited after at.
+	DeleteDraft(userID string, channelID string, at time.Time) error
+	// DeleteDrafts removes every draft of a user edited before at.
+	DeleteDrafts(userID string, at time.Time) error
+}
+
+type draftRepository struct { //_private
+	session *gocql.Session
+	cipher  ContentCipher
+}
+
+// NewDraftRepository keeps the content of drafts encrypted like that of messages.
+func NewDraftRepository(session *gocql.Session, cipher ContentCipher) DraftRepository {
+	return &draftRepository{session: session, cipher: cipher}
+}
+
+func (repository *draftRepository) SaveDraft(draft models.Draft, ttl time.Duration) error {
+	content, err := repository.cipher.Seal(models.Message{ID: draft.ChannelID, UserID: draft.UserID, Message: draft.Message})
+	if err != nil {
+		return translate(err)
+	}
+
+	// the edit time as write timestamp lets Cassandra keep the latest edit
+	var query string = "INSERT INTO drafts (UserID, ChannelID, Message, UpdatedAt) VALUES (?, ?, ?, ?) USING TTL ? AND TIMESTAMP ?"
+	return translate(repository.session.Query(query,
+		draft.UserID, draft.ChannelID, content, draft.UpdatedAt, int(ttl.Seconds()), draft.UpdatedAt.UnixMicro()).Exec())
+}
+
+func (repository *draftRepository) GetDraft(userID string, channelID string) (*models.Draft, error) {
+	var query string = "SELECT Message, UpdatedAt FROM drafts WHERE UserID = ? AND ChannelID = ?"
+
+	draft := models.Draft{UserID: userID, ChannelID: channelID}
+	if err := repository.session.Query(query, userID, channelID).Scan(&draft.Message, &draft.UpdatedAt); err != nil {
+		return nil, translate(err)
+	}
+
+	message := models.Message{ID: channelID, UserID: userID, Message: draft.Message}
+	if err := repository.cipher.Open(&message); err != nil {
+		return nil, translate(err)
+	}
+	draft.Message = message.Message
+	return &draft, nil
+}
+
+func (repository *draftRepository) GetDrafts(userID string) ([]*models.Draft, error) {
+	var drafts []*models.Draft
+	var query string = "SELECT ChannelID, Message, UpdatedAt FROM drafts WHERE UserID = ?"
+
+	iter := repository.session.Query(query, userID).Iter()
+	open := repository.cipher.Opener()
+	for {
+		draft := models.Draft{UserID: userID}
+		if !iter.Scan(&draft.ChannelID, &draft.Message, &draft.UpdatedAt) {
+			break
+		}
+		message := models.Message{ID: draft.ChannelID, UserID: userID, Message: draft.Message}
+		if err := open(&message); err != nil {
+			iter.Close()
+			return nil, translate(err)
+		}
+		draft.Message = message.Message
+		drafts = append(drafts, &draft)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return drafts, nil
+}
+
+func (repository *draftRepository) DeleteDraft(userID string, channelID string, at time.Time) error {
+	var query string = "DELETE FROM drafts USING TIMESTAMP ? WHERE UserID = ? AND ChannelID = ?"
+	return translate(repository.session.Query(query, at.UnixMicro(), userID, channelID).Exec())
+}
+
+func (repository *draftRepository) DeleteDrafts(userID string, at time.Time) error {
+	var query string = "DELETE FROM drafts USING TIMESTAMP ? WHERE UserID = ?"
+	return translate(repository.session.Query(query, at.UnixMicro(), userID).Exec())
+}
+
+// === Integration Test ===
+type inMemoryDraft struct {
+	draft   models.Draft
+	expires time.Time
+}
+
+type inMemoryDraftRepository struct {
+	mutex      sync.Mutex
+	drafts     map[string]inMemoryDraft // user ID/channel ID -> draft
+	tombstones map[string]time.Time     // user ID/channel ID or user ID -> latest deletion
+}
+
+func NewInMemoryDraftRepository() DraftRepository {
+	return &inMemoryDraftRepository{
+		drafts:     make(map[string]inMemoryDraft),
+		tombstones: make(map[string]time.Time)}
+}
+
+// deleted tells whether a deletion at the same time or later covers the draft.
+func (repository *inMemoryDraftRepository) deleted(draft models.Draft) bool {
+	for _, key := range []string{draft.UserID + "/" + draft.ChannelID, draft.UserID} {
+		if deletedAt, found := repository.tombstones[key]; found && !deletedAt.Before(draft.UpdatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (repository *inMemoryDraftRepository) SaveDraft(draft models.Draft, ttl time.Duration) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := draft.UserID + "/" + draft.ChannelID
+	if current, found := repository.drafts[key]; found && current.draft.UpdatedAt.After(draft.UpdatedAt) {
+		return nil
+	}
+	if repository.deleted(draft) {
+		return nil
+	}
+	repository.drafts[key] = inMemoryDraft{draft: draft, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (repository *inMemoryDraftRepository) GetDraft(userID string, channelID string) (*models.Draft, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, found := repository.drafts[userID+"/"+channelID]
+	if !found || !time.Now().Before(stored.expires) || repository.deleted(stored.draft) {
+		return nil, ErrNotFound
+	}
+	return &stored.draft, nil
+}
+
+func (repository *inMemoryDraftRepository) GetDrafts(userID string) ([]*models.Draft, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var drafts []*models.Draft
+	for _, stored := range repository.drafts {
+		if stored.draft.UserID == userID && time.Now().Before(stored.expires) && !repository.deleted(stored.draft) {
+			drafts = append(drafts, &stored.draft)
+		}
+	}
+	slices.SortFunc(drafts, func(a, b *models.Draft) int { return strings.Compare(a.ChannelID, b.ChannelID) })
+	return drafts, nil
+}
+
+func (repository *inMemoryDraftRepository) DeleteDraft(userID string, channelID string, at time.Time) error {
+	return repository.tombstone(userID+"/"+channelID, at)
+}
+
+func (repository *inMemoryDraftRepository) DeleteDrafts(userID string, at time.Time) error {
+	return repository.tombstone(userID, at)
+}
+
+func (repository *inMemoryDraftRepository) tombstone(key string, at time.Time) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if deletedAt, found := repository.tombstones[key]; !found || at.After(deletedAt) {
+		repository.tombstones[key] = at
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+// Every repository returns errors matching one of these with errors.Is so
+// callers never have to know about the storage driver.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrUnavailable     = errors.New("storage unavailable")
+)
+
+// translate maps gocql errors onto the sentinel errors above.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		marshalError   gocql.MarshalError
+		requestError   gocql.RequestError
+		alreadyExists  *gocql.RequestErrAlreadyExists
+		unavailable    *gocql.RequestErrUnavailable
+		writeTimeout   *gocql.RequestErrWriteTimeout
+		readTimeout    *gocql.RequestErrReadTimeout
+		invalidRequest = errors.As(err, &requestError) && requestError.Code() == gocql.ErrCodeInvalid
+	)
+
+	switch {
+	case errors.Is(err, gocql.ErrNotFound):
+		return ErrNotFound
+	case errors.As(err, &marshalError), invalidRequest:
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	case errors.As(err, &alreadyExists):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, gocql.ErrUnavailable),
+		errors.Is(err, gocql.ErrNoConnections),
+		errors.Is(err, gocql.ErrSessionClosed),
+		errors.Is(err, gocql.ErrTimeoutNoResponse),
+		errors.Is(err, gocql.ErrConnectionClosed),
+		errors.As(err, &unavailable),
+		errors.As(err, &writeTimeout),
+		errors.As(err, &readTimeout):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type ExportRepository interface {
+	// SaveExport stores the export for ttl, forever if it is zero.
+	SaveExport(export models.Export, ttl time.Duration) error
+	GetExport(id string) (*models.Export, error)
+	GetExportsByUser(userID string) ([]*models.Export, error)
+	GetRunningExports() ([]*models.Export, error)
+}
+
+type exportRepository struct { //_private
+	session *gocql.Session
+}
+
+const exportColumns = "ID, UserID, Status, Messages, CreatedAt, CompletedAt, Download, ExpiresAt, Error"
+
+func NewExportRepository(session *gocql.Session) ExportRepository {
+	return &exportRepository{session: session}
+}
+
+func (repository *exportRepository) SaveExport(export models.Export, ttl time.Duration) error {
+	var query string = "INSERT INTO exports (" + exportColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?"
+	var userQuery string = "INSERT INTO exports_by_user (UserID, ID) VALUES (?, ?) USING TTL ?"
+
+	seconds := int(ttl.Seconds())
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(query, export.ID, export.UserID, export.Status, export.Messages, export.CreatedAt,
+		export.CompletedAt, export.Download, export.ExpiresAt, export.Error, seconds)
+	batch.Query(userQuery, export.UserID, export.ID, seconds)
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func scanExport(scan func(...any) bool) (*models.Export, bool) {
+	var export models.Export
+	var completedAt, expiresAt time.Time
+	if !scan(&export.ID, &export.UserID, &export.Status, &export.Messages, &export.CreatedAt,
+		&completedAt, &export.Download, &expiresAt, &export.Error) {
+		return nil, false
+	}
+	if !completedAt.IsZero() {
+		export.CompletedAt = &completedAt
+	}
+	if !expiresAt.IsZero() {
+		export.ExpiresAt = &expiresAt
+	}
+	return &export, true
+}
+
+func (repository *exportRepository) GetExport(id string) (*models.Export, error) {
+	var query string = "SELECT " + exportColumns + " FROM exports WHERE ID = ?"
+
+	iter := repository.session.Query(query, id).Iter()
+	export, found := scanExport(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return export, nil
+}
+
+func (repository *exportRepository) GetExportsByUser(userID string) ([]*models.Export, error) {
+	var ids []string
+	var id string
+	iter := repository.session.Query("SELECT ID FROM exports_by_user WHERE UserID = ?", userID).Iter()
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return repository.scan(repository.session.Query("SELECT "+exportColumns+" FROM exports WHERE ID IN ?", ids).Iter())
+}
+
+// GetRunningExports filters the whole table, it only runs once on startup.
+func (repository *exportRepository) GetRunningExports() ([]*models.Export, error) {
+	var query string = "SELECT " + exportColumns + " FROM exports WHERE Status = ? ALLOW FILTERING"
+	return repository.scan(repository.session.Query(query, models.ExportRunning).Iter())
+}
+
+func (repository *exportRepository) scan(iter *gocql.Iter) ([]*models.Export, error) {
+	var exports []*models.Export
+	for {
+		export, found := scanExport(iter.Scan)
+		if !found {
+			break
+		}
+		exports = append(exports, export)
+	}
+	return exports, translate(iter.Close())
+}
+
+// === Integration Test ===
+type inMemoryExport struct {
+	export  models.Export
+	expires time.Time // zero if it is kept forever
+}
+
+type inMemoryExportRepository struct {
+	mutex   sync.Mutex
+	exports map[string]inMemoryExport
+}
+
+func NewInMemoryExportRepository() ExportRepository {
+	return &inMemoryExportRepository{
+		exports: make(map[string]inMemoryExport)}
+}
+
+func (repository *inMemoryExportRepository) SaveExport(export models.Export, ttl time.Duration) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored := inMemoryExport{export: export}
+	if ttl > 0 {
+		stored.expires = time.Now().Add(ttl)
+	}
+	repository.exports[export.ID] = stored
+	return nil
+}
+
+// list returns the live exports matching the filter, the caller holds the lock.
+func (repository *inMemoryExportRepository) list(matches func(models.Export) bool) []*models.Export {
+	var exports []*models.Export
+	for id, stored := range repository.exports {
+		if !stored.expires.IsZero() && !time.Now().Before(stored.expires) {
+			delete(repository.exports, id)
+			continue
+		}
+		if matches(stored.export) {
+			export := stored.export
+			exports = append(exports, &export)
+		}
+	}
+	return exports
+}
+
+func (repository *inMemoryExportRepository) GetExport(id string) (*models.Export, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	exports := repository.list(func(export models.Export) bool { return export.ID == id })
+	if len(exports) == 0 {
+		return nil, ErrNotFound
+	}
+	return exports[0], nil
+}
+
+func (repository *inMemoryExportRepository) GetExportsByUser(userID string) ([]*models.Export, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.list(func(export models.Export) bool { return export.UserID == userID }), nil
+}
+
+func (repository *inMemoryExportRepository) GetRunningExports() ([]*models.Export, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.list(func(export models.Export) bool { return export.Status == models.ExportRunning }), nil
+}
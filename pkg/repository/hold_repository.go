@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type HoldRepository interface {
+	SaveHold(hold models.LegalHold) error
+	GetHold(id string) (*models.LegalHold, error)
+	// GetHolds returns every hold, released ones included, oldest first.
+	GetHolds() ([]*models.LegalHold, error)
+
+	// SaveDeferral records a deletion deferred by a hold, once per kind and
+	// target. Saving it again with ProcessedAt set marks it as retried.
+	SaveDeferral(deferral models.Deferral) error
+	GetDeferrals(holdID string) ([]*models.Deferral, error)
+}
+
+type holdRepository struct { //_private
+	session *gocql.Session
+}
+
+const holdColumns = "ID, Scope, TargetID, Reason, PlacedBy, PlacedAt, ReleasedBy, ReleasedAt"
+
+func NewHoldRepository(session *gocql.Session) HoldRepository {
+	return &holdRepository{session: session}
+}
+
+func (repository *holdRepository) SaveHold(hold models.LegalHold) error {
+	var query string = "INSERT INTO legal_holds (" + holdColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		hold.ID, hold.Scope, hold.TargetID, hold.Reason, hold.PlacedBy, hold.PlacedAt,
+		hold.ReleasedBy, hold.ReleasedAt).Exec())
+}
+
+func scanHold(scan func(...any) bool) (*models.LegalHold, bool) {
+	var hold models.LegalHold
+	var releasedAt time.Time
+	if !scan(&hold.ID, &hold.Scope, &hold.TargetID, &hold.Reason, &hold.PlacedBy, &hold.PlacedAt,
+		&hold.ReleasedBy, &releasedAt) {
+		return nil, false
+	}
+	if !releasedAt.IsZero() {
+		hold.ReleasedAt = &releasedAt
+	}
+	return &hold, true
+}
+
+func (repository *holdRepository) GetHold(id string) (*models.LegalHold, error) {
+	var query string = "SELECT " + holdColumns + " FROM legal_holds WHERE ID = ?"
+
+	iter := repository.session.Query(query, id).Iter()
+	hold, found := scanHold(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return hold, nil
+}
+
+// GetHolds reads the whole table, there are only ever a few holds.
+func (repository *holdRepository) GetHolds() ([]*models.LegalHold, error) {
+	var holds []*models.LegalHold
+	var query string = "SELECT " + holdColumns + " FROM legal_holds"
+
+	iter := repository.session.Query(query).Iter()
+	for {
+		hold, found := scanHold(iter.Scan)
+		if !found {
+			break
+		}
+		holds = append(holds, hold)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	slices.SortFunc(holds, func(a, b *models.LegalHold) int { return timeuuid.Compare(a.ID, b.ID) })
+	return holds, nil
+}
+
+func (repository *holdRepository) SaveDeferral(deferral models.Deferral) error {
+	var query string = "INSERT INTO legal_hold_deferrals (HoldID, Kind, TargetID, Reason, At, ProcessedAt) VALUES (?, ?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		deferral.HoldID, deferral.Kind, deferral.TargetID, deferral.Reason, deferral.At, deferral.ProcessedAt).Exec())
+}
+
+func (repository *holdRepository) GetDeferrals(holdID string) ([]*models.Deferral, error) {
+	var deferrals []*models.Deferral
+	var query string = "SELECT HoldID, Kind, TargetID, Reason, At, ProcessedAt FROM legal_hold_deferrals WHERE HoldID = ?"
+
+	iter := repository.session.Query(query, holdID).Iter()
+	for {
+		var deferral models.Deferral
+		var processedAt time.Time
+		if !iter.Scan(&deferral.HoldID, &deferral.Kind, &deferral.TargetID, &deferral.Reason, &deferral.At, &processedAt) {
+			break
+		}
+		if !processedAt.IsZero() {
+			deferral.ProcessedAt = &processedAt
+		}
+		deferrals = append(deferrals, &deferral)
+	}
+	return deferrals, translate(iter.Close())
+}
+
+// === Integration Test ===
+type inMemoryHoldRepository struct {
+	mutex     sync.Mutex
+	holds     map[string]models.LegalHold
+	deferrals map[string]map[string]models.Deferral // hold ID -> kind/target ID -> deferral
+}
+
+func NewInMemoryHoldRepository() HoldRepository {
+	return &inMemoryHoldRepository{
+		holds:     make(map[string]models.LegalHold),
+		deferrals: make(map[string]map[string]models.Deferral)}
+}
+
+func (repository *inMemoryHoldRepository) SaveHold(hold models.LegalHold) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	hold.Deferrals = nil
+	repository.holds[hold.ID] = hold
+	return nil
+}
+
+func (repository *inMemoryHoldRepository) GetHold(id string) (*models.LegalHold, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	hold, found := repository.holds[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &hold, nil
+}
+
+func (repository *inMemoryHoldRepository) GetHolds() ([]*models.LegalHold, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var holds []*models.LegalHold
+	for _, hold := range repository.holds {
+		holds = append(holds, &hold)
+	}
+	slices.SortFunc(holds, func(a, b *models.LegalHold) int { return timeuuid.Compare(a.ID, b.ID) })
+	return holds, nil
+}
+
+func (repository *inMemoryHoldRepository) SaveDeferral(deferral models.Deferral) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if repository.deferrals[deferral.HoldID] == nil {
+		repository.deferrals[deferral.HoldID] = make(map[string]models.Deferral)
+	}
+	repository.deferrals[deferral.HoldID][deferral.Kind+"/"+deferral.TargetID] = deferral
+	return nil
+}
+
+func (repository *inMemoryHoldRepository) GetDeferrals(holdID string) ([]*models.Deferral, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var deferrals []*models.Deferral
+	for _, deferral := range repository.deferrals[holdID] {
+		deferrals = append(deferrals, &deferral)
+	}
+	slices.SortFunc(deferrals, func(a, b *models.Deferral) int {
+		if order := strings.Compare(a.Kind, b.Kind); order != 0 {
+			return order
+		}
+		return strings.Compare(a.TargetID, b.TargetID)
+	})
+	return deferrals, nil
+}
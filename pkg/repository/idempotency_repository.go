@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type IdempotencyRepository interface {
+	// Claim stores key for messageID unless the key is already taken, in which
+	// case the message ID it was first claimed for is returned.
+	Claim(key string, messageID string, ttl time.Duration) (existingID string, claimed bool, err error)
+	// Confirm keeps the claim of key for messageID for ttl, once its message is
+	// saved. It does nothing when the claim expired in the meantime.
+	Confirm(key string, messageID string, ttl time.Duration) error
+	// Release gives up the claim of key for messageID, a claim another
+	// request took after it expired is kept.
+	Release(key string, messageID string) error
+}
+
+type idempotencyRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewIdempotencyRepository(session *gocql.Session) IdempotencyRepository {
+	return &idempotencyRepository{session: session}
+}
+
+func (repository *idempotencyRepository) Claim(key string, messageID string, ttl time.Duration) (string, bool, error) {
+	var query string = "INSERT INTO message_idempotency (IdempotencyKey, MessageID) VALUES (?, ?) IF NOT EXISTS USING TTL ?"
+
+	uuid, err := gocql.ParseUUID(messageID)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(query, key, uuid, int(ttl.Seconds())).MapScanCAS(previous)
+	if err != nil {
+		return "", false, translate(err)
+	}
+	if applied {
+		return messageID, true, nil
+	}
+
+	existing, _ := previous["messageid"].(gocql.UUID)
+	return existing.String(), false, nil
+}
+
+func (repository *idempotencyRepository) Confirm(key string, messageID string, ttl time.Duration) error {
+	var query string = "UPDATE message_idempotency USING TTL ? SET MessageID = ? WHERE IdempotencyKey = ? IF MessageID = ?"
+
+	uuid, err := gocql.ParseUUID(messageID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+
+	previous := make(map[string]interface{})
+	_, err = repository.session.Query(query, int(ttl.Seconds()), uuid, key, uuid).MapScanCAS(previous)
+	return translate(err)
+}
+
+func (repository *idempotencyRepository) Release(key string, messageID string) error {
+	var query string = "DELETE FROM message_idempotency WHERE IdempotencyKey = ? IF MessageID = ?"
+
+	uuid, err := gocql.ParseUUID(messageID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+
+	previous := make(map[string]interface{})
+	_, err = repository.session.Query(query, key, uuid).MapScanCAS(previous)
+	return translate(err)
+}
+
+// === Integration Test ===
+type idempotencyClaim struct {
+	messageID string
+	expires   time.Time
+}
+
+type inMemoryIdempotencyRepository struct {
+	mutex  sync.Mutex
+	claims map[string]idempotencyClaim
+}
+
+func NewInMemoryIdempotencyRepository() IdempotencyRepository {
+	return &inMemoryIdempotencyRepository{
+		claims: make(map[string]idempotencyClaim)}
+}
+
+func (repository *inMemoryIdempotencyRepository) Claim(key string, messageID string, ttl time.Duration) (string, bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if claim, exists := repository.claims[key]; exists && time.Now().Before(claim.expires) {
+		return claim.messageID, false, nil
+	}
+
+	repository.claims[key] = idempotencyClaim{messageID: messageID, expires: time.Now().Add(ttl)}
+	return messageID, true, nil
+}
+
+func (repository *inMemoryIdempotencyRepository) Confirm(key string, messageID string, ttl time.Duration) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if claim, exists := repository.claims[key]; exists && claim.messageID == messageID && time.Now().Before(claim.expires) {
+		repository.claims[key] = idempotencyClaim{messageID: messageID, expires: time.Now().Add(ttl)}
+	}
+	return nil
+}
+
+func (repository *inMemoryIdempotencyRepository) Release(key string, messageID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if claim, exists := repository.claims[key]; exists && claim.messageID == messageID {
+		delete(repository.claims, key)
+	}
+	return nil
+}
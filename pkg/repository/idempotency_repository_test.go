@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimReturnsTheFirstMessage(t *testing.T) {
+	repository := NewInMemoryIdempotencyRepository()
+	first, second := gocql.TimeUUID().String(), gocql.TimeUUID().String()
+
+	existingID, claimed, err := repository.Claim("key", first, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, first, existingID)
+
+	// a retry replays the first message
+	existingID, claimed, err = repository.Claim("key", second, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, first, existingID)
+
+	_, claimed, _ = repository.Claim("other key", second, time.Minute)
+	assert.True(t, claimed)
+}
+
+func TestConfirmKeepsTheClaim(t *testing.T) {
+	repository := NewInMemoryIdempotencyRepository()
+	first, second := gocql.TimeUUID().String(), gocql.TimeUUID().String()
+
+	repository.Claim("key", first, time.Millisecond)
+	assert.NoError(t, repository.Confirm("key", first, time.Hour))
+	time.Sleep(2 * time.Millisecond)
+
+	existingID, claimed, _ := repository.Claim("key", second, time.Minute)
+	assert.False(t, claimed)
+	assert.Equal(t, first, existingID)
+}
+
+func TestConfirmIgnoresTheClaimOfAnotherMessage(t *testing.T) {
+	repository := NewInMemoryIdempotencyRepository()
+	first, second := gocql.TimeUUID().String(), gocql.TimeUUID().String()
+
+	repository.Claim("key", first, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	repository.Claim("key", second, time.Millisecond)
+
+	assert.NoError(t, repository.Confirm("key", first, time.Hour))
+	time.Sleep(2 * time.Millisecond)
+	_, claimed, _ := repository.Claim("key", first, time.Minute)
+	assert.True(t, claimed, "the late confirm did not extend the claim of the second message")
+}
+
+func TestReleaseOnlyGivesUpItsOwnClaim(t *testing.T) {
+	repository := NewInMemoryIdempotencyRepository()
+	first, second, third := gocql.TimeUUID().String(), gocql.TimeUUID().String(), gocql.TimeUUID().String()
+
+	repository.Claim("key", first, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	// the claim of the first request expired and another request took the key
+	_, claimed, _ := repository.Claim("key", second, time.Minute)
+	assert.True(t, claimed)
+
+	assert.NoError(t, repository.Release("key", first))
+	existingID, claimed, _ := repository.Claim("key", third, time.Minute)
+	assert.False(t, claimed)
+	assert.Equal(t, second, existingID)
+
+	assert.NoError(t, repository.Release("key", second))
+	_, claimed, _ = repository.Claim("key", third, time.Minute)
+	assert.True(t, claimed)
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrShredded is returned by CreateKey for a user whose key was deleted. They
+// never get a new one, content sealed under the old key stays unreadable.
+var ErrShredded = fmt.Errorf("%w: the key of the user was shredded", ErrConflict)
+
+// KeyRepository stores the data key of every user, wrapped by the master key.
+type KeyRepository interface {
+	// GetKey returns ErrNotFound for users without a key and for shredded keys.
+	GetKey(userID string) ([]byte, error)
+	// CreateKey stores a key unless the user already has one, the stored key is returned.
+	CreateKey(userID string, wrapped []byte) ([]byte, error)
+	// DeleteKey shreds the key, it leaves a tombstone so no key is created again.
+	DeleteKey(userID string) error
+}
+
+type keyRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewKeyRepository(session *gocql.Session) KeyRepository {
+	return &keyRepository{session: session}
+}
+
+func (repository *keyRepository) GetKey(userID string) ([]byte, error) {
+	var wrapped []byte
+	var query string = "SELECT WrappedKey FROM user_keys WHERE UserID = ?"
+
+	if err := repository.session.Query(query, userID).Scan(&wrapped); err != nil {
+		return nil, translate(err)
+	}
+	if len(wrapped) == 0 {
+		return nil, ErrNotFound // shredded
+	}
+	return wrapped, nil
+}
+
+func (repository *keyRepository) CreateKey(userID string, wrapped []byte) ([]byte, error) {
+	var query string = "INSERT INTO user_keys (UserID, WrappedKey, CreatedAt) VALUES (?, ?, ?) IF NOT EXISTS"
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(query, userID, wrapped, time.Now().UTC()).MapScanCAS(previous)
+	if err != nil {
+		return nil, translate(err)
+	}
+	if applied {
+		return wrapped, nil
+	}
+
+	existing, _ := previous["wrappedkey"].([]byte)
+	if len(existing) == 0 {
+		return nil, ErrShredded
+	}
+	return existing, nil
+}
+
+func (repository *keyRepository) DeleteKey(userID string) error {
+	var query string = "UPDATE user_keys SET WrappedKey = null, ShreddedAt = ? WHERE UserID = ?"
+	return translate(repository.session.Query(query, time.Now().UTC(), userID).Exec())
+}
+
+// === Integration Test ===
+type inMemoryKeyRepository struct {
+	mutex sync.Mutex
+	keys  map[string][]byte // nil once shredded
+}
+
+func NewInMemoryKeyRepository() KeyRepository {
+	return &inMemoryKeyRepository{
+		keys: make(map[string][]byte)}
+}
+
+func (repository *inMemoryKeyRepository) GetKey(userID string) ([]byte, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	wrapped, found := repository.keys[userID]
+	if !found || wrapped == nil {
+		return nil, ErrNotFound
+	}
+	return wrapped, nil
+}
+
+func (repository *inMemoryKeyRepository) CreateKey(userID string, wrapped []byte) ([]byte, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if existing, found := repository.keys[userID]; found {
+		if existing == nil {
+			return nil, ErrShredded
+		}
+		return existing, nil
+	}
+	repository.keys[userID] = wrapped
+	return wrapped, nil
+}
+
+func (repository *inMemoryKeyRepository) DeleteKey(userID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.keys[userID] = nil
+	return nil
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"slices"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+type MentionRepository interface {
+	SaveMentions(mentions []models.Mention) error
+	DeleteMentions(userIDs []string, messageID string) error
+	// GetMentions returns a page of the mentions of a user, newest first.
+	GetMentions(userID string, page models.Page) ([]*models.Mention, error)
+	// DeleteInbox removes every mention of a user.
+	DeleteInbox(userID string) error
+}
+
+type mentionRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewMentionRepository(session *gocql.Session) MentionRepository {
+	return &mentionRepository{session: session}
+}
+
+func (repository *mentionRepository) SaveMentions(mentions []models.Mention) error {
+	var query string = "INSERT INTO mentions_by_user (UserID, MessageID, ServerID, ChannelID, AuthorID) VALUES (?, ?, ?, ?, ?)"
+
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	for _, mention := range mentions {
+		batch.Query(query, mention.UserID, mention.MessageID, mention.ServerID, mention.ChannelID, mention.AuthorID)
+	}
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func (repository *mentionRepository) DeleteMentions(userIDs []string, messageID string) error {
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	for _, userID := range userIDs {
+		batch.Query("DELETE FROM mentions_by_user WHERE UserID = ? AND MessageID = ?", userID, messageID)
+	}
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func (repository *mentionRepository) GetMentions(userID string, page models.Page) ([]*models.Mention, error) {
+	var mentions []*models.Mention
+	var query string = "SELECT MessageID, ServerID, ChannelID, AuthorID FROM mentions_by_user WHERE UserID = ?"
+	values := []any{userID}
+
+	if page.After != "" {
+		query += " AND MessageID > ?"
+		values = append(values, page.After)
+	}
+	if page.Before != "" {
+		query += " AND MessageID < ?"
+		values = append(values, page.Before)
+	}
+	if page.After != "" { // the page right after the cursor, not the newest one
+		query += " ORDER BY MessageID ASC"
+	}
+	query += " LIMIT ?"
+	values = append(values, pageSize(page))
+
+	iter := repository.session.Query(query, values...).Iter()
+	for {
+		var id gocql.UUID
+		mention := models.Mention{UserID: userID}
+		if !iter.Scan(&id, &mention.ServerID, &mention.ChannelID, &mention.AuthorID) {
+			break
+		}
+		mention.MessageID = id.String()
+		mentions = append(mentions, &mention)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	if page.After != "" {
+		slices.Reverse(mentions)
+	}
+	return mentions, nil
+}
+
+func (repository *mentionRepository) DeleteInbox(userID string) error {
+	return translate(repository.session.Query("DELETE FROM mentions_by_user WHERE UserID = ?", userID).Exec())
+}
+
+// === Integration Test ===
+type inMemoryMentionRepository struct {
+	mutex    sync.Mutex
+	mentions map[string][]models.Mention // user ID -> mentions
+}
+
+func NewInMemoryMentionRepository() MentionRepository {
+	return &inMemoryMentionRepository{
+		mentions: make(map[string][]models.Mention)}
+}
+
+func (repository *inMemoryMentionRepository) SaveMentions(mentions []models.Mention) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, mention := range mentions {
+		stored := slices.DeleteFunc(repository.mentions[mention.UserID], func(stored models.Mention) bool {
+			return stored.MessageID == mention.MessageID
+		})
+		repository.mentions[mention.UserID] = append(stored, mention)
+	}
+	return nil
+}
+
+func (repository *inMemoryMentionRepository) DeleteMentions(userIDs []string, messageID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, userID := range userIDs {
+		repository.mentions[userID] = slices.DeleteFunc(repository.mentions[userID], func(mention models.Mention) bool {
+			return mention.MessageID == messageID
+		})
+	}
+	return nil
+}
+
+func (repository *inMemoryMentionRepository) GetMentions(userID string, page models.Page) ([]*models.Mention, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var mentions []*models.Mention
+	for _, mention := range repository.mentions[userID] {
+		if page.After != "" && timeuuid.Compare(mention.MessageID, page.After) <= 0 {
+			continue
+		}
+		if page.Before != "" && timeuuid.Compare(mention.MessageID, page.Before) >= 0 {
+			continue
+		}
+		mentions = append(mentions, &mention)
+	}
+	slices.SortFunc(mentions, func(a, b *models.Mention) int { return timeuuid.Compare(b.MessageID, a.MessageID) })
+
+	size := pageSize(page)
+	if len(mentions) > size {
+		if page.After != "" {
+			mentions = mentions[len(mentions)-size:]
+		} else {
+			mentions = mentions[:size]
+		}
+	}
+	return mentions, nil
+}
+
+func (repository *inMemoryMentionRepository) DeleteInbox(userID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.mentions, userID)
+	return nil
+}
@@ -2,6 +2,12 @@ package repository
 
 import (
 	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/gocql/gocql"
 )
@@ -10,83 +16,520 @@ type MessageRepository interface {
 	Save(message models.Message) (*models.Message, error)
 	GetById(id string) (*models.Message, error)
 	GetAllByUserId(userID string) ([]*models.Message, error)
-	DeleteAllByUserId(userID string) error
+	GetAllByChannelId(channelID string, page models.Page) ([]*models.Message, error)
+	// Update overwrites the author, content, mentions, poll, embed and markdown of a stored message.
+	Update(message models.Message) error
+	Delete(message models.Message) error
+	ForEach(fn func(*models.Message) error) error
+	// GetChannelsByServer returns every channel the server ever had a message
+	// in, channels emptied since are included.
+	GetChannelsByServer(serverID string) ([]string, error)
+	// GetAllWithoutChannel returns a page of the messages of a server that
+	// belong to no channel, ordered like GetAllByChannelId.
+	GetAllWithoutChannel(serverID string, page models.Page) ([]*models.Message, error)
+	// IndexServers adds the messages stored before the server lookups
+	// existed to them.
+	IndexServers() error
+	// ForEachByUserId calls fn with every message of a user, reading them page by page.
+	ForEachByUserId(userID string, fn func(*models.Message) error) error
+	// CountUnread counts up to limit messages of the channel after the given
+	// message ID that were written by others, without reading their content.
+	CountUnread(channelID string, after string, userID string, limit int) (models.Unread, error)
+}
+
+const (
+	defaultPageSize = 50
+	maximumPageSize = 100
+)
+
+func pageSize(page models.Page) int {
+	if page.Limit <= 0 {
+		return defaultPageSize
+	}
+	if page.Limit > maximumPageSize {
+		return maximumPageSize
+	}
+	return page.Limit
+}
+
+// ContentCipher encrypts the content of messages at rest, see encryption.Keyring.
+type ContentCipher interface {
+	Seal(message models.Message) (string, error)
+	// Open decrypts the content of the messages in place.
+	Open(messages ...*models.Message) error
+	// Opener returns an Open that keeps the keys it looked up across its calls.
+	Opener() func(messages ...*models.Message) error
 }
 
 type messageRepository struct { //_private
 	session *gocql.Session
+	cipher  ContentCipher
+}
+
+const messageColumns = "ID, UserID, ServerID, ChannelID, Message, " +
+	"MentionedUsers, MentionedRoles, MentionedChannels, MentionsEveryone, " +
+	"Kind, PollOptions, PollMultipleChoice, PollExpiresAt, System, Embed, Markdown"
+
+// messageRow is a message as it is stored, the poll is kept in columns of
+// its own and the announcement of a system message in a map. The embed and
+// the markdown are JSON, encrypted like the content since they repeat it.
+type messageRow struct {
+	message        models.Message
+	pollOptions    []string
+	multipleChoice bool
+	pollExpiresAt  time.Time
+	system         map[string]string
+	embed          string
+	markdown       string
+}
+
+func (row *messageRow) fields() []any {
+	message := &row.message
+	return []any{&message.ID, &message.UserID, &message.ServerID, &message.ChannelID, &message.Message,
+		&message.Mentions.Users, &message.Mentions.Roles, &message.Mentions.Channels, &message.Mentions.Everyone,
+		&message.Kind, &row.pollOptions, &row.multipleChoice, &row.pollExpiresAt, &row.system,
+		&row.embed, &row.markdown}
+}
+
+func (row *messageRow) decode() *models.Message {
+	message := row.message
+	if len(row.pollOptions) > 0 {
+		message.Poll = &models.Poll{MultipleChoice: row.multipleChoice, ExpiresAt: row.pollExpiresAt}
+		for _, option := range row.pollOptions {
+			message.Poll.Options = append(message.Poll.Options, models.PollOption{Text: option})
+		}
+	}
+	if len(row.system) > 0 {
+		message.System = &models.System{
+			Type:         row.system["type"],
+			UserID:       row.system["user_id"],
+			ActorID:      row.system["actor_id"],
+			Name:         row.system["name"],
+			PreviousName: row.system["previous_name"],
+		}
+	}
+	return &message
+}
+
+// systemValue returns the system column of a message, empty unless it is a system message.
+func systemValue(message models.Message) map[string]string {
+	if message.System == nil {
+		return nil
+	}
+	return map[string]string{
+		"type":          message.System.Type,
+		"user_id":       message.System.UserID,
+		"actor_id":      message.System.ActorID,
+		"name":          message.System.Name,
+		"previous_name": message.System.PreviousName,
+	}
+}
+
+const (
+	// the embed and markdown are sealed under IDs of their own, so they cannot be swapped
+	embedSuffix    = "/embed"
+	markdownSuffix = "/markdown"
+)
+
+// sealedValues returns the embed and markdown columns of a message, empty
+// unless it has them.
+func (repository *messageRepository) sealedValues(message models.Message) ([]any, error) {
+	embed, markdown := "", ""
+	var err error
+	if message.Embed != nil {
+		if embed, err = repository.seal(message, embedSuffix, message.Embed); err != nil {
+			return nil, err
+		}
+	}
+	if len(message.Markdown) > 0 {
+		if markdown, err = repository.seal(message, markdownSuffix, message.Markdown); err != nil {
+			return nil, err
+		}
+	}
+	return []any{embed, markdown}, nil
+}
+
+func (repository *messageRepository) seal(message models.Message, suffix string, value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return repository.cipher.Seal(models.Message{ID: message.ID + suffix, UserID: message.UserID, Message: string(encoded)})
+}
+
+// open decodes the rows and decrypts their content, embed and markdown. An
+// embed or markdown whose key was shredded is dropped like the content.
+func (repository *messageRepository) open(rows ...*messageRow) ([]*models.Message, error) {
+	return openWith(repository.cipher.Open, rows...)
+}
+
+// openWith opens the rows with open, iterations pass one from Opener so the
+// key of an author is read once instead of for every row.
+func openWith(open func(messages ...*models.Message) error, rows ...*messageRow) ([]*models.Message, error) {
+	messages := make([]*models.Message, 0, len(rows))
+	var sealed []*models.Message
+	for _, row := range rows {
+		message := row.decode()
+		messages = append(messages, message)
+		sealed = append(sealed, message,
+			&models.Message{ID: message.ID + embedSuffix, UserID: message.UserID, Message: row.embed},
+			&models.Message{ID: message.ID + markdownSuffix, UserID: message.UserID, Message: row.markdown})
+	}
+	if err := open(sealed...); err != nil {
+		return nil, err
+	}
+
+	for i, message := range messages {
+		embed, markdown := sealed[3*i+1].Message, sealed[3*i+2].Message
+		if embed != "" {
+			if err := json.Unmarshal([]byte(embed), &message.Embed); err != nil {
+				return nil, fmt.Errorf("embed of message %v: %w", message.ID, err)
+			}
+		}
+		if markdown != "" {
+			if err := json.Unmarshal([]byte(markdown), &message.Markdown); err != nil {
+				return nil, fmt.Errorf("markdown of message %v: %w", message.ID, err)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// pollValues returns the poll columns of a message, empty unless it is a poll.
+func pollValues(message models.Message) []any {
+	if message.Poll == nil {
+		return []any{nil, false, nil}
+	}
+	options := make([]string, 0, len(message.Poll.Options))
+	for _, option := range message.Poll.Options {
+		options = append(options, option.Text)
+	}
+	return []any{options, message.Poll.MultipleChoice, message.Poll.ExpiresAt}
+}
+
+// serverIndex returns the statement that makes a message findable by its
+// server: its channel, or the message itself if it has none.
+func serverIndex(serverID string, channelID string, id any) (string, any, any) {
+	if channelID != "" {
+		return "INSERT INTO server_channels (ServerID, ChannelID) VALUES (?, ?)", serverID, channelID
+	}
+	return "INSERT INTO messages_without_channel (ServerID, ID) VALUES (?, ?)", serverID, id
 }
 
-func NewMessageRepository(session *gocql.Session) MessageRepository {
-	return &messageRepository{session: session}
+func NewMessageRepository(session *gocql.Session, cipher ContentCipher) MessageRepository {
+	return &messageRepository{session: session, cipher: cipher}
 }
 
 func (repository *messageRepository) Save(message models.Message) (*models.Message, error) {
-	var query string = "INSERT INTO messages (ID, UserID, ServerID, Message) VALUES (?, ?, ?, ?)"
+	var query string = "INSERT INTO messages (" + messageColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	var channelQuery string = "INSERT INTO messages_by_channel (" + messageColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
-	uuid := gocql.TimeUUID() // ignore provided ID if provided
+	uuid := gocql.TimeUUID()
+	if message.ID != "" { // pre-allocated by the caller, e.g. for idempotent creation
+		parsed, err := gocql.ParseUUID(message.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+		}
+		uuid = parsed
+	}
 	message.ID = uuid.String()
 
-	if err := repository.session.Query(
-		query, uuid, message.UserID, message.ServerID, message.Message).Exec(); err != nil {
-		return nil, err
+	content, err := repository.cipher.Seal(message)
+	if err != nil {
+		return nil, translate(err)
+	}
+	sealed, err := repository.sealedValues(message)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	mentions := message.Mentions
+	values := append([]any{uuid, message.UserID, message.ServerID, message.ChannelID, content,
+		mentions.Users, mentions.Roles, mentions.Channels, mentions.Everyone, message.Kind}, pollValues(message)...)
+	values = append(append(values, systemValue(message)), sealed...)
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(query, values...)
+	if message.ChannelID != "" {
+		batch.Query(channelQuery, values...)
+	}
+	batch.Query(serverIndex(message.ServerID, message.ChannelID, uuid))
+	if err := repository.session.ExecuteBatch(batch); err != nil {
+		return nil, translate(err)
 	}
 
 	return &message, nil
 }
 
 func (repository *messageRepository) GetById(id string) (*models.Message, error) {
-	var message models.Message
-	var query string = "SELECT ID, UserID, ServerID, Message FROM messages WHERE ID = ?"
+	var row messageRow
+	var query string = "SELECT " + messageColumns + " FROM messages WHERE ID = ?"
 
-	if err := repository.session.Query(query, id).Scan(
-		&message.ID, &message.UserID, &message.ServerID, &message.Message); err != nil {
-		return nil, err
+	if err := repository.session.Query(query, id).Scan(row.fields()...); err != nil {
+		return nil, translate(err)
 	}
 
-	return &message, nil
+	messages, err := repository.open(&row)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return messages[0], nil
 }
 
 func (repository *messageRepository) GetAllByUserId(userID string) ([]*models.Message, error) {
-	var messages []*models.Message
-	var query string = "SELECT * FROM messages WHERE UserID = ? ALLOW FILTERING"
+	var rows []*messageRow
+	var query string = "SELECT " + messageColumns + " FROM messages WHERE UserID = ? ALLOW FILTERING"
 
 	iter := repository.session.Query(query, userID).Iter()
 	for {
-		var message models.Message
-		if !iter.Scan(&message.ID, &message.UserID, &message.ServerID, &message.Message) {
+		var row messageRow
+		if !iter.Scan(row.fields()...) {
 			break
 		}
-		messages = append(messages, &message)
+		rows = append(rows, &row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
 	}
 
-	return messages, nil
+	messages, err := repository.open(rows...)
+	return messages, translate(err)
 }
 
-func (repository *messageRepository) DeleteAllByUserId(userID string) error {
-	var ids []string
-	var query string = "SELECT ID FROM messages WHERE UserID = ? ALLOW FILTERING"
-	iter := repository.session.Query(query, userID).Iter()
+// GetAllByChannelId returns a page of the channel history oldest first. Without
+// an After cursor it is the newest page before the Before cursor.
+func (repository *messageRepository) GetAllByChannelId(channelID string, page models.Page) ([]*models.Message, error) {
+	var rows []*messageRow
+	var query string = "SELECT " + messageColumns + " FROM messages_by_channel WHERE ChannelID = ?"
+	values := []any{channelID}
+
+	if page.After != "" {
+		query += " AND ID > ?"
+		values = append(values, page.After)
+	}
+	if page.Before != "" {
+		query += " AND ID < ?"
+		values = append(values, page.Before)
+	}
+	if page.After != "" {
+		query += " ORDER BY ID ASC"
+	}
+	query += " LIMIT ?"
+	values = append(values, pageSize(page))
+
+	iter := repository.session.Query(query, values...).Iter()
 	for {
-		var id string
-		if !iter.Scan(&id) {
+		var row messageRow
+		if !iter.Scan(row.fields()...) {
 			break
 		}
-		ids = append(ids, id)
+		rows = append(rows, &row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	if page.After == "" { // the table is clustered newest first
+		slices.Reverse(rows)
+	}
+	messages, err := repository.open(rows...)
+	return messages, translate(err)
+}
+
+func (repository *messageRepository) Update(message models.Message) error {
+	content, err := repository.cipher.Seal(message)
+	if err != nil {
+		return translate(err)
+	}
+	sealed, err := repository.sealedValues(message)
+	if err != nil {
+		return translate(err)
+	}
+
+	var update string = "SET UserID = ?, Message = ?, " +
+		"MentionedUsers = ?, MentionedRoles = ?, MentionedChannels = ?, MentionsEveryone = ?, " +
+		"PollOptions = ?, PollMultipleChoice = ?, PollExpiresAt = ?, Embed = ?, Markdown = ?"
+	mentions := message.Mentions
+	values := append([]any{message.UserID, content,
+		mentions.Users, mentions.Roles, mentions.Channels, mentions.Everyone}, pollValues(message)...)
+	values = slices.Clip(append(values, sealed...))
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query("UPDATE messages "+update+" WHERE ID = ?", append(values, message.ID)...)
+	if message.ChannelID != "" {
+		batch.Query("UPDATE messages_by_channel "+update+" WHERE ChannelID = ? AND ID = ?",
+			append(values, message.ChannelID, message.ID)...)
+	}
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+// Delete removes a message from every table it is stored in.
+func (repository *messageRepository) Delete(message models.Message) error {
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query("DELETE FROM messages WHERE ID = ?", message.ID)
+	if message.ChannelID != "" {
+		batch.Query("DELETE FROM messages_by_channel WHERE ChannelID = ? AND ID = ?", message.ChannelID, message.ID)
+	} else {
+		batch.Query("DELETE FROM messages_without_channel WHERE ServerID = ? AND ID = ?", message.ServerID, message.ID)
+	}
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+// ForEach calls fn with every stored message until it returns an error.
+func (repository *messageRepository) ForEach(fn func(*models.Message) error) error {
+	var query string = "SELECT " + messageColumns + " FROM messages"
+	iter := repository.session.Query(query).PageSize(1000).Iter()
+	open := repository.cipher.Opener()
+	for {
+		var row messageRow
+		if !iter.Scan(row.fields()...) {
+			break
+		}
+		messages, err := openWith(open, &row)
+		if err != nil {
+			iter.Close()
+			return translate(err)
+		}
+		if err := fn(messages[0]); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return translate(iter.Close())
+}
+
+func (repository *messageRepository) GetChannelsByServer(serverID string) ([]string, error) {
+	var channels []string
+	var query string = "SELECT ChannelID FROM server_channels WHERE ServerID = ?"
+
+	iter := repository.session.Query(query, serverID).PageSize(1000).Iter()
+	var channelID string
+	for iter.Scan(&channelID) {
+		channels = append(channels, channelID)
 	}
+	return channels, translate(iter.Close())
+}
+
+// GetAllWithoutChannel reads the IDs of a page from the index and then every
+// message of it.
+func (repository *messageRepository) GetAllWithoutChannel(serverID string, page models.Page) ([]*models.Message, error) {
+	var query string = "SELECT ID FROM messages_without_channel WHERE ServerID = ?"
+	values := []any{serverID}
 
-	query = "DELETE FROM messages WHERE ID = ?"
+	if page.After != "" {
+		query += " AND ID > ?"
+		values = append(values, page.After)
+	}
+	if page.Before != "" {
+		query += " AND ID < ?"
+		values = append(values, page.Before)
+	}
+	if page.After != "" {
+		query += " ORDER BY ID ASC"
+	}
+	query += " LIMIT ?"
+	values = append(values, pageSize(page))
+
+	var ids []string
+	iter := repository.session.Query(query, values...).Iter()
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id.String())
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if page.After == "" { // the table is clustered newest first
+		slices.Reverse(ids)
+	}
+
+	rows := make([]*messageRow, 0, len(ids))
 	for _, id := range ids {
-		if err := repository.session.Query(query, id).Exec(); err != nil {
+		var row messageRow
+		err := repository.session.Query("SELECT "+messageColumns+" FROM messages WHERE ID = ?", id).Scan(row.fields()...)
+		if err == gocql.ErrNotFound { // deleted since
+			continue
+		}
+		if err != nil {
+			return nil, translate(err)
+		}
+		rows = append(rows, &row)
+	}
+	messages, err := openWith(repository.cipher.Opener(), rows...)
+	return messages, translate(err)
+}
+
+// IndexServers scans the messages once without reading their content. It is
+// safe to repeat, every write only adds what is already there.
+func (repository *messageRepository) IndexServers() error {
+	var query string = "SELECT ID, ServerID, ChannelID FROM messages"
+
+	iter := repository.session.Query(query).PageSize(1000).Iter()
+	var id gocql.UUID
+	var serverID, channelID string
+	for iter.Scan(&id, &serverID, &channelID) {
+		if err := repository.session.Query(serverIndex(serverID, channelID, id)).Exec(); err != nil {
+			iter.Close()
+			return translate(err)
+		}
+	}
+	return translate(iter.Close())
+}
+
+func (repository *messageRepository) ForEachByUserId(userID string, fn func(*models.Message) error) error {
+	var query string = "SELECT " + messageColumns + " FROM messages WHERE UserID = ? ALLOW FILTERING"
+	iter := repository.session.Query(query, userID).PageSize(1000).Iter()
+	open := repository.cipher.Opener()
+	for {
+		var row messageRow
+		if !iter.Scan(row.fields()...) {
+			break
+		}
+		messages, err := openWith(open, &row)
+		if err != nil {
+			iter.Close()
+			return translate(err)
+		}
+		if err := fn(messages[0]); err != nil {
+			iter.Close()
 			return err
 		}
 	}
+	return translate(iter.Close())
+}
 
-	return nil
+func (repository *messageRepository) CountUnread(channelID string, after string, userID string, limit int) (models.Unread, error) {
+	unread := models.Unread{ChannelID: channelID, LastReadID: after}
+	var query string = "SELECT UserID, MentionedUsers, MentionsEveryone FROM messages_by_channel " +
+		"WHERE ChannelID = ? AND ID > ? ORDER BY ID ASC"
+
+	// stops right after the limit, own messages only cost the rows they take
+	iter := repository.session.Query(query, channelID, after).PageSize(limit + 1).Iter()
+	var author string
+	var mentioned []string
+	var everyone bool
+	for !unread.More && iter.Scan(&author, &mentioned, &everyone) {
+		count(&unread, userID, limit, author, mentioned, everyone)
+	}
+	return unread, translate(iter.Close())
+}
+
+// count adds a message to the unread counts unless the user wrote it.
+func count(unread *models.Unread, userID string, limit int, author string, mentioned []string, everyone bool) {
+	if author == userID {
+		return
+	}
+	if unread.Unread == limit {
+		unread.More = true
+		return
+	}
+	unread.Unread++
+	if everyone || slices.Contains(mentioned, userID) {
+		unread.Mentions++
+	}
 }
 
 // === Integration Test ===
 type inMemoryMessageRepository struct {
+	mutex    sync.RWMutex
 	messages []*models.Message
 }
 
@@ -96,20 +539,32 @@ func NewInMemoryMessageRepository() MessageRepository {
 }
 
 func (repository *inMemoryMessageRepository) Save(message models.Message) (*models.Message, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if message.ID == "" {
+		message.ID = gocql.TimeUUID().String()
+	}
 	repository.messages = append(repository.messages, &message)
 	return &message, nil
 }
 
 func (repository *inMemoryMessageRepository) GetById(id string) (*models.Message, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
 	for _, message := range repository.messages {
 		if message.ID == id {
 			return message, nil
 		}
 	}
-	return nil, nil
+	return nil, ErrNotFound
 }
 
 func (repository *inMemoryMessageRepository) GetAllByUserId(userID string) ([]*models.Message, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
 	var messages []*models.Message
 	for _, message := range repository.messages {
 		if message.UserID == userID {
@@ -119,13 +574,155 @@ func (repository *inMemoryMessageRepository) GetAllByUserId(userID string) ([]*m
 	return messages, nil
 }
 
-func (repository *inMemoryMessageRepository) DeleteAllByUserId(userID string) error {
+func (repository *inMemoryMessageRepository) GetAllByChannelId(channelID string, page models.Page) ([]*models.Message, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	var messages []*models.Message
+	for _, message := range repository.messages {
+		if message.ChannelID != channelID {
+			continue
+		}
+		if page.After != "" && timeuuid.Compare(message.ID, page.After) <= 0 {
+			continue
+		}
+		if page.Before != "" && timeuuid.Compare(message.ID, page.Before) >= 0 {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	slices.SortFunc(messages, func(a, b *models.Message) int { return timeuuid.Compare(a.ID, b.ID) })
+
+	size := pageSize(page)
+	if len(messages) > size {
+		if page.After != "" {
+			messages = messages[:size]
+		} else {
+			messages = messages[len(messages)-size:]
+		}
+	}
+	return messages, nil
+}
+
+// Update replaces the stored message, messages already handed out stay unchanged.
+func (repository *inMemoryMessageRepository) Update(message models.Message) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for i, stored := range repository.messages {
+		if stored.ID == message.ID {
+			updated := *stored
+			updated.UserID = message.UserID
+			updated.Message = message.Message
+			updated.Mentions = message.Mentions
+			updated.Poll = message.Poll
+			updated.Embed = message.Embed
+			updated.Markdown = message.Markdown
+			repository.messages[i] = &updated
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (repository *inMemoryMessageRepository) Delete(message models.Message) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.messages = slices.DeleteFunc(repository.messages, func(stored *models.Message) bool {
+		return stored.ID == message.ID
+	})
+	return nil
+}
+
+func (repository *inMemoryMessageRepository) ForEach(fn func(*models.Message) error) error {
+	repository.mutex.RLock()
+	messages := slices.Clone(repository.messages)
+	repository.mutex.RUnlock()
+
+	for _, message := range messages {
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository *inMemoryMessageRepository) GetChannelsByServer(serverID string) ([]string, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	var channels []string
+	for _, message := range repository.messages {
+		if message.ServerID == serverID && message.ChannelID != "" && !slices.Contains(channels, message.ChannelID) {
+			channels = append(channels, message.ChannelID)
+		}
+	}
+	return channels, nil
+}
+
+func (repository *inMemoryMessageRepository) GetAllWithoutChannel(serverID string, page models.Page) ([]*models.Message, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
 	var messages []*models.Message
 	for _, message := range repository.messages {
+		if message.ServerID != serverID || message.ChannelID != "" {
+			continue
+		}
+		if page.After != "" && timeuuid.Compare(message.ID, page.After) <= 0 {
+			continue
+		}
+		if page.Before != "" && timeuuid.Compare(message.ID, page.Before) >= 0 {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	slices.SortFunc(messages, func(a, b *models.Message) int { return timeuuid.Compare(a.ID, b.ID) })
+
+	size := pageSize(page)
+	if len(messages) > size {
+		if page.After != "" {
+			messages = messages[:size]
+		} else {
+			messages = messages[len(messages)-size:]
+		}
+	}
+	return messages, nil
+}
+
+// IndexServers has nothing to do, the messages are looked up by scanning.
+func (repository *inMemoryMessageRepository) IndexServers() error {
+	return nil
+}
+
+func (repository *inMemoryMessageRepository) ForEachByUserId(userID string, fn func(*models.Message) error) error {
+	return repository.ForEach(func(message *models.Message) error {
 		if message.UserID != userID {
+			return nil
+		}
+		return fn(message)
+	})
+}
+
+func (repository *inMemoryMessageRepository) CountUnread(channelID string, after string, userID string, limit int) (models.Unread, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	var messages []*models.Message
+	for _, message := range repository.messages {
+		if message.ChannelID == channelID && timeuuid.Compare(message.ID, after) > 0 {
 			messages = append(messages, message)
 		}
 	}
-	repository.messages = messages
-	return nil
+	slices.SortFunc(messages, func(a, b *models.Message) int { return timeuuid.Compare(a.ID, b.ID) })
+
+	unread := models.Unread{ChannelID: channelID, LastReadID: after}
+	for _, message := range messages {
+		if unread.More {
+			break
+		}
+		count(&unread, userID, limit, message.UserID, message.Mentions.Users, message.Mentions.Everyone)
+	}
+	return unread, nil
 }
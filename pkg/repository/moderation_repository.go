@@ -0,0 +1,407 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type ModerationRepository interface {
+	// GetRules returns the rules of a server in order, none if it has no rules.
+	GetRules(serverID string) ([]models.ModerationRule, error)
+	SetRules(serverID string, rules []models.ModerationRule) error
+
+	SaveFlagged(flagged models.FlaggedMessage) error
+	// GetFlagged returns the review queue of a server, oldest message first.
+	GetFlagged(serverID string) ([]*models.FlaggedMessage, error)
+	DeleteFlagged(serverID string, messageID string) error
+
+	SaveReport(report models.Report) error
+	GetReport(serverID string, id string) (*models.Report, error)
+	// GetReports returns the reports of a server, oldest first.
+	GetReports(serverID string) ([]*models.Report, error)
+	// UpdateReport saves report unless its status or claim changed since
+	// expected was read, updated is false then.
+	UpdateReport(report models.Report, expected models.Report) (updated bool, err error)
+	// GetReportsByReporter returns the reports a user filed.
+	GetReportsByReporter(reporterID string) ([]*models.Report, error)
+	// RemoveReporter keeps a report for the moderators without who filed it
+	// and the details they wrote.
+	RemoveReporter(report models.Report) error
+
+	AppendAction(action models.ModerationAction) error
+	// GetActions returns the audit trail of a server, oldest first.
+	GetActions(serverID string) ([]*models.ModerationAction, error)
+}
+
+type moderationRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewModerationRepository(session *gocql.Session) ModerationRepository {
+	return &moderationRepository{session: session}
+}
+
+func (repository *moderationRepository) GetRules(serverID string) ([]models.ModerationRule, error) {
+	var rules []models.ModerationRule
+	var query string = "SELECT Kind, Action, Words, Pattern, Domains FROM moderation_rules WHERE ServerID = ?"
+
+	iter := repository.session.Query(query, serverID).Iter()
+	for {
+		var rule models.ModerationRule
+		if !iter.Scan(&rule.Kind, &rule.Action, &rule.Words, &rule.Pattern, &rule.Domains) {
+			break
+		}
+		rules = append(rules, rule)
+	}
+	return rules, translate(iter.Close())
+}
+
+// SetRules replaces the rules of a server, the rows past the new rules are
+// dropped in the same batch so readers never see a mix of both.
+func (repository *moderationRepository) SetRules(serverID string, rules []models.ModerationRule) error {
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	for position, rule := range rules {
+		batch.Query("INSERT INTO moderation_rules (ServerID, Position, Kind, Action, Words, Pattern, Domains) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			serverID, position, rule.Kind, rule.Action, rule.Words, rule.Pattern, rule.Domains)
+	}
+	batch.Query("DELETE FROM moderation_rules WHERE ServerID = ? AND Position >= ?", serverID, len(rules))
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func (repository *moderationRepository) SaveFlagged(flagged models.FlaggedMessage) error {
+	var query string = "INSERT INTO flagged_messages (ServerID, MessageID, ChannelID, UserID, Reasons, FlaggedAt) VALUES (?, ?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		flagged.ServerID, flagged.MessageID, flagged.ChannelID, flagged.UserID, flagged.Reasons, flagged.FlaggedAt).Exec())
+}
+
+func (repository *moderationRepository) GetFlagged(serverID string) ([]*models.FlaggedMessage, error) {
+	var queue []*models.FlaggedMessage
+	var query string = "SELECT ServerID, MessageID, ChannelID, UserID, Reasons, FlaggedAt FROM flagged_messages WHERE ServerID = ?"
+
+	iter := repository.session.Query(query, serverID).Iter()
+	for {
+		var flagged models.FlaggedMessage
+		var messageID gocql.UUID
+		if !iter.Scan(&flagged.ServerID, &messageID, &flagged.ChannelID, &flagged.UserID, &flagged.Reasons, &flagged.FlaggedAt) {
+			break
+		}
+		flagged.MessageID = messageID.String()
+		queue = append(queue, &flagged)
+	}
+	return queue, translate(iter.Close())
+}
+
+func (repository *moderationRepository) DeleteFlagged(serverID string, messageID string) error {
+	var query string = "DELETE FROM flagged_messages WHERE ServerID = ? AND MessageID = ?"
+	return translate(repository.session.Query(query, serverID, messageID).Exec())
+}
+
+const reportColumns = "ServerID, ID, ChannelID, MessageID, AuthorID, ReporterID, Category, Details, Status, ClaimedBy, Resolution, Note, CreatedAt, ClaimedAt, ResolvedAt"
+
+// SaveReport stores the report together with its entry in the reporter index.
+func (repository *moderationRepository) SaveReport(report models.Report) error {
+	var query string = "INSERT INTO reports (" + reportColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	var reporterQuery string = "INSERT INTO reports_by_reporter (ReporterID, ServerID, ID) VALUES (?, ?, ?)"
+
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(query,
+		report.ServerID, report.ID, report.ChannelID, report.MessageID, report.AuthorID, report.ReporterID,
+		report.Category, report.Details, report.Status, report.ClaimedBy, report.Resolution, report.Note,
+		report.CreatedAt, report.ClaimedAt, report.ResolvedAt)
+	if report.ReporterID != "" {
+		batch.Query(reporterQuery, report.ReporterID, report.ServerID, report.ID)
+	}
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func scanReport(scan func(...any) bool) (*models.Report, bool) {
+	var report models.Report
+	var id gocql.UUID
+	var claimedAt, resolvedAt time.Time
+	if !scan(&report.ServerID, &id, &report.ChannelID, &report.MessageID, &report.AuthorID, &report.ReporterID,
+		&report.Category, &report.Details, &report.Status, &report.ClaimedBy, &report.Resolution, &report.Note,
+		&report.CreatedAt, &claimedAt, &resolvedAt) {
+		return nil, false
+	}
+	report.ID = id.String()
+	if !claimedAt.IsZero() {
+		report.ClaimedAt = &claimedAt
+	}
+	if !resolvedAt.IsZero() {
+		report.ResolvedAt = &resolvedAt
+	}
+	return &report, true
+}
+
+func (repository *moderationRepository) GetReport(serverID string, id string) (*models.Report, error) {
+	var query string = "SELECT " + reportColumns + " FROM reports WHERE ServerID = ? AND ID = ?"
+
+	iter := repository.session.Query(query, serverID, id).Iter()
+	report, found := scanReport(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return report, nil
+}
+
+func (repository *moderationRepository) GetReports(serverID string) ([]*models.Report, error) {
+	var reports []*models.Report
+	var query string = "SELECT " + reportColumns + " FROM reports WHERE ServerID = ?"
+
+	iter := repository.session.Query(query, serverID).Iter()
+	for {
+		report, found := scanReport(iter.Scan)
+		if !found {
+			break
+		}
+		reports = append(reports, report)
+	}
+	return reports, translate(iter.Close())
+}
+
+func (repository *moderationRepository) UpdateReport(report models.Report, expected models.Report) (bool, error) {
+	var query string = "UPDATE reports SET Status = ?, ClaimedBy = ?, Resolution = ?, Note = ?, ClaimedAt = ?, ResolvedAt = ? " +
+		"WHERE ServerID = ? AND ID = ? IF Status = ? AND ClaimedBy = ?"
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(query,
+		report.Status, report.ClaimedBy, report.Resolution, report.Note, report.ClaimedAt, report.ResolvedAt,
+		report.ServerID, report.ID, expected.Status, expected.ClaimedBy).MapScanCAS(previous)
+	return applied, translate(err)
+}
+
+func (repository *moderationRepository) GetReportsByReporter(reporterID string) ([]*models.Report, error) {
+	var query string = "SELECT ServerID, ID FROM reports_by_reporter WHERE ReporterID = ?"
+
+	var entries []models.Report
+	iter := repository.session.Query(query, reporterID).Iter()
+	for {
+		var entry models.Report
+		var id gocql.UUID
+		if !iter.Scan(&entry.ServerID, &id) {
+			break
+		}
+		entry.ID = id.String()
+		entries = append(entries, entry)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	var reports []*models.Report
+	for _, entry := range entries {
+		report, err := repository.GetReport(entry.ServerID, entry.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (repository *moderationRepository) RemoveReporter(report models.Report) error {
+	var query string = "UPDATE reports SET ReporterID = null, Details = null WHERE ServerID = ? AND ID = ?"
+	var reporterQuery string = "DELETE FROM reports_by_reporter WHERE ReporterID = ? AND ServerID = ? AND ID = ?"
+
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(query, report.ServerID, report.ID)
+	batch.Query(reporterQuery, report.ReporterID, report.ServerID, report.ID)
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func (repository *moderationRepository) AppendAction(action models.ModerationAction) error {
+	var query string = "INSERT INTO moderation_audit (ServerID, ID, ModeratorID, Action, ReportID, MessageID, Detail, At) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		action.ServerID, action.ID, action.ModeratorID, action.Action, action.ReportID, action.MessageID,
+		action.Detail, action.At).Exec())
+}
+
+func (repository *moderationRepository) GetActions(serverID string) ([]*models.ModerationAction, error) {
+	var actions []*models.ModerationAction
+	var query string = "SELECT ServerID, ID, ModeratorID, Action, ReportID, MessageID, Detail, At FROM moderation_audit WHERE ServerID = ?"
+
+	iter := repository.session.Query(query, serverID).Iter()
+	for {
+		var action models.ModerationAction
+		var id gocql.UUID
+		if !iter.Scan(&action.ServerID, &id, &action.ModeratorID, &action.Action, &action.ReportID, &action.MessageID,
+			&action.Detail, &action.At) {
+			break
+		}
+		action.ID = id.String()
+		actions = append(actions, &action)
+	}
+	return actions, translate(iter.Close())
+}
+
+// === Integration Test ===
+type inMemoryModerationRepository struct {
+	mutex   sync.Mutex
+	rules   map[string][]models.ModerationRule
+	flagged map[string]map[string]models.FlaggedMessage // server ID -> message ID -> flagged message
+	reports map[string]models.Report                    // server ID/report ID -> report
+	actions []models.ModerationAction
+}
+
+func NewInMemoryModerationRepository() ModerationRepository {
+	return &inMemoryModerationRepository{
+		rules:   make(map[string][]models.ModerationRule),
+		flagged: make(map[string]map[string]models.FlaggedMessage),
+		reports: make(map[string]models.Report)}
+}
+
+func (repository *inMemoryModerationRepository) GetRules(serverID string) ([]models.ModerationRule, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return slices.Clone(repository.rules[serverID]), nil
+}
+
+func (repository *inMemoryModerationRepository) SetRules(serverID string, rules []models.ModerationRule) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if len(rules) == 0 {
+		delete(repository.rules, serverID)
+		return nil
+	}
+	repository.rules[serverID] = slices.Clone(rules)
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) SaveFlagged(flagged models.FlaggedMessage) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if repository.flagged[flagged.ServerID] == nil {
+		repository.flagged[flagged.ServerID] = make(map[string]models.FlaggedMessage)
+	}
+	repository.flagged[flagged.ServerID][flagged.MessageID] = flagged
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) GetFlagged(serverID string) ([]*models.FlaggedMessage, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var queue []*models.FlaggedMessage
+	for _, flagged := range repository.flagged[serverID] {
+		queue = append(queue, &flagged)
+	}
+	slices.SortFunc(queue, func(a, b *models.FlaggedMessage) int { return timeuuid.Compare(a.MessageID, b.MessageID) })
+	return queue, nil
+}
+
+func (repository *inMemoryModerationRepository) DeleteFlagged(serverID string, messageID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.flagged[serverID], messageID)
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) SaveReport(report models.Report) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.reports[report.ServerID+"/"+report.ID] = report
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) GetReport(serverID string, id string) (*models.Report, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	report, found := repository.reports[serverID+"/"+id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &report, nil
+}
+
+func (repository *inMemoryModerationRepository) GetReports(serverID string) ([]*models.Report, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var reports []*models.Report
+	for _, report := range repository.reports {
+		if report.ServerID == serverID {
+			reports = append(reports, &report)
+		}
+	}
+	slices.SortFunc(reports, func(a, b *models.Report) int { return timeuuid.Compare(a.ID, b.ID) })
+	return reports, nil
+}
+
+func (repository *inMemoryModerationRepository) UpdateReport(report models.Report, expected models.Report) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	current, found := repository.reports[report.ServerID+"/"+report.ID]
+	if !found || current.Status != expected.Status || current.ClaimedBy != expected.ClaimedBy {
+		return false, nil
+	}
+	repository.reports[report.ServerID+"/"+report.ID] = report
+	return true, nil
+}
+
+func (repository *inMemoryModerationRepository) GetReportsByReporter(reporterID string) ([]*models.Report, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var reports []*models.Report
+	for _, report := range repository.reports {
+		if report.ReporterID == reporterID {
+			reports = append(reports, &report)
+		}
+	}
+	slices.SortFunc(reports, func(a, b *models.Report) int { return timeuuid.Compare(a.ID, b.ID) })
+	return reports, nil
+}
+
+func (repository *inMemoryModerationRepository) RemoveReporter(report models.Report) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, found := repository.reports[report.ServerID+"/"+report.ID]
+	if !found {
+		return nil
+	}
+	stored.ReporterID = ""
+	stored.Details = ""
+	repository.reports[report.ServerID+"/"+report.ID] = stored
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) AppendAction(action models.ModerationAction) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.actions = append(repository.actions, action)
+	return nil
+}
+
+func (repository *inMemoryModerationRepository) GetActions(serverID string) ([]*models.ModerationAction, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var actions []*models.ModerationAction
+	for _, action := range repository.actions {
+		if action.ServerID == serverID {
+			actions = append(actions, &action)
+		}
+	}
+	return actions, nil
+}
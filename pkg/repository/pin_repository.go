@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// pinRetries bounds how often SavePin and DeletePin retry moving the pin
+// count of a channel another instance moved first.
+const pinRetries = 10
+
+// PinRepository keeps pins and limits per channel of a server, like slow mode
+// and retention, so a channel ID of another server never reaches them.
+type PinRepository interface {
+	// SavePin stores the pin unless its message is already pinned, the earlier
+	// pin is returned then. It stores nothing when the channel already has
+	// limit pins and full is set. Both hold across instances.
+	SavePin(pin models.Pin, limit int) (saved models.Pin, full bool, err error)
+	DeletePin(pin models.Pin) error
+	// GetPins returns the pins of a channel in the order they were pinned.
+	GetPins(serverID string, channelID string) ([]*models.Pin, error)
+	GetLimit(serverID string, channelID string) (int, error)
+	SetLimit(serverID string, channelID string, limit int) error
+}
+
+type pinRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewPinRepository(session *gocql.Session) PinRepository {
+	return &pinRepository{session: session}
+}
+
+// SavePin claims the message in pinned_messages first, so it is pinned once,
+// then takes a slot by moving the pin count with a lightweight transaction.
+func (repository *pinRepository) SavePin(pin models.Pin, limit int) (models.Pin, bool, error) {
+	var claimQuery string = "INSERT INTO pinned_messages (ServerID, ChannelID, MessageID, PinID, PinnedBy) VALUES (?, ?, ?, ?, ?) IF NOT EXISTS"
+	var releaseQuery string = "DELETE FROM pinned_messages WHERE ServerID = ? AND ChannelID = ? AND MessageID = ?"
+	var query string = "INSERT INTO pins (ServerID, ChannelID, ID, MessageID, PinnedBy) VALUES (?, ?, ?, ?, ?)"
+
+	id, err := gocql.ParseUUID(pin.ID)
+	if err != nil {
+		return models.Pin{}, false, fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	// claims the pins made before the count was kept, so they are found below
+	if _, err := repository.count(pin.ServerID, pin.ChannelID); err != nil {
+		return models.Pin{}, false, err
+	}
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(claimQuery, pin.ServerID, pin.ChannelID, pin.MessageID, id, pin.PinnedBy).MapScanCAS(previous)
+	if err != nil {
+		return models.Pin{}, false, translate(err)
+	}
+	if !applied {
+		existingID, _ := previous["pinid"].(gocql.UUID)
+		existing := models.Pin{ID: existingID.String(), ServerID: pin.ServerID, ChannelID: pin.ChannelID, MessageID: pin.MessageID,
+			PinnedAt: existingID.Time().UTC()}
+		existing.PinnedBy, _ = previous["pinnedby"].(string)
+		return existing, false, nil
+	}
+
+	taken, err := repository.move(pin.ServerID, pin.ChannelID, func(pinned int) (int, bool) {
+		return pinned + 1, pinned < limit
+	})
+	if err != nil || !taken {
+		repository.session.Query(releaseQuery, pin.ServerID, pin.ChannelID, pin.MessageID).Exec()
+		return models.Pin{}, !taken && err == nil, err
+	}
+
+	if err := repository.session.Query(query, pin.ServerID, pin.ChannelID, id, pin.MessageID, pin.PinnedBy).Exec(); err != nil {
+		return models.Pin{}, false, translate(err)
+	}
+	return pin, false, nil
+}
+
+// DeletePin removes the pin and gives its slot back, only the delete that
+// releases the claim of the message does so it is never given back twice.
+func (repository *pinRepository) DeletePin(pin models.Pin) error {
+	var query string = "DELETE FROM pins WHERE ServerID = ? AND ChannelID = ? AND ID = ?"
+	var releaseQuery string = "DELETE FROM pinned_messages WHERE ServerID = ? AND ChannelID = ? AND MessageID = ? IF PinID = ?"
+
+	id, err := gocql.ParseUUID(pin.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	if err := repository.session.Query(query, pin.ServerID, pin.ChannelID, id).Exec(); err != nil {
+		return translate(err)
+	}
+
+	released, err := repository.session.Query(releaseQuery, pin.ServerID, pin.ChannelID, pin.MessageID, id).MapScanCAS(map[string]any{})
+	if err != nil || !released {
+		return translate(err)
+	}
+	_, err = repository.move(pin.ServerID, pin.ChannelID, func(pinned int) (int, bool) {
+		return max(pinned-1, 0), true
+	})
+	return err
+}
+
+// count returns the pin count of a channel. Channels pinned in before the
+// count was kept start from the pins they have, which are claimed for it.
+func (repository *pinRepository) count(serverID string, channelID string) (int, error) {
+	var pinned int
+	err := repository.session.Query("SELECT Pinned FROM pin_counts WHERE ServerID = ? AND ChannelID = ?", serverID, channelID).
+		SerialConsistency(gocql.Serial).Scan(&pinned)
+	if err != gocql.ErrNotFound {
+		return pinned, translate(err)
+	}
+
+	pins, err := repository.GetPins(serverID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	var claimQuery string = "INSERT INTO pinned_messages (ServerID, ChannelID, MessageID, PinID, PinnedBy) VALUES (?, ?, ?, ?, ?) IF NOT EXISTS"
+	for _, pin := range pins {
+		id, _ := gocql.ParseUUID(pin.ID)
+		if _, err := repository.session.Query(claimQuery, serverID, channelID, pin.MessageID, id, pin.PinnedBy).
+			MapScanCAS(map[string]any{}); err != nil {
+			return 0, translate(err)
+		}
+	}
+	var insertQuery string = "INSERT INTO pin_counts (ServerID, ChannelID, Pinned) VALUES (?, ?, ?) IF NOT EXISTS"
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(insertQuery, serverID, channelID, len(pins)).MapScanCAS(previous)
+	if err != nil {
+		return 0, translate(err)
+	}
+	if !applied {
+		pinned, _ = previous["pinned"].(int)
+		return pinned, nil
+	}
+	return len(pins), nil
+}
+
+// move sets the pin count of a channel to what next makes of it, unless next
+// refuses. It retries when another instance moved the count first.
+func (repository *pinRepository) move(serverID string, channelID string, next func(pinned int) (int, bool)) (bool, error) {
+	var query string = "UPDATE pin_counts SET Pinned = ? WHERE ServerID = ? AND ChannelID = ? IF Pinned = ?"
+
+	for attempt := 0; attempt < pinRetries; attempt++ {
+		pinned, err := repository.count(serverID, channelID)
+		if err != nil {
+			return false, err
+		}
+		moved, allowed := next(pinned)
+		if !allowed {
+			return false, nil
+		}
+		applied, err := repository.session.Query(query, moved, serverID, channelID, pinned).MapScanCAS(map[string]any{})
+		if err != nil {
+			return false, translate(err)
+		}
+		if applied {
+			return true, nil
+		}
+	}
+	return false, ErrConflict
+}
+
+func (repository *pinRepository) GetPins(serverID string, channelID string) ([]*models.Pin, error) {
+	var pins []*models.Pin
+	var query string = "SELECT ID, MessageID, PinnedBy FROM pins WHERE ServerID = ? AND ChannelID = ?"
+
+	iter := repository.session.Query(query, serverID, channelID).Iter()
+	for {
+		var id gocql.UUID
+		pin := models.Pin{ServerID: serverID, ChannelID: channelID}
+		if !iter.Scan(&id, &pin.MessageID, &pin.PinnedBy) {
+			break
+		}
+		pin.ID = id.String()
+		pin.PinnedAt = id.Time().UTC()
+		pins = append(pins, &pin)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return pins, nil
+}
+
+func (repository *pinRepository) GetLimit(serverID string, channelID string) (int, error) {
+	var limit int
+	var query string = "SELECT MaxPins FROM pin_limits WHERE ServerID = ? AND ChannelID = ?"
+	if err := repository.session.Query(query, serverID, channelID).Scan(&limit); err != nil {
+		return 0, translate(err)
+	}
+	return limit, nil
+}
+
+func (repository *pinRepository) SetLimit(serverID string, channelID string, limit int) error {
+	var query string = "INSERT INTO pin_limits (ServerID, ChannelID, MaxPins) VALUES (?, ?, ?)"
+	return translate(repository.session.Query(query, serverID, channelID, limit).Exec())
+}
+
+// === Integration Test ===
+type inMemoryPinRepository struct {
+	mutex  sync.Mutex
+	pins   map[string][]models.Pin // server ID/channel ID -> pins
+	limits map[string]int          // server ID/channel ID -> limit
+}
+
+func NewInMemoryPinRepository() PinRepository {
+	return &inMemoryPinRepository{
+		pins:   make(map[string][]models.Pin),
+		limits: make(map[string]int)}
+}
+
+func (repository *inMemoryPinRepository) SavePin(pin models.Pin, limit int) (models.Pin, bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := pin.ServerID + "/" + pin.ChannelID
+	pins := repository.pins[key]
+	for _, stored := range pins {
+		if stored.MessageID == pin.MessageID {
+			return stored, false, nil
+		}
+	}
+	if len(pins) >= limit {
+		return models.Pin{}, true, nil
+	}
+
+	pins = append(pins, pin)
+	slices.SortFunc(pins, func(a, b models.Pin) int {
+		return timeuuid.Compare(a.ID, b.ID)
+	})
+	repository.pins[key] = pins
+	return pin, false, nil
+}
+
+func (repository *inMemoryPinRepository) DeletePin(pin models.Pin) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := pin.ServerID + "/" + pin.ChannelID
+	repository.pins[key] = slices.DeleteFunc(repository.pins[key], func(stored models.Pin) bool {
+		return stored.ID == pin.ID
+	})
+	return nil
+}
+
+func (repository *inMemoryPinRepository) GetPins(serverID string, channelID string) ([]*models.Pin, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var pins []*models.Pin
+	for _, pin := range repository.pins[serverID+"/"+channelID] {
+		pins = append(pins, &pin)
+	}
+	return pins, nil
+}
+
+func (repository *inMemoryPinRepository) GetLimit(serverID string, channelID string) (int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	limit, found := repository.limits[serverID+"/"+channelID]
+	if !found {
+		return 0, ErrNotFound
+	}
+	return limit, nil
+}
+
+func (repository *inMemoryPinRepository) SetLimit(serverID string, channelID string, limit int) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.limits[serverID+"/"+channelID] = limit
+	return nil
+}
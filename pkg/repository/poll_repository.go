@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+type PollRepository interface {
+	// SaveVote stores the vote unless the user already voted in the poll.
+	SaveVote(vote models.PollVote) (bool, error)
+	DeleteVote(messageID string, userID string) error
+	GetVote(messageID string, userID string) (*models.PollVote, error)
+	// GetVotes returns the votes of a poll ordered by user.
+	GetVotes(messageID string) ([]*models.PollVote, error)
+	// GetVotedPolls returns the message IDs of the polls a user voted in.
+	GetVotedPolls(userID string) ([]string, error)
+	DeleteVotes(messageID string) error
+}
+
+type pollRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewPollRepository(session *gocql.Session) PollRepository {
+	return &pollRepository{session: session}
+}
+
+func (repository *pollRepository) SaveVote(vote models.PollVote) (bool, error) {
+	var query string = "INSERT INTO poll_votes (MessageID, UserID, Options, VotedAt) VALUES (?, ?, ?, ?) IF NOT EXISTS"
+	var userQuery string = "INSERT INTO poll_votes_by_user (UserID, MessageID) VALUES (?, ?)"
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(query, vote.MessageID, vote.UserID, vote.Options, vote.VotedAt).MapScanCAS(previous)
+	if err != nil || !applied {
+		return false, translate(err)
+	}
+	return true, translate(repository.session.Query(userQuery, vote.UserID, vote.MessageID).Exec())
+}
+
+func (repository *pollRepository) DeleteVote(messageID string, userID string) error {
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query("DELETE FROM poll_votes WHERE MessageID = ? AND UserID = ?", messageID, userID)
+	batch.Query("DELETE FROM poll_votes_by_user WHERE UserID = ? AND MessageID = ?", userID, messageID)
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+func (repository *pollRepository) GetVote(messageID string, userID string) (*models.PollVote, error) {
+	var query string = "SELECT Options, VotedAt FROM poll_votes WHERE MessageID = ? AND UserID = ?"
+
+	vote := models.PollVote{MessageID: messageID, UserID: userID}
+	if err := repository.session.Query(query, messageID, userID).Scan(&vote.Options, &vote.VotedAt); err != nil {
+		return nil, translate(err)
+	}
+	return &vote, nil
+}
+
+func (repository *pollRepository) GetVotes(messageID string) ([]*models.PollVote, error) {
+	var votes []*models.PollVote
+	var query string = "SELECT UserID, Options, VotedAt FROM poll_votes WHERE MessageID = ?"
+
+	iter := repository.session.Query(query, messageID).Iter()
+	for {
+		vote := models.PollVote{MessageID: messageID}
+		if !iter.Scan(&vote.UserID, &vote.Options, &vote.VotedAt) {
+			break
+		}
+		votes = append(votes, &vote)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return votes, nil
+}
+
+func (repository *pollRepository) GetVotedPolls(userID string) ([]string, error) {
+	var messageIDs []string
+	var query string = "SELECT MessageID FROM poll_votes_by_user WHERE UserID = ?"
+
+	iter := repository.session.Query(query, userID).Iter()
+	var messageID gocql.UUID
+	for iter.Scan(&messageID) {
+		messageIDs = append(messageIDs, messageID.String())
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return messageIDs, nil
+}
+
+// DeleteVotes removes every vote of a poll together with the entries of its voters.
+func (repository *pollRepository) DeleteVotes(messageID string) error {
+	votes, err := repository.GetVotes(messageID)
+	if err != nil {
+		return err
+	}
+
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	for _, vote := range votes {
+		batch.Query("DELETE FROM poll_votes_by_user WHERE UserID = ? AND MessageID = ?", vote.UserID, messageID)
+	}
+	batch.Query("DELETE FROM poll_votes WHERE MessageID = ?", messageID)
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+// === Integration Test ===
+type inMemoryPollRepository struct {
+	mutex sync.Mutex
+	votes map[string]models.PollVote // message ID/user ID -> vote
+}
+
+func NewInMemoryPollRepository() PollRepository {
+	return &inMemoryPollRepository{
+		votes: make(map[string]models.PollVote)}
+}
+
+func (repository *inMemoryPollRepository) SaveVote(vote models.PollVote) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.votes[vote.MessageID+"/"+vote.UserID]; found {
+		return false, nil
+	}
+	repository.votes[vote.MessageID+"/"+vote.UserID] = vote
+	return true, nil
+}
+
+func (repository *inMemoryPollRepository) DeleteVote(messageID string, userID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.votes, messageID+"/"+userID)
+	return nil
+}
+
+func (repository *inMemoryPollRepository) GetVote(messageID string, userID string) (*models.PollVote, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	vote, found := repository.votes[messageID+"/"+userID]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &vote, nil
+}
+
+func (repository *inMemoryPollRepository) GetVotes(messageID string) ([]*models.PollVote, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var votes []*models.PollVote
+	for _, vote := range repository.votes {
+		if vote.MessageID == messageID {
+			votes = append(votes, &vote)
+		}
+	}
+	slices.SortFunc(votes, func(a, b *models.PollVote) int { return strings.Compare(a.UserID, b.UserID) })
+	return votes, nil
+}
+
+func (repository *inMemoryPollRepository) GetVotedPolls(userID string) ([]string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var messageIDs []string
+	for _, vote := range repository.votes {
+		if vote.UserID == userID {
+			messageIDs = append(messageIDs, vote.MessageID)
+		}
+	}
+	slices.Sort(messageIDs)
+	return messageIDs, nil
+}
+
+func (repository *inMemoryPollRepository) DeleteVotes(messageID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for key, vote := range repository.votes {
+		if vote.MessageID == messageID {
+			delete(repository.votes, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+type ReadStateRepository interface {
+	SetReadState(state models.ReadState) error
+	// GetReadStates returns the read states of a user ordered by channel.
+	GetReadStates(userID string) ([]*models.ReadState, error)
+	DeleteReadStates(userID string) error
+}
+
+type readStateRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewReadStateRepository(session *gocql.Session) ReadStateRepository {
+	return &readStateRepository{session: session}
+}
+
+func (repository *readStateRepository) SetReadState(state models.ReadState) error {
+	var query string = "INSERT INTO read_states (UserID, ChannelID, ServerID, LastReadID, UpdatedAt) VALUES (?, ?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		state.UserID, state.ChannelID, state.ServerID, state.LastReadID, state.UpdatedAt).Exec())
+}
+
+func (repository *readStateRepository) GetReadStates(userID string) ([]*models.ReadState, error) {
+	var states []*models.ReadState
+	var query string = "SELECT ChannelID, ServerID, LastReadID, UpdatedAt FROM read_states WHERE UserID = ?"
+
+	iter := repository.session.Query(query, userID).Iter()
+	for {
+		var lastRead gocql.UUID
+		state := models.ReadState{UserID: userID}
+		if !iter.Scan(&state.ChannelID, &state.ServerID, &lastRead, &state.UpdatedAt) {
+			break
+		}
+		state.LastReadID = lastRead.String()
+		states = append(states, &state)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return states, nil
+}
+
+func (repository *readStateRepository) DeleteReadStates(userID string) error {
+	return translate(repository.session.Query("DELETE FROM read_states WHERE UserID = ?", userID).Exec())
+}
+
+// === Integration Test ===
+type inMemoryReadStateRepository struct {
+	mutex  sync.Mutex
+	states map[string]models.ReadState // user ID/channel ID -> read state
+}
+
+func NewInMemoryReadStateRepository() ReadStateRepository {
+	return &inMemoryReadStateRepository{
+		states: make(map[string]models.ReadState)}
+}
+
+func (repository *inMemoryReadStateRepository) SetReadState(state models.ReadState) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.states[state.UserID+"/"+state.ChannelID] = state
+	return nil
+}
+
+func (repository *inMemoryReadStateRepository) GetReadStates(userID string) ([]*models.ReadState, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var states []*models.ReadState
+	for _, state := range repository.states {
+		if state.UserID == userID {
+			states = append(states, &state)
+		}
+	}
+	slices.SortFunc(states, func(a, b *models.ReadState) int { return strings.Compare(a.ChannelID, b.ChannelID) })
+	return states, nil
+}
+
+func (repository *inMemoryReadStateRepository) DeleteReadStates(userID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for key, state := range repository.states {
+		if state.UserID == userID {
+			delete(repository.states, key)
+		}
+	}
+	return nil
+}
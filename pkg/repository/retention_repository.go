@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+type RetentionRepository interface {
+	SetRule(rule models.RetentionRule) error
+	// DeleteRule removes the rule of a server, or of a channel of the server.
+	DeleteRule(scope string, serverID string, targetID string) error
+	// GetRules returns every rule, server rules first.
+	GetRules() ([]*models.RetentionRule, error)
+}
+
+type retentionRepository struct { //_private
+	session *gocql.Session
+}
+
+func NewRetentionRepository(session *gocql.Session) RetentionRepository {
+	return &retentionRepository{session: session}
+}
+
+// SetRule keeps the rules of channels per server, so a rule set through one
+// server never replaces that of a channel with the same ID in another.
+func (repository *retentionRepository) SetRule(rule models.RetentionRule) error {
+	if rule.Scope == models.RetentionScopeChannel {
+		var query string = "INSERT INTO channel_retention_rules (ServerID, ChannelID, MaxAgeSeconds, MaxCount) VALUES (?, ?, ?, ?)"
+		return translate(repository.session.Query(query,
+			rule.ServerID, rule.TargetID, rule.MaxAgeSeconds, rule.MaxCount).Exec())
+	}
+	var query string = "INSERT INTO retention_rules (Scope, TargetID, MaxAgeSeconds, MaxCount) VALUES (?, ?, ?, ?)"
+	return translate(repository.session.Query(query,
+		rule.Scope, rule.TargetID, rule.MaxAgeSeconds, rule.MaxCount).Exec())
+}
+
+func (repository *retentionRepository) DeleteRule(scope string, serverID string, targetID string) error {
+	if scope == models.RetentionScopeChannel {
+		var query string = "DELETE FROM channel_retention_rules WHERE ServerID = ? AND ChannelID = ?"
+		return translate(repository.session.Query(query, serverID, targetID).Exec())
+	}
+	var query string = "DELETE FROM retention_rules WHERE Scope = ? AND TargetID = ?"
+	return translate(repository.session.Query(query, scope, targetID).Exec())
+}
+
+// GetRules reads the channel rules of every server, there are only ever a few.
+func (repository *retentionRepository) GetRules() ([]*models.RetentionRule, error) {
+	var rules []*models.RetentionRule
+
+	iter := repository.session.Query("SELECT TargetID, MaxAgeSeconds, MaxCount FROM retention_rules WHERE Scope = ?",
+		models.RetentionScopeServer).Iter()
+	for {
+		rule := models.RetentionRule{Scope: models.RetentionScopeServer}
+		if !iter.Scan(&rule.TargetID, &rule.MaxAgeSeconds, &rule.MaxCount) {
+			break
+		}
+		rule.ServerID = rule.TargetID
+		rules = append(rules, &rule)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	iter = repository.session.Query("SELECT ServerID, ChannelID, MaxAgeSeconds, MaxCount FROM channel_retention_rules").Iter()
+	for {
+		rule := models.RetentionRule{Scope: models.RetentionScopeChannel}
+		if !iter.Scan(&rule.ServerID, &rule.TargetID, &rule.MaxAgeSeconds, &rule.MaxCount) {
+			break
+		}
+		rules = append(rules, &rule)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return rules, nil
+}
+
+// === Integration Test ===
+type inMemoryRetentionRepository struct {
+	mutex sync.Mutex
+	rules map[string]models.RetentionRule // scope/server ID/target ID -> rule
+}
+
+func NewInMemoryRetentionRepository() RetentionRepository {
+	return &inMemoryRetentionRepository{
+		rules: make(map[string]models.RetentionRule)}
+}
+
+func (repository *inMemoryRetentionRepository) SetRule(rule models.RetentionRule) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.rules[rule.Scope+"/"+rule.ServerID+"/"+rule.TargetID] = rule
+	return nil
+}
+
+func (repository *inMemoryRetentionRepository) DeleteRule(scope string, serverID string, targetID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.rules, scope+"/"+serverID+"/"+targetID)
+	return nil
+}
+
+func (repository *inMemoryRetentionRepository) GetRules() ([]*models.RetentionRule, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var rules []*models.RetentionRule
+	for _, rule := range repository.rules {
+		rules = append(rules, &rule)
+	}
+	// "channel" sorts before "server", so order descending by scope
+	slices.SortFunc(rules, func(a, b *models.RetentionRule) int {
+		if order := strings.Compare(b.Scope, a.Scope); order != 0 {
+			return order
+		}
+		if order := strings.Compare(a.ServerID, b.ServerID); order != 0 {
+			return order
+		}
+		return strings.Compare(a.TargetID, b.TargetID)
+	})
+	return rules, nil
+}
@@ -0,0 +1,399 @@
+package repository
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// scheduledShards spreads the due index over this many partitions
+	scheduledShards = 16
+	// finishedScheduledTTL is how long sent, cancelled and failed messages
+	// are kept so their outcome can still be looked up
+	finishedScheduledTTL = 30 * 24 * time.Hour
+)
+
+type ScheduledRepository interface {
+	SaveScheduled(scheduled models.ScheduledMessage) error
+	GetScheduled(serverID string, id string) (*models.ScheduledMessage, error)
+	// GetScheduledByServer returns the scheduled messages of a server, oldest first.
+	GetScheduledByServer(serverID string) ([]*models.ScheduledMessage, error)
+	// GetScheduledByUser returns the pending and sending messages of a user.
+	GetScheduledByUser(userID string) ([]*models.ScheduledMessage, error)
+	// GetDue returns the pending and sending messages of every server that
+	// were to be sent at until or before.
+	GetDue(until time.Time) ([]*models.ScheduledMessage, error)
+	// UpdateScheduled only applies while the stored message still has the
+	// status and claim of expected. Finished messages expire after a while.
+	UpdateScheduled(scheduled models.ScheduledMessage, expected models.ScheduledMessage) (bool, error)
+	// Reindex adds the unfinished messages stored before GetDue and
+	// GetScheduledByUser were indexed,
+	// it scans every scheduled message so it is only run once per start.
+	Reindex() error
+}
+
+// finished reports whether a scheduled message will never be sent again.
+func finished(status string) bool {
+	return status == models.ScheduledSent || status == models.ScheduledCancelled || status == models.ScheduledFailed
+}
+
+type scheduledRepository struct { //_private
+	session *gocql.Session
+	cipher  ContentCipher
+}
+
+const scheduledColumns = "ServerID, ID, ChannelID, UserID, Message, SendAt, Status, ScheduledBy, ClaimedBy, ClaimedAt, Attempts, MessageID, Error, CreatedAt, SentAt"
+
+// NewScheduledRepository keeps the content of scheduled messages encrypted
+// like that of sent ones.
+func NewScheduledRepository(session *gocql.Session, cipher ContentCipher) ScheduledRepository {
+	return &scheduledRepository{session: session, cipher: cipher}
+}
+
+// shardOf returns the partition of the due index a scheduled message is in.
+func shardOf(id string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return int(hash.Sum32() % scheduledShards)
+}
+
+// SaveScheduled stores the message together with its entries in the due and
+// user indexes, finished messages are stored without them to expire.
+func (repository *scheduledRepository) SaveScheduled(scheduled models.ScheduledMessage) error {
+	var dueQuery string = "INSERT INTO scheduled_due (Shard, SendAt, ServerID, ID) VALUES (?, ?, ?, ?)"
+	var userQuery string = "INSERT INTO scheduled_by_user (UserID, ServerID, ID) VALUES (?, ?, ?)"
+
+	insert, values, err := repository.insert(scheduled)
+	if err != nil {
+		return err
+	}
+	if finished(scheduled.Status) {
+		return translate(repository.session.Query(insert, values...).Exec())
+	}
+
+	batch := repository.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(insert, values...)
+	batch.Query(dueQuery, shardOf(scheduled.ID), scheduled.SendAt, scheduled.ServerID, scheduled.ID)
+	batch.Query(userQuery, scheduled.UserID, scheduled.ServerID, scheduled.ID)
+	return translate(repository.session.ExecuteBatch(batch))
+}
+
+// insert returns the statement storing the message with its content sealed.
+func (repository *scheduledRepository) insert(scheduled models.ScheduledMessage) (string, []any, error) {
+	content, err := repository.cipher.Seal(models.Message{ID: scheduled.ID, UserID: scheduled.UserID, Message: scheduled.Message})
+	if err != nil {
+		return "", nil, translate(err)
+	}
+
+	var query string = "INSERT INTO scheduled_messages (" + scheduledColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?"
+	ttl := 0
+	if finished(scheduled.Status) {
+		ttl = int(finishedScheduledTTL.Seconds())
+	}
+	return query, []any{
+		scheduled.ServerID, scheduled.ID, scheduled.ChannelID, scheduled.UserID, content, scheduled.SendAt,
+		scheduled.Status, scheduled.ScheduledBy, scheduled.ClaimedBy, scheduled.ClaimedAt, scheduled.Attempts,
+		scheduled.MessageID, scheduled.Error, scheduled.CreatedAt, scheduled.SentAt, ttl}, nil
+}
+
+func scanScheduled(scan func(...any) bool) (*models.ScheduledMessage, bool) {
+	var scheduled models.ScheduledMessage
+	var id gocql.UUID
+	var claimedAt, sentAt time.Time
+	if !scan(&scheduled.ServerID, &id, &scheduled.ChannelID, &scheduled.UserID, &scheduled.Message, &scheduled.SendAt,
+		&scheduled.Status, &scheduled.ScheduledBy, &scheduled.ClaimedBy, &claimedAt, &scheduled.Attempts,
+		&scheduled.MessageID, &scheduled.Error, &scheduled.CreatedAt, &sentAt) {
+		return nil, false
+	}
+	scheduled.ID = id.String()
+	if !claimedAt.IsZero() {
+		scheduled.ClaimedAt = &claimedAt
+	}
+	if !sentAt.IsZero() {
+		scheduled.SentAt = &sentAt
+	}
+	return &scheduled, true
+}
+
+// open decrypts the content of scheduled messages in place.
+func (repository *scheduledRepository) open(scheduled ...*models.ScheduledMessage) error {
+	messages := make([]*models.Message, 0, len(scheduled))
+	for _, item := range scheduled {
+		messages = append(messages, &models.Message{ID: item.ID, UserID: item.UserID, Message: item.Message})
+	}
+	if err := repository.cipher.Open(messages...); err != nil {
+		return translate(err)
+	}
+	for i, message := range messages {
+		scheduled[i].Message = message.Message
+	}
+	return nil
+}
+
+func (repository *scheduledRepository) GetScheduled(serverID string, id string) (*models.ScheduledMessage, error) {
+	var query string = "SELECT " + scheduledColumns + " FROM scheduled_messages WHERE ServerID = ? AND ID = ?"
+
+	iter := repository.session.Query(query, serverID, id).Iter()
+	scheduled, found := scanScheduled(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return scheduled, repository.open(scheduled)
+}
+
+func (repository *scheduledRepository) GetScheduledByServer(serverID string) ([]*models.ScheduledMessage, error) {
+	var query string = "SELECT " + scheduledColumns + " FROM scheduled_messages WHERE ServerID = ?"
+	return repository.list(repository.session.Query(query, serverID))
+}
+
+// GetScheduledByUser loads the messages of the user index, dropping the
+// entries of messages that finished without leaving it.
+func (repository *scheduledRepository) GetScheduledByUser(userID string) ([]*models.ScheduledMessage, error) {
+	var query string = "SELECT ServerID, ID FROM scheduled_by_user WHERE UserID = ?"
+
+	var entries []models.ScheduledMessage
+	iter := repository.session.Query(query, userID).Iter()
+	for {
+		entry := models.ScheduledMessage{UserID: userID}
+		var id gocql.UUID
+		if !iter.Scan(&entry.ServerID, &id) {
+			break
+		}
+		entry.ID = id.String()
+		entries = append(entries, entry)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+
+	var scheduled []*models.ScheduledMessage
+	for _, entry := range entries {
+		item, err := repository.GetScheduled(entry.ServerID, entry.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if err != nil || finished(item.Status) {
+			if err := repository.unindexUser(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		scheduled = append(scheduled, item)
+	}
+	return scheduled, nil
+}
+
+// GetDue reads the due entries of every shard of the index, they are ordered
+// by SendAt so only the due ones are read. Only those messages are loaded.
+func (repository *scheduledRepository) GetDue(until time.Time) ([]*models.ScheduledMessage, error) {
+	var query string = "SELECT SendAt, ServerID, ID FROM scheduled_due WHERE Shard = ? AND SendAt <= ?"
+
+	var due []*models.ScheduledMessage
+	for shard := 0; shard < scheduledShards; shard++ {
+		var entries []models.ScheduledMessage
+		iter := repository.session.Query(query, shard, until).Iter()
+		for {
+			var entry models.ScheduledMessage
+			var id gocql.UUID
+			if !iter.Scan(&entry.SendAt, &entry.ServerID, &id) {
+				break
+			}
+			entry.ID = id.String()
+			entries = append(entries, entry)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, translate(err)
+		}
+
+		for _, entry := range entries {
+			scheduled, err := repository.GetScheduled(entry.ServerID, entry.ID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			if err != nil || finished(scheduled.Status) {
+				// finished without leaving the index, or expired
+				if err := repository.unindex(entry); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			due = append(due, scheduled)
+		}
+	}
+	return due, nil
+}
+
+// unindex removes a message from the due index.
+func (repository *scheduledRepository) unindex(scheduled models.ScheduledMessage) error {
+	var query string = "DELETE FROM scheduled_due WHERE Shard = ? AND SendAt = ? AND ServerID = ? AND ID = ?"
+
+	id, err := gocql.ParseUUID(scheduled.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	return translate(repository.session.Query(query, shardOf(scheduled.ID), scheduled.SendAt, scheduled.ServerID, id).Exec())
+}
+
+// unindexUser removes a message from the user index.
+func (repository *scheduledRepository) unindexUser(scheduled models.ScheduledMessage) error {
+	var query string = "DELETE FROM scheduled_by_user WHERE UserID = ? AND ServerID = ? AND ID = ?"
+
+	id, err := gocql.ParseUUID(scheduled.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	return translate(repository.session.Query(query, scheduled.UserID, scheduled.ServerID, id).Exec())
+}
+
+func (repository *scheduledRepository) Reindex() error {
+	var query string = "SELECT ServerID, ID, UserID, SendAt, Status FROM scheduled_messages"
+	var dueQuery string = "INSERT INTO scheduled_due (Shard, SendAt, ServerID, ID) VALUES (?, ?, ?, ?)"
+	var userQuery string = "INSERT INTO scheduled_by_user (UserID, ServerID, ID) VALUES (?, ?, ?)"
+
+	iter := repository.session.Query(query).PageSize(1000).Iter()
+	var serverID, userID, status string
+	var id gocql.UUID
+	var sendAt time.Time
+	for iter.Scan(&serverID, &id, &userID, &sendAt, &status) {
+		if finished(status) {
+			continue
+		}
+		batch := repository.session.NewBatch(gocql.LoggedBatch)
+		batch.Query(dueQuery, shardOf(id.String()), sendAt, serverID, id)
+		batch.Query(userQuery, userID, serverID, id)
+		if err := repository.session.ExecuteBatch(batch); err != nil {
+			iter.Close()
+			return translate(err)
+		}
+	}
+	return translate(iter.Close())
+}
+
+func (repository *scheduledRepository) list(query *gocql.Query) ([]*models.ScheduledMessage, error) {
+	var scheduled []*models.ScheduledMessage
+	iter := query.Iter()
+	for {
+		item, found := scanScheduled(iter.Scan)
+		if !found {
+			break
+		}
+		scheduled = append(scheduled, item)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, translate(err)
+	}
+	return scheduled, repository.open(scheduled...)
+}
+
+// UpdateScheduled moves a finished message out of the indexes and writes
+// it again to expire. Nothing changes it after it finished, so the plain
+// write cannot undo another update.
+func (repository *scheduledRepository) UpdateScheduled(scheduled models.ScheduledMessage, expected models.ScheduledMessage) (bool, error) {
+	var query string = "UPDATE scheduled_messages SET Status = ?, ClaimedBy = ?, ClaimedAt = ?, Attempts = ?, MessageID = ?, Error = ?, SentAt = ? " +
+		"WHERE ServerID = ? AND ID = ? IF Status = ? AND ClaimedBy = ?"
+
+	previous := make(map[string]interface{})
+	applied, err := repository.session.Query(query,
+		scheduled.Status, scheduled.ClaimedBy, scheduled.ClaimedAt, scheduled.Attempts, scheduled.MessageID,
+		scheduled.Error, scheduled.SentAt, scheduled.ServerID, scheduled.ID,
+		expected.Status, expected.ClaimedBy).MapScanCAS(previous)
+	if err != nil || !applied || !finished(scheduled.Status) {
+		return applied, translate(err)
+	}
+
+	// best effort, GetDue and GetScheduledByUser drop the entries of a finished
+	// message should this fail
+	repository.unindex(scheduled)
+	repository.unindexUser(scheduled)
+	if insert, values, err := repository.insert(scheduled); err == nil {
+		repository.session.Query(insert, values...).Exec() // only the expiry is lost on failure
+	}
+	return true, nil
+}
+
+// === Integration Test ===
+type inMemoryScheduledRepository struct {
+	mutex     sync.Mutex
+	scheduled map[string]models.ScheduledMessage // server ID/ID -> scheduled message
+}
+
+func NewInMemoryScheduledRepository() ScheduledRepository {
+	return &inMemoryScheduledRepository{
+		scheduled: make(map[string]models.ScheduledMessage)}
+}
+
+func (repository *inMemoryScheduledRepository) SaveScheduled(scheduled models.ScheduledMessage) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.scheduled[scheduled.ServerID+"/"+scheduled.ID] = scheduled
+	return nil
+}
+
+func (repository *inMemoryScheduledRepository) GetScheduled(serverID string, id string) (*models.ScheduledMessage, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	scheduled, found := repository.scheduled[serverID+"/"+id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &scheduled, nil
+}
+
+func (repository *inMemoryScheduledRepository) GetScheduledByServer(serverID string) ([]*models.ScheduledMessage, error) {
+	return repository.filter(func(scheduled models.ScheduledMessage) bool { return scheduled.ServerID == serverID })
+}
+
+func (repository *inMemoryScheduledRepository) GetScheduledByUser(userID string) ([]*models.ScheduledMessage, error) {
+	return repository.filter(func(scheduled models.ScheduledMessage) bool {
+		return !finished(scheduled.Status) && scheduled.UserID == userID
+	})
+}
+
+func (repository *inMemoryScheduledRepository) GetDue(until time.Time) ([]*models.ScheduledMessage, error) {
+	return repository.filter(func(scheduled models.ScheduledMessage) bool {
+		return !finished(scheduled.Status) && !scheduled.SendAt.After(until)
+	})
+}
+
+func (repository *inMemoryScheduledRepository) Reindex() error {
+	return nil
+}
+
+func (repository *inMemoryScheduledRepository) filter(keep func(models.ScheduledMessage) bool) ([]*models.ScheduledMessage, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var scheduled []*models.ScheduledMessage
+	for _, item := range repository.scheduled {
+		if keep(item) {
+			scheduled = append(scheduled, &item)
+		}
+	}
+	slices.SortFunc(scheduled, func(a, b *models.ScheduledMessage) int { return timeuuid.Compare(a.ID, b.ID) })
+	return scheduled, nil
+}
+
+func (repository *inMemoryScheduledRepository) UpdateScheduled(scheduled models.ScheduledMessage, expected models.ScheduledMessage) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	current, found := repository.scheduled[scheduled.ServerID+"/"+scheduled.ID]
+	if !found || current.Status != expected.Status || current.ClaimedBy != expected.ClaimedBy {
+		return false, nil
+	}
+	repository.scheduled[scheduled.ServerID+"/"+scheduled.ID] = scheduled
+	return true, nil
+}
@@ -0,0 +1,357 @@
+package retention
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/timeuuid"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const defaultBatchSize = 100 // the largest page the repository returns
+
+var ErrSweepRunning = fmt.Errorf("%w: a retention sweep is already running", repository.ErrConflict)
+
+// Worker deletes the messages that outlived the retention rule of their
+// channel or server. It pages through every channel with a rule newest
+// first, so both the age and the count limit are decided in a single pass.
+// Messages without a channel only expire by age.
+// Messages under a legal hold are kept until a sweep after its release.
+type Worker struct {
+	messages repository.MessageRepository
+	rules    repository.RetentionRepository
+	holds    *legalhold.Holds
+	events   events.Publisher
+	settings configuration.RetentionSettings
+
+	running sync.Mutex // held while sweeping
+
+	sweeps        *metrics.Counter
+	deleted       *metrics.Counter
+	failed        *metrics.Counter
+	deferred      *metrics.Counter
+	lastExpired   *metrics.Gauge
+	lastSweep     *metrics.Gauge
+	lastDuration  *metrics.Gauge
+	channelsTotal *metrics.Gauge
+	channelsSwept *metrics.Gauge
+}
+
+func NewWorker(messages *repository.MessageRepository, rules *repository.RetentionRepository,
+	holds *legalhold.Holds, events events.Publisher, registry *metrics.Registry, settings configuration.RetentionSettings) *Worker {
+	if settings.BatchSize <= 0 || settings.BatchSize > defaultBatchSize {
+		settings.BatchSize = defaultBatchSize
+	}
+	return &Worker{
+		messages: *messages,
+		rules:    *rules,
+		holds:    holds,
+		events:   events,
+		settings: settings,
+
+		sweeps:        registry.Counter("message_retention_sweeps_total", "Retention sweeps started, dry runs included."),
+		deleted:       registry.Counter("message_retention_deleted_total", "Messages deleted for outliving their retention rule."),
+		failed:        registry.Counter("message_retention_failed_total", "Expired messages that could not be deleted."),
+		deferred:      registry.Counter("message_retention_deferred_total", "Expired messages kept for a legal hold."),
+		lastExpired:   registry.Gauge("message_retention_last_expired", "Expired messages found by the last sweep, deleted unless it was a dry run."),
+		lastSweep:     registry.Gauge("message_retention_last_sweep_timestamp_seconds", "Unix time the last sweep completed."),
+		lastDuration:  registry.Gauge("message_retention_last_sweep_duration_seconds", "How long the last sweep took."),
+		channelsTotal: registry.Gauge("message_retention_channels", "Channels with a retention rule in the current or last sweep."),
+		channelsSwept: registry.Gauge("message_retention_channels_swept", "Channels the current or last sweep is done with."),
+	}
+}
+
+// Run sweeps every interval of the settings until the process exits.
+func (worker *Worker) Run() {
+	if worker.settings.Interval <= 0 {
+		logger.LOG.Println("Retention worker disabled")
+		return
+	}
+	if err := worker.messages.IndexServers(); err != nil {
+		logger.ERROR.Println("Failed to index the messages by server:", err)
+	}
+
+	ticker := time.NewTicker(worker.settings.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := worker.Sweep(worker.settings.DryRun)
+		if err != nil {
+			logger.ERROR.Println("Retention sweep failed:", err)
+			continue
+		}
+		if report.DryRun {
+			logger.LOG.Printf("Retention dry run: %v messages in %v channels would be deleted\n", report.Expired, len(report.Channels))
+		} else {
+			logger.LOG.Printf("Retention sweep deleted %v messages in %v channels, %v failed, %v deferred by legal holds\n",
+				report.Expired-report.Failed, len(report.Channels), report.Failed, report.Deferred)
+		}
+	}
+}
+
+// Rules returns every retention rule, server rules first.
+func (worker *Worker) Rules() ([]*models.RetentionRule, error) {
+	rules, err := worker.rules.GetRules()
+	if rules == nil {
+		rules = []*models.RetentionRule{}
+	}
+	return rules, err
+}
+
+func (worker *Worker) SetRule(rule models.RetentionRule) error {
+	return worker.rules.SetRule(rule)
+}
+
+func (worker *Worker) DeleteRule(scope string, serverID string, targetID string) error {
+	return worker.rules.DeleteRule(scope, serverID, targetID)
+}
+
+// Sweep deletes every expired message, or with dryRun only reports them.
+func (worker *Worker) Sweep(dryRun bool) (models.RetentionReport, error) {
+	if !worker.running.TryLock() {
+		return models.RetentionReport{}, ErrSweepRunning
+	}
+	defer worker.running.Unlock()
+
+	report := models.RetentionReport{DryRun: dryRun, StartedAt: time.Now().UTC(), Channels: []models.RetentionChannel{}}
+	worker.sweeps.Add(1)
+	worker.channelsSwept.Set(0)
+
+	sweep, err := worker.plan()
+	if err != nil {
+		return report, err
+	}
+	worker.channelsTotal.Set(float64(len(sweep.channels)))
+
+	for _, serverID := range sortedKeys(sweep.servers) {
+		if err := worker.sweepLoose(sweep, serverID, sweep.servers[serverID], report.StartedAt, &report); err != nil {
+			return report, err
+		}
+	}
+
+	for i, key := range sortedKeys(sweep.channels) {
+		if err := worker.sweepChannel(sweep, sweep.channels[key], report.StartedAt, &report); err != nil {
+			return report, err
+		}
+		worker.channelsSwept.Set(float64(i + 1))
+	}
+
+	if !dryRun {
+		for _, held := range sweep.held {
+			worker.holds.Defer([]*models.LegalHold{held.hold}, models.DeferredRetention, held.channelID,
+				fmt.Sprintf("%v expired messages", held.messages))
+		}
+	}
+
+	report.CompletedAt = time.Now().UTC()
+	worker.lastExpired.Set(float64(report.Expired))
+	worker.lastSweep.Set(float64(report.CompletedAt.Unix()))
+	worker.lastDuration.Set(report.CompletedAt.Sub(report.StartedAt).Seconds())
+	return report, nil
+}
+
+type plan struct {
+	channels map[string]channelRule            // server ID/channel ID -> rule in effect
+	servers  map[string]models.RetentionPolicy // server ID -> rule of its messages without a channel
+	active   legalhold.Active
+	held     map[string]*heldMessages // hold ID/channel ID -> expired messages kept
+}
+
+// channelRule is the policy in effect for the messages of a server in a channel.
+type channelRule struct {
+	serverID  string
+	channelID string
+	policy    models.RetentionPolicy
+}
+
+type heldMessages struct {
+	hold      *models.LegalHold
+	channelID string
+	messages  int
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// plan finds the channels to sweep, server rules apply to every channel of
+// the server without a rule of its own.
+func (worker *Worker) plan() (plan, error) {
+	sweep := plan{
+		channels: make(map[string]channelRule),
+		servers:  make(map[string]models.RetentionPolicy),
+		held:     make(map[string]*heldMessages),
+	}
+
+	rules, err := worker.rules.GetRules()
+	if err != nil {
+		return sweep, err
+	}
+	if sweep.active, err = worker.holds.Active(); err != nil {
+		return sweep, err
+	}
+	for _, rule := range rules {
+		if rule.Scope == models.RetentionScopeServer {
+			sweep.servers[rule.TargetID] = rule.RetentionPolicy
+			continue
+		}
+		sweep.channels[rule.ServerID+"/"+rule.TargetID] = channelRule{
+			serverID: rule.ServerID, channelID: rule.TargetID, policy: rule.RetentionPolicy}
+	}
+
+	for serverID, policy := range sweep.servers {
+		channels, err := worker.messages.GetChannelsByServer(serverID)
+		if err != nil {
+			return sweep, err
+		}
+		for _, channelID := range channels {
+			key := serverID + "/" + channelID
+			if _, found := sweep.channels[key]; !found {
+				sweep.channels[key] = channelRule{serverID: serverID, channelID: channelID, policy: policy}
+			}
+		}
+	}
+	return sweep, nil
+}
+
+// sweepChannel pages through a channel newest first and expires every message
+// of the server past the age or count limit, one page per batch.
+func (worker *Worker) sweepChannel(sweep plan, rule channelRule, now time.Time, report *models.RetentionReport) error {
+	policy := rule.policy
+	if policy.MaxAgeSeconds == 0 && policy.MaxCount == 0 {
+		return nil
+	}
+
+	kept := 0
+	before := ""
+	for {
+		page, err := worker.messages.GetAllByChannelId(rule.channelID, models.Page{Before: before, Limit: worker.settings.BatchSize})
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		var batch []*models.Message
+		for i := len(page) - 1; i >= 0; i-- { // the page is ordered oldest first
+			if page[i].ServerID != rule.serverID {
+				continue
+			}
+			if expired(page[i], policy, now) || (policy.MaxCount > 0 && kept >= policy.MaxCount) {
+				batch = append(batch, page[i])
+				continue
+			}
+			kept++
+		}
+		if len(batch) > 0 {
+			worker.expire(sweep, batch, rule.channelID, rule.serverID, report)
+		}
+
+		if len(page) < worker.settings.BatchSize {
+			return nil
+		}
+		before = page[0].ID
+	}
+}
+
+// sweepLoose pages through the messages of a server without a channel from
+// the newest one past the age limit backwards, one page per batch.
+func (worker *Worker) sweepLoose(sweep plan, serverID string, policy models.RetentionPolicy, now time.Time, report *models.RetentionReport) error {
+	if policy.MaxAgeSeconds == 0 {
+		return nil
+	}
+
+	before := gocql.MinTimeUUID(now.Add(-time.Duration(policy.MaxAgeSeconds) * time.Second)).String()
+	for {
+		page, err := worker.messages.GetAllWithoutChannel(serverID, models.Page{Before: before, Limit: worker.settings.BatchSize})
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		var batch []*models.Message
+		for _, message := range page {
+			if expired(message, policy, now) {
+				batch = append(batch, message)
+			}
+		}
+		if len(batch) > 0 {
+			worker.expire(sweep, batch, "", serverID, report)
+		}
+
+		if len(page) < worker.settings.BatchSize {
+			return nil
+		}
+		before = page[0].ID
+	}
+}
+
+func expired(message *models.Message, policy models.RetentionPolicy, now time.Time) bool {
+	if policy.MaxAgeSeconds == 0 {
+		return false
+	}
+	created, valid := timeuuid.Time(message.ID)
+	return valid && now.Sub(created) > time.Duration(policy.MaxAgeSeconds)*time.Second
+}
+
+// expire deletes a batch of expired messages of a channel and adds it to the
+// report, the messages under a legal hold are only counted.
+func (worker *Worker) expire(sweep plan, batch []*models.Message, channelID string, serverID string, report *models.RetentionReport) {
+	expired := make([]*models.Message, 0, len(batch))
+	for _, message := range batch {
+		covering := sweep.active.Covering(*message)
+		if len(covering) == 0 {
+			expired = append(expired, message)
+			continue
+		}
+		for _, hold := range covering {
+			key := hold.ID + "/" + channelID
+			if sweep.held[key] == nil {
+				sweep.held[key] = &heldMessages{hold: hold, channelID: channelID}
+			}
+			sweep.held[key].messages++
+		}
+	}
+	deferred := len(batch) - len(expired)
+
+	report.Expired += len(expired)
+	report.Deferred += deferred
+	if i := len(report.Channels) - 1; i >= 0 && report.Channels[i].ChannelID == channelID && report.Channels[i].ServerID == serverID {
+		report.Channels[i].Expired += len(expired)
+		report.Channels[i].Deferred += deferred
+	} else {
+		report.Channels = append(report.Channels, models.RetentionChannel{
+			ChannelID: channelID, ServerID: serverID, Expired: len(expired), Deferred: deferred})
+	}
+	if report.DryRun {
+		return
+	}
+
+	worker.deferred.Add(deferred)
+	for _, message := range expired {
+		if err := worker.messages.Delete(*message); err != nil {
+			logger.WARN.Printf("Failed to delete expired message %v: %v\n", message.ID, err)
+			report.Failed++
+			worker.failed.Add(1)
+			continue
+		}
+		worker.events.Publish(events.New(events.MessageDeleted, *message))
+		worker.deleted.Add(1)
+	}
+}
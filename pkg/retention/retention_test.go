@@ -0,0 +1,170 @@
+package retention
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/legalhold"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWorker(batchSize int) (*Worker, repository.MessageRepository, *metrics.Registry) {
+	messages := repository.NewInMemoryMessageRepository()
+	rules := repository.NewInMemoryRetentionRepository()
+	holds := repository.NewInMemoryHoldRepository()
+	registry := metrics.NewRegistry()
+	worker := NewWorker(&messages, &rules, legalhold.NewHolds(&holds), events.Publishers{}, registry,
+		configuration.RetentionSettings{BatchSize: batchSize})
+	return worker, messages, registry
+}
+
+// save stores a message per age, oldest first.
+func save(t *testing.T, messages repository.MessageRepository, serverID string, channelID string, ages ...time.Duration) {
+	for _, age := range ages {
+		_, err := messages.Save(models.Message{
+			ID:        gocql.UUIDFromTime(time.Now().Add(-age)).String(),
+			UserID:    "user",
+			ServerID:  serverID,
+			ChannelID: channelID,
+			Message:   "hello",
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func count(messages repository.MessageRepository, channelID string) int {
+	page, _ := messages.GetAllByChannelId(channelID, models.Page{Limit: 100})
+	return len(page)
+}
+
+func TestMaxCount(t *testing.T) {
+	worker, messages, _ := newWorker(2)
+	save(t, messages, "server", "channel", 5*time.Hour, 4*time.Hour, 3*time.Hour, 2*time.Hour, time.Hour)
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeChannel, ServerID: "server", TargetID: "channel",
+		RetentionPolicy: models.RetentionPolicy{MaxCount: 3}})
+
+	report, err := worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Expired)
+	assert.Equal(t, 3, count(messages, "channel"))
+
+	// the oldest messages are the ones deleted
+	remaining, _ := messages.GetAllByChannelId("channel", models.Page{})
+	created, _ := gocql.ParseUUID(remaining[0].ID)
+	assert.WithinDuration(t, time.Now().Add(-3*time.Hour), created.Time(), time.Minute)
+}
+
+func TestMaxAgeOfServer(t *testing.T) {
+	worker, messages, _ := newWorker(100)
+	save(t, messages, "server", "first", 3*time.Hour, time.Minute)
+	save(t, messages, "server", "second", 3*time.Hour, 2*time.Hour)
+	save(t, messages, "server", "exempt", 3*time.Hour)
+	save(t, messages, "other", "unrelated", 3*time.Hour)
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeServer, TargetID: "server",
+		RetentionPolicy: models.RetentionPolicy{MaxAgeSeconds: int64(time.Hour.Seconds())}})
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeChannel, ServerID: "server", TargetID: "exempt"})
+
+	report, err := worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Expired)
+	assert.Equal(t, []models.RetentionChannel{
+		{ChannelID: "first", ServerID: "server", Expired: 1},
+		{ChannelID: "second", ServerID: "server", Expired: 2},
+	}, report.Channels)
+	assert.Equal(t, 1, count(messages, "first"))
+	assert.Equal(t, 0, count(messages, "second"))
+	assert.Equal(t, 1, count(messages, "exempt"))
+	assert.Equal(t, 1, count(messages, "unrelated"))
+}
+
+func TestMaxAgeOfMessagesWithoutChannel(t *testing.T) {
+	worker, messages, _ := newWorker(2)
+	save(t, messages, "server", "", 5*time.Hour, 4*time.Hour, 3*time.Hour, 2*time.Hour, 3*time.Minute, 2*time.Minute, time.Minute)
+	save(t, messages, "other", "", 3*time.Hour)
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeServer, TargetID: "server",
+		RetentionPolicy: models.RetentionPolicy{MaxAgeSeconds: int64(time.Hour.Seconds())}})
+
+	report, err := worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.RetentionChannel{{ServerID: "server", Expired: 4}}, report.Channels)
+	remaining, _ := messages.GetAllWithoutChannel("server", models.Page{})
+	assert.Len(t, remaining, 3)
+	remaining, _ = messages.GetAllWithoutChannel("other", models.Page{})
+	assert.Len(t, remaining, 1)
+}
+
+func TestChannelRuleOnlyAppliesToItsServer(t *testing.T) {
+	worker, messages, _ := newWorker(100)
+	save(t, messages, "server", "channel", 3*time.Hour, time.Minute)
+	save(t, messages, "other", "channel", 3*time.Hour)
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeChannel, ServerID: "other", TargetID: "channel",
+		RetentionPolicy: models.RetentionPolicy{MaxAgeSeconds: int64(time.Hour.Seconds())}})
+
+	report, err := worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.RetentionChannel{{ChannelID: "channel", ServerID: "other", Expired: 1}}, report.Channels)
+	assert.Equal(t, 2, count(messages, "channel"))
+	page, _ := messages.GetAllByChannelId("channel", models.Page{})
+	for _, message := range page {
+		assert.Equal(t, "server", message.ServerID)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	worker, messages, registry := newWorker(100)
+	save(t, messages, "server", "channel", 3*time.Hour, 2*time.Hour, time.Minute)
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeChannel, ServerID: "server", TargetID: "channel",
+		RetentionPolicy: models.RetentionPolicy{MaxAgeSeconds: int64(time.Hour.Seconds())}})
+
+	report, err := worker.Sweep(true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Expired)
+	assert.Equal(t, 3, count(messages, "channel"))
+
+	var output strings.Builder
+	assert.NoError(t, registry.Write(&output))
+	assert.Contains(t, output.String(), "message_retention_last_expired 2\n")
+	assert.Contains(t, output.String(), "message_retention_deleted_total 0\n")
+
+	_, err = worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count(messages, "channel"))
+	assert.Equal(t, int64(2), worker.deleted.Value())
+}
+
+func TestLegalHoldDefersRetention(t *testing.T) {
+	worker, messages, _ := newWorker(100)
+	save(t, messages, "server", "channel", 3*time.Hour, 2*time.Hour, time.Minute)
+	held, _ := messages.Save(models.Message{
+		ID: gocql.UUIDFromTime(time.Now().Add(-2 * time.Hour)).String(), UserID: "suspect", ServerID: "server", ChannelID: "channel",
+	})
+	worker.SetRule(models.RetentionRule{Scope: models.RetentionScopeServer, TargetID: "server",
+		RetentionPolicy: models.RetentionPolicy{MaxAgeSeconds: int64(time.Hour.Seconds())}})
+	hold, _ := worker.holds.Place(models.HoldRequest{Scope: models.HoldScopeUser, TargetID: "suspect", Reason: "case 42"}, "admin")
+
+	report, err := worker.Sweep(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Expired)
+	assert.Equal(t, 1, report.Deferred)
+	assert.Equal(t, 2, count(messages, "channel"))
+	_, err = messages.GetById(held.ID)
+	assert.NoError(t, err)
+
+	found, _ := worker.holds.Get(hold.ID)
+	assert.Len(t, found.Deferrals, 1)
+	assert.Equal(t, "channel", found.Deferrals[0].TargetID)
+	assert.Equal(t, "1 expired messages", found.Deferrals[0].Reason)
+
+	worker.holds.Release(hold.ID, "admin")
+	report, _ = worker.Sweep(false)
+	assert.Equal(t, 1, report.Expired)
+	assert.Equal(t, 1, count(messages, "channel"))
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	defaultLease    = time.Minute
+	maximumDelay    = 365 * 24 * time.Hour
+	maximumAttempts = 5 // before a message failing for a transient reason is given up
+)
+
+var (
+	ErrInvalidSendAt = fmt.Errorf("%w: send_at has to be in the future and at most a year ahead", repository.ErrInvalidArgument)
+	ErrNotFound      = fmt.Errorf("%w: no such scheduled message", repository.ErrNotFound)
+	ErrNotPending    = fmt.Errorf("%w: the message is no longer pending", repository.ErrConflict)
+	ErrNotText       = fmt.Errorf("%w: only text messages can be scheduled", repository.ErrInvalidArgument)
+	errUnreadable    = errors.New("the content can no longer be decrypted")
+)
+
+// Send saves a message the way SaveMessage does. Calls repeating a key
+// return the message saved by the first one.
+type Send func(key string, message models.Message) (*models.Message, error)
+
+// Scheduler sends scheduled messages once they are due. Everything it needs
+// is kept in storage, so a restarted instance carries on where it stopped.
+// Instances claim a message before sending it, only one of them wins the
+// claim. A claim outlives its instance for the lease, after which another
+// instance sends the message with the same idempotency key, which returns
+// the message if the stopped instance already sent it.
+type Scheduler struct {
+	repository repository.ScheduledRepository
+	send       Send
+	settings   configuration.SchedulerSettings
+	instance   string
+
+	sent   *metrics.Counter
+	failed *metrics.Counter
+}
+
+func NewScheduler(repository *repository.ScheduledRepository, send Send, registry *metrics.Registry,
+	settings configuration.SchedulerSettings) *Scheduler {
+	if settings.Lease <= 0 {
+		settings.Lease = defaultLease
+	}
+	return &Scheduler{
+		repository: *repository,
+		send:       send,
+		settings:   settings,
+		instance:   gocql.TimeUUID().String(),
+
+		sent:   registry.Counter("message_scheduled_sent_total", "Scheduled messages sent."),
+		failed: registry.Counter("message_scheduled_failed_total", "Scheduled messages given up on."),
+	}
+}
+
+// Schedule stores a message to be sent at its SendAt, the user scheduling it
+// is its author.
+func (scheduler *Scheduler) Schedule(request models.ScheduleRequest, scheduledBy string) (models.ScheduledMessage, error) {
+	if (request.Kind != "" && request.Kind != models.KindText) || request.Poll != nil {
+		return models.ScheduledMessage{}, ErrNotText
+	}
+	now := time.Now().UTC()
+	if !request.SendAt.After(now) || request.SendAt.After(now.Add(maximumDelay)) {
+		return models.ScheduledMessage{}, ErrInvalidSendAt
+	}
+
+	scheduled := models.ScheduledMessage{
+		ID:          gocql.TimeUUID().String(),
+		ServerID:    request.ServerID,
+		ChannelID:   request.ChannelID,
+		UserID:      scheduledBy,
+		Message:     request.Message.Message,
+		SendAt:      request.SendAt.UTC(),
+		Status:      models.ScheduledPending,
+		ScheduledBy: scheduledBy,
+		CreatedAt:   now,
+	}
+	return scheduled, scheduler.repository.SaveScheduled(scheduled)
+}
+
+func (scheduler *Scheduler) Get(serverID string, id string) (models.ScheduledMessage, error) {
+	scheduled, err := scheduler.repository.GetScheduled(serverID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ScheduledMessage{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ScheduledMessage{}, err
+	}
+	return *scheduled, nil
+}
+
+// List returns the scheduled messages of a server, the next one to be sent first.
+func (scheduler *Scheduler) List(serverID string) ([]*models.ScheduledMessage, error) {
+	scheduled, err := scheduler.repository.GetScheduledByServer(serverID)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(scheduled, func(a, b *models.ScheduledMessage) int { return a.SendAt.Compare(b.SendAt) })
+	if scheduled == nil {
+		scheduled = []*models.ScheduledMessage{}
+	}
+	return scheduled, nil
+}
+
+// Cancel keeps a pending message from being sent.
+func (scheduler *Scheduler) Cancel(serverID string, id string) (models.ScheduledMessage, error) {
+	scheduled, err := scheduler.Get(serverID, id)
+	if err != nil {
+		return scheduled, err
+	}
+	if scheduled.Status != models.ScheduledPending {
+		return scheduled, ErrNotPending
+	}
+
+	cancelled := scheduled
+	cancelled.Status = models.ScheduledCancelled
+	if err := scheduler.update(cancelled, scheduled); err != nil {
+		return scheduled, err
+	}
+	return cancelled, nil
+}
+
+// DeleteUser cancels the pending messages of a user whose messages are
+// deleted. Those being sent are left to finish, their content can no longer
+// be read once the key of the user is shredded.
+func (scheduler *Scheduler) DeleteUser(userID string) error {
+	scheduled, err := scheduler.repository.GetScheduledByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, item := range scheduled {
+		if item.Status != models.ScheduledPending {
+			continue
+		}
+		if _, err := scheduler.Cancel(item.ServerID, item.ID); err != nil && !errors.Is(err, ErrNotPending) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (scheduler *Scheduler) update(scheduled models.ScheduledMessage, expected models.ScheduledMessage) error {
+	updated, err := scheduler.repository.UpdateScheduled(scheduled, expected)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// Run sends due messages every interval of the settings until the process
+// exits, starting with those that came due while no instance was running.
+func (scheduler *Scheduler) Run() {
+	if scheduler.settings.Interval <= 0 {
+		logger.LOG.Println("Message scheduler disabled")
+		return
+	}
+
+	if err := scheduler.repository.Reindex(); err != nil {
+		logger.ERROR.Println("Failed to index the scheduled messages stored before the due index:", err)
+	}
+
+	ticker := time.NewTicker(scheduler.settings.Interval)
+	defer ticker.Stop()
+	for {
+		if sent := scheduler.Dispatch(time.Now().UTC()); sent > 0 {
+			logger.LOG.Printf("Sent %v scheduled messages\n", sent)
+		}
+		<-ticker.C
+	}
+}
+
+// Dispatch sends the messages due at now, including those claimed by an
+// instance whose lease ran out, and returns how many were sent.
+func (scheduler *Scheduler) Dispatch(now time.Time) int {
+	due, err := scheduler.due(now)
+	if err != nil {
+		logger.ERROR.Println("Failed to look up due scheduled messages:", err)
+		return 0
+	}
+
+	sent := 0
+	for _, scheduled := range due {
+		claimed := *scheduled
+		claimed.Status = models.ScheduledSending
+		claimed.ClaimedBy = scheduler.instance
+		claimed.ClaimedAt = &now
+		claimed.Attempts++
+		if err := scheduler.update(claimed, *scheduled); err != nil {
+			continue // another instance claimed it first
+		}
+		if scheduler.deliver(claimed, now) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// due returns the pending messages due at now and the claimed ones whose lease ran out.
+func (scheduler *Scheduler) due(now time.Time) ([]*models.ScheduledMessage, error) {
+	due, err := scheduler.repository.GetDue(now)
+	if err != nil {
+		return nil, err
+	}
+
+	due = slices.DeleteFunc(due, func(scheduled *models.ScheduledMessage) bool {
+		return scheduled.Status == models.ScheduledSending &&
+			scheduled.ClaimedAt != nil && !scheduled.ClaimedAt.Add(scheduler.settings.Lease).Before(now)
+	})
+	slices.SortStableFunc(due, func(a, b *models.ScheduledMessage) int { return a.SendAt.Compare(b.SendAt) })
+	return due, nil
+}
+
+// deliver sends a claimed message and records the outcome.
+func (scheduler *Scheduler) deliver(claimed models.ScheduledMessage, now time.Time) bool {
+	var message *models.Message
+	err := errUnreadable
+	if claimed.Message != "" { // empty once the key of its author was shredded
+		message, err = scheduler.send("scheduled:"+claimed.ID, models.Message{
+			UserID:    claimed.UserID,
+			ServerID:  claimed.ServerID,
+			ChannelID: claimed.ChannelID,
+			Message:   claimed.Message,
+		})
+	}
+
+	outcome := claimed
+	switch {
+	case err == nil:
+		outcome.Status = models.ScheduledSent
+		outcome.MessageID = message.ID
+		outcome.Error = ""
+		outcome.SentAt = &now
+		scheduler.sent.Add(1)
+	case err == errUnreadable || errors.Is(err, repository.ErrInvalidArgument) || claimed.Attempts >= maximumAttempts:
+		outcome.Status = models.ScheduledFailed
+		outcome.Error = err.Error()
+		scheduler.failed.Add(1)
+	default: // try again with the next dispatch
+		outcome.Status = models.ScheduledPending
+		outcome.ClaimedBy = ""
+		outcome.ClaimedAt = nil
+		outcome.Error = err.Error()
+	}
+
+	if updateErr := scheduler.update(outcome, claimed); updateErr != nil {
+		logger.WARN.Printf("Failed to record the outcome of scheduled message %v: %v\n", claimed.ID, updateErr)
+	}
+	if err != nil {
+		logger.WARN.Printf("Failed to send scheduled message %v: %v\n", claimed.ID, err)
+	}
+	return err == nil
+}
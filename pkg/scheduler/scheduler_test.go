@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"discard/message-service/pkg/configuration"
+	"discard/message-service/pkg/metrics"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+// outbox saves messages the way SaveMessage does with idempotency keys.
+type outbox struct {
+	mutex sync.Mutex
+	saved map[string]models.Message
+	sends int
+}
+
+func (outbox *outbox) send(key string, message models.Message) (*models.Message, error) {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	if saved, found := outbox.saved[key]; found {
+		return &saved, nil
+	}
+	message.ID = gocql.TimeUUID().String()
+	outbox.saved[key] = message
+	outbox.sends++
+	return &message, nil
+}
+
+func newScheduler(store *repository.ScheduledRepository, outbox *outbox) *Scheduler {
+	return NewScheduler(store, outbox.send, metrics.NewRegistry(), configuration.SchedulerSettings{Lease: time.Minute})
+}
+
+func request(sendAt time.Time) models.ScheduleRequest {
+	return models.ScheduleRequest{
+		Message: models.Message{UserID: "alice", ServerID: "server", ChannelID: "general", Message: "good morning"},
+		SendAt:  sendAt,
+	}
+}
+
+func TestScheduledMessagesAreSentOnce(t *testing.T) {
+	store := repository.NewInMemoryScheduledRepository()
+	sent := &outbox{saved: make(map[string]models.Message)}
+	first := newScheduler(&store, sent)
+	second := newScheduler(&store, sent) // another instance of the service
+
+	_, err := first.Schedule(request(time.Now().Add(-time.Second)), "alice")
+	assert.ErrorIs(t, err, ErrInvalidSendAt)
+
+	now := time.Now().UTC()
+	scheduled, err := first.Schedule(request(now.Add(time.Hour)), "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, first.Dispatch(now), "not due yet")
+
+	due := now.Add(2 * time.Hour)
+	assert.Equal(t, 1, first.Dispatch(due))
+	assert.Equal(t, 0, second.Dispatch(due))
+	assert.Equal(t, 1, sent.sends)
+
+	stored, err := second.Get("server", scheduled.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledSent, stored.Status)
+	assert.Equal(t, sent.saved["scheduled:"+scheduled.ID].ID, stored.MessageID)
+
+	_, err = first.Cancel("server", scheduled.ID)
+	assert.ErrorIs(t, err, ErrNotPending)
+}
+
+func TestCancelledMessagesAreNotSent(t *testing.T) {
+	store := repository.NewInMemoryScheduledRepository()
+	sent := &outbox{saved: make(map[string]models.Message)}
+	scheduler := newScheduler(&store, sent)
+
+	now := time.Now().UTC()
+	later, _ := scheduler.Schedule(request(now.Add(2*time.Hour)), "alice")
+	sooner, _ := scheduler.Schedule(request(now.Add(time.Hour)), "alice")
+
+	listed, err := scheduler.List("server")
+	assert.NoError(t, err)
+	if assert.Len(t, listed, 2) {
+		assert.Equal(t, sooner.ID, listed[0].ID)
+		assert.Equal(t, later.ID, listed[1].ID)
+	}
+
+	cancelled, err := scheduler.Cancel("server", sooner.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledCancelled, cancelled.Status)
+	_, err = scheduler.Cancel("server", "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Equal(t, 1, scheduler.Dispatch(now.Add(3*time.Hour)))
+	assert.Equal(t, "good morning", sent.saved["scheduled:"+later.ID].Message)
+	_, found := sent.saved["scheduled:"+sooner.ID]
+	assert.False(t, found)
+}
+
+func TestExpiredClaimsAreTakenOver(t *testing.T) {
+	store := repository.NewInMemoryScheduledRepository()
+	sent := &outbox{saved: make(map[string]models.Message)}
+	scheduler := newScheduler(&store, sent)
+
+	now := time.Now().UTC()
+	scheduled, _ := scheduler.Schedule(request(now.Add(time.Minute)), "alice")
+
+	// an instance claimed and sent the message, then stopped before recording it
+	stopped := scheduled
+	claimedAt := now.Add(2 * time.Minute)
+	stopped.Status = models.ScheduledSending
+	stopped.ClaimedBy = "stopped"
+	stopped.ClaimedAt = &claimedAt
+	stopped.Attempts = 1
+	updated, err := store.UpdateScheduled(stopped, scheduled)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	_, _ = sent.send("scheduled:"+scheduled.ID, models.Message{Message: "good morning"})
+
+	assert.Equal(t, 0, scheduler.Dispatch(claimedAt.Add(time.Second)), "the claim is still held")
+	assert.Equal(t, 1, scheduler.Dispatch(claimedAt.Add(2*time.Minute)))
+	assert.Equal(t, 1, sent.sends, "the message was not sent again")
+
+	stored, _ := scheduler.Get("server", scheduled.ID)
+	assert.Equal(t, models.ScheduledSent, stored.Status)
+	assert.Equal(t, 2, stored.Attempts)
+}
+
+func TestPendingMessagesOfDeletedUsersAreCancelled(t *testing.T) {
+	store := repository.NewInMemoryScheduledRepository()
+	sent := &outbox{saved: make(map[string]models.Message)}
+	scheduler := newScheduler(&store, sent)
+
+	now := time.Now().UTC()
+	deleted, _ := scheduler.Schedule(request(now.Add(time.Hour)), "alice")
+	other := request(now.Add(time.Hour))
+	other.UserID = "bob"
+	kept, _ := scheduler.Schedule(other, "bob")
+
+	assert.NoError(t, scheduler.DeleteUser("alice"))
+	assert.NoError(t, scheduler.DeleteUser("alice"), "nothing is left to cancel")
+
+	stored, _ := scheduler.Get("server", deleted.ID)
+	assert.Equal(t, models.ScheduledCancelled, stored.Status)
+	assert.Equal(t, 1, scheduler.Dispatch(now.Add(2*time.Hour)))
+	_, found := sent.saved["scheduled:"+kept.ID]
+	assert.True(t, found)
+}
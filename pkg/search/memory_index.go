@@ -0,0 +1,198 @@
+package search
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/timeuuid"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// memoryIndex is an inverted index held in memory, it maps every term to the
+// positions it occurs at in each message.
+type memoryIndex struct {
+	mutex    sync.RWMutex
+	postings map[string]map[string][]int // term -> message ID -> positions
+	messages map[string]indexedMessage
+}
+
+type indexedMessage struct {
+	message models.Message
+	tokens  []token
+}
+
+func NewInMemoryIndex() SearchIndex {
+	return &memoryIndex{
+		postings: make(map[string]map[string][]int),
+		messages: make(map[string]indexedMessage),
+	}
+}
+
+func (index *memoryIndex) Index(message models.Message) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.remove(message.ID)
+	tokens := tokenize(message.Message)
+	index.messages[message.ID] = indexedMessage{message: message, tokens: tokens}
+	for _, token := range tokens {
+		if index.postings[token.term] == nil {
+			index.postings[token.term] = make(map[string][]int)
+		}
+		index.postings[token.term][message.ID] = append(index.postings[token.term][message.ID], token.position)
+	}
+	return nil
+}
+
+func (index *memoryIndex) Remove(messageID string) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.remove(messageID)
+	return nil
+}
+
+func (index *memoryIndex) RemoveUser(userID string) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	for messageID, indexed := range index.messages {
+		if indexed.message.UserID == userID {
+			index.remove(messageID)
+		}
+	}
+	return nil
+}
+
+// remove drops a message from the index, the caller holds the lock.
+func (index *memoryIndex) remove(messageID string) {
+	indexed, found := index.messages[messageID]
+	if !found {
+		return
+	}
+	for _, token := range indexed.tokens {
+		delete(index.postings[token.term], messageID)
+		if len(index.postings[token.term]) == 0 {
+			delete(index.postings, token.term)
+		}
+	}
+	delete(index.messages, messageID)
+}
+
+func (index *memoryIndex) Search(query Query) ([]models.SearchHit, error) {
+	clauses := query.clauses()
+	if len(clauses) == 0 {
+		return []models.SearchHit{}, nil
+	}
+
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	// start from the rarest term so the candidate set is as small as possible
+	rarest := clauses[0][0]
+	for _, clause := range clauses {
+		for _, term := range clause {
+			if len(index.postings[term]) < len(index.postings[rarest]) {
+				rarest = term
+			}
+		}
+	}
+
+	var hits []models.SearchHit
+	for messageID := range index.postings[rarest] {
+		indexed := index.messages[messageID]
+		if !query.matches(indexed.message) {
+			continue
+		}
+
+		var highlights []token
+		for _, clause := range clauses {
+			found := index.phrase(clause, messageID, indexed.tokens)
+			if found == nil {
+				highlights = nil
+				break
+			}
+			highlights = append(highlights, found...)
+		}
+		if highlights == nil {
+			continue
+		}
+
+		hits = append(hits, models.SearchHit{
+			Message:     indexed.message,
+			Highlighted: highlight(indexed.message.Message, highlights),
+		})
+	}
+
+	slices.SortFunc(hits, func(a models.SearchHit, b models.SearchHit) int {
+		return timeuuid.Compare(b.Message.ID, a.Message.ID)
+	})
+	if len(hits) > query.limit() {
+		hits = hits[:query.limit()]
+	}
+	if hits == nil {
+		hits = []models.SearchHit{}
+	}
+	return hits, nil
+}
+
+// phrase returns the tokens of every occurrence of the phrase in a message,
+// nil if it does not occur.
+func (index *memoryIndex) phrase(phrase []string, messageID string, tokens []token) []token {
+	var found []token
+	for _, start := range index.postings[phrase[0]][messageID] {
+		if start+len(phrase) > len(tokens) {
+			continue
+		}
+		matches := true
+		for offset, term := range phrase[1:] {
+			if tokens[start+offset+1].term != term {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, tokens[start:start+len(phrase)]...)
+		}
+	}
+	return found
+}
+
+func (query Query) matches(message models.Message) bool {
+	switch {
+	case query.CanAccess == nil || !query.CanAccess(message.ServerID):
+		return false
+	case query.ServerID != "" && message.ServerID != query.ServerID:
+		return false
+	case query.ChannelID != "" && message.ChannelID != query.ChannelID:
+		return false
+	case query.AuthorID != "" && message.UserID != query.AuthorID:
+		return false
+	case query.Before != "" && timeuuid.Compare(message.ID, query.Before) >= 0:
+		return false
+	case query.After != "" && timeuuid.Compare(message.ID, query.After) <= 0:
+		return false
+	}
+	return true
+}
+
+// highlight HTML escapes text and wraps the matched tokens in <mark> tags.
+func highlight(text string, tokens []token) string {
+	slices.SortFunc(tokens, func(a token, b token) int { return a.start - b.start })
+
+	var builder strings.Builder
+	offset := 0
+	for _, token := range tokens {
+		if token.start < offset { // the same word matched by several clauses
+			continue
+		}
+		builder.WriteString(html.EscapeString(text[offset:token.start]))
+		builder.WriteString("<mark>")
+		builder.WriteString(html.EscapeString(text[token.start:token.end]))
+		builder.WriteString("</mark>")
+		offset = token.end
+	}
+	builder.WriteString(html.EscapeString(text[offset:]))
+	return builder.String()
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	DefaultLimit = 25
+	MaximumLimit = 100
+)
+
+// SearchIndex finds messages by their content. Implementations are kept up to
+// date through Indexer, so they never have to read the message storage.
+type SearchIndex interface {
+	Index(message models.Message) error
+	Remove(messageID string) error
+	// RemoveUser drops every message written by the user.
+	RemoveUser(userID string) error
+	Search(query Query) ([]models.SearchHit, error)
+}
+
+// Query selects the messages containing every term and phrase of Text.
+// Results are ordered newest first and only contain messages of servers
+// CanAccess allows, which is required.
+type Query struct {
+	Text      string
+	ServerID  string
+	ChannelID string
+	AuthorID  string
+	Before    string // message ID
+	After     string // message ID
+	Limit     int
+	CanAccess func(serverID string) bool
+}
+
+func (query Query) limit() int {
+	if query.Limit <= 0 {
+		return DefaultLimit
+	}
+	if query.Limit > MaximumLimit {
+		return MaximumLimit
+	}
+	return query.Limit
+}
+
+// clauses parses the query text into the phrases every hit has to contain.
+// Words outside of double quotes are phrases of their own.
+func (query Query) clauses() [][]string {
+	var clauses [][]string
+	for i, part := range strings.Split(query.Text, `"`) {
+		tokens := tokenize(part)
+		if i%2 == 1 { // inside quotes
+			if len(tokens) > 0 {
+				phrase := make([]string, 0, len(tokens))
+				for _, token := range tokens {
+					phrase = append(phrase, token.term)
+				}
+				clauses = append(clauses, phrase)
+			}
+			continue
+		}
+		for _, token := range tokens {
+			clauses = append(clauses, []string{token.term})
+		}
+	}
+	return clauses
+}
+
+// Valid reports whether the text contains anything to search for.
+func Valid(text string) bool {
+	return strings.IndexFunc(text, func(character rune) bool {
+		return unicode.IsLetter(character) || unicode.IsDigit(character)
+	}) >= 0
+}
+
+// Indexer keeps an index in sync with the message events.
+type Indexer struct {
+	index SearchIndex
+
+	mutex sync.Mutex
+	// what changed while rebuilding, nil otherwise. The rebuild read those
+	// messages earlier, so its copy may be stale.
+	touched map[string]bool // message ID
+	erased  map[string]bool // user ID
+}
+
+func NewIndexer(index SearchIndex) *Indexer {
+	return &Indexer{index: index}
+}
+
+func (indexer *Indexer) Publish(event events.Event) {
+	indexer.mutex.Lock()
+	if indexer.touched != nil {
+		if event.Type == events.UserErased {
+			indexer.erased[event.Message.UserID] = true
+		} else {
+			indexer.touched[event.Message.ID] = true
+		}
+	}
+	indexer.mutex.Unlock()
+
+	var err error
+	switch event.Type {
+	case events.MessageCreated, events.MessageUpdated:
+		err = indexer.index.Index(event.Message)
+	case events.MessageDeleted:
+		err = indexer.index.Remove(event.Message.ID)
+	case events.UserErased:
+		err = indexer.index.RemoveUser(event.Message.UserID)
+	}
+	if err != nil {
+		logger.WARN.Printf("Failed to index message %v: %v\n", event.Message.ID, err)
+	}
+}
+
+// Rebuild indexes every stored message, forEach is typically
+// MessageRepository.ForEach. Messages changed while it runs and the messages
+// of users erased meanwhile keep what the events made of them.
+func (indexer *Indexer) Rebuild(forEach func(func(*models.Message) error) error) error {
+	indexer.mutex.Lock()
+	indexer.touched = make(map[string]bool)
+	indexer.erased = make(map[string]bool)
+	indexer.mutex.Unlock()
+
+	defer func() {
+		indexer.mutex.Lock()
+		indexer.touched, indexer.erased = nil, nil
+		indexer.mutex.Unlock()
+	}()
+
+	return forEach(func(message *models.Message) error {
+		indexer.mutex.Lock()
+		defer indexer.mutex.Unlock()
+		if indexer.touched[message.ID] || indexer.erased[message.UserID] {
+			return nil
+		}
+		return indexer.index.Index(*message)
+	})
+}
@@ -0,0 +1,184 @@
+package search
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	for word, expected := range map[string]string{
+		"caresses":    "caress",
+		"ponies":      "poni",
+		"cats":        "cat",
+		"agreed":      "agre",
+		"hopping":     "hop",
+		"filing":      "file",
+		"happy":       "happi",
+		"relational":  "relat",
+		"deployments": "deploy",
+		"connections": "connect",
+		"running":     "run",
+		"runs":        "run",
+		"go":          "go",
+		"café":        "café",
+	} {
+		assert.Equal(t, expected, stem(word), word)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Hello, World! it's 2024")
+
+	var terms []string
+	for _, token := range tokens {
+		terms = append(terms, token.term)
+	}
+	assert.Equal(t, []string{"hello", "world", "it", "s", "2024"}, terms)
+	assert.Equal(t, "World", "Hello, World! it's 2024"[tokens[1].start:tokens[1].end])
+}
+
+type testIndex struct {
+	SearchIndex
+	ids []string
+}
+
+func newTestIndex(texts ...string) testIndex {
+	index := testIndex{SearchIndex: NewInMemoryIndex()}
+	for _, text := range texts {
+		id := gocql.TimeUUID().String()
+		index.ids = append(index.ids, id)
+		index.Index(models.Message{ID: id, UserID: "user", ServerID: "server", ChannelID: "channel", Message: text})
+	}
+	return index
+}
+
+func allowAll(string) bool { return true }
+
+func texts(hits []models.SearchHit) []string {
+	var found []string
+	for _, hit := range hits {
+		found = append(found, hit.Message.Message)
+	}
+	return found
+}
+
+func TestSearchMatchesStemmedTermsNewestFirst(t *testing.T) {
+	index := newTestIndex("we are connected", "two connections dropped", "lunch time")
+
+	hits, err := index.Search(Query{Text: "Connecting", CanAccess: allowAll})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"two connections dropped", "we are connected"}, texts(hits))
+	assert.Equal(t, "two <mark>connections</mark> dropped", hits[0].Highlighted)
+}
+
+func TestSearchPhrases(t *testing.T) {
+	index := newTestIndex("new release today", "release a new build", "<b>new release</b>")
+
+	hits, _ := index.Search(Query{Text: `"new release"`, CanAccess: allowAll})
+	assert.Equal(t, []string{"<b>new release</b>", "new release today"}, texts(hits))
+	assert.Equal(t, "&lt;b&gt;<mark>new</mark> <mark>release</mark>&lt;/b&gt;", hits[0].Highlighted)
+
+	hits, _ = index.Search(Query{Text: `build "a new"`, CanAccess: allowAll})
+	assert.Equal(t, []string{"release a new build"}, texts(hits))
+}
+
+func TestSearchFilters(t *testing.T) {
+	index := newTestIndex("hello one", "hello two", "hello three")
+	index.Index(models.Message{ID: gocql.TimeUUID().String(), ServerID: "private", Message: "hello secret"})
+
+	hits, _ := index.Search(Query{Text: "hello", CanAccess: func(server string) bool { return server == "server" }})
+	assert.Equal(t, []string{"hello three", "hello two", "hello one"}, texts(hits))
+
+	hits, _ = index.Search(Query{Text: "hello", Before: index.ids[2], After: index.ids[0], CanAccess: allowAll})
+	assert.Equal(t, []string{"hello two"}, texts(hits))
+
+	hits, _ = index.Search(Query{Text: "hello", Limit: 1, CanAccess: allowAll})
+	assert.Len(t, hits, 1)
+
+	hits, _ = index.Search(Query{Text: "hello", AuthorID: "somebody else", CanAccess: allowAll})
+	assert.Empty(t, hits)
+
+	hits, _ = index.Search(Query{Text: "hello"})
+	assert.Empty(t, hits, "without an authorization check nothing is visible")
+}
+
+func TestIndexerFollowsEvents(t *testing.T) {
+	index := NewInMemoryIndex()
+	indexer := NewIndexer(index)
+	message := models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", Message: "first draft"}
+
+	indexer.Publish(events.New(events.MessageCreated, message))
+	message.Message = "final version"
+	indexer.Publish(events.New(events.MessageUpdated, message))
+
+	hits, _ := index.Search(Query{Text: "draft", CanAccess: allowAll})
+	assert.Empty(t, hits)
+	hits, _ = index.Search(Query{Text: "final", CanAccess: allowAll})
+	assert.Len(t, hits, 1)
+
+	indexer.Publish(events.New(events.MessageDeleted, message))
+	hits, _ = index.Search(Query{Text: "final", CanAccess: allowAll})
+	assert.Empty(t, hits)
+}
+
+func TestIndexerForgetsErasedUsers(t *testing.T) {
+	index := newTestIndex("hello one", "hello two")
+	index.Index(models.Message{ID: gocql.TimeUUID().String(), UserID: "other", ServerID: "server", Message: "hello three"})
+
+	NewIndexer(index).Publish(events.New(events.UserErased, models.Message{UserID: "user"}))
+	hits, _ := index.Search(Query{Text: "hello", CanAccess: allowAll})
+	assert.Equal(t, []string{"hello three"}, texts(hits))
+}
+
+func TestRebuildKeepsMessagesChangedMeanwhile(t *testing.T) {
+	index := NewInMemoryIndex()
+	indexer := NewIndexer(index)
+	updated := models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", Message: "original words"}
+	deleted := models.Message{ID: gocql.TimeUUID().String(), ServerID: "server", Message: "removed words"}
+
+	assert.NoError(t, indexer.Rebuild(func(each func(*models.Message) error) error {
+		stale := []models.Message{updated, deleted}
+		// the copies were read before the events arrived
+		anonymized := updated
+		anonymized.Message = "tombstone"
+		indexer.Publish(events.New(events.MessageUpdated, anonymized))
+		indexer.Publish(events.New(events.MessageDeleted, deleted))
+		for i := range stale {
+			if err := each(&stale[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	hits, _ := index.Search(Query{Text: "words", CanAccess: allowAll})
+	assert.Empty(t, hits)
+	hits, _ = index.Search(Query{Text: "tombstone", CanAccess: allowAll})
+	assert.Len(t, hits, 1)
+}
+
+func TestRebuildSkipsUsersErasedMeanwhile(t *testing.T) {
+	index := NewInMemoryIndex()
+	indexer := NewIndexer(index)
+	erased := models.Message{ID: gocql.TimeUUID().String(), UserID: "erased", ServerID: "server", Message: "secret words"}
+	kept := models.Message{ID: gocql.TimeUUID().String(), UserID: "other", ServerID: "server", Message: "public words"}
+
+	assert.NoError(t, indexer.Rebuild(func(each func(*models.Message) error) error {
+		// the rows were read and decrypted before the key was shredded
+		stale := []models.Message{erased, kept}
+		indexer.Publish(events.New(events.UserErased, models.Message{UserID: "erased"}))
+		for i := range stale {
+			if err := each(&stale[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	hits, _ := index.Search(Query{Text: "words", CanAccess: allowAll})
+	assert.Equal(t, []string{"public words"}, texts(hits))
+}
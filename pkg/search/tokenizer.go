@@ -0,0 +1,243 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a normalized word of a text together with where it was found.
+type token struct {
+	term     string
+	position int // index of the word within the text
+	start    int // byte offsets into the original text
+	end      int
+}
+
+// tokenize splits text into lower cased, stemmed words. Anything that is not
+// a letter or a digit separates words.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for offset, character := range text + " " {
+		if unicode.IsLetter(character) || unicode.IsDigit(character) {
+			if start < 0 {
+				start = offset
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{
+				term:     stem(strings.ToLower(text[start:offset])),
+				position: len(tokens),
+				start:    start,
+				end:      offset,
+			})
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// stem reduces an English word to its stem with the Porter algorithm, other
+// words are returned as they are.
+func stem(word string) string {
+	if len(word) <= 2 || utf8.RuneCountInString(word) != len(word) {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	stemmer := &porter{word: []byte(word)}
+	stemmer.step1a()
+	stemmer.step1b()
+	stemmer.step1c()
+	stemmer.replaceSuffix(step2, 0)
+	stemmer.replaceSuffix(step3, 0)
+	stemmer.step4()
+	stemmer.step5()
+	return string(stemmer.word)
+}
+
+type porter struct {
+	word []byte
+}
+
+func (stemmer *porter) consonant(i int) bool {
+	switch stemmer.word[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !stemmer.consonant(i-1)
+	}
+	return true
+}
+
+// measure counts the vowel consonant sequences of the first length letters.
+func (stemmer *porter) measure(length int) int {
+	count := 0
+	vowel := false
+	for i := 0; i < length; i++ {
+		if stemmer.consonant(i) {
+			if vowel {
+				count++
+			}
+			vowel = false
+		} else {
+			vowel = true
+		}
+	}
+	return count
+}
+
+func (stemmer *porter) hasVowel(length int) bool {
+	for i := 0; i < length; i++ {
+		if !stemmer.consonant(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (stemmer *porter) doubleConsonant(length int) bool {
+	return length >= 2 && stemmer.word[length-1] == stemmer.word[length-2] && stemmer.consonant(length-1)
+}
+
+// cvc reports whether the first length letters end consonant vowel consonant,
+// where the last consonant is not w, x or y.
+func (stemmer *porter) cvc(length int) bool {
+	if length < 3 || !stemmer.consonant(length-1) || stemmer.consonant(length-2) || !stemmer.consonant(length-3) {
+		return false
+	}
+	last := stemmer.word[length-1]
+	return last != 'w' && last != 'x' && last != 'y'
+}
+
+func (stemmer *porter) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(stemmer.word), suffix)
+}
+
+func (stemmer *porter) setSuffix(suffix string, replacement string) {
+	stemmer.word = append(stemmer.word[:len(stemmer.word)-len(suffix)], replacement...)
+}
+
+func (stemmer *porter) step1a() {
+	switch {
+	case stemmer.hasSuffix("sses"):
+		stemmer.setSuffix("sses", "ss")
+	case stemmer.hasSuffix("ies"):
+		stemmer.setSuffix("ies", "i")
+	case stemmer.hasSuffix("ss"):
+	case stemmer.hasSuffix("s"):
+		stemmer.setSuffix("s", "")
+	}
+}
+
+func (stemmer *porter) step1b() {
+	if stemmer.hasSuffix("eed") {
+		if stemmer.measure(len(stemmer.word)-3) > 0 {
+			stemmer.setSuffix("eed", "ee")
+		}
+		return
+	}
+
+	removed := false
+	for _, suffix := range []string{"ed", "ing"} {
+		if stemmer.hasSuffix(suffix) && stemmer.hasVowel(len(stemmer.word)-len(suffix)) {
+			stemmer.setSuffix(suffix, "")
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return
+	}
+
+	length := len(stemmer.word)
+	switch {
+	case stemmer.hasSuffix("at"), stemmer.hasSuffix("bl"), stemmer.hasSuffix("iz"):
+		stemmer.word = append(stemmer.word, 'e')
+	case stemmer.doubleConsonant(length):
+		if last := stemmer.word[length-1]; last != 'l' && last != 's' && last != 'z' {
+			stemmer.word = stemmer.word[:length-1]
+		}
+	case stemmer.measure(length) == 1 && stemmer.cvc(length):
+		stemmer.word = append(stemmer.word, 'e')
+	}
+}
+
+func (stemmer *porter) step1c() {
+	if stemmer.hasSuffix("y") && stemmer.hasVowel(len(stemmer.word)-1) {
+		stemmer.setSuffix("y", "i")
+	}
+}
+
+// Suffix rules of steps 2 and 3, only the first matching suffix is considered.
+var (
+	step2 = [][2]string{
+		{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+		{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+		{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+		{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+		{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	}
+	step3 = [][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+		{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	}
+	step4 = []string{
+		"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+		"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+	}
+)
+
+// replaceSuffix applies the first rule matching the word when the remaining
+// stem has a measure above minimum.
+func (stemmer *porter) replaceSuffix(rules [][2]string, minimum int) {
+	for _, rule := range rules {
+		if stemmer.hasSuffix(rule[0]) {
+			if stemmer.measure(len(stemmer.word)-len(rule[0])) > minimum {
+				stemmer.setSuffix(rule[0], rule[1])
+			}
+			return
+		}
+	}
+}
+
+func (stemmer *porter) step4() {
+	longest := ""
+	for _, suffix := range step4 {
+		if stemmer.hasSuffix(suffix) && len(suffix) > len(longest) {
+			longest = suffix
+		}
+	}
+	if longest == "" {
+		return
+	}
+
+	length := len(stemmer.word) - len(longest)
+	if stemmer.measure(length) <= 1 {
+		return
+	}
+	if longest == "ion" && (length == 0 || (stemmer.word[length-1] != 's' && stemmer.word[length-1] != 't')) {
+		return
+	}
+	stemmer.word = stemmer.word[:length]
+}
+
+func (stemmer *porter) step5() {
+	if stemmer.hasSuffix("e") {
+		length := len(stemmer.word) - 1
+		if measure := stemmer.measure(length); measure > 1 || (measure == 1 && !stemmer.cvc(length)) {
+			stemmer.word = stemmer.word[:length]
+		}
+	}
+
+	length := len(stemmer.word)
+	if stemmer.word[length-1] == 'l' && stemmer.doubleConsonant(length) && stemmer.measure(length) > 1 {
+		stemmer.word = stemmer.word[:length-1]
+	}
+}
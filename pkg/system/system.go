@@ -0,0 +1,66 @@
+package system
+
+import (
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"fmt"
+)
+
+const (
+	// MembershipQueue carries the members joining and leaving servers
+	MembershipQueue = "server-membership-events"
+	// ChannelQueue carries the channels created and renamed
+	ChannelQueue = "channel-events"
+)
+
+var ErrInvalidEvent = fmt.Errorf("%w: invalid system event", repository.ErrInvalidArgument)
+
+// Render turns an event into the system message announcing it in its
+// channel. Users and channels are written as mentions for clients to show
+// their names, they are not parsed, so nobody is notified.
+func Render(event models.SystemEvent) (models.Message, error) {
+	system := event.System
+	switch system.Type {
+	case models.SystemMemberJoined, models.SystemMemberLeft, models.SystemMemberKicked, models.SystemMemberBanned:
+		if system.UserID == "" {
+			return models.Message{}, fmt.Errorf("%w: %v needs the member", ErrInvalidEvent, system.Type)
+		}
+	}
+
+	var content string
+	switch system.Type {
+	case models.SystemMemberJoined:
+		content = fmt.Sprintf("<@%v> joined the server.", system.UserID)
+	case models.SystemMemberLeft:
+		content = fmt.Sprintf("<@%v> left the server.", system.UserID)
+	case models.SystemMemberKicked:
+		content = fmt.Sprintf("<@%v> was removed from the server", system.UserID) + by(system.ActorID)
+	case models.SystemMemberBanned:
+		content = fmt.Sprintf("<@%v> was banned from the server", system.UserID) + by(system.ActorID)
+	case models.SystemChannelCreated:
+		content = fmt.Sprintf("The channel <#%v> was created", event.ChannelID) + by(system.ActorID)
+	case models.SystemChannelRenamed:
+		if system.Name == "" {
+			return models.Message{}, fmt.Errorf("%w: a renamed channel needs its new name", ErrInvalidEvent)
+		}
+		content = fmt.Sprintf("The channel was renamed to %v", system.Name) + by(system.ActorID)
+	default:
+		return models.Message{}, fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, system.Type)
+	}
+
+	return models.Message{
+		UserID:    models.SystemUserID,
+		ServerID:  event.ServerID,
+		ChannelID: event.ChannelID,
+		Message:   content,
+		Kind:      models.KindSystem,
+		System:    &system,
+	}, nil
+}
+
+func by(actorID string) string {
+	if actorID == "" {
+		return "."
+	}
+	return fmt.Sprintf(" by <@%v>.", actorID)
+}
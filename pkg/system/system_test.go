@@ -0,0 +1,47 @@
+package system
+
+import (
+	"discard/message-service/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func event(system models.System) models.SystemEvent {
+	return models.SystemEvent{ID: "event", ServerID: "server", ChannelID: "general", System: system}
+}
+
+func TestRender(t *testing.T) {
+	for _, test := range []struct {
+		system  models.System
+		content string
+	}{
+		{models.System{Type: models.SystemMemberJoined, UserID: "alice"}, "<@alice> joined the server."},
+		{models.System{Type: models.SystemMemberLeft, UserID: "alice"}, "<@alice> left the server."},
+		{models.System{Type: models.SystemMemberKicked, UserID: "alice", ActorID: "bob"}, "<@alice> was removed from the server by <@bob>."},
+		{models.System{Type: models.SystemMemberBanned, UserID: "alice"}, "<@alice> was banned from the server."},
+		{models.System{Type: models.SystemChannelCreated, ActorID: "bob"}, "The channel <#general> was created by <@bob>."},
+		{models.System{Type: models.SystemChannelRenamed, Name: "lounge"}, "The channel was renamed to lounge."},
+	} {
+		message, err := Render(event(test.system))
+		assert.NoError(t, err)
+		assert.Equal(t, test.content, message.Message)
+		assert.Equal(t, models.KindSystem, message.Kind)
+		assert.Equal(t, models.SystemUserID, message.UserID)
+		assert.Equal(t, "general", message.ChannelID)
+		assert.Equal(t, test.system, *message.System)
+		assert.Equal(t, models.Mentions{}, message.Mentions, "nobody is notified")
+	}
+}
+
+func TestRenderRefusesIncompleteEvents(t *testing.T) {
+	for _, system := range []models.System{
+		{Type: models.SystemMemberJoined},
+		{Type: models.SystemMemberKicked, ActorID: "bob"},
+		{Type: models.SystemChannelRenamed, ActorID: "bob"},
+		{Type: "member_promoted", UserID: "alice"},
+	} {
+		_, err := Render(event(system))
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+	}
+}
@@ -0,0 +1,46 @@
+package timeuuid
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Time returns the timestamp of a version 1 UUID such as the message IDs.
+func Time(id string) (time.Time, bool) {
+	uuid, err := gocql.ParseUUID(id)
+	if err != nil || uuid.Version() != 1 {
+		return time.Time{}, false
+	}
+	return uuid.Time(), true
+}
+
+// Compare orders time UUIDs the way Cassandra orders a timeuuid column, by
+// time first and by their bytes second. Invalid IDs sort before valid ones.
+func Compare(a string, b string) int {
+	first, errA := gocql.ParseUUID(a)
+	second, errB := gocql.ParseUUID(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+
+	if first.Time().Before(second.Time()) {
+		return -1
+	}
+	if first.Time().After(second.Time()) {
+		return 1
+	}
+	return bytes.Compare(first.Bytes(), second.Bytes())
+}
+
+// Valid reports whether id is a version 1 UUID.
+func Valid(id string) bool {
+	_, valid := Time(id)
+	return valid
+}
@@ -0,0 +1,108 @@
+package unread
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/models/logger"
+	"discard/message-service/pkg/repository"
+	"discard/message-service/pkg/timeuuid"
+	"fmt"
+	"time"
+)
+
+// MaximumUnread is as far as the messages of a channel are counted, clients
+// show more as e.g. 99+.
+const MaximumUnread = 100
+
+var ErrInvalidMarker = fmt.Errorf("%w: the read marker has to be a message ID", repository.ErrInvalidArgument)
+
+// ReadStates keeps the read marker of every user in the channels they read.
+// Unread counts are taken from the channel history when asked for, so they
+// follow every created and deleted message without any bookkeeping. It
+// receives the message events to mark the messages of their authors read.
+type ReadStates struct {
+	repository repository.ReadStateRepository
+	messages   repository.MessageRepository
+}
+
+func NewReadStates(repository *repository.ReadStateRepository, messages *repository.MessageRepository) *ReadStates {
+	return &ReadStates{
+		repository: *repository,
+		messages:   *messages,
+	}
+}
+
+// Ack moves the read marker of a user in a channel forward to the message,
+// a marker already past it is kept.
+func (states *ReadStates) Ack(userID string, serverID string, channelID string, ack models.Ack) (models.ReadState, error) {
+	if !timeuuid.Valid(ack.MessageID) {
+		return models.ReadState{}, ErrInvalidMarker
+	}
+
+	return states.advance(models.ReadState{
+		UserID:     userID,
+		ServerID:   serverID,
+		ChannelID:  channelID,
+		LastReadID: ack.MessageID,
+		UpdatedAt:  time.Now().UTC(),
+	})
+}
+
+// advance saves the read state unless the marker of the user in the channel
+// is already at or past it, which is returned instead.
+func (states *ReadStates) advance(state models.ReadState) (models.ReadState, error) {
+	current, err := states.repository.GetReadStates(state.UserID)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	for _, read := range current {
+		if read.ChannelID == state.ChannelID && timeuuid.Compare(read.LastReadID, state.LastReadID) >= 0 {
+			return *read, nil
+		}
+	}
+	return state, states.repository.SetReadState(state)
+}
+
+// Unread counts the unread messages and mentions in every channel the user
+// has read before.
+func (states *ReadStates) Unread(userID string) ([]*models.Unread, error) {
+	current, err := states.repository.GetReadStates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := []*models.Unread{}
+	for _, state := range current {
+		unread, err := states.messages.CountUnread(state.ChannelID, state.LastReadID, userID, MaximumUnread)
+		if err != nil {
+			return nil, err
+		}
+		unread.ServerID = state.ServerID
+		counts = append(counts, &unread)
+	}
+	return counts, nil
+}
+
+// DeleteUser removes the read markers of a user whose messages are deleted.
+func (states *ReadStates) DeleteUser(userID string) error {
+	return states.repository.DeleteReadStates(userID)
+}
+
+// Publish marks new messages read for their author, who has seen the channel
+// up to them. Events arriving out of order leave a newer marker in place.
+func (states *ReadStates) Publish(event events.Event) {
+	if event.Type != events.MessageCreated || event.Message.ChannelID == "" {
+		return
+	}
+
+	state := models.ReadState{
+		UserID:     event.Message.UserID,
+		ServerID:   event.Message.ServerID,
+		ChannelID:  event.Message.ChannelID,
+		LastReadID: event.Message.ID,
+		UpdatedAt:  event.Timestamp.UTC(),
+	}
+	if _, err := states.advance(state); err != nil {
+		logger.WARN.Printf("Failed to mark message %v read for its author: %v\n", event.Message.ID, err)
+	}
+}
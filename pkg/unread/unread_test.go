@@ -0,0 +1,103 @@
+package unread
+
+import (
+	"discard/message-service/pkg/events"
+	"discard/message-service/pkg/mentions"
+	"discard/message-service/pkg/models"
+	"discard/message-service/pkg/repository"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnreadCounts(t *testing.T) {
+	store := repository.NewInMemoryReadStateRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	states := NewReadStates(&store, &messages)
+
+	send := func(author string, channelID string, content string) models.Message {
+		message, err := messages.Save(models.Message{
+			ID:        gocql.TimeUUID().String(),
+			UserID:    author,
+			ServerID:  "server",
+			ChannelID: channelID,
+			Message:   content,
+			Mentions:  mentions.Parse(content),
+		})
+		assert.NoError(t, err)
+		states.Publish(events.New(events.MessageCreated, *message))
+		return *message
+	}
+
+	first := send("alice", "general", "hello")
+	send("bob", "general", "hi <@alice>")
+	mentioning := send("bob", "general", "@everyone meeting")
+	send("alice", "general", "coming")
+	send("bob", "general", "great")
+	send("bob", "random", "unrelated")
+
+	_, err := states.Ack("alice", "server", "general", models.Ack{MessageID: "not a message"})
+	assert.ErrorIs(t, err, ErrInvalidMarker)
+	state, err := states.Ack("alice", "server", "general", models.Ack{MessageID: first.ID})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.ID, state.LastReadID, "their own newer message already moved the marker")
+
+	counts, err := states.Unread("alice")
+	assert.NoError(t, err)
+	if assert.Len(t, counts, 1) {
+		assert.Equal(t, models.Unread{ServerID: "server", ChannelID: "general", LastReadID: state.LastReadID, Unread: 1}, *counts[0])
+	}
+
+	counts, _ = states.Unread("carol")
+	assert.Empty(t, counts)
+	_, err = states.Ack("carol", "server", "general", models.Ack{MessageID: first.ID})
+	assert.NoError(t, err)
+	counts, _ = states.Unread("carol")
+	if assert.Len(t, counts, 1) {
+		assert.Equal(t, 4, counts[0].Unread)
+		assert.Equal(t, 1, counts[0].Mentions)
+	}
+
+	assert.NoError(t, messages.Delete(mentioning))
+	counts, _ = states.Unread("carol")
+	assert.Equal(t, 3, counts[0].Unread)
+	assert.Equal(t, 0, counts[0].Mentions)
+}
+
+func TestUnreadCountsStopAtTheMaximum(t *testing.T) {
+	store := repository.NewInMemoryReadStateRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	states := NewReadStates(&store, &messages)
+
+	marker := gocql.TimeUUID().String()
+	for i := 0; i < MaximumUnread+5; i++ {
+		_, err := messages.Save(models.Message{ID: gocql.TimeUUID().String(), UserID: "bob", ChannelID: "general", Message: "spam"})
+		assert.NoError(t, err)
+	}
+	_, err := states.Ack("alice", "server", "general", models.Ack{MessageID: marker})
+	assert.NoError(t, err)
+
+	counts, err := states.Unread("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, MaximumUnread, counts[0].Unread)
+	assert.True(t, counts[0].More)
+}
+
+func TestOwnMessagesOutOfOrderKeepTheMarker(t *testing.T) {
+	store := repository.NewInMemoryReadStateRepository()
+	messages := repository.NewInMemoryMessageRepository()
+	states := NewReadStates(&store, &messages)
+
+	older := models.Message{ID: gocql.TimeUUID().String(), UserID: "alice", ServerID: "server", ChannelID: "general"}
+	newer := models.Message{ID: gocql.TimeUUID().String(), UserID: "alice", ServerID: "server", ChannelID: "general"}
+	states.Publish(events.New(events.MessageCreated, newer))
+	states.Publish(events.New(events.MessageCreated, older))
+
+	current, err := store.GetReadStates("alice")
+	assert.NoError(t, err)
+	if assert.Len(t, current, 1) {
+		assert.Equal(t, newer.ID, current[0].LastReadID)
+		assert.Equal(t, "server", current[0].ServerID)
+	}
+}